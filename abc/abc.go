@@ -0,0 +1,281 @@
+// Package abc converts between ABC notation tunes (https://abcnotation.com)
+// and midi tracks. The decoder reads the tunes of an ABC file into tracks,
+// the encoder writes midi tracks as a tune using the notation package.
+package abc
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/go-audio/midi"
+)
+
+// defaultVelocity is the velocity of the notes before any dynamics mark,
+// mezzo forte.
+const defaultVelocity = 80
+
+// dynamics are the dynamics decorations from the softest to the loudest
+// with their velocity.
+var dynamics = []struct {
+	mark     string
+	velocity int
+}{
+	{"pppp", 12}, {"ppp", 16}, {"pp", 33}, {"p", 49}, {"mp", 64},
+	{"mf", 80}, {"f", 96}, {"ff", 112}, {"fff", 120}, {"ffff", 124},
+}
+
+// dynamicsMark returns the dynamics decoration closest to a velocity.
+func dynamicsMark(vel int) string {
+	best := dynamics[0]
+	for _, d := range dynamics[1:] {
+		if abs(d.velocity-vel) < abs(best.velocity-vel) {
+			best = d
+		}
+	}
+	return best.mark
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// letterFifths is the position of the natural notes in the circle of
+// fifths, the number of sharps of their major key.
+var letterFifths = map[byte]int{'F': -1, 'C': 0, 'G': 1, 'D': 2, 'A': 3, 'E': 4, 'B': 5}
+
+// modeFifths shifts the key signature of a major key to the one of its mode,
+// modes are identified by their first three letters.
+var modeFifths = map[string]int{
+	"": 0, "maj": 0, "ion": 0, "mix": -1, "dor": -2, "m": -3, "min": -3,
+	"aeo": -3, "phr": -4, "loc": -5, "lyd": 1,
+}
+
+// key is the key signature of a K: field.
+type key struct {
+	sig midi.KeySignature
+	// alters are the accidentals applied to each letter.
+	alters map[byte]int
+	// none is set for K:none, which doesn't have a key signature event.
+	none bool
+}
+
+// parseKey parses the value of a K: field such as "G", "Ador", "F# minor",
+// "Bb mix" or "D exp ^c _b". The clef and other voice properties are
+// ignored. Modes other than major and minor are written as the major key
+// with the same signature.
+func parseKey(s string) (key, error) {
+	fields := strings.Fields(s)
+	k := key{alters: map[byte]int{}}
+	if len(fields) == 0 {
+		return k, nil
+	}
+	tonic := fields[0]
+	fields = fields[1:]
+	switch strings.ToLower(tonic) {
+	case "none":
+		k.none = true
+		return k, nil
+	case "hp":
+		// highland bagpipe music is written without key signature
+		return k, nil
+	}
+	fifths, ok := letterFifths[tonic[0]]
+	if !ok {
+		return k, fmt.Errorf("invalid key %q", s)
+	}
+	mode := tonic[1:]
+	if len(mode) > 0 && (mode[0] == '#' || mode[0] == 'b') {
+		if mode[0] == '#' {
+			fifths += 7
+		} else {
+			fifths -= 7
+		}
+		mode = mode[1:]
+	}
+	shift, ok := modeFifths[normalizeMode(mode)]
+	if !ok {
+		return k, fmt.Errorf("invalid mode in key %q", s)
+	}
+	// the mode can also be separated from the tonic, the other words are
+	// clefs or voice properties
+	if mode == "" && len(fields) > 0 {
+		if sh, ok := modeFifths[normalizeMode(fields[0])]; ok {
+			shift = sh
+			fields = fields[1:]
+		}
+	}
+	fifths += shift
+	if fifths < -7 || fifths > 7 {
+		return k, fmt.Errorf("key %q has no key signature", s)
+	}
+	k.sig = midi.KeySignature{Key: int8(fifths), Minor: shift == -3}
+	k.alters = k.sig.Alterations()
+
+	// explicit accidentals added to (or replacing with exp) the signature
+	for _, f := range fields {
+		if f == "exp" {
+			k.alters = map[byte]int{}
+			continue
+		}
+		if len(f) < 2 || !isAccidental(f[0]) {
+			continue
+		}
+		alter, n := parseAccidental(f)
+		if n == len(f)-1 {
+			letter := strings.ToUpper(f[n:])[0]
+			if _, ok := letterFifths[letter]; ok {
+				k.alters[letter] = alter
+			}
+		}
+	}
+	return k, nil
+}
+
+// normalizeMode returns the key of a mode name in modeFifths.
+func normalizeMode(mode string) string {
+	if mode == "m" {
+		return mode
+	}
+	mode = strings.ToLower(mode)
+	if len(mode) > 3 {
+		mode = mode[:3]
+	}
+	return mode
+}
+
+func isAccidental(c byte) bool {
+	return c == '^' || c == '_' || c == '='
+}
+
+// parseAccidental parses the accidental at the beginning of s and returns it
+// in semitones with its length.
+func parseAccidental(s string) (int, int) {
+	switch {
+	case strings.HasPrefix(s, "^^"):
+		return 2, 2
+	case strings.HasPrefix(s, "__"):
+		return -2, 2
+	case strings.HasPrefix(s, "^"):
+		return 1, 1
+	case strings.HasPrefix(s, "_"):
+		return -1, 1
+	case strings.HasPrefix(s, "="):
+		return 0, 1
+	}
+	return 0, 0
+}
+
+// meter is the time signature of a M: field.
+type meter struct {
+	sig *midi.TimeSignature
+	// length is the length of a bar in whole notes, nil for free meter.
+	length *big.Rat
+}
+
+// parseMeter parses the value of a M: field: "C" (4/4), "C|" (2/2), "none",
+// or a fraction such as "6/8" or "2+3/8" whose numerators are added up.
+func parseMeter(s string) (meter, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "", "none":
+		return meter{}, nil
+	case "C":
+		s = "4/4"
+	case "C|":
+		s = "2/2"
+	}
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return meter{}, fmt.Errorf("invalid meter %q", s)
+	}
+	var num int
+	for _, n := range strings.Split(strings.Trim(parts[0], "()"), "+") {
+		v, err := strconv.Atoi(strings.TrimSpace(n))
+		if err != nil || v <= 0 {
+			return meter{}, fmt.Errorf("invalid meter %q", s)
+		}
+		num += v
+	}
+	den, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || den <= 0 || den&(den-1) != 0 || num > 255 {
+		return meter{}, fmt.Errorf("invalid meter %q", s)
+	}
+	return meter{
+		sig: &midi.TimeSignature{
+			Numerator:                   uint8(num),
+			Denominator:                 uint8(bits.TrailingZeros(uint(den))),
+			ClocksPerTick:               24,
+			ThirtySecondNotesPerQuarter: 8,
+		},
+		length: big.NewRat(int64(num), int64(den)),
+	}, nil
+}
+
+// compound reports whether the meter has a dotted beat, like 6/8.
+func (m meter) compound() bool {
+	return m.sig != nil && m.sig.Numerator > 3 && m.sig.Numerator%3 == 0
+}
+
+// parseFraction parses a fraction such as "1/8" as found in the L: and Q:
+// fields.
+func parseFraction(s string) (*big.Rat, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), "/", 2)
+	num, err := strconv.Atoi(parts[0])
+	den := 1
+	if err == nil && len(parts) == 2 {
+		den, err = strconv.Atoi(parts[1])
+	}
+	if err != nil || num <= 0 || den <= 0 {
+		return nil, fmt.Errorf("invalid fraction %q", s)
+	}
+	return big.NewRat(int64(num), int64(den)), nil
+}
+
+// parseTempo parses the value of a Q: field such as "1/4=120", "3/8=60",
+// "1/8 3/8=40" or "\"Allegro\" 1/4=132" and returns the tempo in quarter
+// notes per minute, 0 if the field only holds text. The legacy "120" form
+// counts unit notes.
+func parseTempo(s string, unit *big.Rat) (float64, error) {
+	// drop the quoted texts
+	var b strings.Builder
+	quoted := false
+	for _, r := range s {
+		if r == '"' {
+			quoted = !quoted
+			continue
+		}
+		if !quoted {
+			b.WriteRune(r)
+		}
+	}
+	s = strings.TrimSpace(b.String())
+	if s == "" {
+		return 0, nil
+	}
+	beat := new(big.Rat).Set(unit)
+	perMinute := s
+	if i := strings.Index(s, "="); i >= 0 {
+		beat.SetInt64(0)
+		for _, f := range strings.Fields(s[:i]) {
+			r, err := parseFraction(f)
+			if err != nil {
+				return 0, fmt.Errorf("invalid tempo %q", s)
+			}
+			beat.Add(beat, r)
+		}
+		perMinute = s[i+1:]
+	}
+	bpm, err := strconv.ParseFloat(strings.TrimSpace(perMinute), 64)
+	if err != nil || bpm <= 0 || beat.Sign() <= 0 {
+		return 0, fmt.Errorf("invalid tempo %q", s)
+	}
+	quarters, _ := new(big.Rat).Mul(beat, big.NewRat(4, 1)).Float64()
+	return math.Round(bpm*quarters*1000) / 1000, nil
+}
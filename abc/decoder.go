@@ -0,0 +1,963 @@
+package abc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-audio/midi"
+)
+
+// DefaultTicksPerQuarterNote is the resolution of the decoded tracks unless
+// set otherwise.
+const DefaultTicksPerQuarterNote = 480
+
+// bodyFields are the fields which can be found on their own line in the
+// body of a tune, the other lines are music.
+const bodyFields = "IKLMmNPQRrsTUVWw"
+
+// notePitchClasses maps the note letters to their pitch class.
+var notePitchClasses = map[byte]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
+
+// Tune is a tune of an ABC file.
+type Tune struct {
+	// Number is the reference number of the X: field.
+	Number int
+	// Title is the first title of the T: fields.
+	Title string
+	// Track holds the title, the time signatures, key signatures, tempo
+	// changes and programs of the tune followed by its notes, played on the
+	// first channel.
+	Track *midi.Track
+}
+
+// AbsoluteEvents returns the notes of the tune.
+func (t *Tune) AbsoluteEvents() midi.AbsEvents {
+	return t.Track.AbsoluteEvents()
+}
+
+// Decoder reads the tunes of an ABC file into midi tracks. The X:, T:, M:,
+// L:, Q:, K: and V: fields are interpreted, as well as notes and rests with
+// their accidentals, octaves and lengths, chords, ties, broken rhythms,
+// tuplets, dynamics decorations and %%MIDI program directives. Repeats and
+// endings are expanded. Grace notes, chord symbols, annotations, other
+// decorations and lyrics are ignored.
+type Decoder struct {
+	r io.Reader
+	// TicksPerQuarterNote is the resolution of the decoded tracks,
+	// DefaultTicksPerQuarterNote if not set before decoding.
+	TicksPerQuarterNote uint16
+	Tunes               []*Tune
+}
+
+// NewDecoder returns a decoder reading ABC tunes from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, TicksPerQuarterNote: DefaultTicksPerQuarterNote}
+}
+
+// Decode parses the tunes of the file, each tune starts with a X: field and
+// ends with an empty line.
+func (d *Decoder) Decode() error {
+	if d.TicksPerQuarterNote == 0 {
+		d.TicksPerQuarterNote = DefaultTicksPerQuarterNote
+	}
+	d.Tunes = nil
+	sc := bufio.NewScanner(d.r)
+	var p *parser
+	var lineNum int
+	for sc.Scan() {
+		lineNum++
+		line := strings.TrimRight(sc.Text(), " \t\r")
+		if p == nil {
+			// the lines outside of the tunes are free text or file header
+			if strings.HasPrefix(line, "X:") {
+				p = newParser(d.TicksPerQuarterNote)
+				if err := p.field('X', strings.TrimSpace(line[2:])); err != nil {
+					return fmt.Errorf("abc: line %d: %v", lineNum, err)
+				}
+			}
+			continue
+		}
+		if line == "" {
+			tune, err := p.finish()
+			if err != nil {
+				return fmt.Errorf("abc: line %d: %v", lineNum, err)
+			}
+			d.Tunes = append(d.Tunes, tune)
+			p = nil
+			continue
+		}
+		if err := p.parseLine(line); err != nil {
+			return fmt.Errorf("abc: line %d: %v", lineNum, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("abc: %v", err)
+	}
+	if p != nil {
+		tune, err := p.finish()
+		if err != nil {
+			return fmt.Errorf("abc: line %d: %v", lineNum, err)
+		}
+		d.Tunes = append(d.Tunes, tune)
+	}
+	if len(d.Tunes) == 0 {
+		return errors.New("abc: no tune found")
+	}
+	return nil
+}
+
+type elementKind int
+
+const (
+	noteElement elementKind = iota
+	barElement
+	endingElement
+	eventElement
+)
+
+// element is a parsed item of the body of a tune.
+type element struct {
+	kind elementKind
+	// length is the length of the notes and rests in whole notes.
+	length *big.Rat
+	// pitches are the notes of a note or chord, rests don't have any.
+	pitches []int
+	// ties flags the pitches tied to the next note.
+	ties     []bool
+	velocity int
+	// event is the meta event or program change of an event element.
+	event *midi.Event
+	// repeatStart, repeatEnd and double describe a bar line, double is set
+	// on the bar lines ending a section such as || or |].
+	repeatStart, repeatEnd, double bool
+	// endings are the numbers of the passes playing an ending.
+	endings []int
+}
+
+// state is the context of the music: the fields set in the header apply to
+// all the voices which can then change them.
+type state struct {
+	// unit is the unit note length in whole notes.
+	unit  *big.Rat
+	meter meter
+	key   key
+}
+
+// voice is a voice being parsed.
+type voice struct {
+	state
+	elements []*element
+	// bar holds the accidentals of the current bar by natural note.
+	bar map[string]int
+	// broken is the length factor of the next note set by a broken rhythm.
+	broken *big.Rat
+	// tuplet is the length factor of the next tupletNotes notes.
+	tuplet      *big.Rat
+	tupletNotes int
+	velocity    int
+	// last is the last note, chord or rest.
+	last *element
+}
+
+// parser parses the header and body of a tune.
+type parser struct {
+	ppq    uint16
+	tune   *Tune
+	inBody bool
+	header state
+	tempo  string
+	// events are the events set in the header.
+	events   []*midi.Event
+	voices   []*voice
+	voiceIDs map[string]*voice
+	current  *voice
+}
+
+func newParser(ppq uint16) *parser {
+	return &parser{
+		ppq:      ppq,
+		tune:     &Tune{},
+		header:   state{key: key{alters: map[byte]int{}}},
+		voiceIDs: map[string]*voice{},
+	}
+}
+
+// parseLine parses a line of the tune.
+func (p *parser) parseLine(line string) error {
+	if strings.HasPrefix(line, "%%") {
+		return p.directive(line[2:])
+	}
+	line = stripComment(line)
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+	if len(line) > 1 && line[1] == ':' {
+		if !p.inBody && isLetter(line[0]) || p.inBody && strings.IndexByte(bodyFields, line[0]) >= 0 {
+			return p.field(line[0], strings.TrimSpace(line[2:]))
+		}
+	}
+	if !p.inBody {
+		// be lenient with tunes missing their K: field
+		if err := p.startBody(); err != nil {
+			return err
+		}
+	}
+	return p.parseMusic(line)
+}
+
+// stripComment removes the comment ending a line.
+func stripComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case '%':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// directive interprets the %%MIDI program directive, the other stylesheet
+// directives are ignored.
+func (p *parser) directive(s string) error {
+	fields := strings.Fields(s)
+	if len(fields) < 3 || fields[0] != "MIDI" || fields[1] != "program" {
+		return nil
+	}
+	program, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || program < 0 || program > 127 {
+		return fmt.Errorf("invalid program in %q", s)
+	}
+	p.addEvent(midi.ProgramSelect(0, program))
+	return nil
+}
+
+// field interprets a header field, a field line of the body or an inline
+// field.
+func (p *parser) field(name byte, value string) error {
+	if name == 'V' {
+		// the voices are defined when used in the body
+		if p.inBody {
+			fields := strings.Fields(value)
+			if len(fields) == 0 {
+				return errors.New("missing voice id")
+			}
+			p.current = p.voiceByID(fields[0])
+		}
+		return nil
+	}
+	st := &p.header
+	if p.inBody {
+		st = &p.voice().state
+	}
+	switch name {
+	case 'X':
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid reference number %q", value)
+		}
+		p.tune.Number = n
+	case 'T':
+		if !p.inBody && p.tune.Title == "" {
+			p.tune.Title = value
+		}
+	case 'M':
+		m, err := parseMeter(value)
+		if err != nil {
+			return err
+		}
+		st.meter = m
+		if p.inBody && m.sig != nil {
+			p.addEvent(timeSignatureEvent(m.sig))
+		}
+	case 'L':
+		unit, err := parseFraction(value)
+		if err != nil {
+			return err
+		}
+		st.unit = unit
+	case 'Q':
+		if !p.inBody {
+			// the unit note length may be set after the tempo
+			p.tempo = value
+			return nil
+		}
+		bpm, err := parseTempo(value, st.unit)
+		if err != nil {
+			return err
+		}
+		if bpm > 0 {
+			p.addEvent(midi.TempoEvent(bpm))
+		}
+	case 'K':
+		k, err := parseKey(value)
+		if err != nil {
+			return err
+		}
+		st.key = k
+		if !p.inBody {
+			return p.startBody()
+		}
+		if !k.none {
+			p.addEvent(midi.KeySignatureEvent(int(k.sig.Key), k.sig.Minor))
+		}
+	}
+	return nil
+}
+
+// startBody ends the header: the unit note length defaults to a sixteenth
+// note for meters shorter than 3/4, an eighth note otherwise.
+func (p *parser) startBody() error {
+	p.inBody = true
+	h := &p.header
+	if h.unit == nil {
+		h.unit = big.NewRat(1, 8)
+		if h.meter.length != nil && h.meter.length.Cmp(big.NewRat(3, 4)) < 0 {
+			h.unit = big.NewRat(1, 16)
+		}
+	}
+	if h.meter.sig != nil {
+		p.events = append(p.events, timeSignatureEvent(h.meter.sig))
+	}
+	if !h.key.none {
+		p.events = append(p.events, midi.KeySignatureEvent(int(h.key.sig.Key), h.key.sig.Minor))
+	}
+	if p.tempo != "" {
+		bpm, err := parseTempo(p.tempo, h.unit)
+		if err != nil {
+			return err
+		}
+		if bpm > 0 {
+			p.events = append(p.events, midi.TempoEvent(bpm))
+		}
+	}
+	return nil
+}
+
+func timeSignatureEvent(ts *midi.TimeSignature) *midi.Event {
+	sig := *ts
+	return &midi.Event{
+		MsgType:       midi.EventByteMap["Meta"],
+		Cmd:           midi.MetaByteMap["Time Signature"],
+		TimeSignature: &sig,
+	}
+}
+
+// addEvent adds an event to the header or to the current voice.
+func (p *parser) addEvent(ev *midi.Event) {
+	if !p.inBody {
+		p.events = append(p.events, ev)
+		return
+	}
+	v := p.voice()
+	v.elements = append(v.elements, &element{kind: eventElement, event: ev})
+}
+
+// voice returns the current voice, the music found before any V: field
+// goes to a default voice.
+func (p *parser) voice() *voice {
+	if p.current == nil {
+		p.current = p.voiceByID("")
+	}
+	return p.current
+}
+
+// voiceByID returns the voice with the passed id, creating it with the
+// header state if needed.
+func (p *parser) voiceByID(id string) *voice {
+	if v, ok := p.voiceIDs[id]; ok {
+		return v
+	}
+	v := &voice{state: p.header, bar: map[string]int{}, velocity: defaultVelocity}
+	p.voiceIDs[id] = v
+	p.voices = append(p.voices, v)
+	return v
+}
+
+// parseMusic parses a line of music.
+func (p *parser) parseMusic(s string) error {
+	for i := 0; i < len(s); {
+		v := p.voice()
+		c := s[i]
+		var n int
+		var err error
+		switch {
+		case c == ' ' || c == '\t' || c == '`' || c == '$' || c == '\\' || c == ')':
+			// spaces, line breaks and slur ends
+			n = 1
+		case c == '"' || c == '!' || c == '+' || c == '{':
+			// chord symbols, annotations, decorations and grace notes
+			closing := c
+			if c == '{' {
+				closing = '}'
+			}
+			end := strings.IndexByte(s[i+1:], closing)
+			if end < 0 {
+				return fmt.Errorf("missing closing %q", closing)
+			}
+			if c == '!' || c == '+' {
+				v.decoration(s[i+1 : i+1+end])
+			}
+			n = end + 2
+		case strings.IndexByte("~.HLMOPSTuv", c) >= 0:
+			// single character decorations
+			n = 1
+		case c == '(':
+			n = 1
+			if i+1 < len(s) && isDigit(s[i+1]) {
+				n, err = v.parseTuplet(s[i:])
+			}
+		case c == '-':
+			if v.last == nil || v.last.pitches == nil {
+				return errors.New("tie without a note")
+			}
+			for j := range v.last.ties {
+				v.last.ties[j] = true
+			}
+			n = 1
+		case c == '>' || c == '<':
+			n, err = v.parseBrokenRhythm(s[i:])
+		case c == '[' && i+1 < len(s) && isDigit(s[i+1]):
+			n, err = v.parseEnding(s[i+1:])
+			n++
+		case c == '[' && i+1 < len(s) && s[i+1] == '|':
+			n = v.parseBar(s[i+1:]) + 1
+			v.elements[len(v.elements)-1].double = true
+		case c == '[' && i+2 < len(s) && isLetter(s[i+1]) && s[i+2] == ':':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return errors.New("missing closing ']' of inline field")
+			}
+			err = p.field(s[i+1], strings.TrimSpace(s[i+3:i+end]))
+			n = end + 1
+		case c == '[':
+			n, err = v.parseChord(s[i:])
+		case c == '|' || c == ':':
+			n = v.parseBar(s[i:])
+		case c == 'Z':
+			n, err = v.parseMeasureRest(s[i:])
+		case c == 'y':
+			// spacer
+			_, n, err = parseLength(s[i+1:])
+			n++
+		case c == 'z' || c == 'x' || isAccidental(c) || isNoteLetter(c):
+			n, err = v.parseNote(s[i:])
+		default:
+			return fmt.Errorf("unexpected character %q", c)
+		}
+		if err != nil {
+			return err
+		}
+		i += n
+	}
+	return nil
+}
+
+// decoration applies the dynamics decorations, the others are ignored.
+func (v *voice) decoration(name string) {
+	for _, d := range dynamics {
+		if d.mark == name {
+			v.velocity = d.velocity
+		}
+	}
+}
+
+// parseNote parses a note or a rest (z or x) followed by its length.
+func (v *voice) parseNote(s string) (int, error) {
+	var pitches []int
+	var n int
+	if s[0] == 'z' || s[0] == 'x' {
+		n = 1
+	} else {
+		pitch, m, err := v.parsePitch(s)
+		if err != nil {
+			return 0, err
+		}
+		pitches, n = []int{pitch}, m
+	}
+	length, m, err := parseLength(s[n:])
+	if err != nil {
+		return 0, err
+	}
+	v.addNote(pitches, length)
+	return n + m, nil
+}
+
+// parsePitch parses a note with its accidental and octave marks and returns
+// its midi note number: C is the middle C and c the octave above.
+// Accidentals apply to the following notes of the same pitch in the bar.
+func (v *voice) parsePitch(s string) (int, int, error) {
+	alter, n := parseAccidental(s)
+	if n >= len(s) || !isNoteLetter(s[n]) {
+		return 0, 0, errors.New("accidental without a note")
+	}
+	letter := s[n]
+	natural := 60
+	if letter >= 'a' {
+		letter -= 'a' - 'A'
+		natural = 72
+	}
+	natural += notePitchClasses[letter]
+	explicit := n > 0
+	for n++; n < len(s) && (s[n] == '\'' || s[n] == ','); n++ {
+		if s[n] == '\'' {
+			natural += 12
+		} else {
+			natural -= 12
+		}
+	}
+	id := strconv.Itoa(natural)
+	switch a, ok := v.bar[id]; {
+	case explicit:
+		v.bar[id] = alter
+	case ok:
+		alter = a
+	default:
+		alter = v.key.alters[letter]
+	}
+	pitch := natural + alter
+	if pitch < 0 || pitch > 127 {
+		return 0, 0, fmt.Errorf("note %q out of the midi range", s[:n])
+	}
+	return pitch, n, nil
+}
+
+// parseLength parses a length multiplier such as 2, 3/2, /, // or /4, an
+// empty multiplier is 1.
+func parseLength(s string) (*big.Rat, int, error) {
+	n := 0
+	for n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	num := int64(1)
+	if n > 0 {
+		v, err := strconv.Atoi(s[:n])
+		if err != nil || v == 0 {
+			return nil, 0, fmt.Errorf("invalid length %q", s[:n])
+		}
+		num = int64(v)
+	}
+	den := int64(1)
+	for n < len(s) && s[n] == '/' {
+		n++
+		start := n
+		for n < len(s) && isDigit(s[n]) {
+			n++
+		}
+		if start == n {
+			den *= 2
+			continue
+		}
+		v, err := strconv.Atoi(s[start:n])
+		if err != nil || v == 0 {
+			return nil, 0, fmt.Errorf("invalid length %q", s[:n])
+		}
+		den *= int64(v)
+	}
+	return big.NewRat(num, den), n, nil
+}
+
+// addNote adds a note, chord or rest (without pitches) whose length is a
+// multiple of the unit note length.
+func (v *voice) addNote(pitches []int, mult *big.Rat) {
+	length := new(big.Rat).Mul(v.unit, mult)
+	if v.broken != nil {
+		length.Mul(length, v.broken)
+		v.broken = nil
+	}
+	if v.tupletNotes > 0 {
+		length.Mul(length, v.tuplet)
+		v.tupletNotes--
+	}
+	el := &element{
+		kind:     noteElement,
+		length:   length,
+		pitches:  pitches,
+		ties:     make([]bool, len(pitches)),
+		velocity: v.velocity,
+	}
+	v.elements = append(v.elements, el)
+	v.last = el
+}
+
+// parseChord parses notes played together such as [CEG]2, the length of the
+// chord is the length of its first note multiplied by the length following
+// the chord.
+func (v *voice) parseChord(s string) (int, error) {
+	var pitches []int
+	var ties []bool
+	var first *big.Rat
+	n := 1
+	for {
+		if n >= len(s) {
+			return 0, errors.New("missing closing ']' of chord")
+		}
+		c := s[n]
+		switch {
+		case c == ']':
+			length, m, err := parseLength(s[n+1:])
+			if err != nil {
+				return 0, err
+			}
+			if len(pitches) == 0 {
+				return 0, errors.New("empty chord")
+			}
+			v.addNote(pitches, length.Mul(length, first))
+			copy(v.last.ties, ties)
+			return n + 1 + m, nil
+		case c == '-':
+			if len(ties) == 0 {
+				return 0, errors.New("tie without a note")
+			}
+			ties[len(ties)-1] = true
+			n++
+		case c == '!' || c == '"':
+			end := strings.IndexByte(s[n+1:], c)
+			if end < 0 {
+				return 0, fmt.Errorf("missing closing %q", c)
+			}
+			n += end + 2
+		case isAccidental(c) || isNoteLetter(c):
+			pitch, m, err := v.parsePitch(s[n:])
+			if err != nil {
+				return 0, err
+			}
+			n += m
+			length, m, err := parseLength(s[n:])
+			if err != nil {
+				return 0, err
+			}
+			n += m
+			if first == nil {
+				first = length
+			}
+			pitches = append(pitches, pitch)
+			ties = append(ties, false)
+		case c == ' ' || strings.IndexByte("~.HLMOPSTuv", c) >= 0:
+			n++
+		default:
+			return 0, fmt.Errorf("unexpected character %q in chord", c)
+		}
+	}
+}
+
+// parseMeasureRest parses a rest of one or more bars such as Z or Z4.
+func (v *voice) parseMeasureRest(s string) (int, error) {
+	n := 1
+	for n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	bars := 1
+	if n > 1 {
+		bars, _ = strconv.Atoi(s[1:n])
+	}
+	bar := big.NewRat(1, 1)
+	if v.meter.length != nil {
+		bar.Set(v.meter.length)
+	}
+	el := &element{kind: noteElement, length: bar.Mul(bar, big.NewRat(int64(bars), 1))}
+	v.elements = append(v.elements, el)
+	v.last = el
+	return n, nil
+}
+
+// parseBrokenRhythm parses > or < (doubled or tripled to be more marked):
+// a>b plays a dotted a followed by a shortened b.
+func (v *voice) parseBrokenRhythm(s string) (int, error) {
+	n := 1
+	for n < len(s) && s[n] == s[0] {
+		n++
+	}
+	if v.last == nil || v.broken != nil {
+		return 0, errors.New("broken rhythm without a note")
+	}
+	short := big.NewRat(1, int64(1)<<uint(n))
+	long := new(big.Rat).Sub(big.NewRat(2, 1), short)
+	if s[0] == '<' {
+		long, short = short, long
+	}
+	v.last.length.Mul(v.last.length, long)
+	v.broken = short
+	return n, nil
+}
+
+// parseTuplet parses a tuplet such as (3 or (p:q:r: the next r notes are
+// played in the time of q notes instead of p.
+func (v *voice) parseTuplet(s string) (int, error) {
+	var values [3]int
+	n := 1
+	for i := 0; i < len(values); i++ {
+		start := n
+		for n < len(s) && isDigit(s[n]) {
+			n++
+		}
+		if start < n {
+			values[i], _ = strconv.Atoi(s[start:n])
+		}
+		if i == len(values)-1 || n >= len(s) || s[n] != ':' {
+			break
+		}
+		n++
+	}
+	p, q, r := values[0], values[1], values[2]
+	if p < 2 || p > 9 {
+		return 0, fmt.Errorf("invalid tuplet %q", s[:n])
+	}
+	if q == 0 {
+		switch p {
+		case 2, 4, 8:
+			q = 3
+		case 3, 6:
+			q = 2
+		default:
+			q = 2
+			if v.meter.compound() {
+				q = 3
+			}
+		}
+	}
+	if r == 0 {
+		r = p
+	}
+	v.tuplet = big.NewRat(int64(q), int64(p))
+	v.tupletNotes = r
+	return n, nil
+}
+
+// parseBar parses a bar line such as |, ||, |], :|, |:, :: or :|2 with the
+// ending following it.
+func (v *voice) parseBar(s string) int {
+	n := 0
+	for n < len(s) && (s[n] == '|' || s[n] == ':' || s[n] == ']' && n > 0 && s[n-1] == '|') {
+		n++
+	}
+	bar := s[:n]
+	el := &element{
+		kind:        barElement,
+		repeatEnd:   len(bar) > 1 && bar[0] == ':',
+		repeatStart: len(bar) > 1 && bar[len(bar)-1] == ':',
+		double:      strings.Contains(bar, "||") || strings.Contains(bar, "]"),
+	}
+	v.elements = append(v.elements, el)
+	// the accidentals end with the bar
+	v.bar = map[string]int{}
+	if n < len(s) && isDigit(s[n]) {
+		m, _ := v.parseEnding(s[n:])
+		n += m
+	}
+	return n
+}
+
+// parseEnding parses the passes of an ending such as 1, 2 or 1,3 or 1-3.
+func (v *voice) parseEnding(s string) (int, error) {
+	n := 0
+	for n < len(s) && (isDigit(s[n]) || s[n] == ',' || s[n] == '-') {
+		n++
+	}
+	el := &element{kind: endingElement}
+	for _, r := range strings.Split(s[:n], ",") {
+		bounds := strings.SplitN(r, "-", 2)
+		from, err := strconv.Atoi(bounds[0])
+		to := from
+		if err == nil && len(bounds) == 2 {
+			to, err = strconv.Atoi(bounds[1])
+		}
+		if err != nil || to < from {
+			return 0, fmt.Errorf("invalid ending %q", s[:n])
+		}
+		for pass := from; pass <= to; pass++ {
+			el.endings = append(el.endings, pass)
+		}
+	}
+	v.elements = append(v.elements, el)
+	return n, nil
+}
+
+// expand returns the elements in the order they're played: the sections
+// between |: and :| are played twice, or once per pass of the ending ending
+// with the :|, and the endings are only played during their passes.
+func expand(elements []*element) []*element {
+	var played []*element
+	start, pass := 0, 1
+	var ending []int
+	skipping := false
+	jumps := map[int]int{}
+	for i := 0; i < len(elements); i++ {
+		el := elements[i]
+		switch el.kind {
+		case endingElement:
+			ending = el.endings
+			skipping = true
+			for _, p := range ending {
+				if p == pass {
+					skipping = false
+				}
+			}
+			continue
+		case barElement:
+			if el.repeatEnd && !skipping {
+				passes := 1
+				for _, p := range ending {
+					if p > passes {
+						passes = p
+					}
+				}
+				if jumps[i] < passes {
+					jumps[i]++
+					pass++
+					ending, skipping = nil, false
+					i = start - 1
+					continue
+				}
+			}
+			if el.repeatEnd {
+				start = i + 1
+			}
+			if el.double && !el.repeatEnd || el.repeatStart {
+				start, pass = i+1, 1
+				ending, skipping = nil, false
+			}
+			continue
+		}
+		if !skipping {
+			played = append(played, el)
+		}
+	}
+	return played
+}
+
+// finish converts the parsed tune to a track.
+func (p *parser) finish() (*Tune, error) {
+	if !p.inBody {
+		if err := p.startBody(); err != nil {
+			return nil, err
+		}
+	}
+	toTicks := func(pos *big.Rat) uint64 {
+		f, _ := new(big.Rat).Mul(pos, big.NewRat(4*int64(p.ppq), 1)).Float64()
+		return uint64(math.Round(f))
+	}
+	events := []*midi.Event{}
+	if p.tune.Title != "" {
+		events = append(events, midi.TrackName(p.tune.Title))
+	}
+	// the events of the voices at the same tick are only added once
+	seen := map[string]bool{}
+	addEvent := func(ev *midi.Event, tick uint64) {
+		id := fmt.Sprintf("%d/%d/%d", ev.MsgType, ev.Cmd, tick)
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		ev = ev.Copy()
+		ev.AbsTicks = tick
+		events = append(events, ev)
+	}
+	for _, ev := range p.events {
+		addEvent(ev, 0)
+	}
+
+	type note struct {
+		pitch, vel int
+		start, end *big.Rat
+	}
+	var end uint64
+	for _, v := range p.voices {
+		var notes []*note
+		tied := map[int]*note{}
+		pos := new(big.Rat)
+		for _, el := range expand(v.elements) {
+			if el.kind == eventElement {
+				addEvent(el.event, toTicks(pos))
+				continue
+			}
+			next := new(big.Rat).Add(pos, el.length)
+			continued := map[int]*note{}
+			for i, pitch := range el.pitches {
+				n, ok := tied[pitch]
+				if ok && n.end.Cmp(pos) == 0 {
+					n.end = next
+				} else {
+					n = &note{pitch: pitch, vel: el.velocity, start: pos, end: next}
+					notes = append(notes, n)
+				}
+				if el.ties[i] {
+					continued[pitch] = n
+				}
+			}
+			tied = continued
+			pos = next
+		}
+		for _, n := range notes {
+			on := midi.NoteOn(0, n.pitch, n.vel)
+			on.AbsTicks = toTicks(n.start)
+			off := midi.NoteOff(0, n.pitch)
+			off.AbsTicks = toTicks(n.end)
+			events = append(events, on, off)
+		}
+		if t := toTicks(pos); t > end {
+			end = t
+		}
+	}
+	p.tune.Track = newTrack(events, end)
+	return p.tune, nil
+}
+
+// newTrack creates a track from events with their absolute ticks set. At
+// the same tick, meta events come first, then the program changes, the note
+// offs and the note ons.
+func newTrack(events []*midi.Event, end uint64) *midi.Track {
+	order := func(ev *midi.Event) int {
+		switch ev.MsgType {
+		case midi.EventByteMap["NoteOn"]:
+			return 3
+		case midi.EventByteMap["NoteOff"]:
+			return 2
+		case midi.EventByteMap["Meta"]:
+			return 0
+		}
+		return 1
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].AbsTicks != events[j].AbsTicks {
+			return events[i].AbsTicks < events[j].AbsTicks
+		}
+		return order(events[i]) < order(events[j])
+	})
+	t := &midi.Track{}
+	var last uint64
+	for _, ev := range events {
+		t.AddAfterDelta(uint32(ev.AbsTicks-last), ev)
+		last = ev.AbsTicks
+	}
+	if end < last {
+		end = last
+	}
+	eot := midi.EndOfTrack()
+	eot.AbsTicks = end
+	t.AddAfterDelta(uint32(end-last), eot)
+	return t
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isNoteLetter(c byte) bool {
+	return c >= 'a' && c <= 'g' || c >= 'A' && c <= 'G'
+}
@@ -0,0 +1,240 @@
+package abc
+
+import (
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-audio/midi"
+)
+
+const testTunes = `%abc-2.1
+Free text before the first tune.
+
+X:1
+T:Test
+T:Second title
+M:3/4
+L:1/8
+Q:1/4=100
+K:G
+%%MIDI program 73
+|: G>A B2 (3cBA | [1 [CEG]4 z2 :|[2 ^c2- c=c F,2 |] % comment
+[M:2/4] !f! g'2 C,2 |
+
+X:2
+T:Voices
+M:C
+K:Am
+V:1
+a2 b2 "Am"z4 |
+V:2
+A,4 {g}A,4 |
+`
+
+// trackNote is a note of a decoded track.
+type trackNote struct {
+	pitch, vel int
+	start, end uint64
+}
+
+func trackNotes(t *midi.Track) []trackNote {
+	notes := []trackNote{}
+	started := map[uint8]int{}
+	var tick uint64
+	for _, ev := range t.Events {
+		tick += uint64(ev.TimeDelta)
+		switch {
+		case ev.MsgType == 0x9 && ev.Velocity > 0:
+			started[ev.Note] = len(notes)
+			notes = append(notes, trackNote{pitch: int(ev.Note), vel: int(ev.Velocity), start: tick})
+		case ev.MsgType == 0x8 || ev.MsgType == 0x9:
+			notes[started[ev.Note]].end = tick
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if notes[i].start != notes[j].start {
+			return notes[i].start < notes[j].start
+		}
+		return notes[i].pitch < notes[j].pitch
+	})
+	return notes
+}
+
+func TestDecoder_Decode(t *testing.T) {
+	d := NewDecoder(strings.NewReader(testTunes))
+	d.TicksPerQuarterNote = 96
+	if err := d.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Tunes) != 2 {
+		t.Fatalf("expected 2 tunes, got %d", len(d.Tunes))
+	}
+
+	tune := d.Tunes[0]
+	if tune.Number != 1 || tune.Title != "Test" || tune.Track.Name() != "Test" {
+		t.Errorf("unexpected tune %d %q named %q", tune.Number, tune.Title, tune.Track.Name())
+	}
+	if tm := midi.TempoMapOf(tune.Track); len(tm) != 1 || tm[0].MicrosPerQuarter != 600000 {
+		t.Errorf("expected a single 100 BPM tempo, got %v", tm)
+	}
+	if keys := midi.KeyTimelineOf(tune.Track); len(keys) != 1 || keys[0].String() != "G major" {
+		t.Errorf("expected a G major key signature, got %v", keys)
+	}
+	meters := midi.MeterMapOf(tune.Track)
+	if len(meters) != 2 || meters[0].Numerator != 3 || meters[1].Tick != 1152 || meters[1].Numerator != 2 || meters[1].Denum() != 4 {
+		t.Errorf("expected 3/4 then 2/4 at tick 1152, got %v", meters)
+	}
+	if inst := tune.Track.ProgramAt(midi.GM1Bank, 0, 0); inst.Program != 73 {
+		t.Errorf("expected program 73, got %d", inst.Program)
+	}
+
+	want := []trackNote{
+		// G>A B2 (3cBA
+		{67, 80, 0, 72},
+		{69, 80, 72, 96},
+		{71, 80, 96, 192},
+		{72, 80, 192, 224},
+		{71, 80, 224, 256},
+		{69, 80, 256, 288},
+		// first ending
+		{60, 80, 288, 480},
+		{64, 80, 288, 480},
+		{67, 80, 288, 480},
+		// repeat
+		{67, 80, 576, 648},
+		{69, 80, 648, 672},
+		{71, 80, 672, 768},
+		{72, 80, 768, 800},
+		{71, 80, 800, 832},
+		{69, 80, 832, 864},
+		// second ending, the sharp lasts until the end of the bar and the F
+		// is sharp in G major
+		{73, 80, 864, 1008},
+		{72, 80, 1008, 1056},
+		{54, 80, 1056, 1152},
+		{91, 96, 1152, 1248},
+		{48, 96, 1248, 1344},
+	}
+	if got := trackNotes(tune.Track); !reflect.DeepEqual(got, want) {
+		t.Errorf("notes = %v\nwant %v", got, want)
+	}
+	evs := tune.AbsoluteEvents()
+	if len(evs) != len(want) {
+		t.Errorf("expected %d absolute events, got %d", len(want), len(evs))
+	}
+
+	tune = d.Tunes[1]
+	if keys := midi.KeyTimelineOf(tune.Track); len(keys) != 1 || keys[0].String() != "A minor" {
+		t.Errorf("expected an A minor key signature, got %v", keys)
+	}
+	want = []trackNote{
+		{57, 80, 0, 192},
+		{81, 80, 0, 96},
+		{83, 80, 96, 192},
+		{57, 80, 192, 384},
+	}
+	if got := trackNotes(tune.Track); !reflect.DeepEqual(got, want) {
+		t.Errorf("voices notes = %v\nwant %v", got, want)
+	}
+}
+
+func TestDecoder_Decode_repeats(t *testing.T) {
+	for _, tc := range []struct {
+		body string
+		want string
+	}{
+		{"|: C D :| E |", "CDCDE"},
+		{"C |: D :|: E :| F", "CDDEEF"},
+		{"|: C |1 D :|2 E || F :|", "CDCEFF"},
+		{"|: C [1 D :| [2 E |] F", "CDCEF"},
+		{"|: C |1,2 D :|3 E |]", "CDCDCE"},
+		{"C D :: E ::", "CDCDEE"},
+	} {
+		d := NewDecoder(strings.NewReader("X:1\nL:1/4\nK:C\n" + tc.body))
+		if err := d.Decode(); err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		for _, n := range trackNotes(d.Tunes[0].Track) {
+			got += midi.NoteToName(n.pitch)[:1]
+		}
+		if got != tc.want {
+			t.Errorf("%q played %s, want %s", tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	for _, tc := range []struct {
+		s      string
+		fifths int
+		minor  bool
+		alters map[byte]int
+	}{
+		{"", 0, false, map[byte]int{}},
+		{"G", 1, false, map[byte]int{'F': 1}},
+		{"Dmix", 1, false, map[byte]int{'F': 1}},
+		{"A dorian", 1, false, map[byte]int{'F': 1}},
+		{"F#m", 3, true, map[byte]int{'F': 1, 'C': 1, 'G': 1}},
+		{"Bb", -2, false, map[byte]int{'B': -1, 'E': -1}},
+		{"Eb Lydian", -2, false, map[byte]int{'B': -1, 'E': -1}},
+		{"D clef=bass", 2, false, map[byte]int{'F': 1, 'C': 1}},
+		{"Am ^g", 0, true, map[byte]int{'G': 1}},
+		{"D exp _b", 2, false, map[byte]int{'B': -1}},
+		{"HP", 0, false, map[byte]int{}},
+	} {
+		k, err := parseKey(tc.s)
+		if err != nil {
+			t.Errorf("%q: %v", tc.s, err)
+			continue
+		}
+		if int(k.sig.Key) != tc.fifths || k.sig.Minor != tc.minor || !reflect.DeepEqual(k.alters, tc.alters) {
+			t.Errorf("%q parsed as %+v", tc.s, k)
+		}
+	}
+	for _, s := range []string{"H", "Cwhatever", "G#", "Fbm"} {
+		if _, err := parseKey(s); err == nil {
+			t.Errorf("expected an error parsing key %q", s)
+		}
+	}
+}
+
+func TestParseTempo(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want float64
+	}{
+		{"1/4=120", 120},
+		{"3/8=60", 90},
+		{"1/8 3/8=40", 80},
+		{`"Allegro" 1/4=132`, 132},
+		{"120", 60},
+		{`"Slowly"`, 0},
+	} {
+		bpm, err := parseTempo(tc.s, big.NewRat(1, 8))
+		if err != nil || bpm != tc.want {
+			t.Errorf("%q: expected %v, got %v (%v)", tc.s, tc.want, bpm, err)
+		}
+	}
+}
+
+func TestDecoder_Decode_errors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"T:No reference number\nK:C\nCDE",
+		"X:one\nK:C\nCDE",
+		"X:1\nM:7/9\nK:C\nCDE",
+		"X:1\nK:H\nCDE",
+		"X:1\nK:C\n[CEG",
+		"X:1\nK:C\nC & E",
+		"X:1\nK:C\n-C",
+		"X:1\nK:C\nc''''''",
+	} {
+		if err := NewDecoder(strings.NewReader(data)).Decode(); err == nil {
+			t.Errorf("expected an error decoding %q", data)
+		}
+	}
+}
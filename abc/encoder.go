@@ -0,0 +1,279 @@
+package abc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/notation"
+)
+
+// measuresPerLine is the number of measures written on each line of music.
+const measuresPerLine = 4
+
+// Encoder writes midi tracks as an ABC tune. The notes are snapped to the
+// grid of the notation options and laid out in measures following the time
+// signatures, key signatures and tempo changes of the tracks, each voice of
+// each part of the score is written as an ABC voice.
+type Encoder struct {
+	w                   io.Writer
+	TicksPerQuarterNote uint16
+	Tracks              []*midi.Track
+	// Number is the reference number of the tune, 1 if not set.
+	Number int
+	// Title is the title of the tune, omitted if empty.
+	Title string
+	// Options sets the grid the notes are snapped to, the notes shorter than
+	// the eighth note unit length are written as fractions such as A/4.
+	Options notation.Options
+}
+
+// NewEncoder returns an encoder writing an ABC tune to w.
+func NewEncoder(w io.Writer, ppqn uint16) *Encoder {
+	return &Encoder{w: w, TicksPerQuarterNote: ppqn}
+}
+
+// Write notates the tracks and writes the tune.
+func (e *Encoder) Write() error {
+	s, err := notation.FromTracks(e.Tracks, e.TicksPerQuarterNote, &e.Options)
+	if err != nil {
+		return err
+	}
+	return e.WriteScore(s)
+}
+
+// WriteAbsEvents notates absolute events, expressed in the resolution of the
+// encoder, and writes them as a tune.
+func (e *Encoder) WriteAbsEvents(evs midi.AbsEvents) error {
+	tr := evs.ToMIDITrack(midi.NewEncoder(nil, midi.Syncronous, e.TicksPerQuarterNote))
+	s, err := notation.FromTracks([]*midi.Track{tr}, e.TicksPerQuarterNote, &e.Options)
+	if err != nil {
+		return err
+	}
+	return e.WriteScore(s)
+}
+
+// WriteScore writes a score notated by the notation package. The unit note
+// length of the tune is an eighth note.
+func (e *Encoder) WriteScore(s *notation.Score) error {
+	w := bufio.NewWriter(e.w)
+	number := e.Number
+	if number == 0 {
+		number = 1
+	}
+	fmt.Fprintf(w, "X:%d\n", number)
+	if e.Title != "" {
+		fmt.Fprintf(w, "T:%s\n", e.Title)
+	}
+	first := &notation.Measure{Time: midi.TimeSignature{Numerator: 4, Denominator: 2}}
+	if len(s.Measures) > 0 {
+		first = s.Measures[0]
+	}
+	fmt.Fprintf(w, "M:%s\n", meterString(first.Time))
+	fmt.Fprintf(w, "L:1/8\n")
+	for _, t := range first.Tempos {
+		if t.Offset == 0 {
+			fmt.Fprintf(w, "Q:%s\n", tempoString(t.BPM))
+			break
+		}
+	}
+	fmt.Fprintf(w, "K:%s\n", keyString(first.Key))
+
+	type stream struct {
+		part  *notation.Part
+		voice int
+	}
+	var streams []stream
+	for _, p := range s.Parts {
+		voices := 1
+		for _, m := range p.Measures {
+			for _, v := range m {
+				if v.Number > voices {
+					voices = v.Number
+				}
+			}
+		}
+		for v := 1; v <= voices; v++ {
+			streams = append(streams, stream{part: p, voice: v})
+		}
+	}
+	for i, st := range streams {
+		if len(streams) > 1 {
+			fmt.Fprintf(w, "V:%d", i+1)
+			if st.voice == 1 && st.part.Name != "" {
+				fmt.Fprintf(w, " name=%q", st.part.Name)
+			}
+			fmt.Fprintln(w)
+		}
+		if st.voice == 1 && st.part.Program != 0 {
+			fmt.Fprintf(w, "%%%%MIDI program %d\n", st.part.Program)
+		}
+		writeVoice(w, s, st.part, st.voice, i == 0)
+	}
+	return w.Flush()
+}
+
+// writeVoice writes the measures of a voice of a part, the tempo changes are
+// only written in the first voice of the tune.
+func writeVoice(w *bufio.Writer, s *notation.Score, p *notation.Part, number int, tempos bool) {
+	// the notes start mezzo forte, like the decoded ones
+	mark := dynamicsMark(defaultVelocity)
+	for mi, m := range s.Measures {
+		if mi > 0 && m.TimeChange {
+			fmt.Fprintf(w, "[M:%s] ", meterString(m.Time))
+		}
+		if mi > 0 && m.KeyChange {
+			fmt.Fprintf(w, "[K:%s] ", keyString(m.Key))
+		}
+		var elements []*notation.Element
+		for _, v := range p.Measures[mi] {
+			if v.Number == number {
+				elements = v.Elements
+			}
+		}
+		if elements == nil {
+			// the voice doesn't play in the measure
+			elements = []*notation.Element{{Duration: m.Length, MeasureRest: true}}
+		}
+		var pending []notation.Tempo
+		if tempos {
+			for _, t := range m.Tempos {
+				if mi > 0 || t.Offset > 0 {
+					pending = append(pending, t)
+				}
+			}
+		}
+		beat := m.Beat(s.Divisions)
+		// the accidentals apply to the rest of the measure
+		alters := map[int]int{}
+		keyAlters := m.Key.Alterations()
+		for i, el := range elements {
+			for len(pending) > 0 && pending[0].Offset <= el.Offset {
+				fmt.Fprintf(w, "[Q:%s]", tempoString(pending[0].BPM))
+				pending = pending[1:]
+			}
+			// the notes of a beat are beamed together
+			if i > 0 && el.Offset%beat == 0 {
+				w.WriteByte(' ')
+			}
+			if !el.Rest() && el.Velocity > 0 {
+				if mk := dynamicsMark(el.Velocity); mk != mark {
+					fmt.Fprintf(w, "!%s!", mk)
+					mark = mk
+				}
+			}
+			writeElement(w, s, el, keyAlters, alters)
+		}
+		for _, t := range pending {
+			fmt.Fprintf(w, "[Q:%s]", tempoString(t.BPM))
+		}
+		switch {
+		case mi == len(s.Measures)-1:
+			w.WriteString(" |]\n")
+		case (mi+1)%measuresPerLine == 0:
+			w.WriteString(" |\n")
+		default:
+			w.WriteString(" | ")
+		}
+	}
+}
+
+// writeElement writes a note, a chord or a rest. alters tracks the
+// accidentals written in the measure by natural note.
+func writeElement(w *bufio.Writer, s *notation.Score, el *notation.Element, keyAlters map[byte]int, alters map[int]int) {
+	length := lengthString(el.Duration, s.Divisions)
+	if el.Rest() {
+		w.WriteString("z" + length)
+		return
+	}
+	if len(el.Pitches) > 1 {
+		w.WriteByte('[')
+	}
+	for _, p := range el.Pitches {
+		natural := p.Note - p.Alter
+		current, ok := alters[natural]
+		if !ok {
+			current = keyAlters[p.Letter]
+		}
+		if current != p.Alter {
+			w.WriteString(accidentalString(p.Alter))
+			alters[natural] = p.Alter
+		}
+		w.WriteString(noteString(p.Letter, natural))
+	}
+	if len(el.Pitches) > 1 {
+		w.WriteByte(']')
+	}
+	w.WriteString(length)
+	if el.TieStart {
+		w.WriteByte('-')
+	}
+}
+
+// noteString returns a note letter in the octave of a natural midi note: C
+// is the middle C, c the octave above, c' and C, the next ones.
+func noteString(letter byte, natural int) string {
+	octave := natural/12 - 5
+	if natural < 0 {
+		octave = (natural-11)/12 - 5
+	}
+	if octave > 0 {
+		return string(letter+'a'-'A') + strings.Repeat("'", octave-1)
+	}
+	return string(letter) + strings.Repeat(",", -octave)
+}
+
+func accidentalString(alter int) string {
+	switch alter {
+	case -2:
+		return "__"
+	case -1:
+		return "_"
+	case 1:
+		return "^"
+	case 2:
+		return "^^"
+	}
+	return "="
+}
+
+// lengthString returns the length multiplier of a duration in divisions for
+// an eighth note unit length.
+func lengthString(duration, divisions int) string {
+	r := big.NewRat(int64(2*duration), int64(divisions))
+	num, den := r.Num().Int64(), r.Denom().Int64()
+	switch {
+	case den == 1 && num == 1:
+		return ""
+	case den == 1:
+		return fmt.Sprint(num)
+	case num == 1 && den == 2:
+		return "/"
+	case num == 1:
+		return fmt.Sprintf("/%d", den)
+	}
+	return fmt.Sprintf("%d/%d", num, den)
+}
+
+func meterString(ts midi.TimeSignature) string {
+	num := int(ts.Numerator)
+	if num == 0 {
+		num = 4
+	}
+	return fmt.Sprintf("%d/%d", num, ts.Denum())
+}
+
+func keyString(ks midi.KeySignature) string {
+	if ks.Minor {
+		return ks.TonicName() + "m"
+	}
+	return ks.TonicName()
+}
+
+func tempoString(bpm float64) string {
+	return fmt.Sprintf("1/4=%d", int(math.Round(bpm)))
+}
@@ -0,0 +1,127 @@
+package abc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/internal/miditest"
+)
+
+func TestEncoder_Write(t *testing.T) {
+	tr := miditest.VoicesTrack("Fiddle")
+	// a dotted B natural then a Bb in the same bar
+	tr.AddAfterDelta(0, midi.NoteOn(0, 71, 45))
+	tr.AddAfterDelta(72, midi.NoteOff(0, 71))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 70, 45))
+	tr.AddAfterDelta(24, midi.NoteOff(0, 70))
+	tr.AddAfterDelta(96, midi.NoteOn(0, 48, 110))
+	tr.AddAfterDelta(96, midi.NoteOff(0, 48))
+
+	buf := &bytes.Buffer{}
+	e := NewEncoder(buf, 96)
+	e.Title = "Test"
+	e.Tracks = []*midi.Track{tr}
+	if err := e.Write(); err != nil {
+		t.Fatal(err)
+	}
+	want := `X:1
+T:Test
+M:3/4
+L:1/8
+Q:1/4=100
+K:F
+V:1 name="Fiddle"
+%%MIDI program 40
+G6- | G2 !p!=B3/2_B/ z2 | !ff!C,2 z4 |]
+V:2
+[Bd]4 z2 | z6 | z6 |]
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEncoder_Write_roundTrip(t *testing.T) {
+	tr := &midi.Track{}
+	tr.AddAfterDelta(0, midi.KeySignatureEvent(-3, true))
+	tr.AddAfterDelta(0, midi.TempoEvent(100))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 60, 80))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 63, 80))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 67, 80))
+	tr.AddAfterDelta(144, midi.NoteOff(0, 60))
+	tr.AddAfterDelta(0, midi.NoteOff(0, 63))
+	tr.AddAfterDelta(0, midi.NoteOff(0, 67))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 68, 49))
+	tr.AddAfterDelta(48, midi.NoteOff(0, 68))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 71, 49))
+	tr.AddAfterDelta(48, midi.NoteOff(0, 71))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 72, 112))
+	tr.AddAfterDelta(336, midi.NoteOff(0, 72))
+
+	buf := &bytes.Buffer{}
+	e := NewEncoder(buf, 96)
+	e.Tracks = []*midi.Track{tr}
+	if err := e.Write(); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecoder(buf)
+	d.TicksPerQuarterNote = 96
+	if err := d.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Tunes) != 1 {
+		t.Fatalf("expected 1 tune, got %d", len(d.Tunes))
+	}
+	got := d.Tunes[0].Track
+	if !reflect.DeepEqual(trackNotes(got), trackNotes(tr)) {
+		t.Errorf("notes = %v, want %v", trackNotes(got), trackNotes(tr))
+	}
+	if keys := midi.KeyTimelineOf(got); len(keys) != 1 || keys[0].String() != "C minor" {
+		t.Errorf("expected a C minor key signature, got %v", keys)
+	}
+	if tm := midi.TempoMapOf(got); len(tm) != 1 || tm[0].BPM() != 100 {
+		t.Errorf("expected a 100 BPM tempo, got %v", tm)
+	}
+}
+
+func TestEncoder_WriteAbsEvents(t *testing.T) {
+	evs := midi.AbsEvents{
+		{Start: 0, Duration: 48, Vel: 80, MIDINote: 62},
+		{Start: 48, Duration: 48, Vel: 80, MIDINote: 66},
+		{Start: 96, Duration: 96, Vel: 80, MIDINote: 69},
+	}
+	buf := &bytes.Buffer{}
+	e := NewEncoder(buf, 96)
+	e.Number = 3
+	if err := e.WriteAbsEvents(evs); err != nil {
+		t.Fatal(err)
+	}
+	want := "X:3\nM:4/4\nL:1/8\nK:C\nD^F A2 z4 |]\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestEncoder_Write_fixtures(t *testing.T) {
+	miditest.Fixtures(t, func(t *testing.T, d *midi.Decoder) {
+		buf := &bytes.Buffer{}
+		e := NewEncoder(buf, d.TicksPerQuarterNote)
+		e.Tracks = d.Tracks
+		if err := e.Write(); err != nil {
+			t.Fatal(err)
+		}
+		// every note of the file is written with its pitch in one tune
+		imported := NewDecoder(buf)
+		if err := imported.Decode(); err != nil {
+			t.Fatal(err)
+		}
+		if len(imported.Tunes) != 1 {
+			t.Fatalf("expected 1 tune, got %d", len(imported.Tunes))
+		}
+		if got, want := miditest.NotePitches(imported.Tunes[0].Track), miditest.NotePitches(d.Tracks...); !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %d notes with the pitches of the file, got %d notes", len(want), len(got))
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/abc"
+)
+
+var (
+	fileFlag = flag.String("file", "", "The path to the ABC file to convert, stdin if not set")
+	outFlag  = flag.String("out", "out.mid", "The path of the midi file to write")
+	tuneFlag = flag.Int("tune", 0, "The reference number (X: field) of the tune to convert, the first tune if not set")
+	ppqFlag  = flag.Uint("ppq", abc.DefaultTicksPerQuarterNote, "The resolution of the midi file in ticks per quarter note")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s \n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	in := os.Stdin
+	if *fileFlag != "" {
+		f, err := os.Open(*fileFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	dec := abc.NewDecoder(in)
+	dec.TicksPerQuarterNote = uint16(*ppqFlag)
+	if err := dec.Decode(); err != nil {
+		log.Fatal(err)
+	}
+	tune := dec.Tunes[0]
+	if *tuneFlag != 0 {
+		tune = nil
+		for _, t := range dec.Tunes {
+			if t.Number == *tuneFlag {
+				tune = t
+				break
+			}
+		}
+		if tune == nil {
+			log.Fatalf("tune %d not found", *tuneFlag)
+		}
+	}
+
+	out, err := os.Create(*outFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer out.Close()
+	enc := midi.NewEncoder(out, 0, dec.TicksPerQuarterNote)
+	enc.Tracks = []*midi.Track{tune.Track}
+	if err := enc.Write(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/go-audio/midi"
+)
+
+var (
+	fileFlag = flag.String("file", "", "The path to the midicsv file to convert, stdin if not set")
+	outFlag  = flag.String("out", "out.mid", "The path of the midi file to write")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s \n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	in := os.Stdin
+	if *fileFlag != "" {
+		f, err := os.Open(*fileFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	dec := midi.NewCSVDecoder(in)
+	if err := dec.Decode(); err != nil {
+		log.Fatal(err)
+	}
+
+	out, err := os.Create(*outFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer out.Close()
+	enc := midi.NewEncoder(out, dec.Format, dec.TicksPerQuarterNote)
+	enc.Tracks = dec.Tracks
+	if err := enc.Write(); err != nil {
+		log.Fatal(err)
+	}
+}
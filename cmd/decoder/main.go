@@ -1,16 +1,27 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/abc"
+	"github.com/go-audio/midi/lilypond"
+	"github.com/go-audio/midi/musicxml"
 )
 
 var (
 	fileFlag = flag.String("file", "", "The path to the midi file to decode")
+	csvFlag  = flag.Bool("csv", false, "Print the file in the midicsv format (see cmd/csvmidi to convert it back)")
+	jsonFlag = flag.Bool("json", false, "Print the file in JSON (see midi.JSONSchema for the format)")
+	xmlFlag  = flag.Bool("musicxml", false, "Print the file as a MusicXML score")
+	abcFlag  = flag.Bool("abc", false, "Print the file as an ABC tune (see cmd/abcmidi to convert it back)")
+	lyFlag   = flag.Bool("lilypond", false, "Print the file as a LilyPond score")
 )
 
 func main() {
@@ -27,11 +38,55 @@ func main() {
 	defer f.Close()
 
 	decoder := midi.NewDecoder(f)
-	decoder.Debug = true
+	decoder.Debug = !*csvFlag && !*jsonFlag && !*xmlFlag && !*abcFlag && !*lyFlag
 	if err := decoder.Decode(); err != nil {
 		log.Fatal(err)
 	}
 
+	if *csvFlag {
+		enc := midi.NewCSVEncoder(os.Stdout, decoder.Format, decoder.TicksPerQuarterNote)
+		enc.Tracks = decoder.Tracks
+		if err := enc.Write(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(decoder); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *xmlFlag {
+		enc := musicxml.NewEncoder(os.Stdout, decoder.TicksPerQuarterNote)
+		enc.Title = strings.TrimSuffix(filepath.Base(*fileFlag), filepath.Ext(*fileFlag))
+		enc.Tracks = decoder.Tracks
+		if err := enc.Write(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *lyFlag {
+		enc := lilypond.NewEncoder(os.Stdout, decoder.TicksPerQuarterNote)
+		enc.Title = strings.TrimSuffix(filepath.Base(*fileFlag), filepath.Ext(*fileFlag))
+		enc.Tracks = decoder.Tracks
+		if err := enc.Write(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *abcFlag {
+		enc := abc.NewEncoder(os.Stdout, decoder.TicksPerQuarterNote)
+		enc.Title = strings.TrimSuffix(filepath.Base(*fileFlag), filepath.Ext(*fileFlag))
+		enc.Tracks = decoder.Tracks
+		if err := enc.Write(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	fmt.Println("format:", decoder.Format)
 	fmt.Println(decoder.TicksPerQuarterNote, "ticks per quarter")
 	fmt.Println("Debugger on:", decoder.Debug)
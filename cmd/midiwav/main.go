@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/sf2"
+	"github.com/go-audio/midi/synth"
+)
+
+var (
+	fileFlag = flag.String("file", "", "The path to the midi file to render")
+	outFlag  = flag.String("out", "out.wav", "The path of the WAV file to write")
+	rateFlag = flag.Int("rate", synth.DefaultSampleRate, "The sample rate of the audio")
+	bitsFlag = flag.Int("bits", 16, "The bit depth of the audio: 8, 16, 24 or 32")
+	waveFlag = flag.String("wave", "sine", "The waveform of the melodic channels: sine, saw, square or noise")
+	gainFlag = flag.Float64("gain", synth.DefaultGain, "The master gain")
+	sf2Flag  = flag.String("sf2", "", "The path to a SoundFont 2 bank to play the file with instead of the oscillators")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s \n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	waveform := synth.Sine
+	switch *waveFlag {
+	case "sine":
+	case "saw":
+		waveform = synth.Saw
+	case "square":
+		waveform = synth.Square
+	case "noise":
+		waveform = synth.Noise
+	default:
+		log.Fatalf("unknown waveform %q", *waveFlag)
+	}
+
+	f, err := os.Open(*fileFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	dec := midi.NewDecoder(f)
+	if err := dec.Decode(); err != nil {
+		log.Fatal(err)
+	}
+
+	out, err := os.Create(*outFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer out.Close()
+
+	if *sf2Flag != "" {
+		bank, err := sf2.Open(*sf2Flag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s := sf2.NewSampler(bank, dec.TicksPerQuarterNote)
+		s.Tracks = dec.Tracks
+		s.SampleRate = *rateFlag
+		s.Gain = *gainFlag
+		if err := s.WriteWAV(out, *bitsFlag); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	r := synth.NewRenderer(dec.TicksPerQuarterNote)
+	r.Tracks = dec.Tracks
+	r.SampleRate = *rateFlag
+	r.Gain = *gainFlag
+	for i := range r.Instruments {
+		if i != synth.PercussionChannel {
+			r.Instruments[i].Waveform = waveform
+		}
+	}
+	if err := r.WriteWAV(out, *bitsFlag); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/pianoroll"
+)
+
+var (
+	fileFlag  = flag.String("file", "", "The path to the midi file to draw")
+	outFlag   = flag.String("out", "pianoroll.png", "The path of the PNG or SVG file to write, depending on its extension")
+	fromFlag  = flag.Uint64("from", 0, "The first tick to draw")
+	toFlag    = flag.Uint64("to", 0, "The last tick to draw, the end of the last bar if not set")
+	lowFlag   = flag.Int("low", 0, "The lowest note to draw, see -high")
+	highFlag  = flag.Int("high", 0, "The highest note to draw, the range of the notes played if -low and -high aren't set")
+	scaleFlag = flag.Int("scale", pianoroll.DefaultPixelsPerQuarterNote, "The number of pixels per quarter note")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s \n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	f, err := os.Open(*fileFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	dec := midi.NewDecoder(f)
+	if err := dec.Decode(); err != nil {
+		log.Fatal(err)
+	}
+
+	r := pianoroll.NewRenderer(dec.TicksPerQuarterNote)
+	r.Tracks = dec.Tracks
+	r.FromTick, r.ToTick = *fromFlag, *toFlag
+	r.LowNote, r.HighNote = *lowFlag, *highFlag
+	r.PixelsPerQuarterNote = *scaleFlag
+
+	out, err := os.Create(*outFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer out.Close()
+	if strings.ToLower(filepath.Ext(*outFlag)) == ".svg" {
+		err = r.WriteSVG(out)
+	} else {
+		err = r.WritePNG(out)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/musicxml"
+)
+
+var (
+	fileFlag = flag.String("file", "", "The path to the MusicXML partwise score to convert, stdin if not set")
+	outFlag  = flag.String("out", "out.mid", "The path of the midi file to write")
+	ppqFlag  = flag.Uint("ppq", musicxml.DefaultTicksPerQuarterNote, "The resolution of the midi file in ticks per quarter note")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s \n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	in := os.Stdin
+	if *fileFlag != "" {
+		f, err := os.Open(*fileFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	dec := musicxml.NewDecoder(in)
+	dec.TicksPerQuarterNote = uint16(*ppqFlag)
+	if err := dec.Decode(); err != nil {
+		log.Fatal(err)
+	}
+	for _, w := range dec.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+
+	out, err := os.Create(*outFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer out.Close()
+	enc := midi.NewEncoder(out, dec.Format, dec.TicksPerQuarterNote)
+	enc.Tracks = dec.Tracks
+	if err := enc.Write(); err != nil {
+		log.Fatal(err)
+	}
+}
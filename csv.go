@@ -0,0 +1,624 @@
+package midi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// csvTextTypes maps the text meta events to their midicsv record type.
+var csvTextTypes = map[byte]string{
+	0x01: "Text_t",
+	0x02: "Copyright_t",
+	0x03: "Title_t",
+	0x04: "Instrument_name_t",
+	0x05: "Lyric_t",
+	0x06: "Marker_t",
+	0x07: "Cue_point_t",
+}
+
+// csvRunningStatus is the comment used to record where the events use running
+// status, csvmidi and other midicsv tools ignore it.
+const csvRunningStatus = "# Running_status"
+
+// CSVEncoder writes midi tracks as text in the midicsv format: one record per
+// line made of the track number, the absolute tick, the record type and its
+// parameters. For instance:
+//
+//	0, 0, Header, 1, 1, 96
+//	1, 0, Start_track
+//	1, 0, Title_t, "Piano"
+//	1, 0, Note_on_c, 0, 60, 100
+//	1, 96, Note_off_c, 0, 60, 0
+//	1, 96, End_track
+//	0, 0, End_of_file
+//
+// See http://www.fourmilab.ch/webtools/midicsv/ for the description of the
+// records. The text can be converted back with a CSVDecoder and encoded to a
+// file matching the original byte for byte: running status is recorded with
+// comments and text is escaped so no data is lost.
+type CSVEncoder struct {
+	w io.Writer
+	// Format is the format of the midi file, see Encoder.Format.
+	Format uint16
+	// TicksPerQuarterNote is the resolution of the tracks.
+	TicksPerQuarterNote uint16
+	Tracks              []*Track
+}
+
+// NewCSVEncoder returns an encoder writing the text to the passed writer.
+func NewCSVEncoder(w io.Writer, format uint16, ppqn uint16) *CSVEncoder {
+	return &CSVEncoder{w: w, Format: format, TicksPerQuarterNote: ppqn}
+}
+
+// Write writes the text representation of the tracks.
+func (e *CSVEncoder) Write() error {
+	if e == nil {
+		return fmt.Errorf("can't write a nil encoder")
+	}
+	w := bufio.NewWriter(e.w)
+	fmt.Fprintf(w, "0, 0, Header, %d, %d, %d\n", e.Format, len(e.Tracks), e.TicksPerQuarterNote)
+	for i, t := range e.Tracks {
+		if err := e.writeTrack(w, i+1, t); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(w, "0, 0, End_of_file")
+	return w.Flush()
+}
+
+func (e *CSVEncoder) writeTrack(w *bufio.Writer, n int, t *Track) error {
+	fmt.Fprintf(w, "%d, 0, Start_track\n", n)
+	var tick uint64
+	var status byte
+	var running, ended bool
+	if t == nil {
+		t = &Track{}
+	}
+	for _, ev := range t.Events {
+		tick += uint64(ev.TimeDelta)
+		if isVoiceMsgType(ev.MsgType) {
+			s := ev.MsgType<<4 | ev.MsgChan
+			if s == status && ev.RunningStatus != running {
+				running = ev.RunningStatus
+				fmt.Fprintf(w, "%s, %t\n", csvRunningStatus, running)
+			}
+			status = s
+		} else {
+			status = 0
+		}
+		record, err := csvRecord(ev)
+		if err != nil {
+			return fmt.Errorf("track %d tick %d: %v", n, tick, err)
+		}
+		fmt.Fprintf(w, "%d, %d, %s\n", n, tick, record)
+		if record == "End_track" {
+			ended = true
+			break
+		}
+	}
+	// the encoder adds the missing end of track events
+	if !ended {
+		fmt.Fprintf(w, "%d, %d, End_track\n", n, tick)
+	}
+	return nil
+}
+
+// csvRecord returns the record type and parameters of the event.
+func csvRecord(e *Event) (string, error) {
+	switch e.MsgType {
+	case 0x8:
+		return fmt.Sprintf("Note_off_c, %d, %d, %d", e.MsgChan, e.Note, e.Velocity), nil
+	case 0x9:
+		return fmt.Sprintf("Note_on_c, %d, %d, %d", e.MsgChan, e.Note, e.Velocity), nil
+	case 0xA:
+		return fmt.Sprintf("Poly_aftertouch_c, %d, %d, %d", e.MsgChan, e.Note, e.Velocity), nil
+	case 0xB:
+		return fmt.Sprintf("Control_c, %d, %d, %d", e.MsgChan, e.Controller, e.NewValue), nil
+	case 0xC:
+		return fmt.Sprintf("Program_c, %d, %d", e.MsgChan, e.NewProgram), nil
+	case 0xD:
+		return fmt.Sprintf("Channel_aftertouch_c, %d, %d", e.MsgChan, e.Pressure), nil
+	case 0xE:
+		return fmt.Sprintf("Pitch_bend_c, %d, %d", e.MsgChan, e.AbsPitchBend), nil
+	case 0xF:
+		if e.IsSysEx() {
+			if e.MsgChan == 0x7 {
+				return "System_exclusive_packet, " + csvBytes(e.SysEx), nil
+			}
+			return "System_exclusive, " + csvBytes(e.SysEx), nil
+		}
+		return csvMetaRecord(e), nil
+	}
+	return "", fmt.Errorf("can't write event %v", e)
+}
+
+func csvMetaRecord(e *Event) string {
+	if e.MetaData != nil {
+		switch {
+		case e.Cmd == 0x21 && len(e.MetaData) == 1:
+			return fmt.Sprintf("MIDI_port, %d", e.MetaData[0])
+		case e.Cmd == 0x7F:
+			return "Sequencer_specific, " + csvBytes(e.MetaData)
+		}
+		return fmt.Sprintf("Unknown_meta_event, %d, %s", e.Cmd, csvBytes(e.MetaData))
+	}
+	if name, ok := csvTextTypes[e.Cmd]; ok {
+		return name + ", " + csvQuote(string(e.metaData()))
+	}
+	switch e.Cmd {
+	case 0x00:
+		return fmt.Sprintf("Sequence_number, %d", e.SeqNum)
+	case 0x20:
+		return fmt.Sprintf("Channel_prefix, %d", e.Channel)
+	case 0x2F:
+		return "End_track"
+	case 0x51:
+		return fmt.Sprintf("Tempo, %d", e.MsPerQuartNote)
+	case 0x54:
+		d := e.metaData()
+		return fmt.Sprintf("SMPTE_offset, %d, %d, %d, %d, %d", d[0], d[1], d[2], d[3], d[4])
+	case 0x58:
+		d := e.metaData()
+		return fmt.Sprintf("Time_signature, %d, %d, %d, %d", d[0], d[1], d[2], d[3])
+	case 0x59:
+		ks := e.KeySignature()
+		mode := "major"
+		if ks.Minor {
+			mode = "minor"
+		}
+		return fmt.Sprintf("Key_signature, %d, \"%s\"", ks.Key, mode)
+	}
+	return fmt.Sprintf("Unknown_meta_event, %d, 0", e.Cmd)
+}
+
+// csvBytes writes the length of the data followed by its bytes.
+func csvBytes(data []byte) string {
+	fields := make([]string, len(data)+1)
+	fields[0] = strconv.Itoa(len(data))
+	for i, b := range data {
+		fields[i+1] = strconv.Itoa(int(b))
+	}
+	return strings.Join(fields, ", ")
+}
+
+// csvQuote quotes the text doubling the quotes. Backslashes and the bytes which
+// aren't printable ASCII characters are escaped in octal (\ooo).
+func csvQuote(s string) string {
+	buf := bytes.NewBufferString(`"`)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			buf.WriteString(`""`)
+		case c == '\\':
+			buf.WriteString(`\\`)
+		case c < 0x20 || c > 0x7E:
+			fmt.Fprintf(buf, `\%03o`, c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// CSVDecoder reads midi tracks written in the midicsv text format, see
+// CSVEncoder.
+type CSVDecoder struct {
+	r      io.Reader
+	Format uint16
+	// NumTracks is the number of tracks announced in the header.
+	NumTracks           uint16
+	TicksPerQuarterNote uint16
+	Tracks              []*Track
+}
+
+// NewCSVDecoder returns a decoder reading the text from the passed reader.
+func NewCSVDecoder(r io.Reader) *CSVDecoder {
+	return &CSVDecoder{r: r}
+}
+
+// Decode parses the text into tracks. The events are decoded the same way the
+// binary decoder does, so the tracks can be encoded back into the original
+// file. Blank lines and comments starting with # or ; are ignored.
+func (d *CSVDecoder) Decode() error {
+	br := bufio.NewReader(d.r)
+	tracks := map[int]*Track{}
+	running := map[*Track]bool{}
+	var lineNum int
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		lineNum++
+		if perr := d.parseLine(strings.TrimSpace(line), tracks, running); perr == io.EOF {
+			return nil
+		} else if perr != nil {
+			return fmt.Errorf("line %d: %v - %s", lineNum, perr, ErrUnexpectedData)
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func (d *CSVDecoder) parseLine(line string, tracks map[int]*Track, running map[*Track]bool) error {
+	if line == "" || line[0] == ';' {
+		return nil
+	}
+	if line[0] == '#' {
+		// running status directives apply to the last track started
+		if strings.HasPrefix(line, csvRunningStatus) && len(d.Tracks) > 0 {
+			fields, err := splitCSV(line)
+			if err != nil || len(fields) != 2 {
+				return fmt.Errorf("invalid running status comment")
+			}
+			on, err := strconv.ParseBool(fields[1])
+			if err != nil {
+				return err
+			}
+			running[d.Tracks[len(d.Tracks)-1]] = on
+		}
+		return nil
+	}
+	fields, err := splitCSV(line)
+	if err != nil {
+		return err
+	}
+	if len(fields) < 3 {
+		return fmt.Errorf("expected at least 3 fields, got %d", len(fields))
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return fmt.Errorf("invalid track number %q", fields[0])
+	}
+	tick, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid tick %q", fields[1])
+	}
+	recType, params := fields[2], fields[3:]
+
+	switch recType {
+	case "Header":
+		vals, err := csvInts(params, 3, 0xFFFF)
+		if err != nil {
+			return err
+		}
+		d.Format, d.NumTracks, d.TicksPerQuarterNote = uint16(vals[0]), uint16(vals[1]), uint16(vals[2])
+		return nil
+	case "Start_track":
+		if tracks[n] != nil {
+			return fmt.Errorf("track %d started twice", n)
+		}
+		t := &Track{decoded: true}
+		tracks[n] = t
+		d.Tracks = append(d.Tracks, t)
+		return nil
+	case "End_of_file":
+		return io.EOF
+	}
+
+	t := tracks[n]
+	if t == nil {
+		return fmt.Errorf("track %d wasn't started", n)
+	}
+	if tick < t.currentTicks {
+		return fmt.Errorf("tick %d is before the previous event (%d)", tick, t.currentTicks)
+	}
+	e, err := csvEvent(recType, params)
+	if err != nil {
+		return err
+	}
+	e.TimeDelta = uint32(tick - t.currentTicks)
+	e.AbsTicks = tick
+	if l := len(t.Events); l > 0 && running[t] && isVoiceMsgType(e.MsgType) {
+		prev := t.Events[l-1]
+		e.RunningStatus = prev.MsgType == e.MsgType && prev.MsgChan == e.MsgChan
+	}
+	t.currentTicks = tick
+	t.Events = append(t.Events, e)
+	return nil
+}
+
+// csvEvent creates the event of a record the same way the binary decoder does.
+func csvEvent(recType string, params []string) (*Event, error) {
+	channelEvent := func(msgType uint8, count int) (*Event, []int, error) {
+		vals, err := csvInts(params, count, 127)
+		if err != nil {
+			return nil, nil, err
+		}
+		if vals[0] > 15 {
+			return nil, nil, fmt.Errorf("invalid channel %d", vals[0])
+		}
+		return &Event{MsgType: msgType, MsgChan: uint8(vals[0])}, vals, nil
+	}
+	meta := func(cmd byte) *Event {
+		return &Event{MsgType: 0xF, MsgChan: 0xF, Cmd: cmd}
+	}
+
+	switch recType {
+	case "Note_off_c", "Note_on_c", "Poly_aftertouch_c":
+		msgType := map[string]uint8{"Note_off_c": 0x8, "Note_on_c": 0x9, "Poly_aftertouch_c": 0xA}[recType]
+		e, vals, err := channelEvent(msgType, 3)
+		if err != nil {
+			return nil, err
+		}
+		e.Note, e.Velocity = uint8(vals[1]), uint8(vals[2])
+		return e, nil
+	case "Control_c":
+		e, vals, err := channelEvent(0xB, 3)
+		if err != nil {
+			return nil, err
+		}
+		e.Controller, e.NewValue = uint8(vals[1]), uint8(vals[2])
+		return e, nil
+	case "Program_c":
+		e, vals, err := channelEvent(0xC, 2)
+		if err != nil {
+			return nil, err
+		}
+		e.NewProgram = uint8(vals[1])
+		return e, nil
+	case "Channel_aftertouch_c":
+		e, vals, err := channelEvent(0xD, 2)
+		if err != nil {
+			return nil, err
+		}
+		e.Pressure = uint8(vals[1])
+		return e, nil
+	case "Pitch_bend_c":
+		vals, err := csvInts(params, 2, PitchBendMax)
+		if err != nil {
+			return nil, err
+		}
+		if vals[0] > 15 {
+			return nil, fmt.Errorf("invalid channel %d", vals[0])
+		}
+		e := &Event{MsgType: 0xE, MsgChan: uint8(vals[0]), AbsPitchBend: uint16(vals[1])}
+		e.RelPitchBend = int16(e.AbsPitchBend) - PitchBendCenter
+		return e, nil
+	case "System_exclusive", "System_exclusive_packet":
+		data, err := csvData(params)
+		if err != nil {
+			return nil, err
+		}
+		e := &Event{MsgType: 0xF, SysEx: data}
+		if recType == "System_exclusive_packet" {
+			e.MsgChan = 0x7
+		}
+		return e, nil
+	case "Sequencer_specific":
+		data, err := csvData(params)
+		if err != nil {
+			return nil, err
+		}
+		e := meta(0x7F)
+		e.MetaData = data
+		return e, nil
+	case "Unknown_meta_event":
+		if len(params) < 1 {
+			return nil, fmt.Errorf("missing meta event type")
+		}
+		cmd, err := csvInts(params[:1], 1, 0xFF)
+		if err != nil {
+			return nil, err
+		}
+		data, err := csvData(params[1:])
+		if err != nil {
+			return nil, err
+		}
+		e := meta(byte(cmd[0]))
+		e.MetaData = data
+		return e, nil
+	case "MIDI_port":
+		vals, err := csvInts(params, 1, 0xFF)
+		if err != nil {
+			return nil, err
+		}
+		e := meta(0x21)
+		e.MetaData = []byte{byte(vals[0])}
+		return e, nil
+	case "Sequence_number":
+		vals, err := csvInts(params, 1, 0xFFFF)
+		if err != nil {
+			return nil, err
+		}
+		e := meta(0x00)
+		e.SeqNum = uint16(vals[0])
+		return e, nil
+	case "Channel_prefix":
+		vals, err := csvInts(params, 1, 0xFF)
+		if err != nil {
+			return nil, err
+		}
+		e := meta(0x20)
+		e.Channel = byte(vals[0])
+		return e, nil
+	case "End_track":
+		return meta(0x2F), nil
+	case "Tempo":
+		vals, err := csvInts(params, 1, 0xFFFFFF)
+		if err != nil {
+			return nil, err
+		}
+		e := meta(0x51)
+		e.MsPerQuartNote = uint32(vals[0])
+		if e.MsPerQuartNote > 0 {
+			e.Bpm = 60000000 / e.MsPerQuartNote
+		}
+		return e, nil
+	case "SMPTE_offset":
+		vals, err := csvInts(params, 5, 0xFF)
+		if err != nil {
+			return nil, err
+		}
+		e := meta(0x54)
+		e.SmpteOffset = &SmpteOffset{Hour: uint8(vals[0]), Min: uint8(vals[1]), Sec: uint8(vals[2]), Fr: uint8(vals[3]), SubFr: uint8(vals[4])}
+		return e, nil
+	case "Time_signature":
+		vals, err := csvInts(params, 4, 0xFF)
+		if err != nil {
+			return nil, err
+		}
+		e := meta(0x58)
+		e.TimeSignature = &TimeSignature{
+			Numerator:                   uint8(vals[0]),
+			Denominator:                 uint8(vals[1]),
+			ClocksPerTick:               uint8(vals[2]),
+			ThirtySecondNotesPerQuarter: uint8(vals[3]),
+		}
+		return e, nil
+	case "Key_signature":
+		if len(params) != 2 {
+			return nil, fmt.Errorf("expected 2 parameters, got %d", len(params))
+		}
+		key, err := strconv.Atoi(params[0])
+		if err != nil || key < -128 || key > 127 {
+			return nil, fmt.Errorf("invalid key %q", params[0])
+		}
+		mode, err := csvUnquote(params[1])
+		if err != nil {
+			return nil, err
+		}
+		var minor bool
+		switch strings.ToLower(mode) {
+		case "major":
+		case "minor":
+			minor = true
+		default:
+			return nil, fmt.Errorf("invalid mode %q", mode)
+		}
+		e := KeySignatureEvent(key, minor)
+		e.MsgChan = 0xF
+		return e, nil
+	}
+	for cmd, name := range csvTextTypes {
+		if name != recType {
+			continue
+		}
+		if len(params) != 1 {
+			return nil, fmt.Errorf("expected 1 parameter, got %d", len(params))
+		}
+		text, err := csvUnquote(params[0])
+		if err != nil {
+			return nil, err
+		}
+		e := meta(cmd)
+		switch cmd {
+		case 0x01:
+			e.Text = text
+		case 0x02:
+			e.Copyright = text
+		case 0x03:
+			e.SeqTrackName = text
+		case 0x04:
+			e.InstrumentName = text
+		case 0x05:
+			e.Lyric = text
+		case 0x06:
+			e.Marker = text
+		case 0x07:
+			e.CuePoint = text
+		}
+		return e, nil
+	}
+	return nil, fmt.Errorf("unknown record type %q", recType)
+}
+
+// csvInts parses the expected number of integer parameters between 0 and max.
+func csvInts(params []string, count int, max int) ([]int, error) {
+	if len(params) != count {
+		return nil, fmt.Errorf("expected %d parameters, got %d", count, len(params))
+	}
+	vals := make([]int, count)
+	for i, p := range params {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 || v > max {
+			return nil, fmt.Errorf("invalid value %q", p)
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// csvData parses a length followed by the data bytes.
+func csvData(params []string) ([]byte, error) {
+	if len(params) < 1 {
+		return nil, fmt.Errorf("missing data length")
+	}
+	n, err := strconv.Atoi(params[0])
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid data length %q", params[0])
+	}
+	vals, err := csvInts(params[1:], n, 0xFF)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, n)
+	for i, v := range vals {
+		data[i] = byte(v)
+	}
+	return data, nil
+}
+
+// splitCSV splits the line into trimmed fields, quoted fields are kept
+// quoted so their escape sequences can be decoded by csvUnquote.
+func splitCSV(line string) ([]string, error) {
+	fields := []string{}
+	var field bytes.Buffer
+	var quoted bool
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quoted && c == '"' && i+1 < len(line) && line[i+1] == '"':
+			field.WriteString(`""`)
+			i++
+		case c == '"':
+			quoted = !quoted
+			field.WriteByte(c)
+		case c == ',' && !quoted:
+			fields = append(fields, strings.TrimSpace(field.String()))
+			field.Reset()
+		default:
+			field.WriteByte(c)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated string")
+	}
+	return append(fields, strings.TrimSpace(field.String())), nil
+}
+
+// csvUnquote decodes a quoted text field, see csvQuote.
+func csvUnquote(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", fmt.Errorf("expected a quoted string, got %s", s)
+	}
+	s = s[1 : len(s)-1]
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' && i+1 < len(s) && s[i+1] == '"':
+			buf.WriteByte('"')
+			i++
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\\':
+			buf.WriteByte('\\')
+			i++
+		case c == '\\' && i+3 < len(s):
+			v, err := strconv.ParseUint(s[i+1:i+4], 8, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape sequence %q", s[i:i+4])
+			}
+			buf.WriteByte(byte(v))
+			i += 3
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String(), nil
+}
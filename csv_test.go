@@ -0,0 +1,141 @@
+package midi
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mattetti/filebuffer"
+)
+
+func TestCSV_roundTrip(t *testing.T) {
+	paths, err := filepath.Glob("fixtures/*.mid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			orig, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dec := NewDecoder(bytes.NewReader(orig))
+			if err := dec.Decode(); err != nil {
+				t.Fatal(err)
+			}
+			text := &bytes.Buffer{}
+			csvEnc := NewCSVEncoder(text, dec.Format, dec.TicksPerQuarterNote)
+			csvEnc.Tracks = dec.Tracks
+			if err := csvEnc.Write(); err != nil {
+				t.Fatal(err)
+			}
+
+			csvDec := NewCSVDecoder(bytes.NewReader(text.Bytes()))
+			if err := csvDec.Decode(); err != nil {
+				t.Fatal(err)
+			}
+			if len(csvDec.Tracks) != len(dec.Tracks) {
+				t.Fatalf("expected %d tracks, got %d", len(dec.Tracks), len(csvDec.Tracks))
+			}
+			for i, tr := range csvDec.Tracks {
+				if !reflect.DeepEqual(tr.Events, dec.Tracks[i].Events) {
+					t.Fatalf("track %d events don't match the decoded events", i)
+				}
+			}
+
+			w := filebuffer.New(nil)
+			e := NewEncoder(w, csvDec.Format, csvDec.TicksPerQuarterNote)
+			e.Tracks = csvDec.Tracks
+			if err := e.Write(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(w.Buff.Bytes(), orig) {
+				t.Errorf("the encoded file doesn't match the original file")
+			}
+		})
+	}
+}
+
+func TestCSVEncoder_Write(t *testing.T) {
+	tr := &Track{}
+	tr.AddAfterDelta(0, TrackName(`Lead "1" \ é`))
+	tr.AddAfterDelta(0, TempoEvent(93.75))
+	tr.AddAfterDelta(0, KeySignatureEvent(-3, true))
+	tr.AddAfterDelta(0, SysExEvent([]byte{0x7E, 0x7F, 0x09, 0x01}))
+	tr.AddAfterDelta(0, &Event{MsgType: 0xF, Cmd: 0x21, MetaData: []byte{1}})
+	tr.AddAfterDelta(0, NoteOn(1, 60, 100))
+	ev := NoteOn(1, 64, 100)
+	ev.RunningStatus = true
+	tr.AddAfterDelta(0, ev)
+	tr.AddAfterDelta(96, PitchWheel(1, 0x3000))
+	tr.AddAfterDelta(0, NoteOff(1, 60))
+
+	buf := &bytes.Buffer{}
+	e := NewCSVEncoder(buf, SingleTrack, 96)
+	e.Tracks = []*Track{tr}
+	if err := e.Write(); err != nil {
+		t.Fatal(err)
+	}
+	want := `0, 0, Header, 0, 1, 96
+1, 0, Start_track
+1, 0, Title_t, "Lead ""1"" \\ \303\251"
+1, 0, Tempo, 640000
+1, 0, Key_signature, -3, "minor"
+1, 0, System_exclusive, 5, 126, 127, 9, 1, 247
+1, 0, MIDI_port, 1
+1, 0, Note_on_c, 1, 60, 100
+# Running_status, true
+1, 0, Note_on_c, 1, 64, 100
+1, 96, Pitch_bend_c, 1, 12288
+1, 96, Note_off_c, 1, 60, 64
+1, 96, End_track
+0, 0, End_of_file
+`
+	if got := buf.String(); got != want {
+		t.Fatalf("Write() =\n%s\nwant:\n%s", got, want)
+	}
+
+	dec := NewCSVDecoder(strings.NewReader(want))
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	events := dec.Tracks[0].Events
+	if events[0].SeqTrackName != `Lead "1" \ é` {
+		t.Errorf("unexpected track name %q", events[0].SeqTrackName)
+	}
+	if events[2].KeySignature().String() != "C minor" {
+		t.Errorf("unexpected key signature %s", events[2].KeySignature())
+	}
+	if !events[6].RunningStatus || events[5].RunningStatus {
+		t.Errorf("expected only the second note to use running status")
+	}
+	if events[7].TimeDelta != 96 || events[8].TimeDelta != 0 || events[8].AbsTicks != 96 {
+		t.Errorf("unexpected timing %d %d", events[7].TimeDelta, events[8].TimeDelta)
+	}
+}
+
+func TestCSVDecoder_Decode_errors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"unknown record", "0, 0, Header, 0, 1, 96\n1, 0, Start_track\n1, 0, Foo_c, 1\n"},
+		{"track not started", "0, 0, Header, 0, 1, 96\n2, 0, Note_on_c, 0, 60, 100\n"},
+		{"out of order", "1, 0, Start_track\n1, 10, Note_on_c, 0, 60, 100\n1, 5, Note_off_c, 0, 60, 0\n"},
+		{"invalid channel", "1, 0, Start_track\n1, 0, Note_on_c, 16, 60, 100\n"},
+		{"invalid value", "1, 0, Start_track\n1, 0, Control_c, 0, 7, 128\n"},
+		{"missing parameter", "1, 0, Start_track\n1, 0, Program_c, 0\n"},
+		{"short data", "1, 0, Start_track\n1, 0, System_exclusive, 3, 1, 2\n"},
+		{"unterminated text", "1, 0, Start_track\n1, 0, Text_t, \"abc\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewCSVDecoder(strings.NewReader(tt.text)).Decode(); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
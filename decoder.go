@@ -196,7 +196,7 @@ func (d *Decoder) parseTrack() (uint32, nextChunkType, error) {
 	if id != trackChunkID {
 		return 0, trackChunk, fmt.Errorf("%s - expected track chunk ID %v, got %v", ErrUnexpectedData, trackChunkID, id)
 	}
-	d.Tracks = append(d.Tracks, &Track{Size: size})
+	d.Tracks = append(d.Tracks, &Track{Size: size, decoded: true})
 	return size, eventChunk, nil
 }
 
@@ -43,6 +43,7 @@ func (p *Decoder) parseEvent() (nextChunkType, error) {
 		if p.lastEvent != nil && isVoiceMsgType(p.lastEvent.MsgType) {
 			e.MsgType = p.lastEvent.MsgType
 			e.MsgChan = p.lastEvent.MsgChan
+			e.RunningStatus = true
 			p.r.UnreadByte()
 		}
 	}
@@ -226,6 +227,15 @@ func (p *Decoder) parseMetaMsg(e *Event) (nextChunkType, bool, error) {
 	var err error
 	// channels aren't really channels
 	switch e.MsgChan {
+	// System exclusive event (F0) or escape sequence (F7)
+	// The data is stored with its length, a sysex event usually ends
+	// with F7.
+	case 0x0, 0x7:
+		data, _, err := p.VarLenTxt()
+		if err != nil {
+			return eventChunk, false, err
+		}
+		e.SysEx = append([]byte{}, data...)
 	case 0xF:
 		var b byte
 		if b, err = p.ReadByte(); err != nil {
@@ -249,6 +259,10 @@ func (p *Decoder) parseMetaMsg(e *Event) (nextChunkType, bool, error) {
 		// must be done as a group of format 1 files, each with a different
 		// sequence number.
 		case 0x0:
+			if len(msgBytes) != 2 {
+				e.MetaData = []byte(msgBytes)
+				break
+			}
 			e.SeqNum = binary.BigEndian.Uint16([]byte(msgBytes))
 
 		// Text Event
@@ -420,8 +434,8 @@ func (p *Decoder) parseMetaMsg(e *Event) (nextChunkType, bool, error) {
 				return eventChunk, false, fmt.Errorf("time Signature length not 2 as expected but %d", len(msgBytes))
 			}
 
-			// key
-			e.Key = int32(msgBytes[0])
+			// key, stored as a signed byte
+			e.Key = int32(int8(msgBytes[0]))
 			// scale
 			e.Scale = uint32(msgBytes[1])
 
@@ -431,12 +445,15 @@ func (p *Decoder) parseMetaMsg(e *Event) (nextChunkType, bool, error) {
 		// and the following bytes contain information specified by the manufacturer.
 		// The individual manufacturers may document this information in their respective manuals.
 		case 0x7F:
-			// Information not currently stored
-			_ = msgBytes
+			e.MetaData = []byte(msgBytes)
+
+		// MIDI port and other meta events are kept as they are so they can be
+		// encoded back
 		default:
 			if p.Debug {
-				fmt.Printf("Skipped meta cmd %#X\n", e.Cmd)
+				fmt.Printf("Raw meta cmd %#X\n", e.Cmd)
 			}
+			e.MetaData = []byte(msgBytes)
 		}
 	}
 
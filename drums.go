@@ -0,0 +1,270 @@
+package midi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// GMPercussion maps the General MIDI percussion keys to their names. Keys 35
+// to 81 are defined by GM1, keys 27 to 34 and 82 to 87 were added by GM2.
+var GMPercussion = map[uint8]string{
+	27: "High Q",
+	28: "Slap",
+	29: "Scratch Push",
+	30: "Scratch Pull",
+	31: "Sticks",
+	32: "Square Click",
+	33: "Metronome Click",
+	34: "Metronome Bell",
+	35: "Acoustic Bass Drum",
+	36: "Bass Drum 1",
+	37: "Side Stick",
+	38: "Acoustic Snare",
+	39: "Hand Clap",
+	40: "Electric Snare",
+	41: "Low Floor Tom",
+	42: "Closed Hi-Hat",
+	43: "High Floor Tom",
+	44: "Pedal Hi-Hat",
+	45: "Low Tom",
+	46: "Open Hi-Hat",
+	47: "Low-Mid Tom",
+	48: "Hi-Mid Tom",
+	49: "Crash Cymbal 1",
+	50: "High Tom",
+	51: "Ride Cymbal 1",
+	52: "Chinese Cymbal",
+	53: "Ride Bell",
+	54: "Tambourine",
+	55: "Splash Cymbal",
+	56: "Cowbell",
+	57: "Crash Cymbal 2",
+	58: "Vibraslap",
+	59: "Ride Cymbal 2",
+	60: "Hi Bongo",
+	61: "Low Bongo",
+	62: "Mute Hi Conga",
+	63: "Open Hi Conga",
+	64: "Low Conga",
+	65: "High Timbale",
+	66: "Low Timbale",
+	67: "High Agogo",
+	68: "Low Agogo",
+	69: "Cabasa",
+	70: "Maracas",
+	71: "Short Whistle",
+	72: "Long Whistle",
+	73: "Short Guiro",
+	74: "Long Guiro",
+	75: "Claves",
+	76: "Hi Wood Block",
+	77: "Low Wood Block",
+	78: "Mute Cuica",
+	79: "Open Cuica",
+	80: "Mute Triangle",
+	81: "Open Triangle",
+	82: "Shaker",
+	83: "Jingle Bell",
+	84: "Bell Tree",
+	85: "Castanets",
+	86: "Mute Surdo",
+	87: "Open Surdo",
+}
+
+// PercussionName returns the General MIDI name of the percussion key or an
+// empty string if the key isn't assigned.
+func PercussionName(note int) string {
+	if note < 0 || note > 127 {
+		return ""
+	}
+	return GMPercussion[uint8(note)]
+}
+
+// PercussionKey returns the key of a General MIDI percussion instrument by
+// name (case insensitive) and false if the name isn't known.
+func PercussionKey(name string) (int, bool) {
+	for k, n := range GMPercussion {
+		if strings.EqualFold(n, strings.TrimSpace(name)) {
+			return int(k), true
+		}
+	}
+	return 0, false
+}
+
+// DrumMap remaps percussion notes from one drum kit layout to another, for
+// instance from the GM layout to a drum machine's layout.
+type DrumMap struct {
+	Name string
+	// Notes maps the source notes to the destination notes.
+	Notes map[uint8]uint8
+	// DropUnmapped indicates that notes without a mapping should be removed
+	// instead of being kept as is.
+	DropUnmapped bool
+	// Standard is the bank standard used to find the percussion channels of
+	// a track. With GM1Bank (the default) only channel 10 is considered to
+	// be a percussion channel.
+	Standard BankStandard
+}
+
+// drumMapJSON is the JSON representation of a drum map. Source notes can be
+// note numbers or GM percussion names.
+type drumMapJSON struct {
+	Name         string         `json:"name,omitempty"`
+	DropUnmapped bool           `json:"drop_unmapped,omitempty"`
+	Notes        map[string]int `json:"notes"`
+}
+
+// ReadDrumMap reads a drum map from a JSON or a text document. The JSON format
+// is an object with a "name" and a "notes" object mapping the source notes to
+// the destination notes:
+//
+//	{"name": "GM to TR", "notes": {"36": 60, "Acoustic Snare": 62}}
+//
+// The text format has one mapping per line, notes are separated by an equal
+// sign, lines starting with # are comments and the optional name line starts
+// with "name:":
+//
+//	name: GM to TR
+//	36 = 60
+//	Acoustic Snare = 62
+//
+// Source and destination notes can be note numbers or GM percussion names.
+func ReadDrumMap(r io.Reader) (*DrumMap, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return parseDrumMapJSON(trimmed)
+	}
+	return parseDrumMapText(data)
+}
+
+func parseDrumMapJSON(data []byte) (*DrumMap, error) {
+	var raw drumMapJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	m := &DrumMap{Name: raw.Name, DropUnmapped: raw.DropUnmapped, Notes: map[uint8]uint8{}}
+	for src, dst := range raw.Notes {
+		from, err := parseDrumNote(src)
+		if err != nil {
+			return nil, err
+		}
+		if dst < 0 || dst > 127 {
+			return nil, fmt.Errorf("invalid drum map destination note %d for %s", dst, src)
+		}
+		m.Notes[from] = uint8(dst)
+	}
+	return m, nil
+}
+
+func parseDrumMapText(data []byte) (*DrumMap, error) {
+	m := &DrumMap{Notes: map[uint8]uint8{}}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	var lineNum int
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(line), "name:") {
+			m.Name = strings.TrimSpace(line[len("name:"):])
+			continue
+		}
+		parts := strings.Split(line, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("drum map line %d: expected <note> = <note>, got %q", lineNum, line)
+		}
+		from, err := parseDrumNote(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("drum map line %d: %v", lineNum, err)
+		}
+		to, err := parseDrumNote(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("drum map line %d: %v", lineNum, err)
+		}
+		m.Notes[from] = to
+	}
+	return m, scanner.Err()
+}
+
+// parseDrumNote converts a note number or a GM percussion name into a note.
+func parseDrumNote(s string) (uint8, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n > 127 {
+			return 0, fmt.Errorf("note %d out of range", n)
+		}
+		return uint8(n), nil
+	}
+	if n, ok := PercussionKey(s); ok {
+		return uint8(n), nil
+	}
+	return 0, fmt.Errorf("unknown drum note %q", s)
+}
+
+// Map returns the note the passed note maps to. If the note isn't mapped, the
+// note is returned as is unless the map drops unmapped notes in which case
+// false is returned.
+func (m *DrumMap) Map(note uint8) (uint8, bool) {
+	if m == nil {
+		return note, true
+	}
+	if to, ok := m.Notes[note]; ok {
+		return to, true
+	}
+	return note, !m.DropUnmapped
+}
+
+// Apply returns a copy of the track where the notes played on percussion
+// channels are remapped. Notes on the other channels aren't modified.
+func (m *DrumMap) Apply(track *Track) *Track {
+	cc := track.Copy()
+	if cc == nil || m == nil {
+		return cc
+	}
+	programs := cc.Programs(m.Standard)
+	isDrum := func(channel uint8, tick uint64) bool {
+		drums := LookupInstrument(m.Standard, channel, 0, 0, 0).Drums
+		for _, state := range programs {
+			if state.Tick > tick {
+				break
+			}
+			if state.Channel == channel {
+				drums = state.Drums
+			}
+		}
+		return drums
+	}
+
+	events := make([]*Event, 0, len(cc.Events))
+	var tick uint64
+	var carry uint32
+	for _, ev := range cc.Events {
+		tick += uint64(ev.TimeDelta)
+		switch ev.MsgType {
+		case EventByteMap["NoteOn"], EventByteMap["NoteOff"], EventByteMap["AfterTouch"]:
+			if isDrum(ev.MsgChan, tick) {
+				note, ok := m.Map(ev.Note)
+				if !ok {
+					carry += ev.TimeDelta
+					continue
+				}
+				ev.Note = note
+			}
+		}
+		ev.TimeDelta += carry
+		carry = 0
+		events = append(events, ev)
+	}
+	cc.Events = events
+	return cc
+}
@@ -0,0 +1,102 @@
+package midi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPercussionName(t *testing.T) {
+	tests := []struct {
+		note int
+		want string
+	}{
+		{note: 27, want: "High Q"},
+		{note: 36, want: "Bass Drum 1"},
+		{note: 42, want: "Closed Hi-Hat"},
+		{note: 81, want: "Open Triangle"},
+		{note: 87, want: "Open Surdo"},
+		{note: 88, want: ""},
+		{note: -1, want: ""},
+	}
+	for _, tt := range tests {
+		if got := PercussionName(tt.note); got != tt.want {
+			t.Errorf("PercussionName(%d) = %q, want %q", tt.note, got, tt.want)
+		}
+	}
+	if k, ok := PercussionKey("acoustic snare"); !ok || k != 38 {
+		t.Errorf("PercussionKey() = %d, %v", k, ok)
+	}
+	if ev := NoteOn(9, 38, 100); !strings.HasSuffix(ev.String(), "Note: Acoustic Snare") {
+		t.Errorf("unexpected drum event string %q", ev.String())
+	}
+}
+
+func TestReadDrumMap(t *testing.T) {
+	want := &DrumMap{Name: "GM to TR", Notes: map[uint8]uint8{36: 60, 38: 62, 42: 64}}
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{name: "text", doc: `
+# comment
+name: GM to TR
+36 = 60
+Acoustic Snare = 62
+closed hi-hat = 64
+`},
+		{name: "json", doc: `{"name": "GM to TR", "notes": {"36": 60, "Acoustic Snare": 62, "42": 64}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadDrumMap(strings.NewReader(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ReadDrumMap() = %+v, want %+v", got, want)
+			}
+		})
+	}
+	if _, err := ReadDrumMap(strings.NewReader("36 -> 60")); err == nil {
+		t.Error("expected an error parsing an invalid line")
+	}
+	if _, err := ReadDrumMap(strings.NewReader("Cowbellz = 60")); err == nil {
+		t.Error("expected an error parsing an unknown drum name")
+	}
+}
+
+func TestDrumMap_Apply(t *testing.T) {
+	tr := &Track{}
+	tr.AddAfterDelta(0, NoteOn(9, 36, 100))
+	tr.AddAfterDelta(0, NoteOn(0, 36, 100))
+	tr.AddAfterDelta(10, NoteOn(9, 49, 100))
+	tr.AddAfterDelta(86, NoteOff(9, 36))
+	tr.AddAfterDelta(0, NoteOff(0, 36))
+	tr.AddAfterDelta(0, NoteOff(9, 49))
+
+	m := &DrumMap{Notes: map[uint8]uint8{36: 60}}
+	got := m.Apply(tr)
+	wantNotes := []uint8{60, 36, 49, 60, 36, 49}
+	for i, ev := range got.Events {
+		if ev.Note != wantNotes[i] {
+			t.Errorf("[%d] expected note %d, got %d", i, wantNotes[i], ev.Note)
+		}
+	}
+
+	m.DropUnmapped = true
+	got = m.Apply(tr)
+	wantNotes = []uint8{60, 36, 60, 36}
+	wantDeltas := []uint32{0, 0, 96, 0}
+	if len(got.Events) != len(wantNotes) {
+		t.Fatalf("expected %d events, got %d", len(wantNotes), len(got.Events))
+	}
+	for i, ev := range got.Events {
+		if ev.Note != wantNotes[i] || ev.TimeDelta != wantDeltas[i] {
+			t.Errorf("[%d] expected note %d @ %d, got %d @ %d", i, wantNotes[i], wantDeltas[i], ev.Note, ev.TimeDelta)
+		}
+	}
+	if tr.Events[0].Note != 36 {
+		t.Fatal("the original track should not be modified")
+	}
+}
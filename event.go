@@ -3,9 +3,7 @@ package midi
 import (
 	"bytes"
 	"encoding/binary"
-	"errors"
 	"fmt"
-	"log"
 )
 
 // NoteOn returns a pointer to a new event of type NoteOn (without the delta timing data)
@@ -70,12 +68,38 @@ func ControlChange(channel, controller, newVal int) *Event {
 
 // ProgramChange sets a new value the same way as ControlChange
 // but implements Mode control and special message by using reserved controller numbers 120-127.
+// The new value is also used as the program number, which is the only data
+// byte encoded.
+//
+// Deprecated: use ProgramSelect, the controller isn't part of a program
+// change message.
 func ProgramChange(channel, controller, newVal int) *Event {
 	return &Event{
 		MsgChan:    uint8(channel),
 		MsgType:    uint8(EventByteMap["ProgramChange"]),
 		Controller: uint8(controller),
 		NewValue:   uint8(newVal),
+		NewProgram: uint8(newVal),
+	}
+}
+
+// ProgramSelect selects a new program (patch) on the channel. The program
+// number is between 0-127, see GMInstruments for the General MIDI names. Use
+// BankSelect before the program change to pick a program in another bank.
+func ProgramSelect(channel, program int) *Event {
+	return &Event{
+		MsgChan:    uint8(channel),
+		MsgType:    uint8(EventByteMap["ProgramChange"]),
+		NewProgram: uint8(program),
+	}
+}
+
+// BankSelect returns the bank select MSB (CC0) and LSB (CC32) control changes
+// selecting a bank for the next program change on the channel.
+func BankSelect(channel, msb, lsb int) []*Event {
+	return []*Event{
+		ControlChange(channel, CCVals["Bank Select"], msb),
+		ControlChange(channel, CCVals["Control 0 Bank Select"], lsb),
 	}
 }
 
@@ -90,11 +114,29 @@ func ChannelAfterTouch(channel, vel int) *Event {
 
 // PitchWheelChange is sent to indicate a change in the pitch bender.
 // The possible value goes between 0 and 16383 where 8192 is the center.
-func PitchWheelChange(channel, int, val int) *Event {
+// The second argument is ignored.
+//
+// Deprecated: use PitchWheel, which doesn't take the unused argument.
+func PitchWheelChange(channel, _ int, val int) *Event {
+	return PitchWheel(channel, val)
+}
+
+// PitchWheel is sent to indicate a change in the pitch bender. The value
+// goes between 0 and 16383 where 8192 is the center, values out of range are
+// clamped. See PitchBendSemitones and PitchBendCents to express the bend as a
+// pitch.
+func PitchWheel(channel, val int) *Event {
+	if val < 0 {
+		val = 0
+	}
+	if val > PitchBendMax {
+		val = PitchBendMax
+	}
 	return &Event{
 		MsgChan:      uint8(channel),
 		MsgType:      uint8(EventByteMap["PitchWheelChange"]),
 		AbsPitchBend: uint16(val),
+		RelPitchBend: int16(val - PitchBendCenter),
 	}
 }
 
@@ -109,7 +151,7 @@ func CopyrightEvent(txt string) *Event {
 
 // TempoEvent returns a new tempo event of the passed value.
 func TempoEvent(bpmF float64) *Event {
-	ms := uint32(60000000 / bpmF)
+	ms := BPMToMicros(bpmF)
 
 	// bpm is expressed in in microseconds per MIDI quarter-note
 	// This event indicates a tempo change.  Another way of putting
@@ -124,11 +166,7 @@ func TempoEvent(bpmF float64) *Event {
 	// increase the likelihood, of compatibility with other synchronization
 	// devices so that a time signature/tempo map stored in this format may
 	// easily be transferred to another device.
-	return &Event{
-		MsgType:        uint8(EventByteMap["Meta"]),
-		Cmd:            uint8(MetaByteMap["Tempo"]),
-		MsPerQuartNote: ms,
-	}
+	return TempoEventMicros(ms)
 }
 
 // TODO
@@ -179,12 +217,25 @@ type Event struct {
 	Scale uint32 // 0 or 1
 	//
 	SmpteOffset *SmpteOffset
+	// SysEx holds the data of a system exclusive event (F0) or of an escape
+	// sequence (F7), as stored in the file: the bytes following the status
+	// byte and the length, usually ending with F7.
+	SysEx []byte
+	// MetaData holds the raw data of the meta events which aren't decoded
+	// into a dedicated field (MIDI port, sequencer specific...), it's used
+	// instead of the decoded fields when set.
+	MetaData []byte
+	// RunningStatus indicates that the status byte of the channel event was
+	// omitted because it's the same as the previous event's (running status).
+	// The encoder only omits the status byte of these events.
+	RunningStatus bool
 }
 
 // Copy returns an exact copy of the event
 func (e *Event) Copy() *Event {
 	newEv := &Event{
 		TimeDelta:    e.TimeDelta,
+		AbsTicks:     e.AbsTicks,
 		MsgType:      e.MsgType,
 		MsgChan:      e.MsgChan,
 		Note:         e.Note,
@@ -210,6 +261,7 @@ func (e *Event) Copy() *Event {
 		Bpm:            e.Bpm,
 		Key:            e.Key,
 		Scale:          e.Scale,
+		RunningStatus:  e.RunningStatus,
 	}
 	if e.TimeSignature != nil {
 		newEv.TimeSignature = &TimeSignature{
@@ -219,6 +271,12 @@ func (e *Event) Copy() *Event {
 			ThirtySecondNotesPerQuarter: e.TimeSignature.ThirtySecondNotesPerQuarter,
 		}
 	}
+	if e.SysEx != nil {
+		newEv.SysEx = append([]byte{}, e.SysEx...)
+	}
+	if e.MetaData != nil {
+		newEv.MetaData = append([]byte{}, e.MetaData...)
+	}
 	if e.SmpteOffset != nil {
 		newEv.SmpteOffset = &SmpteOffset{
 			Hour:  e.SmpteOffset.Hour,
@@ -246,11 +304,22 @@ func (e *Event) String() string {
 		out += fmt.Sprintf(" Vel: %d", e.Velocity)
 	}
 	if e.MsgType == EventByteMap["NoteOn"] || e.MsgType == EventByteMap["NoteOff"] {
-		out += fmt.Sprintf(" Note: %s", NoteToName(int(e.Note)))
+		name := NoteToName(int(e.Note))
+		// percussion notes are named after their instrument
+		if perc := PercussionName(int(e.Note)); e.MsgChan == drumChannel && perc != "" {
+			name = perc
+		}
+		out += fmt.Sprintf(" Note: %s", name)
 	}
 	if e.MsgType == EventByteMap["ControlChange"] {
 		out += fmt.Sprintf(" - %s - Value: %d", CCNames[e.Controller], e.NewValue)
 	}
+	if e.MsgType == EventByteMap["ProgramChange"] {
+		out += fmt.Sprintf(" Program: %d", e.NewProgram)
+	}
+	if e.IsSysEx() {
+		return fmt.Sprintf("Ch %d @ %d (%d) \tSysEx -> % X", e.MsgChan, e.TimeDelta, e.AbsTicks, e.SysEx)
+	}
 	if e.Cmd != 0 {
 		out = fmt.Sprintf("Ch %d @ %d (%d) \t%s", e.MsgChan, e.TimeDelta, e.AbsTicks, MetaCmdMap[e.Cmd])
 		switch e.Cmd {
@@ -261,7 +330,9 @@ func (e *Event) String() string {
 		case MetaByteMap["Copyright"]:
 			out = fmt.Sprintf("%s -> %s", out, e.Copyright)
 		case MetaByteMap["Tempo"]:
-			out = fmt.Sprintf("%s -> %d", out, e.Bpm)
+			out = fmt.Sprintf("%s -> %g", out, e.BPM())
+		case MetaByteMap["Key Signature"]:
+			out = fmt.Sprintf("%s -> %s", out, e.KeySignature())
 		}
 	}
 
@@ -277,7 +348,7 @@ func (e *Event) Encode() ([]byte, error) {
 
 	// msg type and chan are stored together
 	msgData := []byte{(e.MsgType << 4) | e.MsgChan}
-	if e.MsgType == EventByteMap["Meta"] {
+	if e.MsgType == EventByteMap["Meta"] && !e.IsSysEx() {
 		msgData = []byte{0xFF}
 	}
 	if _, err := buff.Write(msgData); err != nil {
@@ -344,12 +415,10 @@ func (e *Event) Encode() ([]byte, error) {
 					This message sent when the patch number changes. Value is the new program number.
 		*/
 	case 0xC:
+		// program changes only have 1 data byte
 		if err := binary.Write(buff, binary.BigEndian, e.NewProgram); err != nil {
 			return buff.Bytes(), err
 		}
-		if err := binary.Write(buff, binary.BigEndian, e.NewValue); err != nil {
-			return buff.Bytes(), err
-		}
 		// Channel Pressure (Aftertouch)
 		// This message is most often sent by pressing down on the key after it "bottoms out".
 		// This message is different from polyphonic after-touch.
@@ -381,40 +450,25 @@ func (e *Event) Encode() ([]byte, error) {
 		// or number of bytes that will contain data (nn), and the actual data (dd).
 		// meta_event = 0xFF + <meta_type> + <v_length> + <event_data_bytes>
 	case 0xF:
-		if err := binary.Write(buff, binary.BigEndian, e.Cmd); err != nil {
-			return buff.Bytes(), err
-		}
-		switch e.Cmd {
-		// Copyright Notice
-		case 0x02:
-			copyright := []byte(e.Copyright)
-			if err := binary.Write(buff, binary.BigEndian, EncodeVarint(uint32(len(copyright)))); err != nil {
+		// sysex_event = 0xF0|0xF7 + <v_length> + <data_bytes>
+		if e.IsSysEx() {
+			if _, err := buff.Write(EncodeVarint(uint32(len(e.SysEx)))); err != nil {
 				return buff.Bytes(), err
 			}
-			if err := binary.Write(buff, binary.BigEndian, copyright); err != nil {
-				return buff.Bytes(), err
-			}
-		// track name
-		case 0x03:
-			name := []byte(e.SeqTrackName)
-			if err := binary.Write(buff, binary.BigEndian, EncodeVarint(uint32(len(name)))); err != nil {
-				return buff.Bytes(), err
-			}
-			if err := binary.Write(buff, binary.BigEndian, name); err != nil {
-				return buff.Bytes(), err
-			}
-		// BPM / tempo event
-		case 0x51:
-			if err := binary.Write(buff, binary.BigEndian, EncodeVarint(3)); err != nil {
-				return buff.Bytes(), err
-			}
-			if err := binary.Write(buff, binary.BigEndian, Uint24(e.MsPerQuartNote)); err != nil {
-				return buff.Bytes(), err
-			}
-		case 0x2f: // end of track
-			if err := buff.WriteByte(0x0); err != nil {
+			if _, err := buff.Write(e.SysEx); err != nil {
 				return buff.Bytes(), err
 			}
+			break
+		}
+		if err := binary.Write(buff, binary.BigEndian, e.Cmd); err != nil {
+			return buff.Bytes(), err
+		}
+		data := e.metaData()
+		if _, err := buff.Write(EncodeVarint(uint32(len(data)))); err != nil {
+			return buff.Bytes(), err
+		}
+		if _, err := buff.Write(data); err != nil {
+			return buff.Bytes(), err
 		}
 	default:
 		return buff.Bytes(), fmt.Errorf("didn't encode %#v because didn't know how to", e)
@@ -432,31 +486,71 @@ func (e *Event) Size() uint32 {
 	case 0x8, 0x9, 0xA, 0xB, 0xE:
 		return 2
 	case 0xF:
-		// meta event
-		switch e.Cmd {
-		// Copyright Notice
-		case 0x02:
-			copyright := []byte(e.Copyright)
-			varintBytes := EncodeVarint(uint32(len(copyright)))
-			return uint32(len(copyright) + len(varintBytes))
-			// BPM (size + encoded in uint24)
-		// track name
-		case 0x03:
-			name := []byte(e.SeqTrackName)
-			varintBytes := EncodeVarint(uint32(len(name)))
-			return uint32(len(name) + len(varintBytes))
-		case 0x51: // tempo
-			return 4
-		case 0x2f: // end of track
-			return 1
-		default:
-			// NOT currently support, blowing up on purpose
-			log.Fatal(errors.New("can't encode this meta event, it is not supported yet"))
+		if e.IsSysEx() {
+			return uint32(len(EncodeVarint(uint32(len(e.SysEx)))) + len(e.SysEx))
 		}
+		// meta event
+		data := e.metaData()
+		return uint32(len(EncodeVarint(uint32(len(data)))) + len(data))
 	}
 	return 0
 }
 
+// metaData returns the data of a meta event as stored in the file after its
+// length. The raw MetaData is used when set.
+func (e *Event) metaData() []byte {
+	if e.MetaData != nil {
+		return e.MetaData
+	}
+	switch e.Cmd {
+	// sequence number
+	case 0x00:
+		return []byte{byte(e.SeqNum >> 8), byte(e.SeqNum)}
+	case 0x01:
+		return []byte(e.Text)
+	case 0x02:
+		return []byte(e.Copyright)
+	case 0x03:
+		return []byte(e.SeqTrackName)
+	case 0x04:
+		return []byte(e.InstrumentName)
+	case 0x05:
+		return []byte(e.Lyric)
+	case 0x06:
+		return []byte(e.Marker)
+	case 0x07:
+		return []byte(e.CuePoint)
+	// MIDI channel prefix
+	case 0x20:
+		return []byte{e.Channel}
+	// tempo
+	case 0x51:
+		return Uint24(e.MsPerQuartNote)
+	// SMPTE offset
+	case 0x54:
+		if o := e.SmpteOffset; o != nil {
+			return []byte{o.Hour, o.Min, o.Sec, o.Fr, o.SubFr}
+		}
+		return []byte{0, 0, 0, 0, 0}
+	// time signature, 4/4 is assumed if not set
+	case 0x58:
+		if ts := e.TimeSignature; ts != nil {
+			return []byte{ts.Numerator, ts.Denominator, ts.ClocksPerTick, ts.ThirtySecondNotesPerQuarter}
+		}
+		return []byte{0x04, 0x02, 0x18, 0x08}
+	// key signature
+	case 0x59:
+		ks := e.KeySignature()
+		var mi byte
+		if ks.Minor {
+			mi = 1
+		}
+		return []byte{byte(ks.Key), mi}
+	}
+	// end of track and unknown events without raw data
+	return []byte{}
+}
+
 // isVoiceMsgType whether b corresponds to a voice message tyoe
 func isVoiceMsgType(b byte) bool {
 	// Channel Voice Messages are used to send musical performance information. The messages in
@@ -23,3 +23,26 @@ func TestEventString(t *testing.T) {
 		t.Errorf("Expected '%s' got '%s'", expect, str)
 	}
 }
+
+func TestProgramChange_Encode(t *testing.T) {
+	testCases := []struct {
+		name string
+		ev   *Event
+	}{
+		{"ProgramSelect", ProgramSelect(2, 24)},
+		{"ProgramChange", ProgramChange(2, 0, 24)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := tc.ev.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// delta time, status byte and a single data byte
+			expected := []byte{0x00, 0xC2, 0x18}
+			if !reflect.DeepEqual(data, expected) {
+				t.Errorf("Expected %#v got %#v", expected, data)
+			}
+		})
+	}
+}
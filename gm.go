@@ -0,0 +1,315 @@
+package midi
+
+// GMInstruments lists the General MIDI level 1 instrument names indexed by
+// program number (zero indexed).
+var GMInstruments = [128]string{
+	// Piano
+	"Acoustic Grand Piano", "Bright Acoustic Piano", "Electric Grand Piano", "Honky-tonk Piano",
+	"Electric Piano 1", "Electric Piano 2", "Harpsichord", "Clavi",
+	// Chromatic Percussion
+	"Celesta", "Glockenspiel", "Music Box", "Vibraphone",
+	"Marimba", "Xylophone", "Tubular Bells", "Dulcimer",
+	// Organ
+	"Drawbar Organ", "Percussive Organ", "Rock Organ", "Church Organ",
+	"Reed Organ", "Accordion", "Harmonica", "Tango Accordion",
+	// Guitar
+	"Acoustic Guitar (nylon)", "Acoustic Guitar (steel)", "Electric Guitar (jazz)", "Electric Guitar (clean)",
+	"Electric Guitar (muted)", "Overdriven Guitar", "Distortion Guitar", "Guitar Harmonics",
+	// Bass
+	"Acoustic Bass", "Electric Bass (finger)", "Electric Bass (pick)", "Fretless Bass",
+	"Slap Bass 1", "Slap Bass 2", "Synth Bass 1", "Synth Bass 2",
+	// Strings
+	"Violin", "Viola", "Cello", "Contrabass",
+	"Tremolo Strings", "Pizzicato Strings", "Orchestral Harp", "Timpani",
+	// Ensemble
+	"String Ensemble 1", "String Ensemble 2", "SynthStrings 1", "SynthStrings 2",
+	"Choir Aahs", "Voice Oohs", "Synth Voice", "Orchestra Hit",
+	// Brass
+	"Trumpet", "Trombone", "Tuba", "Muted Trumpet",
+	"French Horn", "Brass Section", "SynthBrass 1", "SynthBrass 2",
+	// Reed
+	"Soprano Sax", "Alto Sax", "Tenor Sax", "Baritone Sax",
+	"Oboe", "English Horn", "Bassoon", "Clarinet",
+	// Pipe
+	"Piccolo", "Flute", "Recorder", "Pan Flute",
+	"Blown Bottle", "Shakuhachi", "Whistle", "Ocarina",
+	// Synth Lead
+	"Lead 1 (square)", "Lead 2 (sawtooth)", "Lead 3 (calliope)", "Lead 4 (chiff)",
+	"Lead 5 (charang)", "Lead 6 (voice)", "Lead 7 (fifths)", "Lead 8 (bass + lead)",
+	// Synth Pad
+	"Pad 1 (new age)", "Pad 2 (warm)", "Pad 3 (polysynth)", "Pad 4 (choir)",
+	"Pad 5 (bowed)", "Pad 6 (metallic)", "Pad 7 (halo)", "Pad 8 (sweep)",
+	// Synth Effects
+	"FX 1 (rain)", "FX 2 (soundtrack)", "FX 3 (crystal)", "FX 4 (atmosphere)",
+	"FX 5 (brightness)", "FX 6 (goblins)", "FX 7 (echoes)", "FX 8 (sci-fi)",
+	// Ethnic
+	"Sitar", "Banjo", "Shamisen", "Koto",
+	"Kalimba", "Bag pipe", "Fiddle", "Shanai",
+	// Percussive
+	"Tinkle Bell", "Agogo", "Steel Drums", "Woodblock",
+	"Taiko Drum", "Melodic Tom", "Synth Drum", "Reverse Cymbal",
+	// Sound Effects
+	"Guitar Fret Noise", "Breath Noise", "Seashore", "Bird Tweet",
+	"Telephone Ring", "Helicopter", "Applause", "Gunshot",
+}
+
+// GMFamilies lists the General MIDI instrument families. Each family groups 8
+// consecutive programs.
+var GMFamilies = [16]string{
+	"Piano", "Chromatic Percussion", "Organ", "Guitar",
+	"Bass", "Strings", "Ensemble", "Brass",
+	"Reed", "Pipe", "Synth Lead", "Synth Pad",
+	"Synth Effects", "Ethnic", "Percussive", "Sound Effects",
+}
+
+// GM2Variations lists the General MIDI level 2 melodic variations indexed by
+// program number (zero indexed) and bank select LSB. The variation 0 of each
+// program is the GM1 instrument and isn't listed here.
+var GM2Variations = map[[2]uint8]string{
+	{0, 1}: "Wide Acoustic Grand", {0, 2}: "Dark Acoustic Grand",
+	{1, 1}: "Wide Bright Acoustic",
+	{2, 1}: "Wide Electric Grand",
+	{3, 1}: "Wide Honky-tonk",
+	{4, 1}: "Detuned Electric Piano 1", {4, 2}: "Electric Piano 1 Variation", {4, 3}: "60's Electric Piano",
+	{5, 1}: "Detuned Electric Piano 2", {5, 2}: "Electric Piano 2 Variation", {5, 3}: "Legend Electric Piano", {5, 4}: "Phase Electric Piano",
+	{6, 1}: "Coupled Harpsichord", {6, 2}: "Wide Harpsichord", {6, 3}: "Open Harpsichord",
+	{7, 1}:  "Pulse Clavi",
+	{11, 1}: "Wet Vibraphone",
+	{12, 1}: "Wide Marimba",
+	{14, 1}: "Church Bell", {14, 2}: "Carillon",
+	{16, 1}: "Detuned Drawbar Organ", {16, 2}: "Italian 60's Organ", {16, 3}: "Drawbar Organ 2",
+	{17, 1}: "Detuned Percussive Organ", {17, 2}: "Percussive Organ 2",
+	{19, 1}: "Church Organ (octave mix)", {19, 2}: "Detuned Church Organ",
+	{20, 1}: "Puff Organ",
+	{21, 1}: "Accordion 2",
+	{24, 1}: "Ukulele", {24, 2}: "Open Nylon Guitar", {24, 3}: "Nylon Guitar 2",
+	{25, 1}: "12-Strings Guitar", {25, 2}: "Mandolin", {25, 3}: "Steel Guitar with Body Sound",
+	{26, 1}: "Pedal Steel Guitar",
+	{27, 1}: "Detuned Clean Electric Guitar", {27, 2}: "Mid Tone Guitar",
+	{28, 1}: "Funk Guitar", {28, 2}: "Funk Guitar 2", {28, 3}: "Jazz Man",
+	{29, 1}: "Guitar Pinch",
+	{30, 1}: "Distortion Guitar (with feedback)", {30, 2}: "Distortion Rhythm Guitar",
+	{31, 1}: "Guitar Feedback",
+	{33, 1}: "Finger Slap Bass",
+	{38, 1}: "Synth Bass (warm)", {38, 2}: "Synth Bass 3 (resonance)", {38, 3}: "Clavi Bass", {38, 4}: "Hammer",
+	{39, 1}: "Synth Bass 4 (attack)", {39, 2}: "Synth Bass (rubber)", {39, 3}: "Attack Pulse",
+	{40, 1}: "Violin (slow attack)",
+	{46, 1}: "Yang Chin",
+	{48, 1}: "Strings and Brass", {48, 2}: "60s Strings",
+	{50, 1}: "Synth Strings 3",
+	{52, 1}: "Choir Aahs 2",
+	{53, 1}: "Humming",
+	{54, 1}: "Analog Voice",
+	{55, 1}: "Bass Hit Plus", {55, 2}: "6th Hit", {55, 3}: "Euro Hit",
+	{56, 1}: "Dark Trumpet Soft",
+	{57, 1}: "Trombone 2", {57, 2}: "Bright Trombone",
+	{59, 1}: "Muted Trumpet 2",
+	{60, 1}: "French Horn 2 (warm)",
+	{61, 1}: "Brass Section 2 (octave mix)",
+	{62, 1}: "Synth Brass 3", {62, 2}: "Analog Synth Brass 1", {62, 3}: "Jump Brass",
+	{63, 1}: "Synth Brass 4", {63, 2}: "Analog Synth Brass 2",
+	{80, 1}: "Lead 1a (square 2)", {80, 2}: "Lead 1b (sine)",
+	{81, 1}: "Lead 2a (sawtooth 2)", {81, 2}: "Lead 2b (saw + pulse)", {81, 3}: "Lead 2c (double sawtooth)", {81, 4}: "Lead 2d (sequenced analog)",
+	{84, 1}:  "Lead 5a (wire lead)",
+	{87, 1}:  "Lead 8a (soft wrl)",
+	{89, 1}:  "Pad 2a (sine pad)",
+	{91, 1}:  "Pad 4a (itopia)",
+	{98, 1}:  "FX 3a (synth mallet)",
+	{102, 1}: "FX 7a (echo bell)", {102, 2}: "FX 7b (echo pan)",
+	{104, 1}: "Sitar 2 (bend)",
+	{107, 1}: "Taisho Koto",
+	{115, 1}: "Castanets",
+	{116, 1}: "Concert Bass Drum",
+	{117, 1}: "Melodic Tom 2 (power)",
+	{118, 1}: "Rhythm Box Tom", {118, 2}: "Electric Drum",
+	{120, 1}: "Guitar Cutting Noise", {120, 2}: "Acoustic Bass String Slap",
+	{121, 1}: "Flute Key Click",
+	{122, 1}: "Rain", {122, 2}: "Thunder", {122, 3}: "Wind", {122, 4}: "Stream", {122, 5}: "Bubble",
+	{123, 1}: "Dog", {123, 2}: "Horse Gallop", {123, 3}: "Bird Tweet 2",
+	{124, 1}: "Telephone Ring 2", {124, 2}: "Door Creaking", {124, 3}: "Door", {124, 4}: "Scratch", {124, 5}: "Wind Chime",
+	{125, 1}: "Car Engine", {125, 2}: "Car Stop", {125, 3}: "Car Pass", {125, 4}: "Car Crash", {125, 5}: "Siren",
+	{125, 6}: "Train", {125, 7}: "Jetplane", {125, 8}: "Starship", {125, 9}: "Burst Noise",
+	{126, 1}: "Laughing", {126, 2}: "Screaming", {126, 3}: "Punch", {126, 4}: "Heart Beat", {126, 5}: "Footsteps",
+	{127, 1}: "Machine Gun", {127, 2}: "Lasergun", {127, 3}: "Explosion",
+}
+
+// GMDrumKits lists the GM2/GS drum kits indexed by program number. GM1 only
+// defines the standard kit.
+var GMDrumKits = map[uint8]string{
+	0:   "Standard Kit",
+	8:   "Room Kit",
+	16:  "Power Kit",
+	24:  "Electronic Kit",
+	25:  "Analog Kit",
+	32:  "Jazz Kit",
+	40:  "Brush Kit",
+	48:  "Orchestra Kit",
+	56:  "SFX Kit",
+	127: "CM-64/CM-32L Kit",
+}
+
+// XGDrumKits lists the XG drum kits (bank MSB 127) indexed by program number.
+var XGDrumKits = map[uint8]string{
+	0:  "Standard Kit",
+	1:  "Standard Kit 2",
+	8:  "Room Kit",
+	16: "Rock Kit",
+	24: "Electro Kit",
+	25: "Analog Kit",
+	32: "Jazz Kit",
+	40: "Brush Kit",
+	48: "Classic Kit",
+}
+
+// XGSFXKits lists the XG SFX kits (bank MSB 126) indexed by program number.
+var XGSFXKits = map[uint8]string{
+	0: "SFX Kit 1",
+	1: "SFX Kit 2",
+}
+
+// BankStandard is the convention used by a synth to interpret bank select
+// messages.
+type BankStandard int
+
+const (
+	// GM1Bank ignores bank selects, channel 10 is the drum channel.
+	GM1Bank BankStandard = iota
+	// GM2Bank uses the MSB 121 melodic bank with variations as the LSB and
+	// the MSB 120 rhythm bank.
+	GM2Bank
+	// GSBank selects the variations with the MSB (Roland GS), channel 10 is
+	// the drum channel. The variations aren't listed, they are named after
+	// their GM capital tone.
+	GSBank
+	// XGBank selects the melodic variations with the LSB, named after their
+	// GM instrument, and uses MSB 127 for drum kits, 126 for SFX kits and 64
+	// for SFX voices (Yamaha XG).
+	XGBank
+)
+
+// drumChannel is the zero indexed General MIDI percussion channel (channel 10).
+const drumChannel = 9
+
+// Instrument is a sound selected by a bank select and program change.
+type Instrument struct {
+	Program uint8
+	BankMSB uint8
+	BankLSB uint8
+	// Drums indicates that the instrument is a drum kit.
+	Drums bool
+	// Name is the name of the instrument or drum kit. The GS and XG melodic
+	// variations and the unknown GM2 variations use the name of the GM
+	// instrument they are a variation of.
+	Name string
+	// Family is the GM family of the melodic instruments.
+	Family string
+}
+
+// LookupInstrument returns the instrument selected on a channel by the bank
+// select and program numbers as per the passed standard.
+func LookupInstrument(std BankStandard, channel, msb, lsb, program uint8) Instrument {
+	program &= 0x7F
+	inst := Instrument{Program: program, BankMSB: msb, BankLSB: lsb}
+
+	switch std {
+	case GM2Bank:
+		switch {
+		case msb == 120 || (channel == drumChannel && msb != 121):
+			inst.Drums = true
+		case msb == 121:
+			if name, ok := GM2Variations[[2]uint8{program, lsb}]; ok {
+				inst.Name = name
+			}
+		}
+	case GSBank:
+		inst.Drums = channel == drumChannel
+	case XGBank:
+		switch msb {
+		case 127:
+			inst.Drums = true
+			inst.Name = XGDrumKits[program]
+		case 126:
+			inst.Drums = true
+			inst.Name = XGSFXKits[program]
+		case 64:
+			inst.Name = "SFX Voice"
+		default:
+			inst.Drums = channel == drumChannel && msb == 0
+		}
+	default:
+		inst.Drums = channel == drumChannel
+	}
+
+	if inst.Drums {
+		if inst.Name == "" {
+			inst.Name = GMDrumKits[program]
+		}
+		if inst.Name == "" {
+			// unknown kits fall back to the standard kit
+			inst.Name = GMDrumKits[0]
+		}
+		return inst
+	}
+	if inst.Name == "" {
+		inst.Name = GMInstruments[program]
+	}
+	inst.Family = GMFamilies[program/8]
+	return inst
+}
+
+// ProgramState is the instrument used by a channel from a given tick.
+type ProgramState struct {
+	Tick    uint64
+	Channel uint8
+	Instrument
+}
+
+// Programs reports the instruments selected by the program changes of the
+// track as per the passed bank standard. Bank selects (CC0 and CC32) are
+// applied on the next program change of their channel as per the MIDI spec.
+func (t *Track) Programs(std BankStandard) []ProgramState {
+	states := []ProgramState{}
+	if t == nil {
+		return states
+	}
+	banks := map[uint8][2]uint8{}
+	var tick uint64
+	for _, ev := range t.Events {
+		tick += uint64(ev.TimeDelta)
+		switch ev.MsgType {
+		case EventByteMap["ControlChange"]:
+			bank := banks[ev.MsgChan]
+			switch int(ev.Controller) {
+			case CCVals["Bank Select"]:
+				bank[0] = ev.NewValue
+			case CCVals["Control 0 Bank Select"]:
+				bank[1] = ev.NewValue
+			}
+			banks[ev.MsgChan] = bank
+		case EventByteMap["ProgramChange"]:
+			bank := banks[ev.MsgChan]
+			states = append(states, ProgramState{
+				Tick:       tick,
+				Channel:    ev.MsgChan,
+				Instrument: LookupInstrument(std, ev.MsgChan, bank[0], bank[1], ev.NewProgram),
+			})
+		}
+	}
+	return states
+}
+
+// ProgramAt returns the instrument used by the channel at the passed tick. If
+// no program change was sent on the channel before that tick, the default
+// program (0) is returned.
+func (t *Track) ProgramAt(std BankStandard, channel uint8, tick uint64) Instrument {
+	inst := LookupInstrument(std, channel, 0, 0, 0)
+	for _, state := range t.Programs(std) {
+		if state.Tick > tick {
+			break
+		}
+		if state.Channel == channel {
+			inst = state.Instrument
+		}
+	}
+	return inst
+}
@@ -0,0 +1,93 @@
+package midi
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLookupInstrument(t *testing.T) {
+	tests := []struct {
+		name                  string
+		std                   BankStandard
+		channel, msb, lsb, pc uint8
+		want                  Instrument
+	}{
+		{name: "GM1 piano", std: GM1Bank, pc: 0,
+			want: Instrument{Name: "Acoustic Grand Piano", Family: "Piano"}},
+		{name: "GM1 ignores banks", std: GM1Bank, msb: 121, lsb: 1, pc: 0,
+			want: Instrument{BankMSB: 121, BankLSB: 1, Name: "Acoustic Grand Piano", Family: "Piano"}},
+		{name: "GM1 drums", std: GM1Bank, channel: 9, pc: 0,
+			want: Instrument{Drums: true, Name: "Standard Kit"}},
+		{name: "GM2 variation", std: GM2Bank, msb: 121, lsb: 2, pc: 0,
+			want: Instrument{BankMSB: 121, BankLSB: 2, Name: "Dark Acoustic Grand", Family: "Piano"}},
+		{name: "GM2 unknown variation", std: GM2Bank, msb: 121, lsb: 9, pc: 25,
+			want: Instrument{Program: 25, BankMSB: 121, BankLSB: 9, Name: "Acoustic Guitar (steel)", Family: "Guitar"}},
+		{name: "GM2 rhythm bank", std: GM2Bank, channel: 2, msb: 120, pc: 25,
+			want: Instrument{Program: 25, BankMSB: 120, Drums: true, Name: "Analog Kit"}},
+		{name: "GS drum channel", std: GSBank, channel: 9, msb: 8, pc: 40,
+			want: Instrument{Program: 40, BankMSB: 8, Drums: true, Name: "Brush Kit"}},
+		{name: "GS variation", std: GSBank, msb: 8, pc: 4,
+			want: Instrument{Program: 4, BankMSB: 8, Name: "Electric Piano 1", Family: "Piano"}},
+		{name: "XG drum bank", std: XGBank, msb: 127, pc: 48,
+			want: Instrument{Program: 48, BankMSB: 127, Drums: true, Name: "Classic Kit"}},
+		{name: "XG SFX kit", std: XGBank, msb: 126, pc: 1,
+			want: Instrument{Program: 1, BankMSB: 126, Drums: true, Name: "SFX Kit 2"}},
+		{name: "XG SFX voice", std: XGBank, msb: 64, pc: 3,
+			want: Instrument{Program: 3, BankMSB: 64, Name: "SFX Voice", Family: "Piano"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LookupInstrument(tt.std, tt.channel, tt.msb, tt.lsb, tt.pc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LookupInstrument() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrack_Programs(t *testing.T) {
+	tr := &Track{}
+	tr.AddAfterDelta(0, ProgramSelect(0, 0))
+	for _, ev := range BankSelect(0, 121, 1) {
+		tr.AddAfterDelta(96, ev)
+	}
+	tr.AddAfterDelta(0, ProgramSelect(0, 0))
+	tr.AddAfterDelta(96, ProgramSelect(9, 32))
+	want := []ProgramState{
+		{Tick: 0, Channel: 0, Instrument: Instrument{Name: "Acoustic Grand Piano", Family: "Piano"}},
+		{Tick: 192, Channel: 0, Instrument: Instrument{BankMSB: 121, BankLSB: 1, Name: "Wide Acoustic Grand", Family: "Piano"}},
+		{Tick: 288, Channel: 9, Instrument: Instrument{Program: 32, Drums: true, Name: "Jazz Kit"}},
+	}
+	if got := tr.Programs(GM2Bank); !reflect.DeepEqual(got, want) {
+		t.Errorf("Programs() = %+v, want %+v", got, want)
+	}
+	if got := tr.ProgramAt(GM2Bank, 0, 100); got.Name != "Acoustic Grand Piano" {
+		t.Errorf("ProgramAt(100) = %+v", got)
+	}
+	if got := tr.ProgramAt(GM2Bank, 0, 200); got.Name != "Wide Acoustic Grand" {
+		t.Errorf("ProgramAt(200) = %+v", got)
+	}
+	if got := tr.ProgramAt(GM2Bank, 9, 0); got.Name != "Standard Kit" {
+		t.Errorf("ProgramAt() on the drum channel before the program change = %+v", got)
+	}
+}
+
+func TestTrack_Programs_fixture(t *testing.T) {
+	r, err := os.Open("fixtures/example-format0.mid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	dec := NewDecoder(r)
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, state := range dec.Tracks[0].Programs(GM1Bank) {
+		names = append(names, state.Name)
+	}
+	want := []string{"Electric Piano 2", "Orchestral Harp", "Bassoon"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Programs() = %v, want %v", names, want)
+	}
+}
@@ -2,4 +2,8 @@ module github.com/go-audio/midi
 
 go 1.12
 
-require github.com/mattetti/filebuffer v1.0.0
+require (
+	github.com/go-audio/audio v1.0.0
+	github.com/go-audio/wav v1.1.0
+	github.com/mattetti/filebuffer v1.0.0
+)
@@ -0,0 +1,157 @@
+// Package miditest provides the helpers shared by the tests of the
+// subpackages writing or rendering midi files.
+package miditest
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/midi"
+)
+
+// Fixtures decodes each midi file of the fixtures directory and passes it to
+// fn in a subtest named after the file. The fixtures are found relatively to
+// the directory of a subpackage, where its tests run.
+func Fixtures(t *testing.T, fn func(t *testing.T, d *midi.Decoder)) {
+	t.Helper()
+	paths, err := filepath.Glob("../fixtures/*.mid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no fixtures found")
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			d := midi.NewDecoder(f)
+			if err := d.Decode(); err != nil {
+				t.Fatal(err)
+			}
+			fn(t, d)
+		})
+	}
+}
+
+// NotePitches returns the sorted pitches of the note ons of the tracks.
+func NotePitches(tracks ...*midi.Track) []int {
+	pitches := []int{}
+	for _, tr := range tracks {
+		for _, ev := range tr.Events {
+			if ev.MsgType == midi.EventByteMap["NoteOn"] && ev.Velocity > 0 {
+				pitches = append(pitches, int(ev.Note))
+			}
+		}
+	}
+	sort.Ints(pitches)
+	return pitches
+}
+
+// Note is a note of a track lasting more than a tick.
+type Note struct {
+	Track      *midi.Track
+	Channel    uint8
+	Start, End uint64
+}
+
+// Notes returns the notes of the tracks which last more than a tick, the
+// notes starting and ending at the same tick can't be heard.
+func Notes(tracks ...*midi.Track) []Note {
+	notes := []Note{}
+	for _, tr := range tracks {
+		playing := map[[2]uint8]uint64{}
+		var tick uint64
+		for _, ev := range tr.Events {
+			tick += uint64(ev.TimeDelta)
+			key := [2]uint8{ev.MsgChan, ev.Note}
+			switch {
+			case ev.MsgType == midi.EventByteMap["NoteOn"] && ev.Velocity > 0:
+				playing[key] = tick
+			case ev.MsgType == midi.EventByteMap["NoteOff"] || ev.MsgType == midi.EventByteMap["NoteOn"]:
+				start, ok := playing[key]
+				if !ok {
+					continue
+				}
+				delete(playing, key)
+				if tick > start {
+					notes = append(notes, Note{Track: tr, Channel: ev.MsgChan, Start: start, End: tick})
+				}
+			}
+		}
+	}
+	return notes
+}
+
+// CheckRender checks that the audio rendered from a decoded file lasts until
+// its last note off and that its notes sound in the 10ms following their
+// start. Only the notes for which listen returns true are listened to, a nil
+// listen checks all of them.
+func CheckRender(t *testing.T, d *midi.Decoder, buf *audio.FloatBuffer, listen func(n Note) bool) {
+	t.Helper()
+	for i, v := range buf.Data {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			t.Fatalf("invalid sample %d: %v", i, v)
+		}
+	}
+	channels := buf.Format.NumChannels
+	rate := buf.Format.SampleRate
+	tempo := midi.TempoMapOf(d.Tracks...)
+	frame := func(tick uint64) int {
+		return int(math.Round(tempo.Seconds(tick, d.TicksPerQuarterNote) * float64(rate)))
+	}
+	frames := len(buf.Data) / channels
+	for _, n := range Notes(d.Tracks...) {
+		if end := frame(n.End); frames < end {
+			t.Fatalf("expected at least %d frames, got %d", end, frames)
+		}
+		if listen != nil && !listen(n) {
+			continue
+		}
+		if silent(buf.Data[channels*frame(n.Start):], channels*rate/100) {
+			t.Errorf("the note starting at tick %d is silent", n.Start)
+		}
+	}
+}
+
+// silent reports if the first samples of data are all zero.
+func silent(data []float64, samples int) bool {
+	if samples > len(data) {
+		samples = len(data)
+	}
+	for _, v := range data[:samples] {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// VoicesTrack returns a track notated at 96 ticks per quarter note in 3/4
+// and F major at 100 BPM, with the violin program on channel 0. Its first bar
+// is laid out in two voices: a Bb-D chord for a half note while a G is held
+// and tied over the bar line, which ends on the second beat of the second
+// bar where the tests add their notes.
+func VoicesTrack(name string) *midi.Track {
+	tr := &midi.Track{}
+	tr.AddAfterDelta(0, midi.TrackName(name))
+	tr.AddAfterDelta(0, &midi.Event{MsgType: 0xF, Cmd: 0x58, TimeSignature: &midi.TimeSignature{Numerator: 3, Denominator: 2}})
+	tr.AddAfterDelta(0, midi.KeySignatureEvent(-1, false))
+	tr.AddAfterDelta(0, midi.TempoEvent(100))
+	tr.AddAfterDelta(0, midi.ProgramSelect(0, 40))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 70, 80))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 74, 80))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 67, 80))
+	tr.AddAfterDelta(192, midi.NoteOff(0, 70))
+	tr.AddAfterDelta(0, midi.NoteOff(0, 74))
+	tr.AddAfterDelta(192, midi.NoteOff(0, 67))
+	return tr
+}
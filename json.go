@@ -0,0 +1,548 @@
+package midi
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"unicode/utf8"
+)
+
+// jsonTextTypes maps the text meta events to their JSON type.
+var jsonTextTypes = map[byte]string{
+	0x01: "text",
+	0x02: "copyright",
+	0x03: "trackName",
+	0x04: "instrumentName",
+	0x05: "lyric",
+	0x06: "marker",
+	0x07: "cuePoint",
+}
+
+// jsonEvent is the JSON representation of an event, only the fields used by
+// the event type are set. See JSONSchema for the description of each type.
+type jsonEvent struct {
+	Type    string `json:"type"`
+	Tick    uint64 `json:"tick"`
+	Channel *uint8 `json:"channel,omitempty"`
+	// channel events
+	Note       *uint8  `json:"note,omitempty"`
+	Velocity   *uint8  `json:"velocity,omitempty"`
+	Pressure   *uint8  `json:"pressure,omitempty"`
+	Controller *uint8  `json:"controller,omitempty"`
+	Program    *uint8  `json:"program,omitempty"`
+	Value      *uint16 `json:"value,omitempty"`
+	// meta and sysex events
+	Cmd              *uint8   `json:"cmd,omitempty"`
+	Text             *string  `json:"text,omitempty"`
+	Data             *string  `json:"data,omitempty"`
+	Number           *uint16  `json:"number,omitempty"`
+	MicrosPerQuarter *uint32  `json:"microsPerQuarter,omitempty"`
+	BPM              *float64 `json:"bpm,omitempty"`
+	Hour             *uint8   `json:"hour,omitempty"`
+	Minute           *uint8   `json:"minute,omitempty"`
+	Second           *uint8   `json:"second,omitempty"`
+	Frame            *uint8   `json:"frame,omitempty"`
+	SubFrame         *uint8   `json:"subFrame,omitempty"`
+	Numerator        *uint8   `json:"numerator,omitempty"`
+	Denominator      *uint16  `json:"denominator,omitempty"`
+	ClocksPerClick   *uint8   `json:"clocksPerClick,omitempty"`
+	ThirtySeconds    *uint8   `json:"thirtySecondNotesPerQuarter,omitempty"`
+	Key              *int8    `json:"key,omitempty"`
+	Minor            bool     `json:"minor,omitempty"`
+	Escape           bool     `json:"escape,omitempty"`
+	RunningStatus    bool     `json:"runningStatus,omitempty"`
+}
+
+func u8(v uint8) *uint8        { return &v }
+func u16(v uint16) *uint16     { return &v }
+func hexData(b []byte) *string { s := hex.EncodeToString(b); return &s }
+
+// MarshalJSON encodes the event as a JSON object with a type discriminator
+// and only the fields used by that type, for instance:
+//
+//	{"type":"noteOn","tick":96,"channel":0,"note":60,"velocity":100}
+//
+// The tick is the AbsTicks of the event, tracks use the position computed from
+// the time deltas instead. See JSONSchema for the description of the format.
+func (e *Event) MarshalJSON() ([]byte, error) {
+	j, err := e.jsonEvent(e.AbsTicks)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(j)
+}
+
+func (e *Event) jsonEvent(tick uint64) (*jsonEvent, error) {
+	j := &jsonEvent{Tick: tick, Channel: u8(e.MsgChan), RunningStatus: e.RunningStatus}
+	switch e.MsgType {
+	case 0x8, 0x9:
+		j.Type = "noteOff"
+		if e.MsgType == 0x9 {
+			j.Type = "noteOn"
+		}
+		j.Note, j.Velocity = u8(e.Note), u8(e.Velocity)
+	case 0xA:
+		j.Type = "polyAftertouch"
+		j.Note, j.Pressure = u8(e.Note), u8(e.Velocity)
+	case 0xB:
+		j.Type = "controlChange"
+		j.Controller, j.Value = u8(e.Controller), u16(uint16(e.NewValue))
+	case 0xC:
+		j.Type = "programChange"
+		j.Program = u8(e.NewProgram)
+	case 0xD:
+		j.Type = "channelAftertouch"
+		j.Pressure = u8(e.Pressure)
+	case 0xE:
+		j.Type = "pitchBend"
+		j.Value = u16(e.AbsPitchBend)
+	case 0xF:
+		j.Channel, j.RunningStatus = nil, false
+		if e.IsSysEx() {
+			j.Type = "sysex"
+			j.Data = hexData(e.SysEx)
+			j.Escape = e.MsgChan == 0x7
+			break
+		}
+		e.jsonMeta(j)
+	default:
+		return nil, fmt.Errorf("can't marshal event %v", e)
+	}
+	return j, nil
+}
+
+func (e *Event) jsonMeta(j *jsonEvent) {
+	if e.MetaData != nil {
+		switch {
+		case e.Cmd == 0x21 && len(e.MetaData) == 1:
+			j.Type = "port"
+			j.Number = u16(uint16(e.MetaData[0]))
+		case e.Cmd == 0x7F:
+			j.Type = "sequencerSpecific"
+			j.Data = hexData(e.MetaData)
+		default:
+			j.Type = "meta"
+			j.Cmd = u8(e.Cmd)
+			j.Data = hexData(e.MetaData)
+		}
+		return
+	}
+	if name, ok := jsonTextTypes[e.Cmd]; ok {
+		j.Type = name
+		// JSON strings are UTF-8, other encodings are kept as raw data
+		if text := string(e.metaData()); utf8.ValidString(text) {
+			j.Text = &text
+		} else {
+			j.Data = hexData(e.metaData())
+		}
+		return
+	}
+	d := e.metaData()
+	switch e.Cmd {
+	case 0x00:
+		j.Type = "sequenceNumber"
+		j.Number = u16(e.SeqNum)
+	case 0x20:
+		j.Type = "channelPrefix"
+		j.Channel = u8(e.Channel)
+	case 0x2F:
+		j.Type = "endOfTrack"
+	case 0x51:
+		j.Type = "tempo"
+		us := e.MsPerQuartNote
+		j.MicrosPerQuarter = &us
+		if us > 0 {
+			bpm := e.BPM()
+			j.BPM = &bpm
+		}
+	case 0x54:
+		j.Type = "smpteOffset"
+		j.Hour, j.Minute, j.Second, j.Frame, j.SubFrame = u8(d[0]), u8(d[1]), u8(d[2]), u8(d[3]), u8(d[4])
+	case 0x58:
+		j.Type = "timeSignature"
+		j.Numerator = u8(d[0])
+		j.Denominator = u16(1 << d[1])
+		j.ClocksPerClick, j.ThirtySeconds = u8(d[2]), u8(d[3])
+		// denominators which can't be written as a number are kept raw
+		if d[1] > 15 {
+			j.Type, j.Numerator, j.Denominator, j.ClocksPerClick, j.ThirtySeconds = "meta", nil, nil, nil, nil
+			j.Cmd, j.Data = u8(e.Cmd), hexData(d)
+		}
+	case 0x59:
+		j.Type = "keySignature"
+		ks := e.KeySignature()
+		j.Key, j.Minor = &ks.Key, ks.Minor
+	default:
+		j.Type = "meta"
+		j.Cmd = u8(e.Cmd)
+		j.Data = hexData(d)
+	}
+}
+
+// UnmarshalJSON decodes an event encoded with MarshalJSON. The events are
+// created the same way the decoder creates them so a decoded file can be
+// encoded back once converted to JSON and back. The tick is stored in
+// AbsTicks, the time delta isn't set.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var j jsonEvent
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	ev, err := j.event()
+	if err != nil {
+		return err
+	}
+	*e = *ev
+	return nil
+}
+
+// event creates the event represented by the JSON object.
+func (j *jsonEvent) event() (*Event, error) {
+	missing := func(field string) error {
+		return fmt.Errorf("%s event without %s - %s", j.Type, field, ErrUnexpectedData)
+	}
+	channelEvent := func(msgType uint8) (*Event, error) {
+		if j.Channel == nil {
+			return nil, missing("channel")
+		}
+		if *j.Channel > 15 {
+			return nil, fmt.Errorf("invalid channel %d - %s", *j.Channel, ErrUnexpectedData)
+		}
+		return &Event{MsgType: msgType, MsgChan: *j.Channel, AbsTicks: j.Tick, RunningStatus: j.RunningStatus}, nil
+	}
+	data7 := func(field string, v *uint8) (uint8, error) {
+		if v == nil {
+			return 0, missing(field)
+		}
+		if *v > 127 {
+			return 0, fmt.Errorf("invalid %s %d - %s", field, *v, ErrUnexpectedData)
+		}
+		return *v, nil
+	}
+	meta := func(cmd byte) *Event {
+		return &Event{MsgType: 0xF, MsgChan: 0xF, Cmd: cmd, AbsTicks: j.Tick}
+	}
+	rawData := func() ([]byte, error) {
+		if j.Data == nil {
+			return nil, missing("data")
+		}
+		return hex.DecodeString(*j.Data)
+	}
+
+	var err error
+	switch j.Type {
+	case "noteOff", "noteOn", "polyAftertouch":
+		msgType := map[string]uint8{"noteOff": 0x8, "noteOn": 0x9, "polyAftertouch": 0xA}[j.Type]
+		e, err := channelEvent(msgType)
+		if err != nil {
+			return nil, err
+		}
+		if e.Note, err = data7("note", j.Note); err != nil {
+			return nil, err
+		}
+		v, field := j.Velocity, "velocity"
+		if msgType == 0xA {
+			v, field = j.Pressure, "pressure"
+		}
+		if e.Velocity, err = data7(field, v); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case "controlChange":
+		e, err := channelEvent(0xB)
+		if err != nil {
+			return nil, err
+		}
+		if e.Controller, err = data7("controller", j.Controller); err != nil {
+			return nil, err
+		}
+		if j.Value == nil {
+			return nil, missing("value")
+		}
+		if *j.Value > 127 {
+			return nil, fmt.Errorf("invalid value %d - %s", *j.Value, ErrUnexpectedData)
+		}
+		e.NewValue = uint8(*j.Value)
+		return e, nil
+	case "programChange":
+		e, err := channelEvent(0xC)
+		if err != nil {
+			return nil, err
+		}
+		e.NewProgram, err = data7("program", j.Program)
+		return e, err
+	case "channelAftertouch":
+		e, err := channelEvent(0xD)
+		if err != nil {
+			return nil, err
+		}
+		e.Pressure, err = data7("pressure", j.Pressure)
+		return e, err
+	case "pitchBend":
+		e, err := channelEvent(0xE)
+		if err != nil {
+			return nil, err
+		}
+		if j.Value == nil {
+			return nil, missing("value")
+		}
+		if *j.Value > PitchBendMax {
+			return nil, fmt.Errorf("invalid pitch bend %d - %s", *j.Value, ErrUnexpectedData)
+		}
+		e.AbsPitchBend = *j.Value
+		e.RelPitchBend = int16(e.AbsPitchBend) - PitchBendCenter
+		return e, nil
+	case "sysex":
+		e := &Event{MsgType: 0xF, AbsTicks: j.Tick}
+		if e.SysEx, err = rawData(); err != nil {
+			return nil, err
+		}
+		if j.Escape {
+			e.MsgChan = 0x7
+		}
+		return e, nil
+	case "sequencerSpecific", "meta":
+		cmd := byte(0x7F)
+		if j.Type == "meta" {
+			if j.Cmd == nil {
+				return nil, missing("cmd")
+			}
+			cmd = *j.Cmd
+		}
+		e := meta(cmd)
+		if e.MetaData, err = rawData(); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case "port":
+		if j.Number == nil {
+			return nil, missing("number")
+		}
+		e := meta(0x21)
+		e.MetaData = []byte{byte(*j.Number)}
+		return e, nil
+	case "sequenceNumber":
+		if j.Number == nil {
+			return nil, missing("number")
+		}
+		e := meta(0x00)
+		e.SeqNum = *j.Number
+		return e, nil
+	case "channelPrefix":
+		if j.Channel == nil {
+			return nil, missing("channel")
+		}
+		e := meta(0x20)
+		e.Channel = *j.Channel
+		return e, nil
+	case "endOfTrack":
+		return meta(0x2F), nil
+	case "tempo":
+		e := meta(0x51)
+		switch {
+		case j.MicrosPerQuarter != nil:
+			e.MsPerQuartNote = *j.MicrosPerQuarter
+		case j.BPM != nil:
+			e.MsPerQuartNote = BPMToMicros(*j.BPM)
+		default:
+			return nil, missing("microsPerQuarter")
+		}
+		if e.MsPerQuartNote > 0xFFFFFF {
+			return nil, fmt.Errorf("invalid tempo %d - %s", e.MsPerQuartNote, ErrUnexpectedData)
+		}
+		if e.MsPerQuartNote > 0 {
+			e.Bpm = 60000000 / e.MsPerQuartNote
+		}
+		return e, nil
+	case "smpteOffset":
+		fields := []*uint8{j.Hour, j.Minute, j.Second, j.Frame, j.SubFrame}
+		for i, name := range []string{"hour", "minute", "second", "frame", "subFrame"} {
+			if fields[i] == nil {
+				return nil, missing(name)
+			}
+		}
+		e := meta(0x54)
+		e.SmpteOffset = &SmpteOffset{Hour: *j.Hour, Min: *j.Minute, Sec: *j.Second, Fr: *j.Frame, SubFr: *j.SubFrame}
+		return e, nil
+	case "timeSignature":
+		if j.Numerator == nil || j.Denominator == nil {
+			return nil, missing("numerator and denominator")
+		}
+		if d := *j.Denominator; d == 0 || d&(d-1) != 0 {
+			return nil, fmt.Errorf("time signature denominator %d isn't a power of 2 - %s", d, ErrUnexpectedData)
+		}
+		ts := &TimeSignature{
+			Numerator:                   *j.Numerator,
+			Denominator:                 uint8(bits.TrailingZeros16(*j.Denominator)),
+			ClocksPerTick:               24,
+			ThirtySecondNotesPerQuarter: 8,
+		}
+		if j.ClocksPerClick != nil {
+			ts.ClocksPerTick = *j.ClocksPerClick
+		}
+		if j.ThirtySeconds != nil {
+			ts.ThirtySecondNotesPerQuarter = *j.ThirtySeconds
+		}
+		e := meta(0x58)
+		e.TimeSignature = ts
+		return e, nil
+	case "keySignature":
+		if j.Key == nil {
+			return nil, missing("key")
+		}
+		e := KeySignatureEvent(int(*j.Key), j.Minor)
+		e.MsgChan, e.AbsTicks = 0xF, j.Tick
+		return e, nil
+	}
+
+	for cmd, name := range jsonTextTypes {
+		if name != j.Type {
+			continue
+		}
+		var text string
+		switch {
+		case j.Text != nil:
+			text = *j.Text
+		case j.Data != nil:
+			b, err := rawData()
+			if err != nil {
+				return nil, err
+			}
+			text = string(b)
+		default:
+			return nil, missing("text")
+		}
+		e := meta(cmd)
+		switch cmd {
+		case 0x01:
+			e.Text = text
+		case 0x02:
+			e.Copyright = text
+		case 0x03:
+			e.SeqTrackName = text
+		case 0x04:
+			e.InstrumentName = text
+		case 0x05:
+			e.Lyric = text
+		case 0x06:
+			e.Marker = text
+		case 0x07:
+			e.CuePoint = text
+		}
+		return e, nil
+	}
+	return nil, fmt.Errorf("unknown event type %q - %s", j.Type, ErrUnexpectedData)
+}
+
+// jsonTrack is the JSON representation of a track.
+type jsonTrack struct {
+	Events []*jsonEvent `json:"events"`
+}
+
+// MarshalJSON encodes the track as a JSON object listing its events. The tick
+// of each event is computed from the time deltas.
+func (t *Track) MarshalJSON() ([]byte, error) {
+	jt := jsonTrack{Events: make([]*jsonEvent, 0, len(t.Events))}
+	var tick uint64
+	for _, ev := range t.Events {
+		tick += uint64(ev.TimeDelta)
+		j, err := ev.jsonEvent(tick)
+		if err != nil {
+			return nil, err
+		}
+		jt.Events = append(jt.Events, j)
+	}
+	return json.Marshal(jt)
+}
+
+// UnmarshalJSON decodes a track encoded with MarshalJSON, the time deltas are
+// computed from the ticks of the events which have to be sorted. Like
+// decoded tracks, the track is encoded as it is (see ChunkData).
+func (t *Track) UnmarshalJSON(data []byte) error {
+	var jt jsonTrack
+	if err := json.Unmarshal(data, &jt); err != nil {
+		return err
+	}
+	events := make([]*Event, 0, len(jt.Events))
+	var last uint64
+	for _, j := range jt.Events {
+		if j == nil {
+			return fmt.Errorf("null event - %s", ErrUnexpectedData)
+		}
+		if j.Tick < last {
+			return fmt.Errorf("%s event at tick %d is before the previous event - %s", j.Type, j.Tick, ErrUnexpectedData)
+		}
+		ev, err := j.event()
+		if err != nil {
+			return err
+		}
+		ev.TimeDelta = uint32(j.Tick - last)
+		last = j.Tick
+		events = append(events, ev)
+	}
+	*t = Track{Events: events, currentTicks: last, decoded: true}
+	return nil
+}
+
+// jsonFile is the JSON representation of a midi file.
+type jsonFile struct {
+	Format              uint16   `json:"format"`
+	TicksPerQuarterNote uint16   `json:"ticksPerQuarterNote"`
+	Tracks              []*Track `json:"tracks"`
+}
+
+func (f *jsonFile) unmarshal(data []byte) error {
+	if err := json.Unmarshal(data, f); err != nil {
+		return err
+	}
+	for i, t := range f.Tracks {
+		if t == nil {
+			return fmt.Errorf("null track %d - %s", i, ErrUnexpectedData)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the decoded file: its header and tracks.
+//
+//	{"format":0,"ticksPerQuarterNote":96,"tracks":[{"events":[...]}]}
+func (d *Decoder) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonFile{Format: d.Format, TicksPerQuarterNote: d.TicksPerQuarterNote, Tracks: d.Tracks})
+}
+
+// UnmarshalJSON loads a file encoded with MarshalJSON as if it was decoded.
+func (d *Decoder) UnmarshalJSON(data []byte) error {
+	var f jsonFile
+	if err := f.unmarshal(data); err != nil {
+		return err
+	}
+	d.Format, d.TicksPerQuarterNote, d.Tracks = f.Format, f.TicksPerQuarterNote, f.Tracks
+	d.NumTracks = uint16(len(f.Tracks))
+	d.TimeFormat = MetricalTF
+	return nil
+}
+
+// MarshalJSON encodes the header and tracks of the encoder, see
+// Decoder.MarshalJSON.
+func (e *Encoder) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonFile{Format: e.Format, TicksPerQuarterNote: e.TicksPerQuarterNote, Tracks: e.Tracks})
+}
+
+// UnmarshalJSON sets the header and tracks of the encoder from a file encoded
+// in JSON so it can be written:
+//
+//	e := midi.NewEncoder(w, 0, 0)
+//	if err := json.Unmarshal(data, e); err != nil {
+//		return err
+//	}
+//	return e.Write()
+func (e *Encoder) UnmarshalJSON(data []byte) error {
+	var f jsonFile
+	if err := f.unmarshal(data); err != nil {
+		return err
+	}
+	e.Format, e.TicksPerQuarterNote, e.Tracks = f.Format, f.TicksPerQuarterNote, f.Tracks
+	e.NumTracks = uint16(len(f.Tracks))
+	return nil
+}
@@ -0,0 +1,195 @@
+package midi
+
+// JSONSchema is the JSON Schema (draft 7) of the JSON representation of a
+// midi file produced by Decoder.MarshalJSON, Encoder.MarshalJSON,
+// Track.MarshalJSON and Event.MarshalJSON. Binary data (sysex messages, raw
+// meta data and text which isn't valid UTF-8) is encoded as hexadecimal
+// strings.
+const JSONSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://github.com/go-audio/midi/midi.schema.json",
+  "title": "MIDI file",
+  "type": "object",
+  "required": ["format", "ticksPerQuarterNote", "tracks"],
+  "properties": {
+    "format": {"type": "integer", "enum": [0, 1, 2]},
+    "ticksPerQuarterNote": {"type": "integer", "minimum": 1, "maximum": 32767},
+    "tracks": {"type": "array", "items": {"$ref": "#/definitions/track"}}
+  },
+  "definitions": {
+    "track": {
+      "type": "object",
+      "required": ["events"],
+      "properties": {
+        "events": {"type": "array", "items": {"$ref": "#/definitions/event"}}
+      }
+    },
+    "uint7": {"type": "integer", "minimum": 0, "maximum": 127},
+    "uint8": {"type": "integer", "minimum": 0, "maximum": 255},
+    "channel": {"type": "integer", "minimum": 0, "maximum": 15},
+    "data": {"type": "string", "pattern": "^([0-9a-f]{2})*$"},
+    "event": {
+      "type": "object",
+      "required": ["type", "tick"],
+      "properties": {
+        "type": {
+          "enum": [
+            "noteOff", "noteOn", "polyAftertouch", "controlChange", "programChange",
+            "channelAftertouch", "pitchBend", "sysex", "sequenceNumber", "text",
+            "copyright", "trackName", "instrumentName", "lyric", "marker", "cuePoint",
+            "channelPrefix", "port", "endOfTrack", "tempo", "smpteOffset",
+            "timeSignature", "keySignature", "sequencerSpecific", "meta"
+          ]
+        },
+        "tick": {"type": "integer", "minimum": 0, "description": "Absolute position in ticks, the events of a track are sorted by tick."},
+        "runningStatus": {"type": "boolean", "description": "The status byte of the channel event is omitted in the file."}
+      },
+      "oneOf": [
+        {
+          "properties": {
+            "type": {"enum": ["noteOff", "noteOn"]},
+            "channel": {"$ref": "#/definitions/channel"},
+            "note": {"$ref": "#/definitions/uint7"},
+            "velocity": {"$ref": "#/definitions/uint7"}
+          },
+          "required": ["channel", "note", "velocity"]
+        },
+        {
+          "properties": {
+            "type": {"const": "polyAftertouch"},
+            "channel": {"$ref": "#/definitions/channel"},
+            "note": {"$ref": "#/definitions/uint7"},
+            "pressure": {"$ref": "#/definitions/uint7"}
+          },
+          "required": ["channel", "note", "pressure"]
+        },
+        {
+          "properties": {
+            "type": {"const": "controlChange"},
+            "channel": {"$ref": "#/definitions/channel"},
+            "controller": {"$ref": "#/definitions/uint7"},
+            "value": {"$ref": "#/definitions/uint7"}
+          },
+          "required": ["channel", "controller", "value"]
+        },
+        {
+          "properties": {
+            "type": {"const": "programChange"},
+            "channel": {"$ref": "#/definitions/channel"},
+            "program": {"$ref": "#/definitions/uint7"}
+          },
+          "required": ["channel", "program"]
+        },
+        {
+          "properties": {
+            "type": {"const": "channelAftertouch"},
+            "channel": {"$ref": "#/definitions/channel"},
+            "pressure": {"$ref": "#/definitions/uint7"}
+          },
+          "required": ["channel", "pressure"]
+        },
+        {
+          "properties": {
+            "type": {"const": "pitchBend"},
+            "channel": {"$ref": "#/definitions/channel"},
+            "value": {"type": "integer", "minimum": 0, "maximum": 16383, "description": "8192 is the centered wheel."}
+          },
+          "required": ["channel", "value"]
+        },
+        {
+          "properties": {
+            "type": {"const": "sysex"},
+            "data": {"$ref": "#/definitions/data", "description": "Message bytes after the F0 or F7 status and length."},
+            "escape": {"type": "boolean", "description": "F7 (escape or continuation) packet instead of a F0 message."}
+          },
+          "required": ["data"]
+        },
+        {
+          "properties": {
+            "type": {"const": "sequenceNumber"},
+            "number": {"type": "integer", "minimum": 0, "maximum": 65535}
+          },
+          "required": ["number"]
+        },
+        {
+          "properties": {
+            "type": {"enum": ["text", "copyright", "trackName", "instrumentName", "lyric", "marker", "cuePoint"]},
+            "text": {"type": "string"},
+            "data": {"$ref": "#/definitions/data", "description": "Raw text bytes, used when the text isn't valid UTF-8."}
+          },
+          "oneOf": [{"required": ["text"]}, {"required": ["data"]}]
+        },
+        {
+          "properties": {
+            "type": {"const": "channelPrefix"},
+            "channel": {"$ref": "#/definitions/channel"}
+          },
+          "required": ["channel"]
+        },
+        {
+          "properties": {
+            "type": {"const": "port"},
+            "number": {"$ref": "#/definitions/uint8"}
+          },
+          "required": ["number"]
+        },
+        {
+          "properties": {"type": {"const": "endOfTrack"}}
+        },
+        {
+          "properties": {
+            "type": {"const": "tempo"},
+            "microsPerQuarter": {"type": "integer", "minimum": 0, "maximum": 16777215},
+            "bpm": {"type": "number", "description": "Informative, only used when microsPerQuarter is missing."}
+          },
+          "anyOf": [{"required": ["microsPerQuarter"]}, {"required": ["bpm"]}]
+        },
+        {
+          "properties": {
+            "type": {"const": "smpteOffset"},
+            "hour": {"$ref": "#/definitions/uint8"},
+            "minute": {"$ref": "#/definitions/uint8"},
+            "second": {"$ref": "#/definitions/uint8"},
+            "frame": {"$ref": "#/definitions/uint8"},
+            "subFrame": {"$ref": "#/definitions/uint8"}
+          },
+          "required": ["hour", "minute", "second", "frame", "subFrame"]
+        },
+        {
+          "properties": {
+            "type": {"const": "timeSignature"},
+            "numerator": {"$ref": "#/definitions/uint8"},
+            "denominator": {"type": "integer", "enum": [1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768]},
+            "clocksPerClick": {"$ref": "#/definitions/uint8", "description": "Defaults to 24."},
+            "thirtySecondNotesPerQuarter": {"$ref": "#/definitions/uint8", "description": "Defaults to 8."}
+          },
+          "required": ["numerator", "denominator"]
+        },
+        {
+          "properties": {
+            "type": {"const": "keySignature"},
+            "key": {"type": "integer", "minimum": -128, "maximum": 127, "description": "Number of sharps (positive) or flats (negative)."},
+            "minor": {"type": "boolean"}
+          },
+          "required": ["key"]
+        },
+        {
+          "properties": {
+            "type": {"const": "sequencerSpecific"},
+            "data": {"$ref": "#/definitions/data"}
+          },
+          "required": ["data"]
+        },
+        {
+          "properties": {
+            "type": {"const": "meta"},
+            "cmd": {"$ref": "#/definitions/uint8", "description": "Meta event type."},
+            "data": {"$ref": "#/definitions/data"}
+          },
+          "required": ["cmd", "data"]
+        }
+      ]
+    }
+  }
+}
+`
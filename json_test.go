@@ -0,0 +1,181 @@
+package midi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mattetti/filebuffer"
+)
+
+func TestJSON_roundTrip(t *testing.T) {
+	paths, err := filepath.Glob("fixtures/*.mid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			orig, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dec := NewDecoder(bytes.NewReader(orig))
+			if err := dec.Decode(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(dec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := filebuffer.New(nil)
+			e := NewEncoder(w, 0, 0)
+			if err := json.Unmarshal(data, e); err != nil {
+				t.Fatal(err)
+			}
+			if len(e.Tracks) != len(dec.Tracks) {
+				t.Fatalf("expected %d tracks, got %d", len(dec.Tracks), len(e.Tracks))
+			}
+			for i, tr := range e.Tracks {
+				if !reflect.DeepEqual(tr.Events, dec.Tracks[i].Events) {
+					t.Fatalf("track %d events don't match the decoded events", i)
+				}
+			}
+			if err := e.Write(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(w.Buff.Bytes(), orig) {
+				t.Errorf("the encoded file doesn't match the original file")
+			}
+		})
+	}
+}
+
+func TestTrack_MarshalJSON(t *testing.T) {
+	tr := &Track{}
+	tr.AddAfterDelta(0, TrackName("Lead"))
+	tr.AddAfterDelta(0, &Event{MsgType: 0xF, Cmd: 0x01, Text: "caf\xe9"})
+	tr.AddAfterDelta(0, TempoEvent(93.75))
+	tr.AddAfterDelta(0, KeySignatureEvent(-3, true))
+	tr.AddAfterDelta(0, &Event{MsgType: 0xF, Cmd: 0x58, TimeSignature: &TimeSignature{6, 3, 36, 8}})
+	tr.AddAfterDelta(0, SysExEvent([]byte{0x7E, 0x7F, 0x09, 0x01}))
+	tr.AddAfterDelta(0, NoteOn(1, 60, 0))
+	tr.AddAfterDelta(96, PitchWheel(1, 0x3000))
+	tr.AddAfterDelta(0, ControlChange(1, 7, 0))
+	tr.AddAfterDelta(0, EndOfTrack())
+
+	data, err := json.Marshal(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"events":[` +
+		`{"type":"trackName","tick":0,"text":"Lead"},` +
+		`{"type":"text","tick":0,"data":"636166e9"},` +
+		`{"type":"tempo","tick":0,"microsPerQuarter":640000,"bpm":93.75},` +
+		`{"type":"keySignature","tick":0,"key":-3,"minor":true},` +
+		`{"type":"timeSignature","tick":0,"numerator":6,"denominator":8,"clocksPerClick":36,"thirtySecondNotesPerQuarter":8},` +
+		`{"type":"sysex","tick":0,"data":"7e7f0901f7"},` +
+		`{"type":"noteOn","tick":0,"channel":1,"note":60,"velocity":0},` +
+		`{"type":"pitchBend","tick":96,"channel":1,"value":12288},` +
+		`{"type":"controlChange","tick":96,"channel":1,"controller":7,"value":0},` +
+		`{"type":"endOfTrack","tick":96}]}`
+	if string(data) != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, data)
+	}
+
+	got := &Track{}
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Events) != len(tr.Events) {
+		t.Fatalf("expected %d events, got %d", len(tr.Events), len(got.Events))
+	}
+	for i, ev := range got.Events {
+		b1, err := ev.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b2, err := tr.Events[i].Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b1, b2) {
+			t.Errorf("event %d: expected % x, got % x", i, b2, b1)
+		}
+	}
+}
+
+func TestEvent_UnmarshalJSON_errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"unknown type", `{"type":"chord","tick":0}`, `unknown event type "chord"`},
+		{"missing channel", `{"type":"noteOn","tick":0,"note":60,"velocity":1}`, "without channel"},
+		{"invalid channel", `{"type":"noteOn","tick":0,"channel":16,"note":60,"velocity":1}`, "invalid channel 16"},
+		{"invalid note", `{"type":"noteOff","tick":0,"channel":0,"note":128,"velocity":1}`, "invalid note 128"},
+		{"missing velocity", `{"type":"noteOn","tick":0,"channel":0,"note":60}`, "without velocity"},
+		{"invalid pitch bend", `{"type":"pitchBend","tick":0,"channel":0,"value":16384}`, "invalid pitch bend"},
+		{"invalid data", `{"type":"sysex","tick":0,"data":"f"}`, "odd length"},
+		{"missing cmd", `{"type":"meta","tick":0,"data":""}`, "without cmd"},
+		{"invalid denominator", `{"type":"timeSignature","tick":0,"numerator":3,"denominator":6}`, "isn't a power of 2"},
+		{"invalid tempo", `{"type":"tempo","tick":0,"microsPerQuarter":16777216}`, "invalid tempo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e Event
+			err := json.Unmarshal([]byte(tt.data), &e)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected the error to contain %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	var tr Track
+	err := json.Unmarshal([]byte(`{"events":[{"type":"endOfTrack","tick":10},{"type":"endOfTrack","tick":5}]}`), &tr)
+	if err == nil || !strings.Contains(err.Error(), "before the previous event") {
+		t.Errorf("expected an unsorted events error, got %v", err)
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	var schema struct {
+		Definitions struct {
+			Event struct {
+				Properties struct {
+					Type struct {
+						Enum []string `json:"enum"`
+					} `json:"type"`
+				} `json:"properties"`
+			} `json:"event"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal([]byte(JSONSchema), &schema); err != nil {
+		t.Fatal(err)
+	}
+	types := map[string]bool{}
+	for _, typ := range schema.Definitions.Event.Properties.Type.Enum {
+		types[typ] = true
+	}
+	// every type the decoder accepts is documented
+	for typ := range types {
+		var e Event
+		err := json.Unmarshal([]byte(`{"type":"`+typ+`","tick":0}`), &e)
+		if err != nil && strings.Contains(err.Error(), "unknown event type") {
+			t.Errorf("%s is documented but not supported", typ)
+		}
+	}
+	for _, typ := range jsonTextTypes {
+		if !types[typ] {
+			t.Errorf("%s isn't documented", typ)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package midi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	majorTonics = [15]string{"Cb", "Gb", "Db", "Ab", "Eb", "Bb", "F", "C", "G", "D", "A", "E", "B", "F#", "C#"}
+	minorTonics = [15]string{"Ab", "Eb", "Bb", "F", "C", "G", "D", "A", "E", "B", "F#", "C#", "G#", "D#", "A#"}
+
+	majorIntervals = [7]int{0, 2, 4, 5, 7, 9, 11}
+	minorIntervals = [7]int{0, 2, 3, 5, 7, 8, 10}
+)
+
+// KeySignature FF 59 02 sf mi Key Signature
+// sf is the number of sharps (positive value) or flats (negative value) from
+// -7 to 7 and mi indicates a major (0) or minor (1) key.
+type KeySignature struct {
+	// Key is the number of sharps if positive or of flats if negative.
+	Key int8
+	// Minor indicates a minor key, major otherwise.
+	Minor bool
+}
+
+// KeySignatureEvent returns a key signature event for the passed number of
+// sharps (positive value) or flats (negative value).
+func KeySignatureEvent(key int, minor bool) *Event {
+	ev := &Event{
+		MsgType: uint8(EventByteMap["Meta"]),
+		Cmd:     uint8(MetaByteMap["Key Signature"]),
+		Key:     int32(int8(key)),
+	}
+	if minor {
+		ev.Scale = 1
+	}
+	return ev
+}
+
+// ParseKeySignature parses a key name such as "C", "Bb major", "F# minor",
+// "Ebm" or "A min". Keys requiring more than 7 sharps or flats are rejected.
+func ParseKeySignature(name string) (KeySignature, error) {
+	letter, alter, rest, err := parsePitchClass(name)
+	if err != nil {
+		return KeySignature{}, err
+	}
+	var minor bool
+	switch r := strings.TrimSpace(rest); r {
+	case "", "M":
+	case "m":
+		minor = true
+	default:
+		switch strings.ToLower(r) {
+		case "maj", "major":
+		case "min", "minor":
+			minor = true
+		default:
+			return KeySignature{}, fmt.Errorf("invalid mode %q in key %q", r, name)
+		}
+	}
+	tonic := string(letter) + DefaultNotation.accidental(alter)
+	for k := -7; k <= 7; k++ {
+		ks := KeySignature{Key: int8(k), Minor: minor}
+		if ks.TonicName() == tonic {
+			return ks, nil
+		}
+	}
+	return KeySignature{}, fmt.Errorf("key %q has no key signature", name)
+}
+
+// valid returns the key clamped to the -7 to 7 range.
+func (k KeySignature) valid() int {
+	if k.Key < -7 {
+		return -7
+	}
+	if k.Key > 7 {
+		return 7
+	}
+	return int(k.Key)
+}
+
+// TonicName returns the name of the key's tonic, for instance Eb or F#.
+func (k KeySignature) TonicName() string {
+	if k.Minor {
+		return minorTonics[k.valid()+7]
+	}
+	return majorTonics[k.valid()+7]
+}
+
+// Tonic returns the pitch class of the key's tonic, 0 for C to 11 for B.
+func (k KeySignature) Tonic() int {
+	// each sharp moves the major tonic a fifth up
+	t := (k.valid()*7%12 + 12) % 12
+	if k.Minor {
+		t = (t + 9) % 12
+	}
+	return t
+}
+
+// PitchClasses returns the pitch classes of the key's scale (natural minor
+// for minor keys) starting with the tonic.
+func (k KeySignature) PitchClasses() []int {
+	intervals := majorIntervals
+	if k.Minor {
+		intervals = minorIntervals
+	}
+	tonic := k.Tonic()
+	pcs := make([]int, len(intervals))
+	for i, iv := range intervals {
+		pcs[i] = (tonic + iv) % 12
+	}
+	return pcs
+}
+
+// Alterations returns the accidental applied to each letter (A to G) by the
+// key signature: 1 for a sharp, -1 for a flat. The letters left natural
+// aren't in the map.
+func (k KeySignature) Alterations() map[byte]int {
+	return keyAlterations(k.valid())
+}
+
+// Spell spells the midi note in the key, see SpellNote.
+func (k KeySignature) Spell(note int) Pitch {
+	return SpellNote(note, k.valid())
+}
+
+func (k KeySignature) String() string {
+	if k.Minor {
+		return k.TonicName() + " minor"
+	}
+	return k.TonicName() + " major"
+}
+
+// KeySignature returns the key signature of a key signature event, made of
+// its Key and Scale.
+func (e *Event) KeySignature() KeySignature {
+	return KeySignature{Key: int8(e.Key), Minor: e.Scale == 1}
+}
+
+// KeyChange is a key signature starting at a given tick.
+type KeyChange struct {
+	Tick uint64
+	KeySignature
+}
+
+// KeyTimeline is a list of key changes sorted by tick.
+type KeyTimeline []KeyChange
+
+// KeyTimelineOf extracts the key signatures of the tracks. The key signatures
+// found in any of the tracks apply to all of them which matches how format 1
+// files store their key signatures in the first track.
+func KeyTimelineOf(tracks ...*Track) KeyTimeline {
+	tl := KeyTimeline{}
+	keyCmd := MetaByteMap["Key Signature"]
+	for _, t := range tracks {
+		if t == nil {
+			continue
+		}
+		var tick uint64
+		for _, ev := range t.Events {
+			tick += uint64(ev.TimeDelta)
+			if ev.MsgType == EventByteMap["Meta"] && ev.Cmd == keyCmd {
+				tl = append(tl, KeyChange{Tick: tick, KeySignature: ev.KeySignature()})
+			}
+		}
+	}
+	sort.SliceStable(tl, func(i, j int) bool { return tl[i].Tick < tl[j].Tick })
+	return tl
+}
+
+// KeySignatures returns the key signatures of the track.
+func (t *Track) KeySignatures() KeyTimeline {
+	return KeyTimelineOf(t)
+}
+
+// At returns the key signature active at the passed tick. C major is
+// returned before the first key signature.
+func (tl KeyTimeline) At(tick uint64) KeySignature {
+	i := sort.Search(len(tl), func(i int) bool { return tl[i].Tick > tick })
+	if i == 0 {
+		return KeySignature{}
+	}
+	return tl[i-1].KeySignature
+}
+
+// Spell spells the midi note played at the passed tick using the active key
+// signature.
+func (tl KeyTimeline) Spell(note int, tick uint64) Pitch {
+	return tl.At(tick).Spell(note)
+}
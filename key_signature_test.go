@@ -0,0 +1,147 @@
+package midi
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/mattetti/filebuffer"
+)
+
+func TestKeySignature(t *testing.T) {
+	tests := []struct {
+		key          KeySignature
+		tonic        string
+		pitchClasses []int
+		alterations  map[byte]int
+	}{
+		{KeySignature{}, "C", []int{0, 2, 4, 5, 7, 9, 11}, map[byte]int{}},
+		{KeySignature{Minor: true}, "A", []int{9, 11, 0, 2, 4, 5, 7}, map[byte]int{}},
+		{KeySignature{Key: -3}, "Eb", []int{3, 5, 7, 8, 10, 0, 2}, map[byte]int{'B': -1, 'E': -1, 'A': -1}},
+		{KeySignature{Key: -3, Minor: true}, "C", []int{0, 2, 3, 5, 7, 8, 10}, map[byte]int{'B': -1, 'E': -1, 'A': -1}},
+		{KeySignature{Key: 6}, "F#", []int{6, 8, 10, 11, 1, 3, 5}, map[byte]int{'F': 1, 'C': 1, 'G': 1, 'D': 1, 'A': 1, 'E': 1}},
+		{KeySignature{Key: 7, Minor: true}, "A#", []int{10, 0, 1, 3, 5, 6, 8}, map[byte]int{'F': 1, 'C': 1, 'G': 1, 'D': 1, 'A': 1, 'E': 1, 'B': 1}},
+		{KeySignature{Key: -7}, "Cb", []int{11, 1, 3, 4, 6, 8, 10}, map[byte]int{'B': -1, 'E': -1, 'A': -1, 'D': -1, 'G': -1, 'C': -1, 'F': -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key.String(), func(t *testing.T) {
+			if got := tt.key.TonicName(); got != tt.tonic {
+				t.Errorf("TonicName() = %s, want %s", got, tt.tonic)
+			}
+			if got := tt.key.PitchClasses(); !reflect.DeepEqual(got, tt.pitchClasses) {
+				t.Errorf("PitchClasses() = %v, want %v", got, tt.pitchClasses)
+			}
+			if got := tt.key.Alterations(); !reflect.DeepEqual(got, tt.alterations) {
+				t.Errorf("Alterations() = %v, want %v", got, tt.alterations)
+			}
+			parsed, err := ParseKeySignature(tt.key.String())
+			if err != nil || parsed != tt.key {
+				t.Errorf("ParseKeySignature(%q) = %v, %v", tt.key.String(), parsed, err)
+			}
+		})
+	}
+}
+
+func TestParseKeySignature(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    KeySignature
+		wantErr bool
+	}{
+		{"Bb", KeySignature{Key: -2}, false},
+		{"B♭ major", KeySignature{Key: -2}, false},
+		{"F#m", KeySignature{Key: 3, Minor: true}, false},
+		{"Ebmin", KeySignature{Key: -6, Minor: true}, false},
+		{"eb minor", KeySignature{Key: -6, Minor: true}, false},
+		{"D# major", KeySignature{}, true},
+		{"C dorian", KeySignature{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKeySignature(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeySignature(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("ParseKeySignature(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeySignatureEvent(t *testing.T) {
+	ev := KeySignatureEvent(-3, true)
+	data, err := ev.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x00, 0xFF, 0x59, 0x02, 0xFD, 0x01}; !reflect.DeepEqual(data, want) {
+		t.Errorf("Encode() = % X, want % X", data, want)
+	}
+	if got := ev.String(); got != "Ch 0 @ 0 (0) \tKey Signature -> C minor" {
+		t.Errorf("String() = %q", got)
+	}
+
+	// flat keys survive a round trip
+	w := filebuffer.New(nil)
+	e := NewEncoder(w, SingleTrack, 96)
+	tr := e.NewTrack()
+	tr.Add(0, KeySignatureEvent(-3, true))
+	tr.Add(0, NoteOn(0, 63, 100))
+	tr.Add(4, KeySignatureEvent(2, false))
+	tr.Add(0, NoteOff(0, 63))
+	if err := e.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	dec := NewDecoder(w)
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	tl := dec.Tracks[0].KeySignatures()
+	want := KeyTimeline{
+		{Tick: 0, KeySignature: KeySignature{Key: -3, Minor: true}},
+		{Tick: 384, KeySignature: KeySignature{Key: 2}},
+	}
+	if !reflect.DeepEqual(tl, want) {
+		t.Fatalf("KeySignatures() = %v, want %v", tl, want)
+	}
+
+	// the decoded fields can be edited
+	for _, ev := range dec.Tracks[0].Events {
+		if ev.Cmd == MetaByteMap["Key Signature"] && ev.Key == 2 {
+			ev.Key, ev.Scale = -3, 1
+			data, err := ev.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []byte{0xFF, 0x59, 0x02, 0xFD, 0x01}; !bytes.HasSuffix(data, want) {
+				t.Errorf("Encode() = % X, want the suffix % X", data, want)
+			}
+			if got := ev.KeySignature().String(); got != "C minor" {
+				t.Errorf("KeySignature() = %s, want C minor", got)
+			}
+		}
+	}
+
+	tests := []struct {
+		tick uint64
+		note int
+		want string
+	}{
+		{0, 70, "Bb3"},
+		{383, 66, "Gb3"},
+		{384, 66, "F#3"},
+		{384, 70, "A#3"},
+	}
+	for _, tt := range tests {
+		if got := tl.Spell(tt.note, tt.tick).String(); got != tt.want {
+			t.Errorf("Spell(%d, %d) = %s, want %s", tt.note, tt.tick, got, tt.want)
+		}
+	}
+	if got := (KeyTimeline{}).At(100); got != (KeySignature{}) {
+		t.Errorf("expected C major without key signature, got %v", got)
+	}
+}
@@ -0,0 +1,110 @@
+package lilypond
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/notation"
+)
+
+// Encoder writes midi tracks as a LilyPond score. Each channel of a track
+// with notes becomes a staff named after the track, the notes are snapped to
+// the grid of the notation options, spelled in the key and laid out in
+// measures following the time signatures, key signatures and tempo changes
+// of the tracks.
+type Encoder struct {
+	w                   io.Writer
+	TicksPerQuarterNote uint16
+	Tracks              []*midi.Track
+	// Title is the title of the score, omitted if empty.
+	Title string
+	// Options sets the grid the notes are snapped to, which is also the
+	// shortest duration written, such as c32 on the default grid.
+	Options notation.Options
+}
+
+// NewEncoder returns an encoder writing a LilyPond score to w.
+func NewEncoder(w io.Writer, ppqn uint16) *Encoder {
+	return &Encoder{w: w, TicksPerQuarterNote: ppqn}
+}
+
+// Write notates the tracks and writes the score.
+func (e *Encoder) Write() error {
+	s, err := notation.FromTracks(e.Tracks, e.TicksPerQuarterNote, &e.Options)
+	if err != nil {
+		return err
+	}
+	return e.WriteScore(s)
+}
+
+// WriteScore writes a score notated by the notation package.
+func (e *Encoder) WriteScore(s *notation.Score) error {
+	w := bufio.NewWriter(e.w)
+	fmt.Fprintf(w, "\\version %s\n\n", quote(Version))
+	if e.Title != "" {
+		fmt.Fprintf(w, "\\header {\n  title = %s\n}\n\n", quote(e.Title))
+	}
+	fmt.Fprintf(w, "\\score {\n  <<\n")
+	for i, p := range s.Parts {
+		writeStaff(w, s, p, i == 0)
+	}
+	fmt.Fprintf(w, "  >>\n  \\layout { }\n}\n")
+	return w.Flush()
+}
+
+// writeStaff writes a part as a staff with a line per measure, the tempo
+// changes are only written in the first staff.
+func writeStaff(w *bufio.Writer, s *notation.Score, p *notation.Part, tempos bool) {
+	fmt.Fprintf(w, "    \\new Staff \\with { instrumentName = %s } {\n", quote(p.Name))
+	switch p.Clef {
+	case notation.BassClef:
+		fmt.Fprintf(w, "      \\clef bass\n")
+	case notation.PercussionClef:
+		fmt.Fprintf(w, "      \\clef percussion\n")
+	default:
+		fmt.Fprintf(w, "      \\clef treble\n")
+	}
+	for mi, m := range s.Measures {
+		if m.TimeChange {
+			fmt.Fprintf(w, "      \\time %s\n", timeString(m.Time))
+		}
+		if m.KeyChange {
+			fmt.Fprintf(w, "      \\key %s\n", keyString(m.Key))
+		}
+		var pending []notation.Tempo
+		if tempos {
+			pending = m.Tempos
+			for len(pending) > 0 && pending[0].Offset == 0 {
+				fmt.Fprintf(w, "      %s\n", tempoString(pending[0].BPM))
+				pending = pending[1:]
+			}
+		}
+		voices := p.Measures[mi]
+		music := make([]string, len(voices))
+		for vi, v := range voices {
+			var items []string
+			for _, el := range v.Elements {
+				// the tempo changes are attached to the first voice
+				for vi == 0 && len(pending) > 0 && pending[0].Offset <= el.Offset {
+					items = append(items, tempoString(pending[0].BPM))
+					pending = pending[1:]
+				}
+				items = append(items, elementString(s, m, el))
+			}
+			music[vi] = strings.Join(items, " ")
+		}
+		fmt.Fprintf(w, "      ")
+		for _, t := range pending {
+			fmt.Fprintf(w, "%s ", tempoString(t.BPM))
+		}
+		if len(music) == 1 {
+			fmt.Fprintf(w, "%s |\n", music[0])
+		} else {
+			fmt.Fprintf(w, "<< { %s } >> |\n", strings.Join(music, " } \\\\ { "))
+		}
+	}
+	fmt.Fprintf(w, "      \\bar \"|.\"\n    }\n")
+}
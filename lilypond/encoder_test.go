@@ -0,0 +1,142 @@
+package lilypond
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/internal/miditest"
+)
+
+func TestEncoder_Write(t *testing.T) {
+	tr := miditest.VoicesTrack(`Piano "1"`)
+	// a dotted B natural then a Bb, the tempo and meter change in the third
+	// bar where a low C is held over the bar line
+	tr.AddAfterDelta(0, midi.NoteOn(0, 71, 80))
+	tr.AddAfterDelta(72, midi.NoteOff(0, 71))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 70, 80))
+	tr.AddAfterDelta(24, midi.NoteOff(0, 70))
+	tr.AddAfterDelta(96, &midi.Event{MsgType: 0xF, Cmd: 0x58, TimeSignature: &midi.TimeSignature{Numerator: 6, Denominator: 3}})
+	tr.AddAfterDelta(0, midi.KeySignatureEvent(3, true))
+	tr.AddAfterDelta(48, midi.TempoEvent(120))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 48, 80))
+	tr.AddAfterDelta(384, midi.NoteOff(0, 48))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 66, 80))
+	tr.AddAfterDelta(48, midi.NoteOff(0, 66))
+
+	buf := &bytes.Buffer{}
+	e := NewEncoder(buf, 96)
+	e.Title = "Test"
+	e.Tracks = []*midi.Track{tr}
+	if err := e.Write(); err != nil {
+		t.Fatal(err)
+	}
+	want := `\version "2.24.0"
+
+\header {
+  title = "Test"
+}
+
+\score {
+  <<
+    \new Staff \with { instrumentName = "Piano \"1\"" } {
+      \clef treble
+      \time 3/4
+      \key f \major
+      \tempo 4 = 100
+      << { g'2.~ } \\ { <bes' d''>2 r4 } >> |
+      g'4 b'8. bes'16 r4 |
+      \time 6/8
+      \key fis \minor
+      r8 \tempo 4 = 120 c4~ c4.~ |
+      c4. fis'8 r4 |
+      \bar "|."
+    }
+  >>
+  \layout { }
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPitchName(t *testing.T) {
+	for _, tc := range []struct {
+		letter byte
+		alter  int
+		want   string
+	}{
+		{'C', 0, "c"},
+		{'F', 1, "fis"},
+		{'G', 2, "gisis"},
+		{'B', -1, "bes"},
+		{'E', -1, "es"},
+		{'A', -1, "as"},
+		{'D', -2, "deses"},
+		{'E', -2, "eses"},
+		{'A', -2, "asas"},
+	} {
+		if got := pitchName(tc.letter, tc.alter); got != tc.want {
+			t.Errorf("pitchName(%c, %d) = %q, want %q", tc.letter, tc.alter, got, tc.want)
+		}
+	}
+	for note, want := range map[int]string{60: "'", 71: "'", 48: "", 47: ",", 84: "'''", 0: ",,,,"} {
+		if got := octaveMarks(note); got != want {
+			t.Errorf("octaveMarks(%d) = %q, want %q", note, got, want)
+		}
+	}
+}
+
+func TestEncoder_Write_fixtures(t *testing.T) {
+	miditest.Fixtures(t, func(t *testing.T, d *midi.Decoder) {
+		buf := &bytes.Buffer{}
+		e := NewEncoder(buf, d.TicksPerQuarterNote)
+		e.Tracks = d.Tracks
+		if err := e.Write(); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+		if strings.Count(out, "{") != strings.Count(out, "}") || strings.Count(out, "<<") != strings.Count(out, ">>") {
+			t.Errorf("unbalanced braces in\n%s", out)
+		}
+		// every note of the file is written
+		if got, want := writtenNotes(out), len(miditest.NotePitches(d.Tracks...)); got != want {
+			t.Errorf("expected %d notes, got %d", want, got)
+		}
+	})
+}
+
+// notePattern matches a note or a pitch of a chord: the chord brackets, the
+// pitch, the duration and the tie.
+var notePattern = regexp.MustCompile(`^<?[a-g](?:isis|eses|is|es)?[',]*>?(\d+\.*)?(~?)$`)
+
+// writtenNotes returns the number of notes of the measures of a score, the
+// notes tied to the following ones aren't counted.
+func writtenNotes(score string) int {
+	var notes, pitches int
+	for _, line := range strings.Split(score, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasSuffix(line, "|") {
+			continue
+		}
+		for _, token := range strings.Fields(line) {
+			m := notePattern.FindStringSubmatch(token)
+			if m == nil {
+				continue
+			}
+			pitches++
+			// the duration ends the note or the chord
+			if m[1] == "" {
+				continue
+			}
+			if m[2] == "" {
+				notes += pitches
+			}
+			pitches = 0
+		}
+	}
+	return notes
+}
@@ -0,0 +1,116 @@
+// Package lilypond writes midi tracks as LilyPond source files
+// (https://lilypond.org) which can be typeset into scores and parts.
+package lilypond
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/notation"
+)
+
+// Version is the LilyPond version the files are written for.
+const Version = "2.24.0"
+
+// elementString returns the LilyPond notation of a note, chord or rest.
+func elementString(s *notation.Score, m *notation.Measure, el *notation.Element) string {
+	if el.MeasureRest {
+		length := big.NewRat(int64(m.Length), int64(4*s.Divisions))
+		if length.Cmp(big.NewRat(1, 1)) == 0 {
+			return "R1"
+		}
+		return "R1*" + length.String()
+	}
+	duration := fmt.Sprintf("%d%s", el.Value, strings.Repeat(".", el.Dots))
+	if el.Rest() {
+		return "r" + duration
+	}
+	var b strings.Builder
+	if len(el.Pitches) > 1 {
+		b.WriteByte('<')
+	}
+	for i, p := range el.Pitches {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(pitchName(p.Letter, p.Alter))
+		b.WriteString(octaveMarks(p.Note - p.Alter))
+	}
+	if len(el.Pitches) > 1 {
+		b.WriteByte('>')
+	}
+	b.WriteString(duration)
+	if el.TieStart {
+		b.WriteByte('~')
+	}
+	return b.String()
+}
+
+// pitchName returns the name of a pitch class in the default (Dutch) note
+// names: bes for B flat, fis for F sharp, es and as for E and A flat.
+func pitchName(letter byte, alter int) string {
+	name := strings.ToLower(string(letter))
+	flat := "es"
+	if name == "e" || name == "a" {
+		flat = "s"
+	}
+	switch alter {
+	case 1:
+		return name + "is"
+	case 2:
+		return name + "isis"
+	case -1:
+		return name + flat
+	case -2:
+		if flat == "s" {
+			// eses and asas
+			return name + flat + name + flat
+		}
+		return name + flat + flat
+	}
+	return name
+}
+
+// octaveMarks returns the octave marks of a natural midi note in absolute
+// mode, where c' is the middle C.
+func octaveMarks(natural int) string {
+	octave := natural/12 - 4
+	if natural < 0 {
+		octave = (natural-11)/12 - 4
+	}
+	if octave > 0 {
+		return strings.Repeat("'", octave)
+	}
+	return strings.Repeat(",", -octave)
+}
+
+func timeString(ts midi.TimeSignature) string {
+	num := int(ts.Numerator)
+	if num == 0 {
+		num = 4
+	}
+	return fmt.Sprintf("%d/%d", num, ts.Denum())
+}
+
+func keyString(ks midi.KeySignature) string {
+	// the tonic is altered as in the key signature
+	tonic := ks.TonicName()[0]
+	mode := "\\major"
+	if ks.Minor {
+		mode = "\\minor"
+	}
+	return pitchName(tonic, ks.Alterations()[tonic]) + " " + mode
+}
+
+func tempoString(bpm float64) string {
+	return fmt.Sprintf("\\tempo 4 = %d", int(math.Round(bpm)))
+}
+
+// quote returns a LilyPond string.
+func quote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
@@ -0,0 +1,481 @@
+package midi
+
+import "sort"
+
+const (
+	// MPELowerManager is the manager channel of the MPE lower zone.
+	MPELowerManager = 0
+	// MPEUpperManager is the manager channel of the MPE upper zone.
+	MPEUpperManager = 15
+	// MPEMemberBendRange is the default pitch bend range in semitones of the
+	// member channels of a MPE zone.
+	MPEMemberBendRange = 48.0
+	// MPETimbreController is the controller used for the per note timbre
+	// (third dimension of control) in MPE.
+	MPETimbreController = 74
+)
+
+// MPEZone is a MIDI Polyphonic Expression zone: a manager channel used for
+// the zone wide messages and member channels each playing a single note so
+// its pitch bend, timbre and pressure can be controlled independently.
+type MPEZone struct {
+	// Manager is the manager channel of the zone, MPELowerManager or
+	// MPEUpperManager.
+	Manager uint8
+	// MemberChannels is the number of member channels of the zone, 0 when
+	// the zone is disabled.
+	MemberChannels int
+}
+
+// MPELowerZone returns a lower zone (manager channel 1) using the passed
+// number of member channels starting at channel 2.
+func MPELowerZone(members int) MPEZone {
+	return MPEZone{Manager: MPELowerManager, MemberChannels: clampMembers(members)}
+}
+
+// MPEUpperZone returns an upper zone (manager channel 16) using the passed
+// number of member channels going down from channel 15.
+func MPEUpperZone(members int) MPEZone {
+	return MPEZone{Manager: MPEUpperManager, MemberChannels: clampMembers(members)}
+}
+
+func clampMembers(members int) int {
+	if members < 0 {
+		return 0
+	}
+	if members > 15 {
+		return 15
+	}
+	return members
+}
+
+// Enabled indicates whether the zone has member channels.
+func (z MPEZone) Enabled() bool {
+	return z.MemberChannels > 0
+}
+
+// Members returns the member channels of the zone, starting next to the
+// manager channel.
+func (z MPEZone) Members() []uint8 {
+	members := make([]uint8, 0, z.MemberChannels)
+	for i := 1; i <= z.MemberChannels; i++ {
+		if z.Manager == MPEUpperManager {
+			members = append(members, uint8(MPEUpperManager-i))
+		} else {
+			members = append(members, uint8(MPELowerManager+i))
+		}
+	}
+	return members
+}
+
+// IsMember indicates whether the channel is a member channel of the zone.
+func (z MPEZone) IsMember(channel uint8) bool {
+	if z.Manager == MPEUpperManager {
+		return channel < MPEUpperManager && int(channel) >= MPEUpperManager-z.MemberChannels
+	}
+	return channel > MPELowerManager && int(channel) <= MPELowerManager+z.MemberChannels
+}
+
+// Events returns the MPE configuration message (MCM) setting up the zone.
+// A zone is disabled by sending a MCM with 0 member channels.
+func (z MPEZone) Events() []*Event {
+	return RPN(int(z.Manager), RPNMPEConfiguration, uint16(z.MemberChannels)<<7)
+}
+
+// MPEConfig is the MPE zone layout of the 16 channels.
+type MPEConfig struct {
+	Lower MPEZone
+	Upper MPEZone
+}
+
+// Set configures a zone. Following the MPE specification, the other zone
+// shrinks if both zones would overlap and is disabled if no member channel
+// is left to it.
+func (c *MPEConfig) Set(zone MPEZone) {
+	zone.MemberChannels = clampMembers(zone.MemberChannels)
+	if zone.Manager == MPEUpperManager {
+		c.Upper = zone
+		if c.Lower.MemberChannels+zone.MemberChannels > 14 {
+			c.Lower.MemberChannels = clampMembers(14 - zone.MemberChannels)
+		}
+		return
+	}
+	c.Lower = MPEZone{Manager: MPELowerManager, MemberChannels: zone.MemberChannels}
+	if c.Upper.MemberChannels+zone.MemberChannels > 14 {
+		c.Upper.MemberChannels = clampMembers(14 - zone.MemberChannels)
+	}
+}
+
+// Zone returns the zone the channel belongs to, as a manager or a member
+// channel, and false if the channel isn't part of an enabled zone.
+func (c MPEConfig) Zone(channel uint8) (MPEZone, bool) {
+	for _, z := range []MPEZone{c.Lower, c.Upper} {
+		if z.Enabled() && (z.Manager == channel || z.IsMember(channel)) {
+			return z, true
+		}
+	}
+	return MPEZone{}, false
+}
+
+// ExpressionPoint is the value of an expression dimension from a given tick.
+type ExpressionPoint struct {
+	Tick  uint64
+	Value float64
+}
+
+// ExpressionCurve is a list of expression values sorted by tick. Values are
+// held until the next point.
+type ExpressionCurve []ExpressionPoint
+
+// At returns the value of the curve at the passed tick or def if the curve
+// starts after the tick.
+func (c ExpressionCurve) At(tick uint64, def float64) float64 {
+	i := sort.Search(len(c), func(i int) bool { return c[i].Tick > tick })
+	if i == 0 {
+		return def
+	}
+	return c[i-1].Value
+}
+
+// set adds a point to the curve, replacing the last point if it's at the
+// same tick.
+func (c ExpressionCurve) set(tick uint64, value float64) ExpressionCurve {
+	if n := len(c); n > 0 && c[n-1].Tick == tick {
+		c[n-1].Value = value
+		return c
+	}
+	return append(c, ExpressionPoint{Tick: tick, Value: value})
+}
+
+// MPENote is a note with its own expression curves. With MPE, each note is
+// played on its own member channel so the channel's pitch bend, timbre (CC74)
+// and pressure only apply to that note.
+type MPENote struct {
+	Channel         uint8
+	Note            uint8
+	Velocity        uint8
+	ReleaseVelocity uint8
+	// Start and End are the ticks of the note on and note off.
+	Start uint64
+	End   uint64
+	// PitchBend is the bend of the note in semitones, it includes the zone
+	// wide bend of the manager channel.
+	PitchBend ExpressionCurve
+	// Timbre is the value of the timbre controller (CC74) from 0 to 127.
+	Timbre ExpressionCurve
+	// Pressure is the channel or polyphonic pressure from 0 to 127.
+	Pressure ExpressionCurve
+}
+
+// AbsEv returns the note without its expression.
+func (n *MPENote) AbsEv() *AbsEv {
+	return &AbsEv{
+		Start:    int(n.Start),
+		Duration: int(n.End - n.Start),
+		Vel:      int(n.Velocity),
+		MIDINote: int(n.Note),
+	}
+}
+
+// PitchAt returns the sounding pitch of the note at the passed tick as a
+// fractional midi note number.
+func (n *MPENote) PitchAt(tick uint64) float64 {
+	return float64(n.Note) + n.PitchBend.At(tick, 0)
+}
+
+// mpeChannel is the expression state of a channel.
+type mpeChannel struct {
+	timbre   float64
+	pressure float64
+}
+
+// MPEDecoder turns the events of a MPE stream into notes with per note
+// expression. The zones are configured by the MPE configuration messages
+// (RPN 6) found in the stream, pitch bend ranges by RPN 0.
+type MPEDecoder struct {
+	Config MPEConfig
+	ctrl   *ControllerDecoder
+	bends  *BendTracker
+	state  [16]mpeChannel
+	active map[[2]uint8]*MPENote
+	notes  []*MPENote
+	tick   uint64
+}
+
+// NewMPEDecoder returns a decoder starting with the passed configuration, use
+// an empty configuration to only rely on the configuration messages of the
+// stream.
+func NewMPEDecoder(cfg MPEConfig) *MPEDecoder {
+	d := &MPEDecoder{
+		ctrl:   NewControllerDecoder(),
+		bends:  NewBendTracker(DefaultPitchBendRange),
+		active: map[[2]uint8]*MPENote{},
+	}
+	for i := range d.state {
+		d.state[i].timbre = 64
+	}
+	d.configure(cfg.Lower)
+	d.configure(cfg.Upper)
+	return d
+}
+
+// configure sets a zone up and resets the bend ranges of its channels to the
+// MPE defaults.
+func (d *MPEDecoder) configure(zone MPEZone) {
+	d.Config.Set(zone)
+	if !zone.Enabled() {
+		return
+	}
+	d.bends.SetRange(zone.Manager, DefaultPitchBendRange)
+	for _, ch := range zone.Members() {
+		d.bends.SetRange(ch, MPEMemberBendRange)
+	}
+}
+
+// bend returns the current bend in semitones of a note played on the channel.
+func (d *MPEDecoder) bend(channel uint8) float64 {
+	semitones := d.bends.Semitones(channel)
+	if zone, ok := d.Config.Zone(channel); ok && zone.Manager != channel {
+		semitones += d.bends.Semitones(zone.Manager)
+	}
+	return semitones
+}
+
+// Feed processes an event at the passed tick. Ticks must not go backwards.
+func (d *MPEDecoder) Feed(tick uint64, ev *Event) {
+	if ev == nil {
+		return
+	}
+	d.tick = tick
+	ch := ev.MsgChan & 0x0F
+	st := &d.state[ch]
+	switch ev.MsgType {
+	case EventByteMap["NoteOn"], EventByteMap["NoteOff"]:
+		id := [2]uint8{ch, ev.Note}
+		if n, ok := d.active[id]; ok {
+			n.End = tick
+			if ev.MsgType == EventByteMap["NoteOff"] {
+				n.ReleaseVelocity = ev.Velocity
+			}
+			delete(d.active, id)
+		}
+		if ev.MsgType == EventByteMap["NoteOff"] || ev.Velocity == 0 {
+			return
+		}
+		n := &MPENote{Channel: ch, Note: ev.Note, Velocity: ev.Velocity, Start: tick, End: tick}
+		n.PitchBend = n.PitchBend.set(tick, d.bend(ch))
+		n.Timbre = n.Timbre.set(tick, st.timbre)
+		n.Pressure = n.Pressure.set(tick, st.pressure)
+		d.active[id] = n
+		d.notes = append(d.notes, n)
+	case EventByteMap["AfterTouch"]:
+		if n, ok := d.active[[2]uint8{ch, ev.Note}]; ok {
+			n.Pressure = n.Pressure.set(tick, float64(ev.Velocity))
+		}
+	case EventByteMap["ChannelAfterTouch"]:
+		st.pressure = float64(ev.Pressure)
+		for _, n := range d.activeOn(ch) {
+			n.Pressure = n.Pressure.set(tick, st.pressure)
+		}
+	case EventByteMap["PitchWheelChange"]:
+		d.bends.Feed(tick, ev)
+		notes := d.activeOn(ch)
+		if zone, ok := d.Config.Zone(ch); ok && zone.Manager == ch {
+			// zone wide bend, applied to all the notes of the zone
+			for _, n := range d.active {
+				if zone.IsMember(n.Channel) {
+					notes = append(notes, n)
+				}
+			}
+		}
+		for _, n := range notes {
+			n.PitchBend = n.PitchBend.set(tick, d.bend(n.Channel))
+		}
+	case EventByteMap["ControlChange"]:
+		if ev.Controller == MPETimbreController {
+			st.timbre = float64(ev.NewValue)
+			for _, n := range d.activeOn(ch) {
+				n.Timbre = n.Timbre.set(tick, st.timbre)
+			}
+			return
+		}
+		change, ok := d.ctrl.Feed(tick, ev)
+		if !ok || change.Kind != RPNParam {
+			return
+		}
+		switch {
+		case change.Number == RPNPitchBendSensitivity:
+			d.bends.SetRange(ch, PitchBendRange(change.Value))
+		case change.Number == RPNMPEConfiguration && (ch == MPELowerManager || ch == MPEUpperManager):
+			d.configure(MPEZone{Manager: ch, MemberChannels: int(change.MSB())})
+		}
+	}
+}
+
+// activeOn returns the notes currently held on the channel.
+func (d *MPEDecoder) activeOn(channel uint8) []*MPENote {
+	var notes []*MPENote
+	for id, n := range d.active {
+		if id[0] == channel {
+			notes = append(notes, n)
+		}
+	}
+	return notes
+}
+
+// Notes returns the decoded notes sorted by start tick. Notes still held are
+// ended at the last tick fed to the decoder.
+func (d *MPEDecoder) Notes() []*MPENote {
+	for _, n := range d.active {
+		n.End = d.tick
+	}
+	return d.notes
+}
+
+// MPENotes decodes the notes of the track with their per note expression.
+// The zones are configured by the passed configuration and the MPE
+// configuration messages of the track.
+func (t *Track) MPENotes(cfg MPEConfig) []*MPENote {
+	d := NewMPEDecoder(cfg)
+	if t == nil {
+		return d.Notes()
+	}
+	var tick uint64
+	for _, ev := range t.Events {
+		tick += uint64(ev.TimeDelta)
+		d.Feed(tick, ev)
+	}
+	return d.Notes()
+}
+
+// MPEEncoder writes notes with per note expression to a MPE zone, allocating
+// a member channel to each note.
+type MPEEncoder struct {
+	Zone MPEZone
+	// BendRange is the pitch bend range of the member channels in semitones,
+	// MPEMemberBendRange is used if 0 or less.
+	BendRange float64
+}
+
+// NewMPEEncoder returns an encoder writing to the passed zone with the default
+// member channel bend range.
+func NewMPEEncoder(zone MPEZone) *MPEEncoder {
+	return &MPEEncoder{Zone: zone, BendRange: MPEMemberBendRange}
+}
+
+// mpeSlot is the allocation state of a member channel.
+type mpeSlot struct {
+	channel uint8
+	// busyUntil is the end tick of the last note allocated to the channel
+	busyUntil uint64
+	// lastStart is the start tick of the last note allocated to the channel
+	lastStart uint64
+	used      bool
+}
+
+// allocate picks the member channel for a note starting at the passed tick:
+// the free channel released the longest time ago so release tails aren't
+// disturbed or, when all channels are busy, the channel playing the oldest
+// note.
+func allocate(slots []*mpeSlot, start uint64) *mpeSlot {
+	var best *mpeSlot
+	for _, s := range slots {
+		if s.used && s.busyUntil > start {
+			continue
+		}
+		if best == nil || (best.used && (!s.used || s.busyUntil < best.busyUntil)) {
+			best = s
+		}
+	}
+	if best != nil {
+		return best
+	}
+	best = slots[0]
+	for _, s := range slots[1:] {
+		if s.lastStart < best.lastStart {
+			best = s
+		}
+	}
+	return best
+}
+
+// Track returns a track with the MPE configuration message of the zone, the
+// bend range of the member channels and the notes. Each note is allocated a
+// member channel and its initial expression is sent on that channel right
+// before its note on, the channel the note was originally played on is
+// ignored.
+func (e *MPEEncoder) Track(notes []*MPENote) *Track {
+	track := &Track{}
+	if !e.Zone.Enabled() {
+		return track
+	}
+	bendRange := e.BendRange
+	if bendRange <= 0 {
+		bendRange = MPEMemberBendRange
+	}
+
+	events := e.Zone.Events()
+	members := e.Zone.Members()
+	semitones := int(bendRange)
+	cents := int((bendRange-float64(semitones))*100 + 0.5)
+	for _, ch := range members {
+		events = append(events, PitchBendSensitivity(int(ch), semitones, cents)...)
+	}
+
+	sorted := make([]*MPENote, len(notes))
+	copy(sorted, notes)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	slots := make([]*mpeSlot, len(members))
+	for i, ch := range members {
+		slots[i] = &mpeSlot{channel: ch}
+	}
+	for _, n := range sorted {
+		slot := allocate(slots, n.Start)
+		slot.used, slot.lastStart = true, n.Start
+		if n.End > slot.busyUntil {
+			slot.busyUntil = n.End
+		}
+		ch := int(slot.channel)
+		at := func(tick uint64, ev *Event) {
+			ev.AbsTicks = tick
+			events = append(events, ev)
+		}
+		// initial expression of the note
+		at(n.Start, PitchBendSemitones(ch, n.PitchBend.At(n.Start, 0), bendRange))
+		at(n.Start, ControlChange(ch, MPETimbreController, int(n.Timbre.At(n.Start, 64)+0.5)))
+		at(n.Start, ChannelAfterTouch(ch, int(n.Pressure.At(n.Start, 0)+0.5)))
+		at(n.Start, NoteOn(ch, int(n.Note), int(n.Velocity)))
+		for _, p := range n.PitchBend {
+			if p.Tick > n.Start && p.Tick < n.End {
+				at(p.Tick, PitchBendSemitones(ch, p.Value, bendRange))
+			}
+		}
+		for _, p := range n.Timbre {
+			if p.Tick > n.Start && p.Tick < n.End {
+				at(p.Tick, ControlChange(ch, MPETimbreController, int(p.Value+0.5)))
+			}
+		}
+		for _, p := range n.Pressure {
+			if p.Tick > n.Start && p.Tick < n.End {
+				at(p.Tick, ChannelAfterTouch(ch, int(p.Value+0.5)))
+			}
+		}
+		off := NoteOff(ch, int(n.Note))
+		if n.ReleaseVelocity > 0 {
+			off.Velocity = n.ReleaseVelocity
+		}
+		at(n.End, off)
+	}
+
+	// the events of a note are generated in order and the notes are sorted
+	// by start so a stable sort keeps note offs before the expression of the
+	// next note allocated to the same channel.
+	sort.SliceStable(events, func(i, j int) bool { return events[i].AbsTicks < events[j].AbsTicks })
+	var last uint64
+	for _, ev := range events {
+		track.AddAfterDelta(uint32(ev.AbsTicks-last), ev)
+		last = ev.AbsTicks
+	}
+	return track
+}
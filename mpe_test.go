@@ -0,0 +1,162 @@
+package midi
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// roundBends rounds the pitch bends of the notes to the cent to ignore the
+// pitch wheel resolution.
+func roundBends(notes []*MPENote) []*MPENote {
+	for _, n := range notes {
+		for i, p := range n.PitchBend {
+			n.PitchBend[i].Value = math.Round(p.Value*100) / 100
+		}
+	}
+	return notes
+}
+
+func TestMPEConfig_Set(t *testing.T) {
+	tests := []struct {
+		name  string
+		zones []MPEZone
+		want  MPEConfig
+	}{
+		{"lower zone", []MPEZone{MPELowerZone(15)}, MPEConfig{Lower: MPELowerZone(15)}},
+		{"split", []MPEZone{MPELowerZone(7), MPEUpperZone(7)},
+			MPEConfig{Lower: MPELowerZone(7), Upper: MPEUpperZone(7)}},
+		{"upper shrinks lower", []MPEZone{MPELowerZone(10), MPEUpperZone(6)},
+			MPEConfig{Lower: MPELowerZone(8), Upper: MPEUpperZone(6)}},
+		{"lower disables upper", []MPEZone{MPEUpperZone(3), MPELowerZone(15)},
+			MPEConfig{Lower: MPELowerZone(15), Upper: MPEUpperZone(0)}},
+		{"disabled", []MPEZone{MPELowerZone(15), MPELowerZone(0)}, MPEConfig{Lower: MPELowerZone(0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg MPEConfig
+			for _, z := range tt.zones {
+				cfg.Set(z)
+			}
+			if !reflect.DeepEqual(cfg, tt.want) {
+				t.Errorf("got %+v, want %+v", cfg, tt.want)
+			}
+		})
+	}
+}
+
+func TestMPEZone_Members(t *testing.T) {
+	if got, want := MPEUpperZone(3).Members(), []uint8{14, 13, 12}; !reflect.DeepEqual(got, want) {
+		t.Errorf("upper zone members = %v, want %v", got, want)
+	}
+	lower := MPELowerZone(2)
+	if got, want := lower.Members(), []uint8{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lower zone members = %v, want %v", got, want)
+	}
+	if lower.IsMember(0) || !lower.IsMember(2) || lower.IsMember(3) {
+		t.Errorf("unexpected member channels for %+v", lower)
+	}
+}
+
+func TestTrack_MPENotes(t *testing.T) {
+	tr := &Track{}
+	add := func(delta uint32, evs ...*Event) {
+		for i, ev := range evs {
+			if i > 0 {
+				delta = 0
+			}
+			tr.AddAfterDelta(delta, ev)
+		}
+	}
+	add(0, MPELowerZone(4).Events()...)
+	// first note on member channel 2 with its initial expression
+	add(0, PitchBendSemitones(1, 0, 48), ControlChange(1, 74, 30), ChannelAfterTouch(1, 0), NoteOn(1, 60, 100))
+	// second note on member channel 3
+	add(10, NoteOn(2, 64, 90))
+	// per note expression
+	add(10, PitchBendSemitones(1, 12, 48), ChannelAfterTouch(2, 80))
+	// zone wide bend on the manager channel (2 semitone range)
+	add(10, PitchBendSemitones(0, -1, 2))
+	add(10, NoteOff(1, 60))
+	add(10, ControlChange(2, 74, 100))
+	off := NoteOff(2, 64)
+	off.Velocity = 20
+	add(10, off)
+
+	notes := roundBends(tr.MPENotes(MPEConfig{}))
+	want := []*MPENote{
+		{Channel: 1, Note: 60, Velocity: 100, Start: 0, End: 40, ReleaseVelocity: 64,
+			PitchBend: ExpressionCurve{{0, 0}, {20, 12}, {30, 11}},
+			Timbre:    ExpressionCurve{{0, 30}},
+			Pressure:  ExpressionCurve{{0, 0}},
+		},
+		{Channel: 2, Note: 64, Velocity: 90, Start: 10, End: 60, ReleaseVelocity: 20,
+			PitchBend: ExpressionCurve{{10, 0}, {30, -1}},
+			Timbre:    ExpressionCurve{{10, 64}, {50, 100}},
+			Pressure:  ExpressionCurve{{10, 0}, {20, 80}},
+		},
+	}
+	if !reflect.DeepEqual(notes, want) {
+		for i, n := range notes {
+			t.Logf("note %d: %+v", i, n)
+		}
+		t.Fatalf("unexpected notes")
+	}
+	if got := notes[0].PitchAt(25); got != 72 {
+		t.Errorf("expected the first note to sound at 72 at tick 25, got %f", got)
+	}
+	if got := notes[1].Timbre.At(5, 64); got != 64 {
+		t.Errorf("expected the default value before the curve starts, got %f", got)
+	}
+}
+
+func TestMPEEncoder_Track(t *testing.T) {
+	notes := []*MPENote{
+		{Note: 60, Velocity: 100, Start: 0, End: 100,
+			PitchBend: ExpressionCurve{{0, 0}, {50, 2}},
+			Timbre:    ExpressionCurve{{0, 64}},
+			Pressure:  ExpressionCurve{{0, 10}, {20, 90}},
+		},
+		{Note: 64, Velocity: 90, Start: 10, End: 40,
+			PitchBend: ExpressionCurve{{10, -0.5}},
+			Timbre:    ExpressionCurve{{10, 20}},
+			Pressure:  ExpressionCurve{{10, 0}},
+		},
+		{Note: 67, Velocity: 80, Start: 40, End: 60,
+			PitchBend: ExpressionCurve{{40, 0}},
+			Timbre:    ExpressionCurve{{40, 64}},
+			Pressure:  ExpressionCurve{{40, 0}},
+		},
+	}
+	enc := NewMPEEncoder(MPELowerZone(2))
+	tr := enc.Track(notes)
+
+	got := roundBends(tr.MPENotes(MPEConfig{}))
+	channels := []uint8{}
+	for i, n := range got {
+		channels = append(channels, n.Channel)
+		n.Channel = 0
+		n.ReleaseVelocity = 0
+		if !reflect.DeepEqual(n, notes[i]) {
+			t.Errorf("note %d: got %+v, want %+v", i, n, notes[i])
+		}
+	}
+	// with two member channels, the third note takes the channel released
+	// by the second note
+	if want := []uint8{1, 2, 2}; !reflect.DeepEqual(channels, want) {
+		t.Errorf("allocated channels %v, want %v", channels, want)
+	}
+
+	// all channels busy, the channel of the oldest note is stolen
+	notes = append(notes, &MPENote{Note: 72, Velocity: 70, Start: 50, End: 80})
+	channels = channels[:0]
+	for _, n := range enc.Track(notes).MPENotes(MPEConfig{}) {
+		channels = append(channels, n.Channel)
+	}
+	if want := []uint8{1, 2, 2, 1}; !reflect.DeepEqual(channels, want) {
+		t.Errorf("allocated channels %v, want %v", channels, want)
+	}
+	if enc := NewMPEEncoder(MPELowerZone(0)); len(enc.Track(notes).Events) != 0 {
+		t.Errorf("expected no events for a disabled zone")
+	}
+}
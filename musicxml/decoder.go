@@ -0,0 +1,604 @@
+package musicxml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-audio/midi"
+)
+
+// DefaultTicksPerQuarterNote is the resolution of the decoded tracks unless
+// set otherwise.
+const DefaultTicksPerQuarterNote = 480
+
+// defaultVelocity is the velocity of the notes before any dynamics, the
+// MusicXML forte.
+const defaultVelocity = 90
+
+// Warning reports a MusicXML element of a part which isn't converted as
+// written, such as an unsupported notation or a part sharing its channel.
+type Warning struct {
+	// Part is the id of the part.
+	Part string
+	// Measure is the number of the first measure with the element.
+	Measure string
+	// Element is the name of the element.
+	Element string
+	// Message describes what happened to the element.
+	Message string
+	// Count is the number of occurrences of the element in the part.
+	Count int
+}
+
+func (w Warning) String() string {
+	s := "part " + w.Part
+	if w.Measure != "" {
+		s += ", measure " + w.Measure
+	}
+	s += fmt.Sprintf(": <%s> %s", w.Element, w.Message)
+	if w.Count > 1 {
+		s += fmt.Sprintf(" (%d times)", w.Count)
+	}
+	return s
+}
+
+// layoutElements are the elements which don't affect the playback, they are
+// dropped without warnings.
+var layoutElements = map[string]bool{
+	// measure
+	"print": true, "bookmark": true, "link": true, "grouping": true,
+	// attributes
+	"staves": true, "part-symbol": true, "instruments": true, "staff-details": true,
+	"measure-style": true, "footnote": true, "level": true,
+	// notes, the durations already include the tuplet ratios
+	"stem": true, "beam": true, "notehead": true, "notehead-text": true,
+	"staff": true, "instrument": true, "time-modification": true,
+}
+
+// dynamicsVelocities maps the dynamic marks to velocities.
+var dynamicsVelocities = map[string]int{
+	"pppppp": 4, "ppppp": 8, "pppp": 12, "ppp": 16, "pp": 33, "p": 49,
+	"mp": 64, "mf": 80, "f": 96, "ff": 112, "fff": 120, "ffff": 124,
+	"fffff": 126, "ffffff": 127, "sf": 112, "sfz": 112, "fz": 112, "sffz": 120,
+	"rfz": 112, "fp": 96, "sfp": 112,
+}
+
+// stepPitchClasses maps the note steps to their pitch class.
+var stepPitchClasses = map[string]int{"C": 0, "D": 2, "E": 4, "F": 5, "G": 7, "A": 9, "B": 11}
+
+// Decoder reads a MusicXML partwise score into midi tracks: a conductor
+// track with the time signatures, key signatures and tempo changes followed
+// by a track per part. Elements which can't be converted are reported in
+// Warnings.
+type Decoder struct {
+	r io.Reader
+	// TicksPerQuarterNote is the resolution of the decoded tracks,
+	// DefaultTicksPerQuarterNote if not set before decoding.
+	TicksPerQuarterNote uint16
+	// Format is the midi file format of the decoded tracks.
+	Format uint16
+	// Title is the title of the work or of the movement.
+	Title    string
+	Tracks   []*midi.Track
+	Warnings []Warning
+}
+
+// NewDecoder returns a decoder reading a MusicXML score from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, TicksPerQuarterNote: DefaultTicksPerQuarterNote}
+}
+
+// Decode parses the score and converts its parts. Notes, rests, chords,
+// ties, backups and forwards, divisions, tempos, dynamics, time signatures,
+// key signatures and transpositions are converted, the program, volume and
+// pan of the parts are set from their midi instrument.
+func (d *Decoder) Decode() error {
+	var doc scorePartwise
+	if err := xml.NewDecoder(d.r).Decode(&doc); err != nil {
+		return fmt.Errorf("musicxml: %v", err)
+	}
+	if d.TicksPerQuarterNote == 0 {
+		d.TicksPerQuarterNote = DefaultTicksPerQuarterNote
+	}
+	d.Format = midi.Syncronous
+	switch {
+	case doc.Work != nil && doc.Work.Title != "":
+		d.Title = doc.Work.Title
+	default:
+		d.Title = doc.MovementTitle
+	}
+
+	im := &importer{
+		ppq:      float64(d.TicksPerQuarterNote),
+		conducts: map[string]bool{},
+		warnings: map[string]int{},
+	}
+	scoreParts := map[string]scorePart{}
+	for _, sp := range doc.PartList.ScoreParts {
+		scoreParts[sp.ID] = sp
+	}
+	channels := im.channels(doc.Parts, scoreParts)
+	parts := [][]*midi.Event{}
+	for i, p := range doc.Parts {
+		sp, ok := scoreParts[p.ID]
+		if !ok {
+			sp = scorePart{ID: p.ID}
+		}
+		parts = append(parts, im.convertPart(sp, p, channels[i]))
+	}
+
+	conductor := []*midi.Event{}
+	if d.Title != "" {
+		conductor = append(conductor, midi.TrackName(d.Title))
+	}
+	conductor = append(conductor, im.conductor...)
+	d.Tracks = []*midi.Track{newTrack(conductor, im.end)}
+	for _, events := range parts {
+		// the time signatures are copied in each track so the encoder doesn't
+		// add its default one
+		for _, ev := range im.meters {
+			c := ev.Copy()
+			c.AbsTicks = ev.AbsTicks
+			events = append(events, c)
+		}
+		d.Tracks = append(d.Tracks, newTrack(events, im.end))
+	}
+	d.Warnings = im.warningList
+	return nil
+}
+
+// importer holds the state shared by the parts during the conversion.
+type importer struct {
+	ppq float64
+	// conductor holds the tempo, time and key signature events and meters
+	// the time signature events.
+	conductor []*midi.Event
+	meters    []*midi.Event
+	// conducts dedups the conductor events found in several parts
+	conducts    map[string]bool
+	end         uint64
+	warnings    map[string]int
+	warningList []Warning
+}
+
+// partState is the state of the conversion of a part.
+type partState struct {
+	divisions float64
+	// positions are in quarter notes
+	pos, lastStart float64
+	velocity       int
+	transpose      int
+	measure        string
+	notes          []partNote
+	// tied maps the pitches of the notes tied to the next note to their
+	// index in notes
+	tied map[int]int
+}
+
+type partNote struct {
+	start, end float64
+	pitch, vel int
+}
+
+func (im *importer) tick(pos float64) uint64 {
+	if pos <= 0 {
+		return 0
+	}
+	return uint64(math.Round(pos * im.ppq))
+}
+
+func (im *importer) warn(part, measure, element, message string) {
+	key := part + "\x00" + element + "\x00" + message
+	if i, ok := im.warnings[key]; ok {
+		im.warningList[i].Count++
+		return
+	}
+	im.warnings[key] = len(im.warningList)
+	im.warningList = append(im.warningList, Warning{Part: part, Measure: measure, Element: element, Message: message, Count: 1})
+}
+
+func (im *importer) warnOthers(st *partState, part string, others []other) {
+	for _, o := range others {
+		if !layoutElements[o.XMLName.Local] {
+			im.warn(part, st.measure, o.XMLName.Local, "isn't supported")
+		}
+	}
+}
+
+// addConductor adds a conductor event unless an event of the same kind was
+// already added at the same tick by another part.
+func (im *importer) addConductor(ev *midi.Event, pos float64) {
+	ev.AbsTicks = im.tick(pos)
+	key := fmt.Sprintf("%d/%d", ev.Cmd, ev.AbsTicks)
+	if im.conducts[key] {
+		return
+	}
+	im.conducts[key] = true
+	im.conductor = append(im.conductor, ev)
+	if ev.Cmd == midi.MetaByteMap["Time Signature"] {
+		im.meters = append(im.meters, ev)
+	}
+}
+
+// channels returns the channel of each part: the channel of its instrument,
+// the percussion channel for the unpitched parts or the least used of the
+// other channels. The parts sharing a channel are reported, except the
+// unpitched parts sharing the percussion channel.
+func (im *importer) channels(parts []part, scoreParts map[string]scorePart) []uint8 {
+	channels := make([]uint8, len(parts))
+	var used [16]int
+	assigned := make([]bool, len(parts))
+	for i, p := range parts {
+		if sp := scoreParts[p.ID]; len(sp.Midi) > 0 && sp.Midi[0].Channel >= 1 && sp.Midi[0].Channel <= 16 {
+			channels[i], assigned[i] = uint8(sp.Midi[0].Channel-1), true
+		} else if hasUnpitched(p) {
+			channels[i], assigned[i] = 9, true
+		}
+		if assigned[i] {
+			used[channels[i]]++
+		}
+	}
+	for i := range parts {
+		if assigned[i] {
+			continue
+		}
+		ch := 0
+		for c := range used {
+			if c != 9 && used[c] < used[ch] {
+				ch = c
+			}
+		}
+		channels[i] = uint8(ch)
+		used[ch]++
+	}
+	for i, p := range parts {
+		ch := channels[i]
+		if used[ch] > 1 && !(ch == 9 && hasUnpitched(p)) {
+			im.warn(p.ID, "", "score-part", fmt.Sprintf("shares the midi channel %d with another part", ch+1))
+		}
+	}
+	return channels
+}
+
+// convertPart returns the events of a part playing on the passed channel.
+func (im *importer) convertPart(sp scorePart, p part, ch uint8) []*midi.Event {
+	st := &partState{divisions: 1, velocity: defaultVelocity, tied: map[int]int{}}
+	var inst midiInstrument
+	if len(sp.Midi) > 0 {
+		inst = sp.Midi[0]
+		if len(sp.Midi) > 1 {
+			im.warn(p.ID, "", "midi-instrument", "only the first instrument of the part is used")
+		}
+	}
+
+	for _, m := range p.Measures {
+		st.measure = m.Number
+		end := st.pos
+		for _, el := range m.Music {
+			switch v := el.(type) {
+			case *attributes:
+				im.convertAttributes(st, p.ID, v)
+			case *direction:
+				pos := st.pos
+				if v.Offset != nil {
+					pos += *v.Offset / st.divisions
+				}
+				im.convertDirection(st, p.ID, v, pos)
+			case *sound:
+				im.convertSound(st, v, st.pos)
+			case *note:
+				im.convertNote(st, p.ID, v, inst)
+			case *backup:
+				st.pos -= v.Duration / st.divisions
+			case *forward:
+				st.pos += v.Duration / st.divisions
+			case *barline:
+				if v.Repeat != nil || v.Ending != nil {
+					im.warn(p.ID, st.measure, "barline", "repeats and endings aren't expanded")
+				}
+			case *other:
+				im.warnOthers(st, p.ID, []other{*v})
+			}
+			if st.pos > end {
+				end = st.pos
+			}
+		}
+		// the next measure starts after the longest voice
+		st.pos = end
+	}
+	if end := im.tick(st.pos); end > im.end {
+		im.end = end
+	}
+
+	events := []*midi.Event{}
+	if sp.Name != "" {
+		events = append(events, midi.TrackName(sp.Name))
+	}
+	if inst.Program >= 1 && inst.Program <= 128 {
+		events = append(events, midi.ProgramSelect(int(ch), inst.Program-1))
+	}
+	if inst.Volume != nil {
+		events = append(events, midi.ControlChange(int(ch), midi.CCVals["Channel Volume"], clamp7(math.Round(*inst.Volume*127/100))))
+	}
+	if inst.Pan != nil {
+		// -90 is hard left and 90 hard right
+		events = append(events, midi.ControlChange(int(ch), midi.CCVals["Pan"], clamp7(math.Round(64+*inst.Pan*64/90))))
+	}
+	im.warnOthers(st, p.ID, inst.Other)
+	for _, n := range st.notes {
+		if n.pitch < 0 || n.pitch > 127 {
+			im.warn(p.ID, "", "note", fmt.Sprintf("pitch %d out of the midi range ignored", n.pitch))
+			continue
+		}
+		on := midi.NoteOn(int(ch), n.pitch, n.vel)
+		on.AbsTicks = im.tick(n.start)
+		off := midi.NoteOff(int(ch), n.pitch)
+		off.AbsTicks = im.tick(n.end)
+		if off.AbsTicks <= on.AbsTicks {
+			off.AbsTicks = on.AbsTicks + 1
+		}
+		events = append(events, on, off)
+	}
+	return events
+}
+
+func (im *importer) convertAttributes(st *partState, part string, a *attributes) {
+	if a.Divisions > 0 {
+		st.divisions = a.Divisions
+	}
+	if a.Key != nil {
+		im.addConductor(midi.KeySignatureEvent(a.Key.Fifths, a.Key.Mode == "minor"), st.pos)
+	}
+	if a.Time != nil {
+		if ts, ok := timeSignature(a.Time); ok {
+			im.addConductor(&midi.Event{
+				MsgType:       midi.EventByteMap["Meta"],
+				Cmd:           midi.MetaByteMap["Time Signature"],
+				TimeSignature: ts,
+			}, st.pos)
+		} else {
+			im.warn(part, st.measure, "time", "unsupported time signature ignored")
+		}
+	}
+	if a.Transpose != nil {
+		st.transpose = int(math.Round(a.Transpose.Chromatic)) + 12*a.Transpose.OctaveChange
+	}
+	im.warnOthers(st, part, a.Other)
+}
+
+// timeSignature converts a time signature, composite signatures such as
+// 3+2/8 are added up.
+func timeSignature(t *timeSig) (*midi.TimeSignature, bool) {
+	if t.SenzaMisura != nil {
+		return nil, false
+	}
+	var beats int
+	for _, s := range strings.Split(t.Beats, "+") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n <= 0 {
+			return nil, false
+		}
+		beats += n
+	}
+	beatType, err := strconv.Atoi(strings.TrimSpace(t.BeatType))
+	if err != nil || beatType <= 0 || beatType&(beatType-1) != 0 || beats > 255 {
+		return nil, false
+	}
+	return &midi.TimeSignature{
+		Numerator:                   uint8(beats),
+		Denominator:                 uint8(bits.TrailingZeros(uint(beatType))),
+		ClocksPerTick:               24,
+		ThirtySecondNotesPerQuarter: 8,
+	}, true
+}
+
+func (im *importer) convertDirection(st *partState, part string, d *direction, pos float64) {
+	hasTempo := d.Sound != nil && d.Sound.Tempo != ""
+	hasDynamics := d.Sound != nil && d.Sound.Dynamics != ""
+	for _, dt := range d.DirectionType {
+		if m := dt.Metronome; m != nil && !hasTempo {
+			if bpm, ok := metronomeBPM(m); ok {
+				im.addConductor(midi.TempoEvent(bpm), pos)
+			} else {
+				im.warn(part, st.measure, "metronome", "unsupported metronome mark ignored")
+			}
+		}
+		if dt.Dynamics != nil && !hasDynamics {
+			for _, mark := range dt.Dynamics.Marks {
+				if vel, ok := dynamicsVelocities[mark.XMLName.Local]; ok {
+					st.velocity = vel
+				} else {
+					im.warn(part, st.measure, mark.XMLName.Local, "dynamics mark isn't supported")
+				}
+			}
+		}
+		for _, o := range dt.Other {
+			im.warn(part, st.measure, o.XMLName.Local, "direction isn't supported")
+		}
+	}
+	if d.Sound != nil {
+		im.convertSound(st, d.Sound, pos)
+	}
+}
+
+func (im *importer) convertSound(st *partState, s *sound, pos float64) {
+	if bpm, err := strconv.ParseFloat(s.Tempo, 64); err == nil && bpm > 0 {
+		im.addConductor(midi.TempoEvent(bpm), pos)
+	}
+	if dyn, err := strconv.ParseFloat(s.Dynamics, 64); err == nil {
+		st.velocity = dynamicsVelocity(dyn)
+	}
+}
+
+// metronomeBPM returns the tempo in quarter notes per minute of a metronome
+// mark.
+func metronomeBPM(m *metronome) (float64, bool) {
+	perMinute, err := strconv.ParseFloat(strings.TrimSpace(m.PerMinute), 64)
+	if err != nil || perMinute <= 0 {
+		return 0, false
+	}
+	var value int
+	for v, name := range valueTypes {
+		if name == m.BeatUnit {
+			value = v
+		}
+	}
+	if value == 0 {
+		return 0, false
+	}
+	quarters := 4 / float64(value)
+	for dot, extra := 0, quarters/2; dot < len(m.BeatUnitDot); dot, extra = dot+1, extra/2 {
+		quarters += extra
+	}
+	return perMinute * quarters, true
+}
+
+// dynamicsVelocity converts a dynamics percentage of the forte velocity to a
+// velocity.
+func dynamicsVelocity(percent float64) int {
+	vel := int(clamp7(math.Round(percent * defaultVelocity / 100)))
+	if vel < 1 {
+		vel = 1
+	}
+	return vel
+}
+
+func clamp7(v float64) int {
+	return int(math.Max(0, math.Min(127, v)))
+}
+
+func (im *importer) convertNote(st *partState, part string, n *note, inst midiInstrument) {
+	im.warnOthers(st, part, n.Other)
+	if n.Notations != nil {
+		for _, o := range n.Notations.Other {
+			im.warn(part, st.measure, o.XMLName.Local, "notation isn't supported")
+		}
+	}
+	if n.Grace != nil {
+		im.warn(part, st.measure, "grace", "grace note ignored")
+		return
+	}
+	dur := n.Duration / st.divisions
+	start := st.pos
+	if n.Chord != nil {
+		start = st.lastStart
+	} else {
+		st.lastStart = st.pos
+		st.pos += dur
+	}
+	if n.Cue != nil {
+		im.warn(part, st.measure, "cue", "cue note ignored")
+		return
+	}
+	if n.Rest != nil || dur <= 0 {
+		return
+	}
+
+	var pitch int
+	switch {
+	case n.Pitch != nil:
+		pc, ok := stepPitchClasses[strings.TrimSpace(n.Pitch.Step)]
+		if !ok {
+			im.warn(part, st.measure, "step", "invalid pitch step ignored")
+			return
+		}
+		if n.Pitch.Alter != math.Trunc(n.Pitch.Alter) {
+			im.warn(part, st.measure, "alter", "microtone rounded to the nearest semitone")
+		}
+		pitch = (n.Pitch.Octave+1)*12 + pc + int(math.Round(n.Pitch.Alter)) + st.transpose
+	case n.Unpitched != nil && inst.Unpitched > 0:
+		pitch = inst.Unpitched - 1
+	case n.Unpitched != nil:
+		pitch = (n.Unpitched.DisplayOctave+1)*12 + stepPitchClasses[strings.TrimSpace(n.Unpitched.DisplayStep)]
+	default:
+		return
+	}
+
+	vel := st.velocity
+	if dyn, err := strconv.ParseFloat(n.Dynamics, 64); err == nil {
+		vel = dynamicsVelocity(dyn)
+	}
+	var tieStart, tieStop bool
+	ties := n.Ties
+	if n.Notations != nil {
+		ties = append(ties, n.Notations.Tied...)
+	}
+	for _, t := range ties {
+		switch t.Type {
+		case "start":
+			tieStart = true
+		case "stop":
+			tieStop = true
+		case "continue":
+			tieStart, tieStop = true, true
+		}
+	}
+
+	if i, ok := st.tied[pitch]; ok && tieStop {
+		if end := start + dur; end > st.notes[i].end {
+			st.notes[i].end = end
+		}
+		if !tieStart {
+			delete(st.tied, pitch)
+		}
+		return
+	}
+	st.notes = append(st.notes, partNote{start: start, end: start + dur, pitch: pitch, vel: vel})
+	if tieStart {
+		st.tied[pitch] = len(st.notes) - 1
+	}
+}
+
+// hasUnpitched reports whether the part has unpitched notes.
+func hasUnpitched(p part) bool {
+	for _, m := range p.Measures {
+		for _, el := range m.Music {
+			if n, ok := el.(*note); ok && n.Unpitched != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newTrack creates a track from events with their absolute ticks set. At
+// the same tick, meta events come first, then the controllers and program
+// changes, the note offs and the note ons.
+func newTrack(events []*midi.Event, end uint64) *midi.Track {
+	order := func(ev *midi.Event) int {
+		switch ev.MsgType {
+		case midi.EventByteMap["NoteOn"]:
+			return 3
+		case midi.EventByteMap["NoteOff"]:
+			return 2
+		case midi.EventByteMap["Meta"]:
+			return 0
+		}
+		return 1
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].AbsTicks != events[j].AbsTicks {
+			return events[i].AbsTicks < events[j].AbsTicks
+		}
+		return order(events[i]) < order(events[j])
+	})
+	t := &midi.Track{}
+	var last uint64
+	for _, ev := range events {
+		t.AddAfterDelta(uint32(ev.AbsTicks-last), ev)
+		last = ev.AbsTicks
+	}
+	if end < last {
+		end = last
+	}
+	eot := midi.EndOfTrack()
+	eot.AbsTicks = end
+	t.AddAfterDelta(uint32(end-last), eot)
+	return t
+}
@@ -0,0 +1,303 @@
+package musicxml
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-audio/midi"
+	"github.com/mattetti/filebuffer"
+)
+
+const testScore = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE score-partwise PUBLIC "-//Recordare//DTD MusicXML 4.0 Partwise//EN" "http://www.musicxml.org/dtds/partwise.dtd">
+<score-partwise version="4.0">
+  <work><work-title>Etude</work-title></work>
+  <part-list>
+    <score-part id="P1">
+      <part-name>Flute</part-name>
+      <midi-instrument id="P1-I1">
+        <midi-channel>3</midi-channel>
+        <midi-program>74</midi-program>
+        <volume>50</volume>
+        <pan>-90</pan>
+      </midi-instrument>
+    </score-part>
+    <score-part id="P2">
+      <part-name>Clarinet in Bb</part-name>
+    </score-part>
+  </part-list>
+  <part id="P1">
+    <measure number="1">
+      <print new-system="yes"/>
+      <attributes>
+        <divisions>2</divisions>
+        <key><fifths>2</fifths><mode>major</mode></key>
+        <time><beats>3</beats><beat-type>4</beat-type></time>
+        <clef><sign>G</sign><line>2</line></clef>
+      </attributes>
+      <direction placement="above">
+        <direction-type><metronome><beat-unit>quarter</beat-unit><per-minute>100</per-minute></metronome></direction-type>
+        <sound tempo="100"/>
+      </direction>
+      <direction>
+        <direction-type><dynamics><p/></dynamics></direction-type>
+      </direction>
+      <direction>
+        <direction-type><words>dolce</words></direction-type>
+      </direction>
+      <note><pitch><step>D</step><octave>5</octave></pitch><duration>2</duration><voice>1</voice><type>quarter</type><stem>down</stem></note>
+      <note><chord/><pitch><step>F</step><alter>1</alter><octave>5</octave></pitch><duration>2</duration><voice>1</voice><type>quarter</type></note>
+      <note><grace/><pitch><step>B</step><octave>4</octave></pitch><voice>1</voice><type>eighth</type></note>
+      <note dynamics="100"><pitch><step>A</step><octave>4</octave></pitch><duration>4</duration><tie type="start"/><voice>1</voice><type>half</type><notations><tied type="start"/><fermata/></notations></note>
+      <backup><duration>6</duration></backup>
+      <forward><duration>2</duration></forward>
+      <note><pitch><step>E</step><octave>4</octave></pitch><duration>4</duration><voice>2</voice><type>half</type></note>
+    </measure>
+    <measure number="2">
+      <attributes><divisions>4</divisions></attributes>
+      <note><pitch><step>A</step><octave>4</octave></pitch><duration>2</duration><tie type="stop"/><voice>1</voice><type>eighth</type></note>
+      <note><rest/><duration>2</duration><voice>1</voice><type>eighth</type></note>
+      <direction><direction-type><dynamics><ff/></dynamics></direction-type><sound dynamics="125"/></direction>
+      <note><pitch><step>G</step><octave>4</octave></pitch><duration>8</duration><voice>1</voice><type>half</type></note>
+      <barline location="right"><bar-style>light-heavy</bar-style><repeat direction="backward"/></barline>
+    </measure>
+  </part>
+  <part id="P2">
+    <measure number="1">
+      <attributes>
+        <divisions>1</divisions>
+        <key><fifths>4</fifths></key>
+        <time><beats>3</beats><beat-type>4</beat-type></time>
+        <transpose><diatonic>-1</diatonic><chromatic>-2</chromatic></transpose>
+      </attributes>
+      <note><pitch><step>E</step><octave>4</octave></pitch><duration>3</duration><voice>1</voice><type>half</type><dot/></note>
+    </measure>
+  </part>
+</score-partwise>
+`
+
+// trackNote is a note of a decoded track.
+type trackNote struct {
+	channel, pitch, vel int
+	start, end          uint64
+}
+
+func trackNotes(t *midi.Track) []trackNote {
+	notes := []trackNote{}
+	started := map[uint8]int{}
+	var tick uint64
+	for _, ev := range t.Events {
+		tick += uint64(ev.TimeDelta)
+		switch {
+		case ev.MsgType == 0x9 && ev.Velocity > 0:
+			started[ev.Note] = len(notes)
+			notes = append(notes, trackNote{channel: int(ev.MsgChan), pitch: int(ev.Note), vel: int(ev.Velocity), start: tick})
+		case ev.MsgType == 0x8 || ev.MsgType == 0x9:
+			notes[started[ev.Note]].end = tick
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if notes[i].start != notes[j].start {
+			return notes[i].start < notes[j].start
+		}
+		return notes[i].pitch < notes[j].pitch
+	})
+	return notes
+}
+
+func TestDecoder_Decode(t *testing.T) {
+	d := NewDecoder(strings.NewReader(testScore))
+	d.TicksPerQuarterNote = 96
+	if err := d.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Title != "Etude" || d.Format != 1 {
+		t.Errorf("unexpected title %q or format %d", d.Title, d.Format)
+	}
+	if len(d.Tracks) != 3 {
+		t.Fatalf("expected 3 tracks, got %d", len(d.Tracks))
+	}
+
+	conductor := d.Tracks[0]
+	if name := conductor.Name(); name != "Etude" {
+		t.Errorf("expected the conductor track to be named Etude, got %q", name)
+	}
+	if tm := midi.TempoMapOf(conductor); len(tm) != 1 || tm[0].MicrosPerQuarter != 600000 {
+		t.Errorf("expected a single 100 BPM tempo, got %v", tm)
+	}
+	if keys := midi.KeyTimelineOf(conductor); len(keys) != 1 || keys[0].Key != 2 {
+		t.Errorf("expected a D major key signature, got %v", keys)
+	}
+	if m := midi.MeterMapOf(d.Tracks[1]); len(m) != 1 || m[0].Numerator != 3 || m[0].Denum() != 4 {
+		t.Errorf("expected the part tracks to have the 3/4 time signature, got %v", m)
+	}
+
+	flute := d.Tracks[1]
+	if name := flute.Name(); name != "Flute" {
+		t.Errorf("expected the first part to be named Flute, got %q", name)
+	}
+	if inst := flute.ProgramAt(midi.GM1Bank, 2, 0); inst.Program != 73 {
+		t.Errorf("expected the flute program on channel 3, got %+v", inst)
+	}
+	var volume, pan int = -1, -1
+	for _, ev := range flute.Events {
+		if ev.MsgType == 0xB && ev.Controller == 7 {
+			volume = int(ev.NewValue)
+		}
+		if ev.MsgType == 0xB && ev.Controller == 10 {
+			pan = int(ev.NewValue)
+		}
+	}
+	if volume != 64 || pan != 0 {
+		t.Errorf("expected volume 64 and pan 0, got %d and %d", volume, pan)
+	}
+
+	want := []trackNote{
+		{2, 74, 49, 0, 96},
+		{2, 78, 49, 0, 96},
+		{2, 64, 49, 96, 288},
+		// tied over the bar line
+		{2, 69, 90, 96, 336},
+		{2, 67, 113, 384, 576},
+	}
+	if got := trackNotes(flute); !reflect.DeepEqual(got, want) {
+		t.Errorf("flute notes = %v, want %v", got, want)
+	}
+	// the clarinet sounds a major second lower
+	want = []trackNote{{0, 62, 90, 0, 288}}
+	if got := trackNotes(d.Tracks[2]); !reflect.DeepEqual(got, want) {
+		t.Errorf("clarinet notes = %v, want %v", got, want)
+	}
+
+	warnings := []string{}
+	for _, w := range d.Warnings {
+		warnings = append(warnings, w.String())
+	}
+	wantWarnings := []string{
+		"part P1, measure 1: <words> direction isn't supported",
+		"part P1, measure 1: <grace> grace note ignored",
+		"part P1, measure 1: <fermata> notation isn't supported",
+		"part P1, measure 2: <barline> repeats and endings aren't expanded",
+	}
+	if !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("warnings = %q, want %q", warnings, wantWarnings)
+	}
+
+	// the tracks can be written as a midi file
+	w := filebuffer.New(nil)
+	e := midi.NewEncoder(w, d.Format, d.TicksPerQuarterNote)
+	e.Tracks = d.Tracks
+	if err := e.Write(); err != nil {
+		t.Fatal(err)
+	}
+	dec := midi.NewDecoder(bytes.NewReader(w.Buff.Bytes()))
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if len(dec.Tracks) != 3 || !reflect.DeepEqual(trackNotes(dec.Tracks[1]), trackNotes(flute)) {
+		t.Errorf("the encoded file doesn't have the decoded notes")
+	}
+}
+
+func TestDecoder_Decode_roundTrip(t *testing.T) {
+	tr := &midi.Track{}
+	tr.AddAfterDelta(0, midi.TrackName("Piano"))
+	tr.AddAfterDelta(0, midi.KeySignatureEvent(-3, true))
+	tr.AddAfterDelta(0, midi.ProgramSelect(0, 1))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 60, 90))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 63, 90))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 67, 45))
+	tr.AddAfterDelta(192, midi.NoteOff(0, 60))
+	tr.AddAfterDelta(0, midi.NoteOff(0, 63))
+	tr.AddAfterDelta(288, midi.NoteOff(0, 67))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 68, 127))
+	tr.AddAfterDelta(48, midi.NoteOff(0, 68))
+
+	buf := &bytes.Buffer{}
+	e := NewEncoder(buf, 96)
+	e.Tracks = []*midi.Track{tr}
+	if err := e.Write(); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecoder(buf)
+	d.TicksPerQuarterNote = 96
+	if err := d.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Warnings) != 0 {
+		t.Errorf("unexpected warnings %v", d.Warnings)
+	}
+	if len(d.Tracks) != 2 {
+		t.Fatalf("expected 2 tracks, got %d", len(d.Tracks))
+	}
+	if got, want := trackNotes(d.Tracks[1]), trackNotes(tr); !reflect.DeepEqual(got, want) {
+		t.Errorf("notes = %v, want %v", got, want)
+	}
+	if inst := d.Tracks[1].ProgramAt(midi.GM1Bank, 0, 0); inst.Program != 1 {
+		t.Errorf("expected program 1, got %d", inst.Program)
+	}
+	if keys := midi.KeyTimelineOf(d.Tracks...); len(keys) != 1 || keys[0].String() != "C minor" {
+		t.Errorf("expected a C minor key signature, got %v", keys)
+	}
+}
+
+func TestDecoder_Decode_channels(t *testing.T) {
+	// 25 melodic parts and a drum part
+	var list, parts strings.Builder
+	for i := 1; i <= 26; i++ {
+		fmt.Fprintf(&list, `<score-part id="P%d"><part-name>Part %d</part-name></score-part>`, i, i)
+		n := `<pitch><step>C</step><octave>4</octave></pitch>`
+		if i == 26 {
+			n = `<unpitched><display-step>C</display-step><display-octave>5</display-octave></unpitched>`
+		}
+		fmt.Fprintf(&parts, `<part id="P%d"><measure number="1"><note>%s<duration>4</duration></note></measure></part>`, i, n)
+	}
+	score := `<score-partwise version="4.0"><part-list>` + list.String() + `</part-list>` + parts.String() + `</score-partwise>`
+	d := NewDecoder(strings.NewReader(score))
+	if err := d.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	channels := []int{}
+	for _, tr := range d.Tracks[1:] {
+		notes := trackNotes(tr)
+		if len(notes) != 1 {
+			t.Fatalf("expected a note per part, got %v", notes)
+		}
+		channels = append(channels, notes[0].channel)
+	}
+	// the melodic parts never play on the percussion channel
+	melodic := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 10, 11, 12, 13, 14, 15}
+	want := append(append(append([]int{}, melodic...), melodic[:10]...), 9)
+	if !reflect.DeepEqual(channels, want) {
+		t.Errorf("channels = %v, want %v", channels, want)
+	}
+	wantWarnings := []string{}
+	for i, ch := range want {
+		if i < 10 || i >= 15 && ch != 9 {
+			wantWarnings = append(wantWarnings, fmt.Sprintf("part P%d: <score-part> shares the midi channel %d with another part", i+1, ch+1))
+		}
+	}
+	warnings := []string{}
+	for _, w := range d.Warnings {
+		warnings = append(warnings, w.String())
+	}
+	if !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("warnings = %q, want %q", warnings, wantWarnings)
+	}
+}
+
+func TestDecoder_Decode_errors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		`<score-timewise version="4.0"></score-timewise>`,
+		`<score-partwise><part id="P1"><measure number="1"><note>`,
+	} {
+		if err := NewDecoder(strings.NewReader(data)).Decode(); err == nil {
+			t.Errorf("expected an error decoding %q", data)
+		}
+	}
+}
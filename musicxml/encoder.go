@@ -0,0 +1,216 @@
+package musicxml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/notation"
+)
+
+// Encoder writes midi tracks as a MusicXML partwise score. Each channel of a
+// track with notes becomes a part named after the track, the notes are
+// snapped to the grid of the notation options and laid out in measures
+// following the time signatures, key signatures and tempo changes of the
+// tracks.
+type Encoder struct {
+	w                   io.Writer
+	TicksPerQuarterNote uint16
+	Tracks              []*midi.Track
+	// Title is the title of the work, omitted if empty.
+	Title string
+	// Options sets the grid the notes are snapped to, its steps per quarter
+	// note are written as the divisions of the score.
+	Options notation.Options
+}
+
+// NewEncoder returns an encoder writing a MusicXML score to w.
+func NewEncoder(w io.Writer, ppqn uint16) *Encoder {
+	return &Encoder{w: w, TicksPerQuarterNote: ppqn}
+}
+
+// Write notates the tracks and writes the score.
+func (e *Encoder) Write() error {
+	s, err := notation.FromTracks(e.Tracks, e.TicksPerQuarterNote, &e.Options)
+	if err != nil {
+		return err
+	}
+	return e.WriteScore(s)
+}
+
+// WriteScore writes a score notated by the notation package.
+func (e *Encoder) WriteScore(s *notation.Score) error {
+	doc := scorePartwise{Version: Version}
+	if e.Title != "" {
+		doc.Work = &work{Title: e.Title}
+	}
+	for i, p := range s.Parts {
+		id := fmt.Sprintf("P%d", i+1)
+		sp := scorePart{
+			ID:         id,
+			Name:       p.Name,
+			Instrument: &scoreInstrument{ID: id + "-I1", Name: p.Name},
+			Midi:       []midiInstrument{{ID: id + "-I1", Channel: int(p.Channel) + 1, Program: int(p.Program) + 1}},
+		}
+		doc.PartList.ScoreParts = append(doc.PartList.ScoreParts, sp)
+		doc.Parts = append(doc.Parts, encodePart(id, s, p, i == 0))
+	}
+
+	if _, err := io.WriteString(e.w, xml.Header+doctype+"\n"); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(e.w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.w, "\n")
+	return err
+}
+
+// encodePart converts a part, the tempo changes are only written in the first
+// part.
+func encodePart(id string, s *notation.Score, p *notation.Part, tempos bool) part {
+	xp := part{ID: id}
+	for mi, m := range s.Measures {
+		xm := measure{Number: strconv.Itoa(m.Number)}
+		if attrs := encodeAttributes(s, m, p, mi == 0); attrs != nil {
+			xm.Music = append(xm.Music, attrs)
+		}
+		if tempos {
+			for _, t := range m.Tempos {
+				xm.Music = append(xm.Music, encodeTempo(t))
+			}
+		}
+		// the accidentals apply to the rest of the measure
+		alters := map[string]int{}
+		for vi, v := range p.Measures[mi] {
+			if vi > 0 {
+				xm.Music = append(xm.Music, &backup{Duration: float64(m.Length)})
+			}
+			for _, el := range v.Elements {
+				for _, n := range encodeElement(el, v.Number, m.Key, p.Clef, alters) {
+					xm.Music = append(xm.Music, n)
+				}
+			}
+		}
+		xp.Measures = append(xp.Measures, xm)
+	}
+	return xp
+}
+
+// encodeAttributes returns the attributes changing at the measure, nil if
+// none.
+func encodeAttributes(s *notation.Score, m *notation.Measure, p *notation.Part, first bool) *attributes {
+	if !first && !m.KeyChange && !m.TimeChange {
+		return nil
+	}
+	attrs := &attributes{}
+	if first {
+		attrs.Divisions = float64(s.Divisions)
+		switch p.Clef {
+		case notation.BassClef:
+			attrs.Clef = &clef{Sign: "F", Line: 4}
+		case notation.PercussionClef:
+			attrs.Clef = &clef{Sign: "percussion"}
+		default:
+			attrs.Clef = &clef{Sign: "G", Line: 2}
+		}
+	}
+	if m.KeyChange {
+		attrs.Key = &key{Fifths: int(m.Key.Key), Mode: "major"}
+		if m.Key.Minor {
+			attrs.Key.Mode = "minor"
+		}
+	}
+	if m.TimeChange {
+		num := int(m.Time.Numerator)
+		if num == 0 {
+			num = 4
+		}
+		attrs.Time = &timeSig{Beats: strconv.Itoa(num), BeatType: strconv.Itoa(m.Time.Denum())}
+	}
+	return attrs
+}
+
+// encodeTempo returns the metronome mark of a tempo change.
+func encodeTempo(t notation.Tempo) *direction {
+	bpm := strconv.FormatFloat(math.Round(t.BPM*100)/100, 'f', -1, 64)
+	d := &direction{
+		Placement:     "above",
+		DirectionType: []directionType{{Metronome: &metronome{BeatUnit: "quarter", PerMinute: bpm}}},
+		Sound:         &sound{Tempo: bpm},
+	}
+	if t.Offset > 0 {
+		offset := float64(t.Offset)
+		d.Offset = &offset
+	}
+	return d
+}
+
+// encodeElement returns the notes of a chord or the rest. alters tracks the
+// accidentals written in the measure.
+func encodeElement(el *notation.Element, voice int, ks midi.KeySignature, c notation.Clef, alters map[string]int) []*note {
+	base := note{Duration: float64(el.Duration), Voice: strconv.Itoa(voice)}
+	if !el.MeasureRest {
+		base.Type = valueTypes[int(el.Value)]
+		base.Dots = make([]empty, el.Dots)
+	}
+	if el.Rest() {
+		n := base
+		n.Rest = &rest{}
+		if el.MeasureRest {
+			n.Rest.Measure = "yes"
+		}
+		return []*note{&n}
+	}
+
+	if el.Velocity > 0 {
+		base.Dynamics = strconv.FormatFloat(math.Round(float64(el.Velocity)/90*10000)/100, 'f', -1, 64)
+	}
+	var tied []tie
+	if el.TieStop {
+		base.Ties = append(base.Ties, tie{Type: "stop"})
+		tied = append(tied, tie{Type: "stop"})
+	}
+	if el.TieStart {
+		base.Ties = append(base.Ties, tie{Type: "start"})
+		tied = append(tied, tie{Type: "start"})
+	}
+	if tied != nil {
+		base.Notations = &notations{Tied: tied}
+	}
+
+	keyAlters := ks.Alterations()
+	notes := make([]*note, len(el.Pitches))
+	for i, p := range el.Pitches {
+		n := base
+		if i > 0 {
+			n.Chord = &empty{}
+		}
+		step, octave := string(p.Letter), notation.Octave(p)
+		if c == notation.PercussionClef {
+			n.Unpitched = &unpitched{DisplayStep: step, DisplayOctave: octave}
+			notes[i] = &n
+			continue
+		}
+		n.Pitch = &pitch{Step: step, Alter: float64(p.Alter), Octave: octave}
+		// a tied note continues the accidental of the note it's tied to
+		if !el.TieStop {
+			id := step + strconv.Itoa(octave)
+			current, ok := alters[id]
+			if !ok {
+				current = keyAlters[p.Letter]
+			}
+			if current != p.Alter {
+				n.Accidental = accidentals[p.Alter]
+				alters[id] = p.Alter
+			}
+		}
+		notes[i] = &n
+	}
+	return notes
+}
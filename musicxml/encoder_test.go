@@ -0,0 +1,129 @@
+package musicxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/internal/miditest"
+)
+
+func TestEncoder_Write(t *testing.T) {
+	tr := miditest.VoicesTrack("Piano & Voice")
+	// a B natural then a Bb in the same bar
+	tr.AddAfterDelta(0, midi.NoteOn(0, 71, 45))
+	tr.AddAfterDelta(96, midi.NoteOff(0, 71))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 70, 45))
+	tr.AddAfterDelta(96, midi.NoteOff(0, 70))
+
+	buf := &bytes.Buffer{}
+	e := NewEncoder(buf, 96)
+	e.Title = "Test"
+	e.Tracks = []*midi.Track{tr}
+	if err := e.Write(); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		xml.Header,
+		`<score-partwise version="4.0">`,
+		`<work-title>Test</work-title>`,
+		`<part-name>Piano &amp; Voice</part-name>`,
+		`<midi-program>41</midi-program>`,
+		`<divisions>8</divisions>`,
+		"<fifths>-1</fifths>",
+		"<beats>3</beats>",
+		"<beat-type>4</beat-type>",
+		"<per-minute>100</per-minute>",
+		`<sound tempo="100"></sound>`,
+		"<backup>",
+		`<note dynamics="88.89">`,
+		`<note dynamics="50">`,
+		"<chord></chord>",
+		`<tie type="start"></tie>`,
+		`<tied type="stop"></tied>`,
+		"<accidental>natural</accidental>",
+		"<accidental>flat</accidental>",
+		"<type>half</type>",
+		"<dot></dot>",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected the score to contain %q\n%s", expected, out)
+		}
+	}
+	// the Bb of the chord is in the key signature
+	if n := strings.Count(out, "<accidental>"); n != 2 {
+		t.Errorf("expected 2 accidentals, got %d", n)
+	}
+	checkMeasures(t, buf.Bytes())
+}
+
+func TestEncoder_Write_fixtures(t *testing.T) {
+	miditest.Fixtures(t, func(t *testing.T, d *midi.Decoder) {
+		buf := &bytes.Buffer{}
+		e := NewEncoder(buf, d.TicksPerQuarterNote)
+		e.Tracks = d.Tracks
+		if err := e.Write(); err != nil {
+			t.Fatal(err)
+		}
+		checkMeasures(t, buf.Bytes())
+
+		// every note of the file is written with its pitch
+		imported := NewDecoder(buf)
+		if err := imported.Decode(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := miditest.NotePitches(imported.Tracks...), miditest.NotePitches(d.Tracks...); !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %d notes with the pitches of the file, got %d notes", len(want), len(got))
+		}
+	})
+}
+
+// checkMeasures checks that the voices of every measure have the same
+// length.
+func checkMeasures(t *testing.T, data []byte) {
+	t.Helper()
+	var doc struct {
+		Parts []struct {
+			Measures []struct {
+				Number string `xml:"number,attr"`
+				Music  []struct {
+					XMLName  xml.Name
+					Chord    *struct{} `xml:"chord"`
+					Duration int       `xml:"duration"`
+				} `xml:",any"`
+			} `xml:"measure"`
+		} `xml:"part"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Parts) == 0 {
+		t.Fatal("no parts")
+	}
+	for _, p := range doc.Parts {
+		for _, m := range p.Measures {
+			var pos, length int
+			for _, el := range m.Music {
+				switch el.XMLName.Local {
+				case "note":
+					if el.Chord == nil {
+						pos += el.Duration
+					}
+				case "backup":
+					if length != 0 && pos != length {
+						t.Fatalf("measure %s: voices of different lengths %d and %d", m.Number, length, pos)
+					}
+					length = pos
+					pos -= el.Duration
+				}
+			}
+			if pos == 0 || (length != 0 && pos != length) {
+				t.Fatalf("measure %s: invalid voice length %d (expected %d)", m.Number, pos, length)
+			}
+		}
+	}
+}
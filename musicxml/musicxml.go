@@ -0,0 +1,265 @@
+// Package musicxml converts midi tracks to MusicXML partwise scores which can
+// be opened by notation software.
+package musicxml
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+const (
+	// Version is the MusicXML version of the written scores.
+	Version = "4.0"
+	// doctype is the document type declaration of partwise scores.
+	doctype = `<!DOCTYPE score-partwise PUBLIC "-//Recordare//DTD MusicXML 4.0 Partwise//EN" "http://www.musicxml.org/dtds/partwise.dtd">`
+)
+
+// The types below map the subset of the MusicXML elements used to notate
+// midi tracks.
+
+type scorePartwise struct {
+	XMLName       xml.Name `xml:"score-partwise"`
+	Version       string   `xml:"version,attr,omitempty"`
+	Work          *work    `xml:"work,omitempty"`
+	MovementTitle string   `xml:"movement-title,omitempty"`
+	PartList      partList `xml:"part-list"`
+	Parts         []part   `xml:"part"`
+}
+
+type work struct {
+	Title string `xml:"work-title"`
+}
+
+type partList struct {
+	ScoreParts []scorePart `xml:"score-part"`
+}
+
+type scorePart struct {
+	ID         string           `xml:"id,attr"`
+	Name       string           `xml:"part-name"`
+	Instrument *scoreInstrument `xml:"score-instrument,omitempty"`
+	Midi       []midiInstrument `xml:"midi-instrument"`
+}
+
+type scoreInstrument struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"instrument-name"`
+}
+
+type midiInstrument struct {
+	ID        string   `xml:"id,attr"`
+	Channel   int      `xml:"midi-channel,omitempty"`
+	Program   int      `xml:"midi-program,omitempty"`
+	Unpitched int      `xml:"midi-unpitched,omitempty"`
+	Volume    *float64 `xml:"volume,omitempty"`
+	Pan       *float64 `xml:"pan,omitempty"`
+	Other     []other  `xml:",any"`
+}
+
+type part struct {
+	ID       string    `xml:"id,attr"`
+	Measures []measure `xml:"measure"`
+}
+
+// measure holds its music data (*attributes, *direction, *note, *backup,
+// *forward, *barline, *sound and other elements) in order.
+type measure struct {
+	Number string        `xml:"number,attr"`
+	Music  []interface{} `xml:",omitempty"`
+}
+
+// UnmarshalXML decodes the music data of the measure keeping their order.
+func (m *measure) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "number" {
+			m.Number = attr.Value
+		}
+	}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			var v interface{}
+			switch t.Name.Local {
+			case "attributes":
+				v = &attributes{}
+			case "direction":
+				v = &direction{}
+			case "note":
+				v = &note{}
+			case "backup":
+				v = &backup{}
+			case "forward":
+				v = &forward{}
+			case "barline":
+				v = &barline{}
+			case "sound":
+				v = &sound{}
+			default:
+				v = &other{}
+			}
+			if err := d.DecodeElement(v, &t); err != nil {
+				return err
+			}
+			m.Music = append(m.Music, v)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// other is an element which isn't converted.
+type other struct {
+	XMLName xml.Name
+}
+
+type attributes struct {
+	XMLName   xml.Name   `xml:"attributes"`
+	Divisions float64    `xml:"divisions,omitempty"`
+	Key       *key       `xml:"key,omitempty"`
+	Time      *timeSig   `xml:"time,omitempty"`
+	Clef      *clef      `xml:"clef,omitempty"`
+	Transpose *transpose `xml:"transpose,omitempty"`
+	Other     []other    `xml:",any"`
+}
+
+type transpose struct {
+	Chromatic    float64 `xml:"chromatic"`
+	OctaveChange int     `xml:"octave-change,omitempty"`
+}
+
+type key struct {
+	Fifths int    `xml:"fifths"`
+	Mode   string `xml:"mode,omitempty"`
+}
+
+type timeSig struct {
+	Beats       string `xml:"beats,omitempty"`
+	BeatType    string `xml:"beat-type,omitempty"`
+	SenzaMisura *empty `xml:"senza-misura,omitempty"`
+}
+
+type clef struct {
+	Sign string `xml:"sign"`
+	Line int    `xml:"line,omitempty"`
+}
+
+type direction struct {
+	XMLName       xml.Name        `xml:"direction"`
+	Placement     string          `xml:"placement,attr,omitempty"`
+	DirectionType []directionType `xml:"direction-type"`
+	Offset        *float64        `xml:"offset,omitempty"`
+	Sound         *sound          `xml:"sound,omitempty"`
+}
+
+type directionType struct {
+	Metronome *metronome `xml:"metronome,omitempty"`
+	Dynamics  *dynamics  `xml:"dynamics,omitempty"`
+	Other     []other    `xml:",any"`
+}
+
+type metronome struct {
+	BeatUnit    string  `xml:"beat-unit"`
+	BeatUnitDot []empty `xml:"beat-unit-dot"`
+	PerMinute   string  `xml:"per-minute"`
+}
+
+// dynamics holds dynamic marks such as <p/> or <ff/>.
+type dynamics struct {
+	Marks []other `xml:",any"`
+}
+
+type sound struct {
+	XMLName  xml.Name `xml:"sound"`
+	Tempo    string   `xml:"tempo,attr,omitempty"`
+	Dynamics string   `xml:"dynamics,attr,omitempty"`
+}
+
+type backup struct {
+	XMLName  xml.Name `xml:"backup"`
+	Duration float64  `xml:"duration"`
+}
+
+type forward struct {
+	XMLName  xml.Name `xml:"forward"`
+	Duration float64  `xml:"duration"`
+}
+
+type barline struct {
+	XMLName xml.Name `xml:"barline"`
+	Repeat  *other   `xml:"repeat,omitempty"`
+	Ending  *other   `xml:"ending,omitempty"`
+}
+
+type empty struct{}
+
+type note struct {
+	XMLName    xml.Name   `xml:"note"`
+	Dynamics   string     `xml:"dynamics,attr,omitempty"`
+	Grace      *empty     `xml:"grace,omitempty"`
+	Cue        *empty     `xml:"cue,omitempty"`
+	Chord      *empty     `xml:"chord,omitempty"`
+	Pitch      *pitch     `xml:"pitch,omitempty"`
+	Unpitched  *unpitched `xml:"unpitched,omitempty"`
+	Rest       *rest      `xml:"rest,omitempty"`
+	Duration   float64    `xml:"duration"`
+	Ties       []tie      `xml:"tie"`
+	Voice      string     `xml:"voice,omitempty"`
+	Type       string     `xml:"type,omitempty"`
+	Dots       []empty    `xml:"dot"`
+	Accidental string     `xml:"accidental,omitempty"`
+	Notations  *notations `xml:"notations,omitempty"`
+	Other      []other    `xml:",any"`
+}
+
+type pitch struct {
+	Step   string  `xml:"step"`
+	Alter  float64 `xml:"alter,omitempty"`
+	Octave int     `xml:"octave"`
+}
+
+type unpitched struct {
+	DisplayStep   string `xml:"display-step"`
+	DisplayOctave int    `xml:"display-octave"`
+}
+
+type rest struct {
+	Measure string `xml:"measure,attr,omitempty"`
+}
+
+type tie struct {
+	Type string `xml:"type,attr"`
+}
+
+type notations struct {
+	Tied  []tie   `xml:"tied"`
+	Other []other `xml:",any"`
+}
+
+// valueTypes are the MusicXML names of the note values.
+var valueTypes = map[int]string{
+	1:   "whole",
+	2:   "half",
+	4:   "quarter",
+	8:   "eighth",
+	16:  "16th",
+	32:  "32nd",
+	64:  "64th",
+	128: "128th",
+	256: "256th",
+}
+
+// accidentals are the MusicXML names of the accidentals.
+var accidentals = map[int]string{
+	-2: "flat-flat",
+	-1: "flat",
+	0:  "natural",
+	1:  "sharp",
+	2:  "double-sharp",
+}
@@ -0,0 +1,541 @@
+// Package notation lays out midi tracks as a score: parts made of measures
+// holding voices of chords and rests whose durations are spelled into tied
+// note values. It's the common ground of the score exporters such as the
+// musicxml package.
+package notation
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/grid"
+)
+
+// Value is a note value expressed as a fraction of a whole note: 1 is a
+// whole note, 4 a quarter note and 32 a thirty-second note.
+type Value int
+
+// Options configures how the tracks are notated.
+type Options struct {
+	// Grid is the resolution the note starts and ends are snapped to,
+	// thirty-second notes by default. It also is the shortest note value of
+	// the score.
+	Grid grid.Res
+}
+
+// Score is the notation of a set of tracks.
+type Score struct {
+	// Divisions is the number of divisions per quarter note, the unit of all
+	// the positions and durations of the score.
+	Divisions int
+	// Measures is the layout of the measures shared by all the parts.
+	Measures []*Measure
+	Parts    []*Part
+}
+
+// Measure is a bar of the score.
+type Measure struct {
+	// Number is the measure number starting at 1.
+	Number int
+	// Start and Length are the position and length of the measure in
+	// divisions.
+	Start  int
+	Length int
+	Time   midi.TimeSignature
+	Key    midi.KeySignature
+	// TimeChange and KeyChange indicate that the time or key signature
+	// changes at this measure, which is always the case of the first measure.
+	TimeChange bool
+	KeyChange  bool
+	// Tempos are the tempo changes happening during the measure.
+	Tempos []Tempo
+}
+
+// Beat returns the length of a beat in divisions: the denominator of the
+// time signature, or a dotted value for compound meters such as 6/8.
+func (m *Measure) Beat(divisions int) int {
+	beat := 4 * divisions / m.Time.Denum()
+	if beat < 1 {
+		beat = 1
+	}
+	if m.Time.Numerator > 3 && m.Time.Numerator%3 == 0 {
+		beat *= 3
+	}
+	return beat
+}
+
+// Tempo is a tempo change at an offset (in divisions) of a measure.
+type Tempo struct {
+	Offset int
+	BPM    float64
+}
+
+// Clef is the clef of a part.
+type Clef int
+
+const (
+	// TrebleClef is the G clef on the second line.
+	TrebleClef Clef = iota
+	// BassClef is the F clef on the fourth line.
+	BassClef
+	// PercussionClef is used by the parts played on the GM drum channel.
+	PercussionClef
+)
+
+// Part is the notation of the notes played on a channel of a track.
+type Part struct {
+	// Name is the track name, the instrument name or the name of the GM
+	// program of the channel.
+	Name    string
+	Channel uint8
+	// Program is the first program selected on the channel.
+	Program uint8
+	Clef    Clef
+	// Measures holds the voices of each measure of the score, voices without
+	// notes in a measure are omitted except for the first one.
+	Measures [][]*Voice
+}
+
+// Voice is a sequence of chords and rests filling a measure.
+type Voice struct {
+	// Number is the voice number starting at 1.
+	Number   int
+	Elements []*Element
+}
+
+// Element is a chord, a note or a rest.
+type Element struct {
+	// Offset and Duration are the position in the measure and the length of
+	// the element in divisions.
+	Offset   int
+	Duration int
+	Value    Value
+	Dots     int
+	// Pitches are the notes of the chord from the lowest to the highest,
+	// rests don't have any pitch.
+	Pitches  []midi.Pitch
+	Velocity int
+	// TieStart indicates that the element is tied to the next one of its
+	// voice, TieStop that it's tied to the previous one.
+	TieStart bool
+	TieStop  bool
+	// MeasureRest is set on the rests filling an empty measure, they don't
+	// have a note value.
+	MeasureRest bool
+}
+
+// Rest reports whether the element is a rest.
+func (e *Element) Rest() bool {
+	return len(e.Pitches) == 0
+}
+
+// Octave returns the octave of the pitch letter in scientific pitch notation
+// (middle C is C4, B♯3 is the same midi note).
+func Octave(p midi.Pitch) int {
+	natural := p.Note - p.Alter
+	if natural < 0 {
+		return (natural-11)/12 - 1
+	}
+	return natural/12 - 1
+}
+
+// note is a note snapped to the grid, in divisions.
+type note struct {
+	start, end int
+	pitch, vel int
+}
+
+// chord is a set of notes of a voice starting and ending together.
+type chord struct {
+	start, end int
+	pitches    []int
+	vel        int
+}
+
+// FromTracks lays out the notes of the tracks: the notes of each channel of
+// a track become a part. The time signatures, key signatures and tempo
+// changes found in any of the tracks apply to all of them.
+func FromTracks(tracks []*midi.Track, ppq uint16, opts *Options) (*Score, error) {
+	if ppq == 0 {
+		return nil, fmt.Errorf("notation: invalid resolution of 0 ticks per quarter note")
+	}
+	res := grid.One32
+	if opts != nil && opts.Grid != "" {
+		res = opts.Grid
+	}
+	s := &Score{Divisions: int(res.StepsInBeat())}
+	toDiv := func(tick uint64) int {
+		return int((tick*uint64(s.Divisions) + uint64(ppq)/2) / uint64(ppq))
+	}
+
+	parts := []*Part{}
+	partNotes := [][]note{}
+	var end int
+	for i, t := range tracks {
+		if t == nil {
+			continue
+		}
+		channels := noteChannels(t)
+		for _, ch := range channels {
+			notes := []note{}
+			for _, ev := range channelTrack(t, ch).AbsoluteEvents() {
+				n := note{start: toDiv(uint64(ev.Start)), end: toDiv(uint64(ev.End())), pitch: ev.MIDINote, vel: ev.Vel}
+				if n.end <= n.start {
+					n.end = n.start + 1
+				}
+				if n.end > end {
+					end = n.end
+				}
+				notes = append(notes, n)
+			}
+			parts = append(parts, &Part{
+				Name:    partName(t, i, ch, len(channels) > 1),
+				Channel: ch,
+				Program: firstProgram(t, ch),
+				Clef:    clef(ch, notes),
+			})
+			partNotes = append(partNotes, notes)
+		}
+	}
+
+	s.layoutMeasures(tracks, ppq, end, toDiv)
+	for i, p := range parts {
+		voices := assignVoices(partNotes[i])
+		p.Measures = make([][]*Voice, len(s.Measures))
+		for mi, m := range s.Measures {
+			for vi, chords := range voices {
+				v := s.layoutVoice(m, chords)
+				if v == nil && vi > 0 {
+					continue
+				}
+				if v == nil {
+					v = &Voice{Elements: []*Element{{Duration: m.Length, MeasureRest: true}}}
+				}
+				v.Number = vi + 1
+				p.Measures[mi] = append(p.Measures[mi], v)
+			}
+			if len(voices) == 0 {
+				p.Measures[mi] = []*Voice{{Number: 1, Elements: []*Element{{Duration: m.Length, MeasureRest: true}}}}
+			}
+		}
+		s.Parts = append(s.Parts, p)
+	}
+	return s, nil
+}
+
+// layoutMeasures creates the measures covering the score up to the passed
+// end (in divisions) using the bar lines of the meter map.
+func (s *Score) layoutMeasures(tracks []*midi.Track, ppq uint16, end int, toDiv func(uint64) int) {
+	meters := midi.MeterMapOf(tracks...)
+	keys := midi.KeyTimelineOf(tracks...)
+	endTick := (uint64(end)*uint64(ppq) + uint64(s.Divisions) - 1) / uint64(s.Divisions)
+	bars := meters.Bars(endTick, ppq)
+	if len(bars) == 0 {
+		bars = []uint64{0}
+	}
+
+	var last *Measure
+	addMeasure := func(tick uint64, length int) {
+		m := &Measure{Number: len(s.Measures) + 1, Length: length, Time: meters.At(tick), Key: keys.At(tick)}
+		if last != nil {
+			m.Start = last.Start + last.Length
+			m.TimeChange = m.Time.Numerator != last.Time.Numerator || m.Time.Denominator != last.Time.Denominator
+			m.KeyChange = m.Key != last.Key
+		} else {
+			m.TimeChange, m.KeyChange = true, true
+		}
+		s.Measures = append(s.Measures, m)
+		last = m
+	}
+	for i, tick := range bars {
+		var length int
+		if i+1 < len(bars) {
+			length = toDiv(bars[i+1]) - toDiv(tick)
+		} else {
+			ts := meters.At(tick)
+			length = toDiv(tick+ts.TicksPerBar(ppq)) - toDiv(tick)
+		}
+		// bars shorter than the grid can't be notated
+		if length < 1 {
+			continue
+		}
+		addMeasure(tick, length)
+	}
+	if last == nil {
+		addMeasure(0, 4*s.Divisions)
+	}
+	for last.Start+last.Length < end {
+		addMeasure(uint64(last.Start+last.Length)*uint64(ppq)/uint64(s.Divisions), last.Length)
+	}
+
+	var bpm float64
+	for _, c := range midi.TempoMapOf(tracks...) {
+		if c.BPM() == bpm {
+			continue
+		}
+		bpm = c.BPM()
+		pos := toDiv(c.Tick)
+		i := sort.Search(len(s.Measures), func(i int) bool { return s.Measures[i].Start > pos })
+		if i == 0 {
+			continue
+		}
+		m := s.Measures[i-1]
+		if pos >= m.Start+m.Length {
+			// tempo changes after the last note
+			continue
+		}
+		m.Tempos = append(m.Tempos, Tempo{Offset: pos - m.Start, BPM: bpm})
+	}
+}
+
+// layoutVoice returns the elements of the voice in the measure, nil if the
+// voice doesn't have any note in the measure.
+func (s *Score) layoutVoice(m *Measure, chords []chord) *Voice {
+	start, end := m.Start, m.Start+m.Length
+	i := sort.Search(len(chords), func(i int) bool { return chords[i].end > start })
+	if i == len(chords) || chords[i].start >= end {
+		return nil
+	}
+	v := &Voice{}
+	beat := m.Beat(s.Divisions)
+	add := func(from, to int, c *chord) {
+		values := spellDuration(from-start, to-start, beat, 4*s.Divisions)
+		pos := from
+		for j, d := range values {
+			el := &Element{Offset: pos - start, Duration: d.length, Value: d.value, Dots: d.dots}
+			if c != nil {
+				el.Pitches = make([]midi.Pitch, len(c.pitches))
+				for k, p := range c.pitches {
+					el.Pitches[k] = m.Key.Spell(p)
+				}
+				el.Velocity = c.vel
+				el.TieStop = j > 0 || from > c.start
+				el.TieStart = j < len(values)-1 || to < c.end
+			}
+			v.Elements = append(v.Elements, el)
+			pos += d.length
+		}
+	}
+	pos := start
+	for ; i < len(chords) && chords[i].start < end; i++ {
+		c := &chords[i]
+		from, to := c.start, c.end
+		if from < start {
+			from = start
+		}
+		if to > end {
+			to = end
+		}
+		if from > pos {
+			add(pos, from, nil)
+		}
+		add(from, to, c)
+		pos = to
+	}
+	if pos < end {
+		add(pos, end, nil)
+	}
+	return v
+}
+
+// assignVoices groups the notes into chords and spreads the chords into
+// voices: a chord goes into the first voice free at its start.
+func assignVoices(notes []note) [][]chord {
+	sort.Slice(notes, func(i, j int) bool {
+		a, b := notes[i], notes[j]
+		if a.start != b.start {
+			return a.start < b.start
+		}
+		if a.end != b.end {
+			return a.end > b.end
+		}
+		return a.pitch < b.pitch
+	})
+	voices := [][]chord{}
+next:
+	for _, n := range notes {
+		for vi, v := range voices {
+			last := &v[len(v)-1]
+			if last.start == n.start && last.end == n.end {
+				last.pitches = append(last.pitches, n.pitch)
+				if n.vel > last.vel {
+					last.vel = n.vel
+				}
+				continue next
+			}
+			if last.end <= n.start {
+				voices[vi] = append(v, chord{start: n.start, end: n.end, pitches: []int{n.pitch}, vel: n.vel})
+				continue next
+			}
+		}
+		voices = append(voices, []chord{{start: n.start, end: n.end, pitches: []int{n.pitch}, vel: n.vel}})
+	}
+	return voices
+}
+
+// duration is a notated value.
+type duration struct {
+	length int
+	value  Value
+	dots   int
+}
+
+// spellDuration splits the span between the two measure offsets into tied
+// note values so the notes don't hide the beats: the values longer than a
+// beat start on a beat, the shorter ones don't cross a beat and start on a
+// multiple of their length (of half their length for dotted values) from the
+// beginning of the beat. The dotted beats of compound meters are divided in
+// three, the values of a division or longer start on a division.
+func spellDuration(from, to, beat, whole int) []duration {
+	division := beat
+	if beat%3 == 0 {
+		division = beat / 3
+	}
+	fits := func(pos, length, align int) bool {
+		if pos+length > to {
+			return false
+		}
+		if length >= beat {
+			return pos%beat == 0
+		}
+		if pos/beat != (pos+length-1)/beat {
+			return false
+		}
+		if length >= division {
+			return pos%beat%division == 0
+		}
+		return pos%beat%division%align == 0
+	}
+	values := []duration{}
+	for pos := from; pos < to; {
+		var best duration
+		for v := 1; whole/v >= 1 && whole%v == 0; v *= 2 {
+			base := whole / v
+			if base%2 == 0 && fits(pos, base+base/2, base/2) {
+				best = duration{length: base + base/2, value: Value(v), dots: 1}
+				break
+			}
+			if fits(pos, base, base) {
+				best = duration{length: base, value: Value(v)}
+				break
+			}
+		}
+		if best.length == 0 {
+			// can't happen with a power of 2 number of divisions per whole note
+			best = duration{length: to - pos}
+		}
+		values = append(values, best)
+		pos += best.length
+	}
+	return values
+}
+
+// noteChannels returns the channels the track plays notes on.
+func noteChannels(t *midi.Track) []uint8 {
+	var used [16]bool
+	for _, ev := range t.Events {
+		if ev.MsgType == midi.EventByteMap["NoteOn"] {
+			used[ev.MsgChan&0xF] = true
+		}
+	}
+	channels := []uint8{}
+	for ch, ok := range used {
+		if ok {
+			channels = append(channels, uint8(ch))
+		}
+	}
+	return channels
+}
+
+// channelTrack returns a track with copies of the note events of the
+// channel, with their absolute ticks set as expected by AbsoluteEvents. Note
+// offs without a matching note on are dropped.
+func channelTrack(t *midi.Track, ch uint8) *midi.Track {
+	ct := &midi.Track{}
+	playing := map[uint8]bool{}
+	var tick, last uint64
+	for _, ev := range t.Events {
+		tick += uint64(ev.TimeDelta)
+		if ev.MsgChan != ch {
+			continue
+		}
+		switch ev.MsgType {
+		case midi.EventByteMap["NoteOn"]:
+			if ev.Velocity == 0 && !playing[ev.Note] {
+				continue
+			}
+			playing[ev.Note] = ev.Velocity > 0
+		case midi.EventByteMap["NoteOff"]:
+			if !playing[ev.Note] {
+				continue
+			}
+			playing[ev.Note] = false
+		default:
+			continue
+		}
+		c := ev.Copy()
+		c.AbsTicks = tick
+		c.TimeDelta = uint32(tick - last)
+		last = tick
+		ct.Events = append(ct.Events, c)
+	}
+	return ct
+}
+
+// partName names the part of the channel of the track.
+func partName(t *midi.Track, index int, ch uint8, multiChannel bool) string {
+	var name string
+	for _, ev := range t.Events {
+		if ev.MsgType != midi.EventByteMap["Meta"] {
+			continue
+		}
+		if ev.Cmd == midi.MetaByteMap["Sequence/Track name"] && ev.SeqTrackName != "" {
+			name = ev.SeqTrackName
+			break
+		}
+		if ev.Cmd == midi.MetaByteMap["Instrument name"] && ev.InstrumentName != "" && name == "" {
+			name = ev.InstrumentName
+		}
+	}
+	if name == "" {
+		for _, state := range t.Programs(midi.GM1Bank) {
+			if state.Channel == ch {
+				return state.Name
+			}
+		}
+		name = fmt.Sprintf("Track %d", index+1)
+	}
+	if multiChannel {
+		name = fmt.Sprintf("%s (channel %d)", name, ch+1)
+	}
+	return name
+}
+
+// firstProgram returns the first program selected on the channel.
+func firstProgram(t *midi.Track, ch uint8) uint8 {
+	for _, state := range t.Programs(midi.GM1Bank) {
+		if state.Channel == ch {
+			return state.Program
+		}
+	}
+	return 0
+}
+
+// clef picks the clef of the notes of a part.
+func clef(ch uint8, notes []note) Clef {
+	if ch == 9 {
+		return PercussionClef
+	}
+	if len(notes) == 0 {
+		return TrebleClef
+	}
+	var sum int
+	for _, n := range notes {
+		sum += n.pitch
+	}
+	if sum/len(notes) < 60 {
+		return BassClef
+	}
+	return TrebleClef
+}
@@ -0,0 +1,128 @@
+package notation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/internal/miditest"
+)
+
+func Test_spellDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to int
+		beat     int
+		want     []duration
+	}{
+		{name: "whole", from: 0, to: 32, beat: 8, want: []duration{{32, 1, 0}}},
+		{name: "dotted half", from: 0, to: 24, beat: 8, want: []duration{{24, 2, 1}}},
+		{name: "half on beat 2", from: 8, to: 24, beat: 8, want: []duration{{16, 2, 0}}},
+		{name: "syncopated eighth", from: 4, to: 12, beat: 8, want: []duration{{4, 8, 0}, {4, 8, 0}}},
+		{name: "sixteenth and dotted eighth", from: 2, to: 8, beat: 8, want: []duration{{6, 8, 1}}},
+		{name: "five eighths", from: 0, to: 20, beat: 8, want: []duration{{16, 2, 0}, {4, 8, 0}}},
+		{name: "6/8 bar", from: 0, to: 24, beat: 12, want: []duration{{24, 2, 1}}},
+		{name: "6/8 second beat", from: 12, to: 24, beat: 12, want: []duration{{12, 4, 1}}},
+		{name: "6/8 quarter on the second beat", from: 12, to: 20, beat: 12, want: []duration{{8, 4, 0}}},
+		{name: "6/8 quarter after an eighth", from: 4, to: 12, beat: 12, want: []duration{{8, 4, 0}}},
+		{name: "6/8 quarter across the beats", from: 8, to: 16, beat: 12, want: []duration{{4, 8, 0}, {4, 8, 0}}},
+		{name: "thirty-second", from: 7, to: 8, beat: 8, want: []duration{{1, 32, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := spellDuration(tt.from, tt.to, tt.beat, 32); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("spellDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromTracks(t *testing.T) {
+	tr := miditest.VoicesTrack("Piano")
+	// an eighth note in the third bar
+	tr.AddAfterDelta(192, midi.NoteOn(0, 60, 64))
+	tr.AddAfterDelta(48, midi.NoteOff(0, 60))
+
+	s, err := FromTracks([]*midi.Track{tr}, 96, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Divisions != 8 {
+		t.Errorf("expected 8 divisions, got %d", s.Divisions)
+	}
+	if len(s.Measures) != 3 {
+		t.Fatalf("expected 3 measures, got %d", len(s.Measures))
+	}
+	m := s.Measures[0]
+	if m.Length != 24 || !m.TimeChange || !m.KeyChange || m.Key.Key != -1 {
+		t.Errorf("unexpected first measure %+v", m)
+	}
+	if len(m.Tempos) != 1 || m.Tempos[0].BPM != 100 {
+		t.Errorf("expected a tempo of 100 BPM, got %v", m.Tempos)
+	}
+	if s.Measures[1].TimeChange || s.Measures[1].KeyChange {
+		t.Errorf("the second measure doesn't change the signatures")
+	}
+
+	if len(s.Parts) != 1 || s.Parts[0].Name != "Piano" {
+		t.Fatalf("expected a Piano part, got %+v", s.Parts)
+	}
+	p := s.Parts[0]
+	type el struct {
+		offset, duration int
+		value            Value
+		dots             int
+		pitches          string
+		tieStart         bool
+		tieStop          bool
+	}
+	summary := func(v *Voice) []el {
+		els := []el{}
+		for _, e := range v.Elements {
+			var pitches string
+			for _, p := range e.Pitches {
+				pitches += p.String()
+			}
+			els = append(els, el{e.Offset, e.Duration, e.Value, e.Dots, pitches, e.TieStart, e.TieStop})
+		}
+		return els
+	}
+
+	bar1 := p.Measures[0]
+	if len(bar1) != 2 {
+		t.Fatalf("expected 2 voices in the first bar, got %d", len(bar1))
+	}
+	if got, want := summary(bar1[0]), []el{{0, 24, 2, 1, "G3", true, false}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("voice 1 of bar 1 = %v, want %v", got, want)
+	}
+	if got, want := summary(bar1[1]), []el{{0, 16, 2, 0, "Bb3D4", false, false}, {16, 8, 4, 0, "", false, false}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("voice 2 of bar 1 = %v, want %v", got, want)
+	}
+	bar2 := p.Measures[1]
+	if len(bar2) != 1 {
+		t.Fatalf("expected 1 voice in the second bar, got %d", len(bar2))
+	}
+	if got, want := summary(bar2[0]), []el{{0, 8, 4, 0, "G3", false, true}, {8, 16, 2, 0, "", false, false}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("voice 1 of bar 2 = %v, want %v", got, want)
+	}
+	if got, want := summary(p.Measures[2][0]), []el{{0, 4, 8, 0, "C3", false, false}, {4, 4, 8, 0, "", false, false}, {8, 16, 2, 0, "", false, false}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("voice 1 of bar 3 = %v, want %v", got, want)
+	}
+}
+
+func TestOctave(t *testing.T) {
+	tests := []struct {
+		pitch midi.Pitch
+		want  int
+	}{
+		{midi.Pitch{Letter: 'C', Note: 60}, 4},
+		{midi.Pitch{Letter: 'B', Alter: 1, Note: 60}, 3},
+		{midi.Pitch{Letter: 'C', Alter: -1, Note: 59}, 4},
+		{midi.Pitch{Letter: 'C', Note: 0}, -1},
+	}
+	for _, tt := range tests {
+		if got := Octave(tt.pitch); got != tt.want {
+			t.Errorf("Octave(%v) = %d, want %d", tt.pitch, got, tt.want)
+		}
+	}
+}
@@ -42,9 +42,14 @@ type Note struct {
 	Velocity int
 }
 
-// KeyInt converts an A-G note notation to a midi note number value.
+// KeyInt converts an A-G note notation to a midi note number value. Flats,
+// double accidentals and the ♯/♭ symbols are supported (Bb, F##, E♭), the
+// octave uses the default notation where the middle C is C3.
 func KeyInt(n string, octave int) int {
 	key := NotesToInt[strings.ToUpper(n)]
+	if letter, alter, rest, err := parsePitchClass(n); err == nil && rest == "" {
+		key = letterPitchClasses[letter] + alter
+	}
 	// octave starts at -2 but first note is at 0
 	return key + (octave+2)*12
 }
@@ -60,7 +65,10 @@ func NoteToFreq(note int) float64 {
 	return rootA * math.Pow(2, (float64(note)-69.0)/12.0)
 }
 
-// NoteToName converts a midi note value into its English name
+// NoteToName converts a midi note value into its English name, spelled with
+// sharps and using the default notation (C-2 for note 0). Use SpellNote or
+// PitchNotation.Name to spell notes in a key or with another octave
+// convention.
 func NoteToName(note int) string {
 	key := Notes[note%12]
 	octave := note/12 - 2 // The MIDI scale starts at octave = -2
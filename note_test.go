@@ -30,6 +30,10 @@ func TestKeyToInt(t *testing.T) {
 		{"A", 0, 33},
 		{"B", 0, 35},
 		{"C", 3, 60},
+		{"Bb", 3, 70},
+		{"B♭", 3, 70},
+		{"Cb", 3, 59},
+		{"F##", 3, 67},
 	}
 
 	for _, tc := range testCases {
@@ -0,0 +1,330 @@
+// Package pianoroll draws the notes of midi tracks as a piano roll, as an
+// image (which can be encoded as PNG) or as SVG. Time runs from left to
+// right with the bar and beat lines of the tracks' meter, pitch from bottom
+// to top. The notes of each track have their own colour, shaded by their
+// velocity.
+package pianoroll
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+
+	"github.com/go-audio/midi"
+)
+
+const (
+	// DefaultPixelsPerQuarterNote is the default horizontal scale.
+	DefaultPixelsPerQuarterNote = 24
+	// DefaultNoteHeight is the default height of a note row in pixels.
+	DefaultNoteHeight = 6
+)
+
+// DefaultColors are the colours given to the tracks, in order.
+var DefaultColors = []color.RGBA{
+	{0x1f, 0x77, 0xb4, 0xff},
+	{0xff, 0x7f, 0x0e, 0xff},
+	{0x2c, 0xa0, 0x2c, 0xff},
+	{0xd6, 0x27, 0x28, 0xff},
+	{0x94, 0x67, 0xbd, 0xff},
+	{0x8c, 0x56, 0x4b, 0xff},
+	{0xe3, 0x77, 0xc2, 0xff},
+	{0x17, 0xbe, 0xcf, 0xff},
+}
+
+var (
+	backgroundColor = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	blackKeyColor   = color.RGBA{0xf0, 0xf0, 0xf0, 0xff}
+	beatColor       = color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+	barColor        = color.RGBA{0x80, 0x80, 0x80, 0xff}
+)
+
+// Renderer draws the notes of tracks.
+type Renderer struct {
+	TicksPerQuarterNote uint16
+	Tracks              []*midi.Track
+	// FromTick and ToTick are the range of ticks drawn, ToTick defaults to
+	// the end of the bar in which the last note ends.
+	FromTick, ToTick uint64
+	// LowNote and HighNote are the range of notes drawn, the range of the
+	// notes played if both are 0.
+	LowNote, HighNote int
+	// PixelsPerQuarterNote is the horizontal scale,
+	// DefaultPixelsPerQuarterNote if not set.
+	PixelsPerQuarterNote int
+	// NoteHeight is the height of a note row in pixels, DefaultNoteHeight if
+	// not set.
+	NoteHeight int
+	// Colors are the colours of the tracks, reused when there are more tracks
+	// than colours. DefaultColors if not set.
+	Colors []color.RGBA
+}
+
+// NewRenderer returns a renderer for tracks with the passed resolution.
+func NewRenderer(ppqn uint16) *Renderer {
+	return &Renderer{TicksPerQuarterNote: ppqn}
+}
+
+// roll is the layout of a piano roll in pixels shared by the image and SVG
+// outputs.
+type roll struct {
+	width, height int
+	low, high     int
+	// bars and beats are the positions of the vertical lines.
+	bars, beats []int
+	notes       []box
+}
+
+// box is a note to draw.
+type box struct {
+	image.Rectangle
+	track int
+	note  int
+	vel   int
+}
+
+// layout places the notes, bars and beats in the ranges of the renderer.
+func (r *Renderer) layout() *roll {
+	ppq := r.TicksPerQuarterNote
+	if ppq == 0 {
+		ppq = 96
+	}
+	pxPerQuarter := r.PixelsPerQuarterNote
+	if pxPerQuarter <= 0 {
+		pxPerQuarter = DefaultPixelsPerQuarterNote
+	}
+	noteHeight := r.NoteHeight
+	if noteHeight <= 0 {
+		noteHeight = DefaultNoteHeight
+	}
+
+	tracks := make([]midi.AbsEvents, len(r.Tracks))
+	low, high := 127, 0
+	var end uint64
+	for i, t := range r.Tracks {
+		tracks[i] = noteEvents(t)
+		for _, ev := range tracks[i] {
+			if ev.MIDINote < low {
+				low = ev.MIDINote
+			}
+			if ev.MIDINote > high {
+				high = ev.MIDINote
+			}
+			if e := uint64(ev.End()); e > end {
+				end = e
+			}
+		}
+	}
+	if r.LowNote != 0 || r.HighNote != 0 {
+		low, high = r.LowNote, r.HighNote
+	}
+	if high < low {
+		// no notes
+		low, high = 60, 71
+	}
+
+	meter := midi.MeterMapOf(r.Tracks...)
+	from, to := r.FromTick, r.ToTick
+	if to == 0 {
+		to = end
+		bars := meter.Bars(end, ppq)
+		if len(bars) > 0 {
+			last := bars[len(bars)-1]
+			ts := meter.At(last)
+			to = last + ts.TicksPerBar(ppq)
+		}
+	}
+	if to <= from {
+		to = from + 4*uint64(ppq)
+	}
+	x := func(tick uint64) int {
+		if tick < from {
+			return 0
+		}
+		return int((tick - from) * uint64(pxPerQuarter) / uint64(ppq))
+	}
+
+	rl := &roll{
+		width:  x(to),
+		height: (high - low + 1) * noteHeight,
+		low:    low,
+		high:   high,
+	}
+	bars := meter.Bars(to, ppq)
+	for i, bar := range bars {
+		next := to
+		if i+1 < len(bars) {
+			next = bars[i+1]
+		}
+		if bar >= from {
+			rl.bars = append(rl.bars, x(bar))
+		}
+		ts := meter.At(bar)
+		beat := 4 * uint64(ppq) / uint64(ts.Denum())
+		if beat == 0 {
+			beat = uint64(ppq)
+		}
+		for tick := bar + beat; tick < next; tick += beat {
+			if tick >= from {
+				rl.beats = append(rl.beats, x(tick))
+			}
+		}
+	}
+	for ti, evs := range tracks {
+		for _, ev := range evs {
+			start, stop := uint64(ev.Start), uint64(ev.End())
+			if stop <= from || start >= to || ev.MIDINote < low || ev.MIDINote > high {
+				continue
+			}
+			if stop > to {
+				stop = to
+			}
+			y := (high - ev.MIDINote) * noteHeight
+			b := box{
+				Rectangle: image.Rect(x(start), y, x(stop), y+noteHeight),
+				track:     ti,
+				note:      ev.MIDINote,
+				vel:       ev.Vel,
+			}
+			// very short notes are still visible
+			if b.Dx() < 1 {
+				b.Max.X = b.Min.X + 1
+			}
+			rl.notes = append(rl.notes, b)
+		}
+	}
+	return rl
+}
+
+// noteEvents returns the notes of a track, on all its channels. The note
+// offs without a matching note on are ignored.
+func noteEvents(t *midi.Track) midi.AbsEvents {
+	var channels [16]*midi.Track
+	playing := [16][128]bool{}
+	var tick uint64
+	for _, ev := range t.Events {
+		tick += uint64(ev.TimeDelta)
+		ch := ev.MsgChan & 0xF
+		note := ev.Note & 0x7F
+		switch ev.MsgType {
+		case midi.EventByteMap["NoteOn"]:
+			if ev.Velocity == 0 && !playing[ch][note] {
+				continue
+			}
+			playing[ch][note] = ev.Velocity > 0
+		case midi.EventByteMap["NoteOff"]:
+			if !playing[ch][note] {
+				continue
+			}
+			playing[ch][note] = false
+		default:
+			continue
+		}
+		if channels[ch] == nil {
+			channels[ch] = &midi.Track{}
+		}
+		c := ev.Copy()
+		c.AbsTicks = tick
+		channels[ch].Events = append(channels[ch].Events, c)
+	}
+	evs := midi.AbsEvents{}
+	for _, ct := range channels {
+		if ct == nil {
+			continue
+		}
+		// AbsoluteEvents accumulates the deltas
+		var last uint64
+		for _, ev := range ct.Events {
+			ev.TimeDelta = uint32(ev.AbsTicks - last)
+			last = ev.AbsTicks
+		}
+		evs = append(evs, ct.AbsoluteEvents()...)
+	}
+	return evs
+}
+
+// color returns the colour of a track.
+func (r *Renderer) color(track int) color.RGBA {
+	colors := r.Colors
+	if len(colors) == 0 {
+		colors = DefaultColors
+	}
+	return colors[track%len(colors)]
+}
+
+// opacity returns the opacity of a note: the softest notes are faint, the
+// loudest ones have the colour of their track.
+func opacity(vel int) float64 {
+	if vel < 0 {
+		vel = 0
+	}
+	if vel > 127 {
+		vel = 127
+	}
+	return 0.2 + 0.8*float64(vel)/127
+}
+
+// shade blends a colour over the background with the passed opacity.
+func shade(c color.RGBA, alpha float64) color.RGBA {
+	mix := func(fg, bg uint8) uint8 {
+		return uint8(float64(fg)*alpha + float64(bg)*(1-alpha) + 0.5)
+	}
+	return color.RGBA{
+		mix(c.R, backgroundColor.R),
+		mix(c.G, backgroundColor.G),
+		mix(c.B, backgroundColor.B),
+		0xff,
+	}
+}
+
+// darken returns the colour of the note outlines.
+func darken(c color.RGBA) color.RGBA {
+	return color.RGBA{c.R / 2, c.G / 2, c.B / 2, c.A}
+}
+
+// isBlackKey reports whether the note is played on a black key.
+func isBlackKey(note int) bool {
+	switch (note%12 + 12) % 12 {
+	case 1, 3, 6, 8, 10:
+		return true
+	}
+	return false
+}
+
+// Image draws the piano roll.
+func (r *Renderer) Image() *image.RGBA {
+	rl := r.layout()
+	img := image.NewRGBA(image.Rect(0, 0, rl.width, rl.height))
+	fill := func(rect image.Rectangle, c color.RGBA) {
+		draw.Draw(img, rect, &image.Uniform{c}, image.Point{}, draw.Src)
+	}
+	fill(img.Bounds(), backgroundColor)
+	noteHeight := rl.height / (rl.high - rl.low + 1)
+	for note := rl.low; note <= rl.high; note++ {
+		if isBlackKey(note) {
+			y := (rl.high - note) * noteHeight
+			fill(image.Rect(0, y, rl.width, y+noteHeight), blackKeyColor)
+		}
+	}
+	for _, x := range rl.beats {
+		fill(image.Rect(x, 0, x+1, rl.height), beatColor)
+	}
+	for _, x := range rl.bars {
+		fill(image.Rect(x, 0, x+1, rl.height), barColor)
+	}
+	for _, b := range rl.notes {
+		c := r.color(b.track)
+		fill(b.Rectangle, darken(c))
+		if b.Dx() > 2 && b.Dy() > 2 {
+			fill(b.Inset(1), shade(c, opacity(b.vel)))
+		}
+	}
+	return img
+}
+
+// WritePNG draws the piano roll and encodes it as PNG.
+func (r *Renderer) WritePNG(w io.Writer) error {
+	return png.Encode(w, r.Image())
+}
@@ -0,0 +1,153 @@
+package pianoroll
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/internal/miditest"
+)
+
+// testTracks returns two tracks in 3/4 at 96 ticks per quarter note.
+func testTracks() []*midi.Track {
+	lead := &midi.Track{}
+	lead.AddAfterDelta(0, midi.TrackName("Lead & Bass"))
+	lead.AddAfterDelta(0, &midi.Event{MsgType: 0xF, Cmd: 0x58, TimeSignature: &midi.TimeSignature{Numerator: 3, Denominator: 2}})
+	// a note off without note on is ignored
+	lead.AddAfterDelta(0, midi.NoteOff(0, 50))
+	lead.AddAfterDelta(0, midi.NoteOn(0, 60, 127))
+	lead.AddAfterDelta(96, midi.NoteOff(0, 60))
+	lead.AddAfterDelta(0, midi.NoteOn(0, 64, 32))
+	lead.AddAfterDelta(192, midi.NoteOn(0, 64, 0))
+
+	pad := &midi.Track{}
+	pad.AddAfterDelta(288, midi.NoteOn(1, 67, 100))
+	pad.AddAfterDelta(96, midi.NoteOff(1, 67))
+	return []*midi.Track{lead, pad}
+}
+
+func TestRenderer_Image(t *testing.T) {
+	r := NewRenderer(96)
+	r.Tracks = testTracks()
+	img := r.Image()
+	// two bars of 3/4 at 4 ticks per pixel, notes 60 to 67
+	if b := img.Bounds(); b.Dx() != 144 || b.Dy() != 48 {
+		t.Fatalf("unexpected size %v", b)
+	}
+	for _, tc := range []struct {
+		name string
+		x, y int
+		want color.RGBA
+	}{
+		{"loudest note", 12, 45, DefaultColors[0]},
+		{"note outline", 0, 42, darken(DefaultColors[0])},
+		{"soft note", 48, 21, shade(DefaultColors[0], opacity(32))},
+		{"second track", 84, 3, shade(DefaultColors[1], opacity(100))},
+		{"bar line", 72, 30, barColor},
+		{"beat line", 24, 30, beatColor},
+		{"beat line of the second bar", 120, 30, beatColor},
+		{"black key", 10, 38, blackKeyColor},
+		{"white key", 10, 32, backgroundColor},
+	} {
+		if got := img.RGBAAt(tc.x, tc.y); got != tc.want {
+			t.Errorf("%s: pixel (%d, %d) = %v, want %v", tc.name, tc.x, tc.y, got, tc.want)
+		}
+	}
+}
+
+func TestRenderer_Image_ranges(t *testing.T) {
+	r := NewRenderer(96)
+	r.Tracks = testTracks()
+	r.FromTick, r.ToTick = 96, 288
+	r.LowNote, r.HighNote = 62, 66
+	r.PixelsPerQuarterNote = 48
+	r.NoteHeight = 4
+	r.Colors = []color.RGBA{{0, 0, 0, 0xff}}
+	img := r.Image()
+	if b := img.Bounds(); b.Dx() != 96 || b.Dy() != 20 {
+		t.Fatalf("unexpected size %v", b)
+	}
+	// only the E is in the ranges
+	rl := r.layout()
+	if len(rl.notes) != 1 || rl.notes[0].note != 64 || rl.notes[0].Min.X != 0 || rl.notes[0].Max.X != 96 || rl.notes[0].Min.Y != 8 {
+		t.Errorf("unexpected notes %+v", rl.notes)
+	}
+	if got, want := img.RGBAAt(50, 10), shade(color.RGBA{0, 0, 0, 0xff}, opacity(32)); got != want {
+		t.Errorf("note pixel = %v, want %v", got, want)
+	}
+}
+
+func TestRenderer_WriteSVG(t *testing.T) {
+	r := NewRenderer(96)
+	r.Tracks = testTracks()
+	buf := &bytes.Buffer{}
+	if err := r.WriteSVG(buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		`<svg xmlns="http://www.w3.org/2000/svg" width="144" height="48" viewBox="0 0 144 48">`,
+		"<title>Lead &amp; Bass</title>",
+		`<g fill="#1f77b4" stroke="#0f3b5a">`,
+		`<rect x="0.5" y="42.5" width="23.5" height="5.5" fill-opacity="1.00"><title>C3 127</title></rect>`,
+		`<rect x="72" width="1" height="48"/>`,
+		"</svg>",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected the SVG to contain %q\n%s", expected, out)
+		}
+	}
+	if n := strings.Count(out, "</title></rect>"); n != 3 {
+		t.Errorf("expected 3 notes, got %d", n)
+	}
+}
+
+func TestRenderer_WritePNG(t *testing.T) {
+	r := NewRenderer(96)
+	r.Tracks = testTracks()
+	buf := &bytes.Buffer{}
+	if err := r.WritePNG(buf); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 144 || b.Dy() != 48 {
+		t.Errorf("unexpected size %v", b)
+	}
+}
+
+func TestRenderer_fixtures(t *testing.T) {
+	miditest.Fixtures(t, func(t *testing.T, d *midi.Decoder) {
+		r := NewRenderer(d.TicksPerQuarterNote)
+		r.Tracks = d.Tracks
+		buf := &bytes.Buffer{}
+		if err := r.WriteSVG(buf); err != nil {
+			t.Fatal(err)
+		}
+		// every note of the file is drawn, titled with its name
+		want := []string{}
+		for _, note := range miditest.NotePitches(d.Tracks...) {
+			want = append(want, midi.NoteToName(note))
+		}
+		got := []string{}
+		for _, m := range noteTitle.FindAllStringSubmatch(buf.String(), -1) {
+			got = append(got, m[1])
+		}
+		sort.Strings(want)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %d notes drawn, got %d", len(want), len(got))
+		}
+	})
+}
+
+// noteTitle matches the title of a note of a SVG piano roll.
+var noteTitle = regexp.MustCompile(`<title>(\S+) \d+</title></rect>`)
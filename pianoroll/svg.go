@@ -0,0 +1,79 @@
+package pianoroll
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+
+	"github.com/go-audio/midi"
+)
+
+// WriteSVG draws the piano roll as an SVG document. Each track is a group
+// titled with the track name and each note has a title with its name and
+// velocity.
+func (r *Renderer) WriteSVG(w io.Writer) error {
+	rl := r.layout()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		rl.width, rl.height, rl.width, rl.height)
+	fmt.Fprintf(bw, `<rect width="%d" height="%d" fill="%s"/>`+"\n", rl.width, rl.height, hex(backgroundColor))
+
+	noteHeight := rl.height / (rl.high - rl.low + 1)
+	fmt.Fprintf(bw, `<g fill="%s">`+"\n", hex(blackKeyColor))
+	for note := rl.low; note <= rl.high; note++ {
+		if isBlackKey(note) {
+			fmt.Fprintf(bw, `<rect y="%d" width="%d" height="%d"/>`+"\n", (rl.high-note)*noteHeight, rl.width, noteHeight)
+		}
+	}
+	fmt.Fprintf(bw, "</g>\n")
+	writeLines(bw, rl.beats, rl.height, beatColor)
+	writeLines(bw, rl.bars, rl.height, barColor)
+
+	for ti, t := range r.Tracks {
+		c := r.color(ti)
+		fmt.Fprintf(bw, `<g fill="%s" stroke="%s">`+"\n", hex(c), hex(darken(c)))
+		if name := t.Name(); name != "" {
+			fmt.Fprintf(bw, "<title>%s</title>\n", escape(name))
+		}
+		for _, b := range rl.notes {
+			if b.track != ti {
+				continue
+			}
+			// the outline is drawn inside the box like in the image
+			fmt.Fprintf(bw, `<rect x="%s" y="%s" width="%s" height="%s" fill-opacity="%s"><title>%s %d</title></rect>`+"\n",
+				half(2*b.Min.X+1), half(2*b.Min.Y+1), half(2*b.Dx()-1), half(2*b.Dy()-1),
+				strconv.FormatFloat(opacity(b.vel), 'f', 2, 64), midi.NoteToName(b.note), b.vel)
+		}
+		fmt.Fprintf(bw, "</g>\n")
+	}
+	fmt.Fprintf(bw, "</svg>\n")
+	return bw.Flush()
+}
+
+// writeLines writes the vertical lines at the passed positions.
+func writeLines(w io.Writer, xs []int, height int, c color.RGBA) {
+	fmt.Fprintf(w, `<g fill="%s">`+"\n", hex(c))
+	for _, x := range xs {
+		fmt.Fprintf(w, `<rect x="%d" width="1" height="%d"/>`+"\n", x, height)
+	}
+	fmt.Fprintf(w, "</g>\n")
+}
+
+// half formats a number of half pixels.
+func half(v int) string {
+	return strconv.FormatFloat(float64(v)/2, 'f', -1, 64)
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func escape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
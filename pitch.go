@@ -0,0 +1,200 @@
+package midi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// letterPitchClasses maps the note letters to their pitch class.
+var letterPitchClasses = map[byte]int{
+	'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11,
+}
+
+// sharpsOrder is the order in which sharps are added to key signatures, flats
+// are added in the reverse order.
+const sharpsOrder = "FCGDAEB"
+
+// Pitch is a spelled midi note: the same midi note can be spelled A♯ or B♭
+// depending on the context.
+type Pitch struct {
+	// Letter is the note letter from 'A' to 'G'.
+	Letter byte
+	// Alter is the accidental in semitones: -2 for a double flat, -1 for a
+	// flat, 0 for a natural, 1 for a sharp and 2 for a double sharp.
+	Alter int
+	// Note is the midi note number.
+	Note int
+}
+
+// String returns the name of the pitch using the default notation (B♭3 is
+// written Bb3 and the middle C is C3).
+func (p Pitch) String() string {
+	return DefaultNotation.Format(p)
+}
+
+// PitchNotation is a convention to write pitches in scientific pitch
+// notation.
+type PitchNotation struct {
+	// MiddleC is the octave number of the middle C (midi note 60). Yamaha
+	// uses 3, scientific pitch notation 4 and some manufacturers 5.
+	MiddleC int
+	// Unicode writes the accidentals with the ♯, ♭, 𝄪 and 𝄫 symbols instead
+	// of #, b, x and bb.
+	Unicode bool
+}
+
+// DefaultNotation is the notation used by NoteToName and KeyInt where the
+// middle C is C3 and the lowest midi note is C-2.
+var DefaultNotation = PitchNotation{MiddleC: 3}
+
+// ScientificNotation is the scientific pitch notation where the middle C is
+// C4 and A4 is the 440Hz A.
+var ScientificNotation = PitchNotation{MiddleC: 4}
+
+// ParsePitch parses a pitch using the default notation, see
+// PitchNotation.Parse.
+func ParsePitch(s string) (Pitch, error) {
+	return DefaultNotation.Parse(s)
+}
+
+// Parse parses a pitch written in scientific pitch notation: a letter, any
+// accidentals and an octave number, for instance C4, Bb3, F##2, Ebb-1, Cx5,
+// G♯4 or B♭3. Flats can be written b or ♭, sharps # or ♯ and double sharps
+// x or 𝄪. The octave is interpreted using the notation's middle C octave.
+func (n PitchNotation) Parse(s string) (Pitch, error) {
+	letter, alter, rest, err := parsePitchClass(s)
+	if err != nil {
+		return Pitch{}, err
+	}
+	octave, err := strconv.Atoi(rest)
+	if err != nil {
+		return Pitch{}, fmt.Errorf("invalid octave in pitch %q", s)
+	}
+	note := (octave-n.MiddleC+5)*12 + letterPitchClasses[letter] + alter
+	if note < 0 || note > 127 {
+		return Pitch{}, fmt.Errorf("pitch %q is out of the midi range", s)
+	}
+	return Pitch{Letter: letter, Alter: alter, Note: note}, nil
+}
+
+// parsePitchClass parses the letter and accidentals of a pitch and returns
+// what's left of the string.
+func parsePitchClass(s string) (letter byte, alter int, rest string, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, 0, "", fmt.Errorf("empty pitch")
+	}
+	letter = strings.ToUpper(s[:1])[0]
+	if _, ok := letterPitchClasses[letter]; !ok {
+		return 0, 0, "", fmt.Errorf("invalid note letter in pitch %q", s)
+	}
+	rest = s[1:]
+	for rest != "" {
+		r, size := utf8.DecodeRuneInString(rest)
+		switch r {
+		case '#', '♯':
+			alter++
+		case 'b', 'B', '♭':
+			alter--
+		case 'x', 'X', '𝄪':
+			alter += 2
+		case '𝄫':
+			alter -= 2
+		case '♮':
+		default:
+			if alter < -2 || alter > 2 {
+				return 0, 0, "", fmt.Errorf("too many accidentals in pitch %q", s)
+			}
+			return letter, alter, rest, nil
+		}
+		rest = rest[size:]
+	}
+	if alter < -2 || alter > 2 {
+		return 0, 0, "", fmt.Errorf("too many accidentals in pitch %q", s)
+	}
+	return letter, alter, rest, nil
+}
+
+// Format writes the pitch in scientific pitch notation. The octave is the
+// octave of the letter, B♯3 and C4 are the same midi note in the scientific
+// notation.
+func (n PitchNotation) Format(p Pitch) string {
+	natural := p.Note - p.Alter
+	octave := floorDiv12(natural) - 5 + n.MiddleC
+	return string(p.Letter) + n.accidental(p.Alter) + strconv.Itoa(octave)
+}
+
+func (n PitchNotation) accidental(alter int) string {
+	symbols := map[int]string{-2: "bb", -1: "b", 1: "#", 2: "x"}
+	if n.Unicode {
+		symbols = map[int]string{-2: "𝄫", -1: "♭", 1: "♯", 2: "𝄪"}
+	}
+	return symbols[alter]
+}
+
+// Name spells the midi note in the passed key signature (number of sharps if
+// positive, of flats if negative) and formats it.
+func (n PitchNotation) Name(note, key int) string {
+	return n.Format(SpellNote(note, key))
+}
+
+func floorDiv12(n int) int {
+	if n < 0 {
+		return (n - 11) / 12
+	}
+	return n / 12
+}
+
+// keyAlterations returns the accidental applied to each letter by the key
+// signature (number of sharps if positive, of flats if negative).
+func keyAlterations(key int) map[byte]int {
+	alters := map[byte]int{}
+	if key > 7 {
+		key = 7
+	}
+	if key < -7 {
+		key = -7
+	}
+	for i := 0; i < key; i++ {
+		alters[sharpsOrder[i]] = 1
+	}
+	for i := 0; i < -key; i++ {
+		alters[sharpsOrder[6-i]] = -1
+	}
+	return alters
+}
+
+// SpellNote spells the midi note in the passed key signature (number of sharps
+// if positive, of flats if negative, as stored in key signature events).
+// Notes of the key's scale are spelled as in the key signature (B♭ in F major,
+// E♯ in C♯ major), other notes are spelled with a natural if possible,
+// otherwise with a sharp in sharp keys and C major and with a flat in flat
+// keys.
+func SpellNote(note, key int) Pitch {
+	pc := ((note % 12) + 12) % 12
+	alters := keyAlterations(key)
+	// diatonic note
+	for letter, lpc := range letterPitchClasses {
+		if (lpc+alters[letter]+12)%12 == pc {
+			return Pitch{Letter: letter, Alter: alters[letter], Note: note}
+		}
+	}
+	// chromatic note
+	for letter, lpc := range letterPitchClasses {
+		if lpc == pc {
+			return Pitch{Letter: letter, Note: note}
+		}
+	}
+	alter := 1
+	if key < 0 {
+		alter = -1
+	}
+	for letter, lpc := range letterPitchClasses {
+		if (lpc+alter+12)%12 == pc {
+			return Pitch{Letter: letter, Alter: alter, Note: note}
+		}
+	}
+	return Pitch{}
+}
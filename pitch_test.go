@@ -0,0 +1,109 @@
+package midi
+
+import "testing"
+
+func TestPitchNotation_Parse(t *testing.T) {
+	tests := []struct {
+		notation PitchNotation
+		input    string
+		want     Pitch
+		wantErr  bool
+	}{
+		{DefaultNotation, "C3", Pitch{'C', 0, 60}, false},
+		{ScientificNotation, "C4", Pitch{'C', 0, 60}, false},
+		{PitchNotation{MiddleC: 5}, "C5", Pitch{'C', 0, 60}, false},
+		{ScientificNotation, "A4", Pitch{'A', 0, 69}, false},
+		{ScientificNotation, "Bb3", Pitch{'B', -1, 58}, false},
+		{ScientificNotation, "B♭3", Pitch{'B', -1, 58}, false},
+		{ScientificNotation, "a#3", Pitch{'A', 1, 58}, false},
+		{ScientificNotation, "G♯4", Pitch{'G', 1, 68}, false},
+		{ScientificNotation, "F##2", Pitch{'F', 2, 43}, false},
+		{ScientificNotation, "Fx2", Pitch{'F', 2, 43}, false},
+		{ScientificNotation, "F𝄪2", Pitch{'F', 2, 43}, false},
+		{ScientificNotation, "Ebb4", Pitch{'E', -2, 62}, false},
+		{ScientificNotation, "E𝄫4", Pitch{'E', -2, 62}, false},
+		{ScientificNotation, "B#3", Pitch{'B', 1, 60}, false},
+		{ScientificNotation, "Cb4", Pitch{'C', -1, 59}, false},
+		{ScientificNotation, "C-1", Pitch{'C', 0, 0}, false},
+		{DefaultNotation, "C-2", Pitch{'C', 0, 0}, false},
+		{ScientificNotation, "E♮4", Pitch{'E', 0, 64}, false},
+		{ScientificNotation, "H4", Pitch{}, true},
+		{ScientificNotation, "C", Pitch{}, true},
+		{ScientificNotation, "C###4", Pitch{}, true},
+		{ScientificNotation, "Cb-1", Pitch{}, true},
+		{ScientificNotation, "G10", Pitch{}, true},
+		{ScientificNotation, "", Pitch{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := tt.notation.Parse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPitchNotation_Format(t *testing.T) {
+	tests := []struct {
+		notation PitchNotation
+		pitch    Pitch
+		want     string
+	}{
+		{DefaultNotation, Pitch{'C', 0, 60}, "C3"},
+		{ScientificNotation, Pitch{'C', 0, 60}, "C4"},
+		{ScientificNotation, Pitch{'B', 1, 60}, "B#3"},
+		{ScientificNotation, Pitch{'C', -1, 59}, "Cb4"},
+		{PitchNotation{MiddleC: 4, Unicode: true}, Pitch{'B', -1, 58}, "B♭3"},
+		{PitchNotation{MiddleC: 4, Unicode: true}, Pitch{'F', 2, 43}, "F𝄪2"},
+		{PitchNotation{MiddleC: 5}, Pitch{'E', -2, 62}, "Ebb5"},
+		{DefaultNotation, Pitch{'C', 0, 0}, "C-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.notation.Format(tt.pitch); got != tt.want {
+				t.Errorf("Format(%+v) = %q, want %q", tt.pitch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpellNote(t *testing.T) {
+	tests := []struct {
+		note int
+		key  int
+		want string
+	}{
+		{70, 0, "A#4"},
+		{70, -1, "Bb4"},
+		{70, 2, "A#4"},
+		{66, -2, "Gb4"},
+		{66, 1, "F#4"},
+		// diatonic notes of extreme keys
+		{72, 7, "B#4"},
+		{65, 7, "E#4"},
+		{71, -7, "Cb5"},
+		{64, -7, "Fb4"},
+		// chromatic notes prefer naturals
+		{65, 1, "F4"},
+		{71, -1, "B4"},
+		{61, -3, "Db4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got := SpellNote(tt.note, tt.key)
+			if s := ScientificNotation.Format(got); s != tt.want {
+				t.Errorf("SpellNote(%d, %d) = %s, want %s", tt.note, tt.key, s, tt.want)
+			}
+			if got.Note != tt.note {
+				t.Errorf("expected the note to be kept, got %d", got.Note)
+			}
+		})
+	}
+	if got := DefaultNotation.Name(58, -2); got != "Bb2" {
+		t.Errorf("Name(58, -2) = %s", got)
+	}
+}
@@ -0,0 +1,183 @@
+package midi
+
+import "math"
+
+const (
+	// PitchBendCenter is the pitch wheel value of a centered wheel (no bend).
+	PitchBendCenter = 0x2000
+	// PitchBendMax is the highest pitch wheel value.
+	PitchBendMax = 0x3FFF
+	// DefaultPitchBendRange is the bend range in semitones used by the
+	// General MIDI synths until RPN 0 is received.
+	DefaultPitchBendRange = 2.0
+)
+
+// PitchBendRange converts a pitch bend sensitivity (RPN 0) value into a bend
+// range in semitones. The MSB holds the semitones and the LSB the cents.
+func PitchBendRange(value uint16) float64 {
+	return float64((value>>7)&0x7F) + float64(value&0x7F)/100
+}
+
+// PitchBendSemitones returns a pitch wheel change bending the channel by the
+// passed number of semitones given the channel's bend range in semitones.
+// Bends beyond the range are clamped.
+func PitchBendSemitones(channel int, semitones, bendRange float64) *Event {
+	return PitchWheel(channel, bendValue(semitones, bendRange))
+}
+
+// PitchBendCents returns a pitch wheel change bending the channel by the
+// passed number of cents given the channel's bend range in semitones.
+// Bends beyond the range are clamped.
+func PitchBendCents(channel int, cents, bendRange float64) *Event {
+	return PitchBendSemitones(channel, cents/100, bendRange)
+}
+
+// bendValue converts a bend in semitones into a pitch wheel value. The wheel
+// isn't symmetric: the center is 8192, the lowest value bends down by the
+// full range and the highest value (8191 steps up) bends up by the full range.
+func bendValue(semitones, bendRange float64) int {
+	if bendRange <= 0 {
+		return PitchBendCenter
+	}
+	ratio := semitones / bendRange
+	if ratio >= 0 {
+		return PitchBendCenter + int(math.Round(math.Min(ratio, 1)*(PitchBendMax-PitchBendCenter)))
+	}
+	return PitchBendCenter + int(math.Round(math.Max(ratio, -1)*PitchBendCenter))
+}
+
+// bendSemitones converts a signed pitch wheel value (relative to the center)
+// into a bend in semitones, the reverse of bendValue.
+func bendSemitones(rel int, bendRange float64) float64 {
+	if rel >= 0 {
+		return float64(rel) / (PitchBendMax - PitchBendCenter) * bendRange
+	}
+	return float64(rel) / PitchBendCenter * bendRange
+}
+
+// BendSemitones returns the bend of a pitch wheel change in semitones given
+// the channel's bend range in semitones. Zero is returned for other events.
+func (e *Event) BendSemitones(bendRange float64) float64 {
+	if e == nil || e.MsgType != EventByteMap["PitchWheelChange"] {
+		return 0
+	}
+	return bendSemitones(int(e.AbsPitchBend&PitchBendMax)-PitchBendCenter, bendRange)
+}
+
+// BendCents returns the bend of a pitch wheel change in cents given the
+// channel's bend range in semitones. Zero is returned for other events.
+func (e *Event) BendCents(bendRange float64) float64 {
+	return e.BendSemitones(bendRange) * 100
+}
+
+// BentNoteToFreq returns the frequency of the passed midi note bent by the
+// passed number of semitones.
+func BentNoteToFreq(note int, semitones float64) float64 {
+	return rootA * math.Pow(2, (float64(note)+semitones-69.0)/12.0)
+}
+
+// PitchBend is a pitch wheel change expressed in semitones.
+type PitchBend struct {
+	Tick    uint64
+	Channel uint8
+	// Value is the raw pitch wheel value (0 to 16383, 8192 is the center).
+	Value uint16
+	// Range is the bend range of the channel in semitones when the bend was
+	// applied.
+	Range float64
+	// Semitones is the resulting bend in semitones.
+	Semitones float64
+}
+
+// BendTracker keeps track of the pitch bend range and of the current bend of
+// the 16 channels. The range of a channel is the configured default until a
+// pitch bend sensitivity (RPN 0) change is received for it.
+type BendTracker struct {
+	ctrl   *ControllerDecoder
+	ranges [16]float64
+	bends  [16]uint16
+}
+
+// NewBendTracker returns a tracker with all the channels centered and using
+// the passed bend range in semitones, DefaultPitchBendRange is used when the
+// passed range is 0 or less.
+func NewBendTracker(defaultRange float64) *BendTracker {
+	if defaultRange <= 0 {
+		defaultRange = DefaultPitchBendRange
+	}
+	bt := &BendTracker{ctrl: NewControllerDecoder()}
+	for i := range bt.ranges {
+		bt.ranges[i] = defaultRange
+		bt.bends[i] = PitchBendCenter
+	}
+	return bt
+}
+
+// SetRange sets the bend range of the channel in semitones.
+func (bt *BendTracker) SetRange(channel uint8, semitones float64) {
+	bt.ranges[channel&0x0F] = semitones
+}
+
+// Range returns the current bend range of the channel in semitones.
+func (bt *BendTracker) Range(channel uint8) float64 {
+	return bt.ranges[channel&0x0F]
+}
+
+// Semitones returns the current bend of the channel in semitones.
+func (bt *BendTracker) Semitones(channel uint8) float64 {
+	ch := channel & 0x0F
+	return bendSemitones(int(bt.bends[ch])-PitchBendCenter, bt.ranges[ch])
+}
+
+// Frequency returns the sounding frequency of the note played on the channel
+// under the channel's current bend.
+func (bt *BendTracker) Frequency(channel uint8, note int) float64 {
+	return BentNoteToFreq(note, bt.Semitones(channel))
+}
+
+// Feed updates the state of the tracker with the passed event. Pitch bend
+// sensitivity changes update the channel's range and pitch wheel changes its
+// bend, the pitch bend is returned with true for the latter.
+func (bt *BendTracker) Feed(tick uint64, ev *Event) (PitchBend, bool) {
+	if ev == nil {
+		return PitchBend{}, false
+	}
+	ch := ev.MsgChan & 0x0F
+	switch ev.MsgType {
+	case EventByteMap["ControlChange"]:
+		if change, ok := bt.ctrl.Feed(tick, ev); ok &&
+			change.Kind == RPNParam && change.Number == RPNPitchBendSensitivity {
+			bt.ranges[ch] = PitchBendRange(change.Value)
+		}
+	case EventByteMap["PitchWheelChange"]:
+		bt.bends[ch] = ev.AbsPitchBend & PitchBendMax
+		return PitchBend{
+			Tick:      tick,
+			Channel:   ch,
+			Value:     bt.bends[ch],
+			Range:     bt.ranges[ch],
+			Semitones: bt.Semitones(ch),
+		}, true
+	}
+	return PitchBend{}, false
+}
+
+// PitchBends returns the pitch wheel changes of the track expressed in
+// semitones. The bend range of each channel is picked up from the pitch bend
+// sensitivity (RPN 0) changes of the track and defaults to the passed range
+// (DefaultPitchBendRange if 0 or less).
+func (t *Track) PitchBends(defaultRange float64) []PitchBend {
+	bends := []PitchBend{}
+	if t == nil {
+		return bends
+	}
+	bt := NewBendTracker(defaultRange)
+	var tick uint64
+	for _, ev := range t.Events {
+		tick += uint64(ev.TimeDelta)
+		if bend, ok := bt.Feed(tick, ev); ok {
+			bends = append(bends, bend)
+		}
+	}
+	return bends
+}
@@ -0,0 +1,114 @@
+package midi
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestPitchBendSemitones(t *testing.T) {
+	tests := []struct {
+		name      string
+		semitones float64
+		bendRange float64
+		want      uint16
+	}{
+		{"center", 0, 2, 8192},
+		{"full up", 2, 2, 16383},
+		{"full down", -2, 2, 0},
+		{"half up", 1, 2, 12288},
+		{"half down", -6, 12, 4096},
+		{"clamped up", 5, 2, 16383},
+		{"clamped down", -48, 24, 0},
+		{"no range", 1, 0, 8192},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := PitchBendSemitones(3, tt.semitones, tt.bendRange)
+			if ev.AbsPitchBend != tt.want {
+				t.Fatalf("expected wheel value %d, got %d", tt.want, ev.AbsPitchBend)
+			}
+			if ev.MsgChan != 3 || int(ev.RelPitchBend) != int(tt.want)-8192 {
+				t.Errorf("unexpected channel %d or relative bend %d", ev.MsgChan, ev.RelPitchBend)
+			}
+			if tt.bendRange <= 0 || math.Abs(tt.semitones) > tt.bendRange {
+				return
+			}
+			if got := ev.BendSemitones(tt.bendRange); math.Abs(got-tt.semitones) > 0.001 {
+				t.Errorf("BendSemitones() = %f, want %f", got, tt.semitones)
+			}
+		})
+	}
+}
+
+func TestPitchBendCents(t *testing.T) {
+	ev := PitchBendCents(0, -50, 2)
+	if ev.AbsPitchBend != 6144 {
+		t.Fatalf("expected wheel value 6144, got %d", ev.AbsPitchBend)
+	}
+	if got := ev.BendCents(2); got != -50 {
+		t.Errorf("BendCents() = %f, want -50", got)
+	}
+	if got := NoteOn(0, 60, 100).BendCents(2); got != 0 {
+		t.Errorf("expected no bend for a note on, got %f", got)
+	}
+}
+
+func TestPitchWheelChange_Encode(t *testing.T) {
+	for name, ev := range map[string]*Event{
+		"PitchWheel":       PitchWheel(1, 0x2001),
+		"PitchWheelChange": PitchWheelChange(1, 0, 0x2001),
+	} {
+		got, err := ev.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []byte{0x00, 0xE1, 0x01, 0x40}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Encode() = %#v, want %#v", name, got, want)
+		}
+		if ev.RelPitchBend != 1 {
+			t.Errorf("%s: expected a relative bend of 1, got %d", name, ev.RelPitchBend)
+		}
+	}
+}
+
+func TestTrack_PitchBends(t *testing.T) {
+	tr := &Track{}
+	tr.AddAfterDelta(0, PitchWheel(0, 16383))
+	for _, ev := range PitchBendSensitivity(0, 12, 50) {
+		tr.AddAfterDelta(0, ev)
+	}
+	tr.AddAfterDelta(10, PitchWheel(0, 16383))
+	tr.AddAfterDelta(10, PitchWheel(1, 0))
+
+	want := []PitchBend{
+		{Tick: 0, Channel: 0, Value: 16383, Range: 1, Semitones: 1},
+		{Tick: 10, Channel: 0, Value: 16383, Range: 12.5, Semitones: 12.5},
+		{Tick: 20, Channel: 1, Value: 0, Range: 1, Semitones: -1},
+	}
+	if got := tr.PitchBends(1); !reflect.DeepEqual(got, want) {
+		t.Errorf("PitchBends() = %+v, want %+v", got, want)
+	}
+}
+
+func TestBendTracker_Frequency(t *testing.T) {
+	bt := NewBendTracker(0)
+	if got := bt.Range(5); got != DefaultPitchBendRange {
+		t.Fatalf("expected the default range, got %f", got)
+	}
+	if got := bt.Frequency(5, 69); got != 440 {
+		t.Errorf("expected an unbent A4 at 440Hz, got %f", got)
+	}
+	bt.Feed(0, PitchBendSemitones(5, 2, DefaultPitchBendRange))
+	if got, want := bt.Frequency(5, 69), NoteToFreq(71); math.Abs(got-want) > 0.001 {
+		t.Errorf("expected A4 bent by 2 semitones to sound at %f, got %f", want, got)
+	}
+	bt.SetRange(5, 12)
+	if got, want := bt.Frequency(5, 57), 440.0; math.Abs(got-want) > 0.001 {
+		t.Errorf("expected A3 bent by an octave to sound at %f, got %f", want, got)
+	}
+	if got, want := BentNoteToFreq(69, -0.5), 440*math.Pow(2, -0.5/12); got != want {
+		t.Errorf("BentNoteToFreq() = %f, want %f", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+package player
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-audio/midi"
+)
+
+// Output receives the events played. Send is called in the order of the
+// events, from the playback goroutine and from the methods of the player
+// (the note offs sent by Pause for instance), while the player is locked: it
+// mustn't call the player back and mustn't block, a slow Send delays the
+// following events and blocks the other methods of the player (State, Pause,
+// Stop...) until it returns. Outputs writing to a slow device should queue
+// the events and write them from their own goroutine.
+type Output interface {
+	Send(ev *midi.Event) error
+}
+
+// Recorded is an event received by a Recorder.
+type Recorded struct {
+	Time  time.Time
+	Event *midi.Event
+}
+
+// Recorder is an output keeping the events it receives with the time of
+// their reception.
+type Recorder struct {
+	Clock Clock
+
+	mu     sync.Mutex
+	events []Recorded
+}
+
+// NewRecorder returns a recorder timing the events with the passed clock.
+func NewRecorder(clock Clock) *Recorder {
+	return &Recorder{Clock: clock}
+}
+
+// Send records the event.
+func (r *Recorder) Send(ev *midi.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, Recorded{Time: r.Clock.Now(), Event: ev})
+	return nil
+}
+
+// Events returns the events recorded so far.
+func (r *Recorder) Events() []Recorded {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Recorded{}, r.events...)
+}
+
+// Reset forgets the events recorded.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
@@ -0,0 +1,454 @@
+// Package player plays decoded midi files in real time: it walks the events
+// of all the tracks in time order and sends them to an Output when they are
+// due, following the tempo map. Playback can be paused, stopped, moved to
+// another tick, looped over a region and played faster or slower.
+//
+// The events are scheduled on absolute times computed from the point where
+// playback started (or was last moved), so the delays of the outputs and of
+// the clock don't add up over time. The Clock and Output interfaces make it
+// possible to test playback without hardware or waiting, see FakeClock and
+// Recorder.
+package player
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-audio/midi"
+)
+
+// State is the playback state of a player.
+type State int
+
+// The playback states.
+const (
+	Stopped State = iota
+	Playing
+	Paused
+)
+
+func (s State) String() string {
+	switch s {
+	case Stopped:
+		return "stopped"
+	case Playing:
+		return "playing"
+	case Paused:
+		return "paused"
+	}
+	return "unknown"
+}
+
+// timedEvent is an event and its absolute tick.
+type timedEvent struct {
+	tick uint64
+	ev   *midi.Event
+}
+
+// Player plays the events of the tracks of a decoder. All the events are
+// sent, meta events included, outputs ignore the ones they can't handle.
+// When playback is paused, stopped or moved, note offs are sent for the
+// notes still sounding. When it resumes from another point than the start,
+// the last program changes, controller values and pitch bends preceding that
+// point are sent first so the channels sound as they would have.
+type Player struct {
+	// Output receives the events.
+	Output Output
+	// Clock times the playback, RealClock by default. It must be set before
+	// playback starts.
+	Clock Clock
+
+	mu    sync.Mutex
+	ppq   uint16
+	tempo midi.TempoMap
+	evs   []timedEvent
+	state State
+	err   error
+	done  chan struct{}
+	// wake is closed to wake up the playback goroutine after a change, timer
+	// is the timer it is waiting for.
+	wake  chan struct{}
+	timer Timer
+	// gen identifies the current playback goroutine.
+	gen int
+	// next is the index of the next event to send.
+	next int
+	// pos is the position in seconds of the sequence (at the normal tempo)
+	// when playback started or moved, at the time anchor. It is the current
+	// position when playback isn't running.
+	pos    float64
+	anchor time.Time
+	scale  float64
+	// loop is the region played in a loop, active while the position is
+	// before its end.
+	loop               bool
+	loopStart, loopEnd uint64
+	// chase tells that the channel state must be sent when playback starts.
+	chase    bool
+	sounding [16][128]bool
+}
+
+// New returns a player sending the events of the decoded tracks to the
+// output.
+func New(d *midi.Decoder, out Output) *Player {
+	p := &Player{
+		Output: out,
+		Clock:  RealClock{},
+		ppq:    d.TicksPerQuarterNote,
+		tempo:  midi.TempoMapOf(d.Tracks...),
+		done:   make(chan struct{}),
+		wake:   make(chan struct{}),
+		scale:  1,
+	}
+	if p.ppq == 0 {
+		p.ppq = 96
+	}
+	for _, t := range d.Tracks {
+		if t == nil {
+			continue
+		}
+		var tick uint64
+		for _, ev := range t.Events {
+			tick += uint64(ev.TimeDelta)
+			p.evs = append(p.evs, timedEvent{tick: tick, ev: ev})
+		}
+	}
+	// the events at the same tick are kept in the order of the tracks
+	sort.SliceStable(p.evs, func(i, j int) bool { return p.evs[i].tick < p.evs[j].tick })
+	return p
+}
+
+// State returns the playback state.
+func (p *Player) State() State {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// Err returns the error returned by the output which stopped playback, nil if
+// there wasn't any.
+func (p *Player) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// Done returns a channel closed when playback stops: at the end of the
+// tracks, when Stop is called or when the output fails.
+func (p *Player) Done() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.done
+}
+
+// Position returns the current tick.
+func (p *Player) Position() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tempo.Tick(p.seconds(p.Clock.Now()), p.ppq)
+}
+
+// Play starts playback from the current position, in the background.
+func (p *Player) Play() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state == Playing {
+		return
+	}
+	if p.state == Stopped {
+		p.err = nil
+		select {
+		case <-p.done:
+			p.done = make(chan struct{})
+		default:
+		}
+	}
+	p.state = Playing
+	p.anchor = p.Clock.Now()
+	p.gen++
+	if p.chase {
+		p.chase = false
+		if !p.chaseState() {
+			return
+		}
+	}
+	go p.run(p.gen)
+}
+
+// Pause suspends playback, Play resumes it.
+func (p *Player) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state != Playing {
+		return
+	}
+	p.pos = p.seconds(p.Clock.Now())
+	p.state = Paused
+	if !p.notesOff() {
+		return
+	}
+	p.signal()
+}
+
+// Stop stops playback and goes back to the start of the tracks.
+func (p *Player) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state == Stopped {
+		return
+	}
+	p.finish()
+}
+
+// Seek moves playback to the passed tick.
+func (p *Player) Seek(tick uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.jump(tick)
+	if p.state != Playing {
+		p.chase = tick > 0
+		return
+	}
+	if !p.notesOff() {
+		return
+	}
+	p.anchor = p.Clock.Now()
+	if !p.chaseState() {
+		return
+	}
+	p.signal()
+}
+
+// SetLoop loops playback over the ticks from start to end (excluded) once
+// the position is in the region. Playback continues past the end when it is
+// moved after it.
+func (p *Player) SetLoop(start, end uint64) error {
+	if end <= start {
+		return fmt.Errorf("player: invalid loop region %d-%d", start, end)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loop, p.loopStart, p.loopEnd = true, start, end
+	p.signal()
+	return nil
+}
+
+// ClearLoop stops looping, playback continues to the end of the tracks.
+func (p *Player) ClearLoop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loop = false
+	p.signal()
+}
+
+// SetTempoScale sets the speed of playback relative to the tempo map: 2
+// plays twice as fast, 0.5 twice as slow.
+func (p *Player) SetTempoScale(scale float64) error {
+	if scale <= 0 {
+		return fmt.Errorf("player: invalid tempo scale %v", scale)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state == Playing {
+		now := p.Clock.Now()
+		p.pos = p.seconds(now)
+		p.anchor = now
+	}
+	p.scale = scale
+	p.signal()
+	return nil
+}
+
+// seconds returns the position in the sequence in seconds at the passed
+// time.
+func (p *Player) seconds(now time.Time) float64 {
+	if p.state != Playing {
+		return p.pos
+	}
+	return p.pos + now.Sub(p.anchor).Seconds()*p.scale
+}
+
+// timeOf returns the time at which the tick is played.
+func (p *Player) timeOf(tick uint64) time.Time {
+	offset := (p.tempo.Seconds(tick, p.ppq) - p.pos) / p.scale
+	return p.anchor.Add(time.Duration(math.Round(offset * float64(time.Second))))
+}
+
+// signal wakes up the playback goroutine.
+func (p *Player) signal() {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+// jump moves the position to the tick, the next event is the first one at
+// or after it.
+func (p *Player) jump(tick uint64) {
+	p.pos = p.tempo.Seconds(tick, p.ppq)
+	p.next = sort.Search(len(p.evs), func(i int) bool { return p.evs[i].tick >= tick })
+}
+
+// looping reports whether the loop region applies to the current position.
+func (p *Player) looping() bool {
+	return p.loop && p.pos < p.tempo.Seconds(p.loopEnd, p.ppq)
+}
+
+// run is the playback goroutine.
+func (p *Player) run(gen int) {
+	for {
+		p.mu.Lock()
+		if p.gen != gen || p.state != Playing {
+			p.mu.Unlock()
+			return
+		}
+		wait, ok := p.step(p.Clock.Now())
+		if !ok {
+			p.mu.Unlock()
+			return
+		}
+		wake := p.wake
+		timer := p.Clock.NewTimer(wait)
+		p.timer = timer
+		p.mu.Unlock()
+		select {
+		case <-timer.C():
+		case <-wake:
+		}
+	}
+}
+
+// step sends the events due at the passed time. It returns the time until the
+// next event, false when playback stopped.
+func (p *Player) step(now time.Time) (time.Duration, bool) {
+	for {
+		if p.looping() && (p.next >= len(p.evs) || p.evs[p.next].tick >= p.loopEnd) {
+			at := p.timeOf(p.loopEnd)
+			if now.Before(at) {
+				return at.Sub(now), true
+			}
+			if !p.notesOff() {
+				return 0, false
+			}
+			p.jump(p.loopStart)
+			p.anchor = at
+			if !p.chaseState() {
+				return 0, false
+			}
+			continue
+		}
+		if p.next >= len(p.evs) {
+			p.finish()
+			return 0, false
+		}
+		te := p.evs[p.next]
+		at := p.timeOf(te.tick)
+		if now.Before(at) {
+			return at.Sub(now), true
+		}
+		p.next++
+		if !p.send(te.ev) {
+			return 0, false
+		}
+	}
+}
+
+// send sends an event to the output and keeps track of the sounding notes.
+// Playback stops if the output fails and false is returned.
+func (p *Player) send(ev *midi.Event) bool {
+	if err := p.Output.Send(ev); err != nil {
+		p.err = err
+		p.finish()
+		return false
+	}
+	ch, note := ev.MsgChan&0x0F, ev.Note&0x7F
+	switch ev.MsgType {
+	case midi.EventByteMap["NoteOn"]:
+		p.sounding[ch][note] = ev.Velocity > 0
+	case midi.EventByteMap["NoteOff"]:
+		p.sounding[ch][note] = false
+	}
+	return true
+}
+
+// notesOff sends note offs for the sounding notes.
+func (p *Player) notesOff() bool {
+	for ch := range p.sounding {
+		for note, on := range p.sounding[ch] {
+			if on && !p.send(midi.NoteOff(ch, note)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// chaseState sends the last program change, controller values and pitch
+// bend of each channel preceding the next event, in their order.
+func (p *Player) chaseState() bool {
+	type key struct {
+		msgType, channel, controller uint8
+	}
+	last := map[key]int{}
+	for i, te := range p.evs[:p.next] {
+		ev := te.ev
+		k := key{msgType: ev.MsgType, channel: ev.MsgChan & 0x0F}
+		switch ev.MsgType {
+		case midi.EventByteMap["ControlChange"]:
+			// the channel mode messages aren't state
+			if ev.Controller >= 120 {
+				continue
+			}
+			k.controller = ev.Controller
+		case midi.EventByteMap["ProgramChange"], midi.EventByteMap["PitchWheelChange"]:
+		default:
+			continue
+		}
+		last[k] = i
+	}
+	indexes := make([]int, 0, len(last))
+	for _, i := range last {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		if !p.send(p.evs[i].ev) {
+			return false
+		}
+	}
+	return true
+}
+
+// finish stops playback, goes back to the start and wakes up the playback
+// goroutine so it exits.
+func (p *Player) finish() {
+	if p.state == Playing {
+		// the output errors are already reported
+		for ch := range p.sounding {
+			for note, on := range p.sounding[ch] {
+				if on {
+					p.sounding[ch][note] = false
+					if p.err == nil {
+						if err := p.Output.Send(midi.NoteOff(ch, note)); err != nil {
+							p.err = err
+						}
+					}
+				}
+			}
+		}
+	}
+	p.state = Stopped
+	p.chase = false
+	p.jump(0)
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+	p.signal()
+}
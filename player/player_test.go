@@ -0,0 +1,398 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-audio/midi"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestPlayer(tracks ...*midi.Track) (*Player, *FakeClock, *Recorder) {
+	clock := NewFakeClock(epoch)
+	rec := NewRecorder(clock)
+	p := New(&midi.Decoder{TicksPerQuarterNote: 96, Tracks: tracks}, rec)
+	p.Clock = clock
+	return p, clock, rec
+}
+
+// idle waits until the player waits for its clock or stopped playing.
+func idle(p *Player, clock *FakeClock) {
+	for p.State() == Playing {
+		if _, ok := clock.Next(); ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// advance moves the clock forward, stopping at every deadline of the player
+// like a real clock would.
+func advance(p *Player, clock *FakeClock, d time.Duration) {
+	end := clock.Now().Add(d)
+	for {
+		idle(p, clock)
+		next, ok := clock.Next()
+		if !ok || next.After(end) {
+			clock.Advance(end.Sub(clock.Now()))
+			idle(p, clock)
+			return
+		}
+		clock.Advance(next.Sub(clock.Now()))
+	}
+}
+
+// describe returns the time and a short description of the recorded events.
+func describe(recs []Recorded) []string {
+	out := []string{}
+	for _, r := range recs {
+		ev := r.Event
+		ch := ev.MsgChan
+		var s string
+		switch {
+		case ev.MsgType == midi.EventByteMap["NoteOn"] && ev.Velocity > 0:
+			s = fmt.Sprintf("on %d %d", ch, ev.Note)
+		case ev.MsgType == midi.EventByteMap["NoteOn"], ev.MsgType == midi.EventByteMap["NoteOff"]:
+			s = fmt.Sprintf("off %d %d", ch, ev.Note)
+		case ev.MsgType == midi.EventByteMap["ControlChange"]:
+			s = fmt.Sprintf("cc %d %d %d", ch, ev.Controller, ev.NewValue)
+		case ev.MsgType == midi.EventByteMap["ProgramChange"]:
+			s = fmt.Sprintf("program %d %d", ch, ev.NewProgram)
+		case ev.MsgType == midi.EventByteMap["PitchWheelChange"]:
+			s = fmt.Sprintf("bend %d %d", ch, ev.AbsPitchBend)
+		case ev.BPM() > 0:
+			s = fmt.Sprintf("tempo %v", ev.BPM())
+		default:
+			s = "meta"
+		}
+		out = append(out, fmt.Sprintf("%v %s", r.Time.Sub(epoch), s))
+	}
+	return out
+}
+
+func checkEvents(t *testing.T, rec *Recorder, want ...string) {
+	t.Helper()
+	got := describe(rec.Events())
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// scale returns a track playing a note on each quarter note, from C.
+func scale(notes int) *midi.Track {
+	tr := &midi.Track{}
+	for i := 0; i < notes; i++ {
+		tr.AddAfterDelta(0, midi.NoteOn(0, 60+i, 100))
+		tr.AddAfterDelta(96, midi.NoteOff(0, 60+i))
+	}
+	return tr
+}
+
+func TestPlayer_Play(t *testing.T) {
+	conductor := &midi.Track{}
+	conductor.AddAfterDelta(0, midi.TempoEvent(120))
+	conductor.AddAfterDelta(192, midi.TempoEvent(60))
+	p, clock, rec := newTestPlayer(conductor, scale(3))
+	p.Play()
+	if s := p.State(); s != Playing {
+		t.Fatalf("expected the player to be playing, got %s", s)
+	}
+	advance(p, clock, 750*time.Millisecond)
+	if pos := p.Position(); pos != 144 {
+		t.Errorf("expected to be at tick 144, got %d", pos)
+	}
+	advance(p, clock, 10*time.Second)
+	checkEvents(t, rec,
+		"0s tempo 120",
+		"0s on 0 60",
+		"500ms off 0 60",
+		"500ms on 0 61",
+		"1s tempo 60",
+		"1s off 0 61",
+		"1s on 0 62",
+		"2s off 0 62",
+	)
+	select {
+	case <-p.Done():
+	default:
+		t.Fatalf("expected playback to be done")
+	}
+	if s, pos := p.State(), p.Position(); s != Stopped || pos != 0 {
+		t.Errorf("expected the player to be stopped at the start, got %s at %d", s, pos)
+	}
+
+	// playing again starts over
+	rec.Reset()
+	p.Play()
+	advance(p, clock, 600*time.Millisecond)
+	checkEvents(t, rec, "10.75s tempo 120", "10.75s on 0 60", "11.25s off 0 60", "11.25s on 0 61")
+}
+
+func TestPlayer_Play_driftFree(t *testing.T) {
+	p, clock, _ := newTestPlayer(scale(8))
+	p.Play()
+	// the clock wakes the player late every time, the events stay on their
+	// half second grid
+	for i := 1; i <= 8; i++ {
+		idle(p, clock)
+		next, ok := clock.Next()
+		if want := epoch.Add(time.Duration(i) * 500 * time.Millisecond); !ok || !next.Equal(want) {
+			t.Fatalf("expected the event %d at %v, got %v", i, want.Sub(epoch), next.Sub(epoch))
+		}
+		clock.Advance(next.Sub(clock.Now()) + 70*time.Millisecond)
+	}
+}
+
+func TestPlayer_Pause(t *testing.T) {
+	p, clock, rec := newTestPlayer(scale(2))
+	p.Play()
+	advance(p, clock, 250*time.Millisecond)
+	p.Pause()
+	if s := p.State(); s != Paused {
+		t.Fatalf("expected the player to be paused, got %s", s)
+	}
+	// nothing is played while paused
+	clock.Advance(time.Minute)
+	if pos := p.Position(); pos != 48 {
+		t.Errorf("expected to be at tick 48, got %d", pos)
+	}
+	p.Play()
+	advance(p, clock, time.Second)
+	checkEvents(t, rec,
+		"0s on 0 60",
+		"250ms off 0 60",
+		"1m0.5s off 0 60",
+		"1m0.5s on 0 61",
+		"1m1s off 0 61",
+	)
+}
+
+func TestPlayer_Stop(t *testing.T) {
+	p, clock, rec := newTestPlayer(scale(2))
+	p.Play()
+	done := p.Done()
+	advance(p, clock, 250*time.Millisecond)
+	p.Stop()
+	select {
+	case <-done:
+	default:
+		t.Fatalf("expected playback to be done")
+	}
+	if s, pos := p.State(), p.Position(); s != Stopped || pos != 0 {
+		t.Errorf("expected the player to be stopped at the start, got %s at %d", s, pos)
+	}
+	checkEvents(t, rec, "0s on 0 60", "250ms off 0 60")
+
+	p.Play()
+	select {
+	case <-p.Done():
+		t.Fatalf("expected a new playback")
+	default:
+	}
+	advance(p, clock, 100*time.Millisecond)
+	p.Stop()
+	checkEvents(t, rec, "0s on 0 60", "250ms off 0 60", "250ms on 0 60", "350ms off 0 60")
+}
+
+func TestPlayer_Seek(t *testing.T) {
+	tr := &midi.Track{}
+	tr.AddAfterDelta(0, midi.ControlChange(1, midi.CCVals["Bank Select"], 1))
+	tr.AddAfterDelta(0, midi.ProgramSelect(1, 5))
+	tr.AddAfterDelta(0, midi.ControlChange(1, midi.CCVals["Channel Volume"], 100))
+	tr.AddAfterDelta(0, midi.NoteOn(1, 48, 100))
+	tr.AddAfterDelta(96, midi.ControlChange(1, midi.CCVals["Channel Volume"], 80))
+	tr.AddAfterDelta(0, midi.PitchWheel(1, 9000))
+	tr.AddAfterDelta(0, midi.ControlChange(1, midi.CCVals["All Notes Off"], 0))
+	tr.AddAfterDelta(96, midi.NoteOff(1, 48))
+	tr.AddAfterDelta(0, midi.NoteOn(1, 50, 100))
+	tr.AddAfterDelta(96, midi.NoteOff(1, 50))
+	p, clock, rec := newTestPlayer(tr)
+
+	// the state of the channel is sent when playback starts
+	p.Seek(192)
+	if pos := p.Position(); pos != 192 {
+		t.Errorf("expected to be at tick 192, got %d", pos)
+	}
+	p.Play()
+	advance(p, clock, 250*time.Millisecond)
+	checkEvents(t, rec,
+		"0s cc 1 0 1",
+		"0s program 1 5",
+		"0s cc 1 7 80",
+		"0s bend 1 9000",
+		"0s off 1 48",
+		"0s on 1 50",
+	)
+
+	// while playing, the sounding notes are released first
+	rec.Reset()
+	p.Seek(96)
+	advance(p, clock, 250*time.Millisecond)
+	checkEvents(t, rec,
+		"250ms off 1 50",
+		"250ms cc 1 0 1",
+		"250ms program 1 5",
+		"250ms cc 1 7 100",
+		"250ms cc 1 7 80",
+		"250ms bend 1 9000",
+		"250ms cc 1 123 0",
+	)
+	if pos := p.Position(); pos != 144 {
+		t.Errorf("expected to be at tick 144, got %d", pos)
+	}
+}
+
+func TestPlayer_SetLoop(t *testing.T) {
+	p, clock, rec := newTestPlayer(scale(3))
+	if err := p.SetLoop(96, 96); err == nil {
+		t.Errorf("expected an error for an empty loop")
+	}
+	if err := p.SetLoop(96, 192); err != nil {
+		t.Fatal(err)
+	}
+	p.Play()
+	advance(p, clock, 1750*time.Millisecond)
+	p.ClearLoop()
+	advance(p, clock, 2*time.Second)
+	checkEvents(t, rec,
+		"0s on 0 60",
+		"500ms off 0 60",
+		"500ms on 0 61",
+		"1s off 0 61",
+		"1s off 0 60",
+		"1s on 0 61",
+		"1.5s off 0 61",
+		"1.5s off 0 60",
+		"1.5s on 0 61",
+		"2s off 0 61",
+		"2s on 0 62",
+		"2.5s off 0 62",
+	)
+}
+
+func TestPlayer_SetTempoScale(t *testing.T) {
+	p, clock, rec := newTestPlayer(scale(3))
+	if err := p.SetTempoScale(0); err == nil {
+		t.Errorf("expected an error for a null scale")
+	}
+	if err := p.SetTempoScale(2); err != nil {
+		t.Fatal(err)
+	}
+	p.Play()
+	advance(p, clock, 375*time.Millisecond)
+	// the rest of the second note is played four times slower than its
+	// start
+	if err := p.SetTempoScale(0.5); err != nil {
+		t.Fatal(err)
+	}
+	advance(p, clock, 3*time.Second)
+	checkEvents(t, rec,
+		"0s on 0 60",
+		"250ms off 0 60",
+		"250ms on 0 61",
+		"875ms off 0 61",
+		"875ms on 0 62",
+		"1.875s off 0 62",
+	)
+}
+
+// failingOutput fails to send its nth event.
+type failingOutput struct {
+	failAt int
+	sent   int
+}
+
+func (o *failingOutput) Send(ev *midi.Event) error {
+	o.sent++
+	if o.sent == o.failAt {
+		return errors.New("unplugged")
+	}
+	return nil
+}
+
+func TestPlayer_outputError(t *testing.T) {
+	p, clock, _ := newTestPlayer(scale(2))
+	out := &failingOutput{failAt: 2}
+	p.Output = out
+	p.Play()
+	advance(p, clock, time.Second)
+	<-p.Done()
+	if err := p.Err(); err == nil || err.Error() != "unplugged" {
+		t.Errorf("expected the output error, got %v", err)
+	}
+	if s := p.State(); s != Stopped {
+		t.Errorf("expected the player to stop, got %s", s)
+	}
+	if out.sent != 2 {
+		t.Errorf("expected playback to stop after the error, %d events were sent", out.sent)
+	}
+}
+
+func TestPlayer_Seek_outputError(t *testing.T) {
+	tr := &midi.Track{}
+	tr.AddAfterDelta(0, midi.ProgramSelect(0, 5))
+	tr.AddAfterDelta(0, midi.ControlChange(0, midi.CCVals["Channel Volume"], 100))
+	tr.AddAfterDelta(96, midi.NoteOn(0, 60, 100))
+	tr.AddAfterDelta(96, midi.NoteOff(0, 60))
+
+	tests := []struct {
+		name   string
+		played time.Duration
+		failAt int
+	}{
+		{name: "chase", played: 250 * time.Millisecond, failAt: 3},
+		{name: "note off", played: 750 * time.Millisecond, failAt: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, clock, _ := newTestPlayer(tr)
+			out := &failingOutput{failAt: tt.failAt}
+			p.Output = out
+			p.Play()
+			advance(p, clock, tt.played)
+			p.Seek(48)
+			<-p.Done()
+			if err := p.Err(); err == nil || err.Error() != "unplugged" {
+				t.Errorf("expected the output error, got %v", err)
+			}
+			if s := p.State(); s != Stopped {
+				t.Errorf("expected the player to stop, got %s", s)
+			}
+			advance(p, clock, time.Second)
+			if out.sent != tt.failAt {
+				t.Errorf("expected playback to stop after the error, %d events were sent", out.sent)
+			}
+			if next, ok := clock.Next(); ok {
+				t.Errorf("expected the playback goroutine to exit, it waits until %v", next)
+			}
+		})
+	}
+}
+
+func TestPlayer_realClock(t *testing.T) {
+	tr := &midi.Track{}
+	tr.AddAfterDelta(0, midi.TempoEvent(600))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 60, 100))
+	tr.AddAfterDelta(48, midi.NoteOff(0, 60))
+	rec := NewRecorder(RealClock{})
+	p := New(&midi.Decoder{TicksPerQuarterNote: 96, Tracks: []*midi.Track{tr}}, rec)
+	start := time.Now()
+	p.Play()
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("playback didn't finish")
+	}
+	evs := rec.Events()
+	if len(evs) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(evs))
+	}
+	if d := evs[2].Time.Sub(start); d < 50*time.Millisecond {
+		t.Errorf("expected the note to last 50ms, got %v", d)
+	}
+}
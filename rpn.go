@@ -0,0 +1,367 @@
+package midi
+
+import "fmt"
+
+// Registered parameter numbers (RPN), the numbers combine the MSB (CC101) and
+// LSB (CC100) of the parameter number: MSB<<7 | LSB.
+const (
+	RPNPitchBendSensitivity uint16 = 0x0000
+	RPNChannelFineTuning    uint16 = 0x0001
+	RPNChannelCoarseTuning  uint16 = 0x0002
+	RPNTuningProgramChange  uint16 = 0x0003
+	RPNTuningBankSelect     uint16 = 0x0004
+	RPNModulationDepthRange uint16 = 0x0005
+	RPNMPEConfiguration     uint16 = 0x0006
+	// RPNNull deselects the current parameter so further data entry
+	// messages are ignored.
+	RPNNull uint16 = 0x3FFF
+)
+
+// RPNNames maps the registered parameter numbers to their names.
+var RPNNames = map[uint16]string{
+	RPNPitchBendSensitivity: "Pitch Bend Sensitivity",
+	RPNChannelFineTuning:    "Channel Fine Tuning",
+	RPNChannelCoarseTuning:  "Channel Coarse Tuning",
+	RPNTuningProgramChange:  "Tuning Program Change",
+	RPNTuningBankSelect:     "Tuning Bank Select",
+	RPNModulationDepthRange: "Modulation Depth Range",
+	RPNMPEConfiguration:     "MPE Configuration Message",
+	RPNNull:                 "RPN Null",
+}
+
+// controllers used by the parameter state machine
+const (
+	ccDataEntryMSB = 6
+	ccDataEntryLSB = 38
+	ccDataInc      = 96
+	ccDataDec      = 97
+	ccNRPNLSB      = 98
+	ccNRPNMSB      = 99
+	ccRPNLSB       = 100
+	ccRPNMSB       = 101
+)
+
+// ParamKind is the kind of parameter changed by a ParamChange.
+type ParamKind int
+
+const (
+	// ControllerParam is a 7 bit controller: 64-127, and the MSB controllers
+	// (0-31) until their LSB is received.
+	ControllerParam ParamKind = iota
+	// Controller14Param is a 14 bit controller made of a MSB (0-31) and a
+	// LSB (32-63) controller, once the LSB was received on the channel.
+	Controller14Param
+	// RPNParam is a registered parameter set via CC101/100 and data entry.
+	RPNParam
+	// NRPNParam is a non registered parameter set via CC99/98 and data entry.
+	NRPNParam
+)
+
+// ParamChange is a high level parameter change decoded from one or more
+// control changes.
+type ParamChange struct {
+	Tick    uint64
+	Channel uint8
+	Kind    ParamKind
+	// Number is the controller number (the MSB controller for 14 bit
+	// controllers) or the 14 bit parameter number for RPN and NRPN changes.
+	Number uint16
+	// Value is the 7 bit value of a controller or the 14 bit value of the
+	// other kinds of parameters.
+	Value uint16
+}
+
+// MSB returns the 7 most significant bits of the 14 bit value.
+func (p ParamChange) MSB() uint8 {
+	return uint8(p.Value>>7) & 0x7F
+}
+
+// LSB returns the 7 least significant bits of the 14 bit value.
+func (p ParamChange) LSB() uint8 {
+	return uint8(p.Value) & 0x7F
+}
+
+func (p ParamChange) String() string {
+	switch p.Kind {
+	case ControllerParam:
+		return fmt.Sprintf("%s = %d", CCNames[uint8(p.Number)], p.Value)
+	case Controller14Param:
+		return fmt.Sprintf("%s = %d", CCNames[uint8(p.Number)], p.Value)
+	case RPNParam:
+		switch p.Number {
+		case RPNPitchBendSensitivity:
+			if p.LSB() != 0 {
+				return fmt.Sprintf("pitch bend range = %d semitones %d cents", p.MSB(), p.LSB())
+			}
+			return fmt.Sprintf("pitch bend range = %d semitones", p.MSB())
+		case RPNChannelFineTuning:
+			return fmt.Sprintf("channel fine tuning = %.2f cents", float64(int(p.Value)-0x2000)*100/0x2000)
+		case RPNChannelCoarseTuning:
+			return fmt.Sprintf("channel coarse tuning = %d semitones", int(p.MSB())-64)
+		case RPNModulationDepthRange:
+			return fmt.Sprintf("modulation depth range = %d semitones %d cents", p.MSB(), p.LSB())
+		case RPNMPEConfiguration:
+			return fmt.Sprintf("MPE configuration = %d member channels", p.MSB())
+		}
+		return fmt.Sprintf("RPN 0x%02X%02X = %d", uint8(p.Number>>7), uint8(p.Number&0x7F), p.Value)
+	case NRPNParam:
+		return fmt.Sprintf("NRPN 0x%02X%02X = %d", uint8(p.Number>>7), uint8(p.Number&0x7F), p.Value)
+	}
+	return fmt.Sprintf("unknown parameter %d = %d", p.Number, p.Value)
+}
+
+// Events expands the parameter change into the control changes setting it.
+// RPN and NRPN changes select the parameter and set both the data entry MSB
+// and LSB, use RPNNullEvents to deselect the parameter afterwards.
+func (p ParamChange) Events() []*Event {
+	ch := int(p.Channel)
+	switch p.Kind {
+	case Controller14Param:
+		return []*Event{
+			ControlChange(ch, int(p.Number), int(p.MSB())),
+			ControlChange(ch, int(p.Number)+32, int(p.LSB())),
+		}
+	case RPNParam:
+		return RPN(ch, p.Number, p.Value)
+	case NRPNParam:
+		return NRPN(ch, p.Number, p.Value)
+	}
+	return []*Event{ControlChange(ch, int(p.Number), int(p.Value&0x7F))}
+}
+
+// RPN returns the control changes setting a registered parameter to a 14 bit
+// value.
+func RPN(channel int, param, value uint16) []*Event {
+	return []*Event{
+		ControlChange(channel, ccRPNMSB, int(param>>7)&0x7F),
+		ControlChange(channel, ccRPNLSB, int(param)&0x7F),
+		ControlChange(channel, ccDataEntryMSB, int(value>>7)&0x7F),
+		ControlChange(channel, ccDataEntryLSB, int(value)&0x7F),
+	}
+}
+
+// NRPN returns the control changes setting a non registered parameter to a 14
+// bit value.
+func NRPN(channel int, param, value uint16) []*Event {
+	return []*Event{
+		ControlChange(channel, ccNRPNMSB, int(param>>7)&0x7F),
+		ControlChange(channel, ccNRPNLSB, int(param)&0x7F),
+		ControlChange(channel, ccDataEntryMSB, int(value>>7)&0x7F),
+		ControlChange(channel, ccDataEntryLSB, int(value)&0x7F),
+	}
+}
+
+// RPNNullEvents returns the control changes deselecting the current parameter
+// so following data entry messages don't modify it by mistake.
+func RPNNullEvents(channel int) []*Event {
+	return []*Event{
+		ControlChange(channel, ccRPNMSB, 0x7F),
+		ControlChange(channel, ccRPNLSB, 0x7F),
+	}
+}
+
+// PitchBendSensitivity returns the control changes setting the pitch bend
+// range (RPN 0) of a channel.
+func PitchBendSensitivity(channel, semitones, cents int) []*Event {
+	return RPN(channel, RPNPitchBendSensitivity, uint16(semitones&0x7F)<<7|uint16(cents&0x7F))
+}
+
+// channelParams is the controller state of a channel.
+type channelParams struct {
+	// controller values (14 bit controllers are stored in the MSB slot)
+	ctrl [128]uint16
+	// paired indicates that the LSB of the 14 bit controller was received
+	paired [32]bool
+	// current parameter selection
+	rpn, nrpn uint16
+	// nrpnMode indicates that the last selected parameter is a NRPN
+	nrpnMode bool
+	rpns     map[uint16]uint16
+	nrpns    map[uint16]uint16
+}
+
+// ControllerDecoder keeps track of the controller state of the 16 channels,
+// pairs the 14 bit controllers and runs the RPN/NRPN state machine to turn
+// control changes into high level parameter changes.
+type ControllerDecoder struct {
+	channels [16]*channelParams
+}
+
+// NewControllerDecoder returns a decoder with all the channels in their reset
+// state (no parameter selected).
+func NewControllerDecoder() *ControllerDecoder {
+	d := &ControllerDecoder{}
+	for i := range d.channels {
+		d.channels[i] = newChannelParams()
+	}
+	return d
+}
+
+func newChannelParams() *channelParams {
+	return &channelParams{
+		rpn:   RPNNull,
+		nrpn:  RPNNull,
+		rpns:  map[uint16]uint16{},
+		nrpns: map[uint16]uint16{},
+	}
+}
+
+// Feed processes an event at the passed tick and returns the parameter change
+// it triggered if any. Events other than control changes are ignored. A LSB
+// (a 14 bit controller's or the data entry LSB) returns the parameter set by
+// the preceding MSB with its updated value.
+func (d *ControllerDecoder) Feed(tick uint64, ev *Event) (ParamChange, bool) {
+	if d == nil || ev == nil || ev.MsgType != EventByteMap["ControlChange"] {
+		return ParamChange{}, false
+	}
+	st := d.channels[ev.MsgChan&0x0F]
+	cc := ev.Controller & 0x7F
+	val := uint16(ev.NewValue & 0x7F)
+	change := ParamChange{Tick: tick, Channel: ev.MsgChan}
+
+	switch {
+	case cc == ccRPNMSB:
+		st.rpn = val<<7 | st.rpn&0x7F
+		st.nrpnMode = false
+		return change, false
+	case cc == ccRPNLSB:
+		st.rpn = st.rpn&(0x7F<<7) | val
+		st.nrpnMode = false
+		return change, false
+	case cc == ccNRPNMSB:
+		st.nrpn = val<<7 | st.nrpn&0x7F
+		st.nrpnMode = true
+		return change, false
+	case cc == ccNRPNLSB:
+		st.nrpn = st.nrpn&(0x7F<<7) | val
+		st.nrpnMode = true
+		return change, false
+	case cc == ccDataEntryMSB, cc == ccDataEntryLSB, cc == ccDataInc, cc == ccDataDec:
+		param, values := st.rpn, st.rpns
+		change.Kind = RPNParam
+		if st.nrpnMode {
+			param, values = st.nrpn, st.nrpns
+			change.Kind = NRPNParam
+		}
+		if param == RPNNull {
+			return change, false
+		}
+		cur := values[param]
+		switch cc {
+		case ccDataEntryMSB:
+			// the LSB is reset when a new MSB is received
+			cur = val << 7
+		case ccDataEntryLSB:
+			cur = cur&(0x7F<<7) | val
+		case ccDataInc:
+			if cur < 0x3FFF {
+				cur++
+			}
+		case ccDataDec:
+			if cur > 0 {
+				cur--
+			}
+		}
+		values[param] = cur
+		change.Number = param
+		change.Value = cur
+		return change, true
+	case cc < 32:
+		// 14 bit controller MSB, the LSB is reset
+		st.ctrl[cc] = val << 7
+		change.Number = uint16(cc)
+		if !st.paired[cc] {
+			// plain 7 bit controller until a LSB is received
+			change.Kind = ControllerParam
+			change.Value = val
+			return change, true
+		}
+		change.Kind = Controller14Param
+		change.Value = st.ctrl[cc]
+		return change, true
+	case cc < 64:
+		msb := cc - 32
+		st.ctrl[msb] = st.ctrl[msb]&(0x7F<<7) | val
+		st.paired[msb] = true
+		change.Kind = Controller14Param
+		change.Number = uint16(msb)
+		change.Value = st.ctrl[msb]
+		return change, true
+	}
+	st.ctrl[cc] = val
+	if int(cc) == CCVals["Reset All Controllers"] {
+		// the parameter selection is reset but not the parameter values
+		st.rpn, st.nrpn, st.nrpnMode = RPNNull, RPNNull, false
+	}
+	change.Kind = ControllerParam
+	change.Number = uint16(cc)
+	change.Value = val
+	return change, true
+}
+
+// RPN returns the last value set for a registered parameter of the channel
+// and false if the parameter was never set.
+func (d *ControllerDecoder) RPN(channel uint8, param uint16) (uint16, bool) {
+	v, ok := d.channels[channel&0x0F].rpns[param]
+	return v, ok
+}
+
+// NRPN returns the last value set for a non registered parameter of the
+// channel and false if the parameter was never set.
+func (d *ControllerDecoder) NRPN(channel uint8, param uint16) (uint16, bool) {
+	v, ok := d.channels[channel&0x0F].nrpns[param]
+	return v, ok
+}
+
+// Controller returns the current value of a controller of the channel. The
+// value of the 14 bit controllers (0-31) is returned on 14 bits once their LSB
+// was received, on 7 bits before.
+func (d *ControllerDecoder) Controller(channel, controller uint8) uint16 {
+	st := d.channels[channel&0x0F]
+	cc := controller & 0x7F
+	if cc < 32 && !st.paired[cc] {
+		return st.ctrl[cc] >> 7
+	}
+	return st.ctrl[cc]
+}
+
+// ParamChanges decodes the control changes of the track into high level
+// parameter changes. A LSB following its MSB at the same tick updates the
+// change of the MSB instead of adding one, so the events of a ParamChange are
+// decoded back to a single change.
+func (t *Track) ParamChanges() []ParamChange {
+	changes := []ParamChange{}
+	if t == nil {
+		return changes
+	}
+	d := NewControllerDecoder()
+	var tick uint64
+	for _, ev := range t.Events {
+		tick += uint64(ev.TimeDelta)
+		change, ok := d.Feed(tick, ev)
+		if !ok {
+			continue
+		}
+		if n := len(changes); n > 0 && isLSB(ev.Controller) && changes[n-1].refinedBy(change) {
+			changes[n-1] = change
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// isLSB reports whether the controller is the LSB of a 14 bit controller or
+// the data entry LSB.
+func isLSB(cc uint8) bool {
+	return cc >= 32 && cc < 64
+}
+
+// refinedBy reports whether the change sets the same parameter at the same
+// tick, the 7 bit MSB of a controller being refined into a 14 bit value.
+func (p ParamChange) refinedBy(change ParamChange) bool {
+	if p.Tick != change.Tick || p.Channel != change.Channel || p.Number != change.Number {
+		return false
+	}
+	return p.Kind == change.Kind || p.Kind == ControllerParam && change.Kind == Controller14Param
+}
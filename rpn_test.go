@@ -0,0 +1,99 @@
+package midi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestControllerDecoder(t *testing.T) {
+	tr := &Track{}
+	add := func(delta uint32, evs ...*Event) {
+		for i, ev := range evs {
+			if i > 0 {
+				delta = 0
+			}
+			tr.AddAfterDelta(delta, ev)
+		}
+	}
+	// pitch bend range of 12 semitones, MSB only
+	add(0, ControlChange(0, 101, 0), ControlChange(0, 100, 0), ControlChange(0, 6, 12))
+	// 7 bit channel volume, MSB only
+	add(0, ControlChange(0, 7, 100))
+	// 14 bit modulation wheel, then its MSB alone which resets the LSB
+	add(10, ControlChange(0, 1, 64), ControlChange(0, 33, 10))
+	add(0, ControlChange(0, 1, 65))
+	// NRPN 0x01 0x20 set to 8192 then incremented
+	add(10, NRPN(1, 0x01<<7|0x20, 8192)...)
+	add(10, ControlChange(1, 96, 0))
+	// null RPN, data entry is ignored
+	add(10, RPNNullEvents(0)...)
+	add(0, ControlChange(0, 6, 2))
+	// 7 bit controller
+	add(10, ControlChange(0, 64, 127))
+
+	want := []string{
+		"pitch bend range = 12 semitones",
+		"Channel Volume (formerly Main Volume) = 100",
+		"Modulation Wheel or Lever = 8202",
+		"Modulation Wheel or Lever = 8320",
+		"NRPN 0x0120 = 8192",
+		"NRPN 0x0120 = 8193",
+		"Damper Pedal on/off (Sustain)   ≤63 off, ≥64 on = 127",
+	}
+	changes := tr.ParamChanges()
+	got := []string{}
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParamChanges() =\n%q\nwant\n%q", got, want)
+	}
+	if changes[0].Tick != 0 || changes[6].Tick != 50 {
+		t.Errorf("unexpected ticks %d and %d", changes[0].Tick, changes[6].Tick)
+	}
+
+	d := NewControllerDecoder()
+	for _, ev := range tr.Events {
+		d.Feed(0, ev)
+	}
+	if v, ok := d.RPN(0, RPNPitchBendSensitivity); !ok || v != 12<<7 {
+		t.Errorf("RPN() = %d, %v", v, ok)
+	}
+	if v, ok := d.NRPN(1, 0x01<<7|0x20); !ok || v != 8193 {
+		t.Errorf("NRPN() = %d, %v", v, ok)
+	}
+	if v := d.Controller(0, 1); v != 8320 {
+		t.Errorf("Controller(0, 1) = %d", v)
+	}
+	if v := d.Controller(0, 7); v != 100 {
+		t.Errorf("Controller(0, 7) = %d", v)
+	}
+}
+
+func TestParamChange_Events(t *testing.T) {
+	tests := []struct {
+		name   string
+		change ParamChange
+	}{
+		{name: "controller", change: ParamChange{Channel: 2, Kind: ControllerParam, Number: 64, Value: 127}},
+		{name: "7 bit MSB controller", change: ParamChange{Channel: 2, Kind: ControllerParam, Number: 7, Value: 100}},
+		{name: "14 bit controller", change: ParamChange{Channel: 2, Kind: Controller14Param, Number: 7, Value: 12345}},
+		{name: "RPN", change: ParamChange{Channel: 3, Kind: RPNParam, Number: RPNPitchBendSensitivity, Value: 24 << 7}},
+		{name: "NRPN", change: ParamChange{Channel: 15, Kind: NRPNParam, Number: 0x1234, Value: 0x3FFF}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &Track{}
+			for _, ev := range tt.change.Events() {
+				tr.AddAfterDelta(0, ev)
+			}
+			changes := tr.ParamChanges()
+			if len(changes) != 1 {
+				t.Fatalf("decoded %d changes, want 1: %+v", len(changes), changes)
+			}
+			if got := changes[0]; !reflect.DeepEqual(got, tt.change) {
+				t.Errorf("round trip = %+v, want %+v", got, tt.change)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package midi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ScalaScale is a scale read from a Scala .scl file.
+// See http://www.huygens-fokker.org/scala/scl_format.html
+type ScalaScale struct {
+	Description string
+	// Cents holds the pitch of each degree of the scale in cents above the
+	// tonic, starting with the second degree (the tonic is always 0 cent and
+	// isn't listed). The last entry is the period of the scale, usually the
+	// octave (1200 cents).
+	Cents []float64
+}
+
+// scalaLines returns the lines of a Scala file without the comments (lines
+// starting with an exclamation mark).
+func scalaLines(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "!") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// ReadScala reads a Scala scale (.scl) file.
+func ReadScala(r io.Reader) (*ScalaScale, error) {
+	lines, err := scalaLines(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("scala file - %s: missing description or note count", ErrUnexpectedData)
+	}
+	scale := &ScalaScale{Description: strings.TrimSpace(lines[0])}
+	count, err := strconv.Atoi(firstField(lines[1]))
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("scala file - invalid note count %q", lines[1])
+	}
+	pitches := []string{}
+	for _, line := range lines[2:] {
+		if f := firstField(line); f != "" {
+			pitches = append(pitches, f)
+		}
+	}
+	if len(pitches) < count {
+		return nil, fmt.Errorf("scala file - expected %d pitches, got %d", count, len(pitches))
+	}
+	for _, p := range pitches[:count] {
+		cents, err := parseScalaPitch(p)
+		if err != nil {
+			return nil, err
+		}
+		scale.Cents = append(scale.Cents, cents)
+	}
+	return scale, nil
+}
+
+// firstField returns the first white space separated field of the line,
+// anything following it is a comment.
+func firstField(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// parseScalaPitch converts a Scala pitch into cents. Pitches containing a
+// period are in cents, the others are ratios (3/2) or integers (2 for 2/1).
+func parseScalaPitch(p string) (float64, error) {
+	if strings.Contains(p, ".") {
+		cents, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return 0, fmt.Errorf("scala file - invalid pitch %q", p)
+		}
+		return cents, nil
+	}
+	num, den := p, "1"
+	if i := strings.Index(p, "/"); i >= 0 {
+		num, den = p[:i], p[i+1:]
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || n <= 0 || d <= 0 {
+		return 0, fmt.Errorf("scala file - invalid pitch %q", p)
+	}
+	return 1200 * math.Log2(n/d), nil
+}
+
+// degreeCents returns the pitch in cents above the tonic of a scale degree,
+// degrees beyond the scale size are in the following periods.
+func (s *ScalaScale) degreeCents(degree int) float64 {
+	size := len(s.Cents)
+	period, deg := floorDivMod(degree, size)
+	cents := float64(period) * s.Cents[size-1]
+	if deg > 0 {
+		cents += s.Cents[deg-1]
+	}
+	return cents
+}
+
+// floorDivMod returns the floored quotient and the positive modulo.
+func floorDivMod(a, b int) (int, int) {
+	q, m := a/b, a%b
+	if m < 0 {
+		q, m = q-1, m+b
+	}
+	return q, m
+}
+
+// KeyboardMapping is a Scala keyboard mapping read from a .kbm file, it maps
+// the midi notes to the degrees of a scale and sets the reference frequency.
+// See http://www.huygens-fokker.org/scala/help.htm#mappings
+type KeyboardMapping struct {
+	// Size is the size of the mapping pattern, 0 for a linear mapping where
+	// each note is the next degree of the scale.
+	Size int
+	// First and Last are the range of midi notes to retune.
+	First, Last int
+	// Middle is the midi note mapped to the first entry of the pattern (the
+	// tonic of the scale for linear mappings).
+	Middle int
+	// Reference is the midi note tuned to the reference frequency.
+	Reference int
+	// Freq is the frequency of the reference note in Hz.
+	Freq float64
+	// Octave is the scale degree of the formal octave, the interval the
+	// pattern repeats at. 0 means the period of the scale.
+	Octave int
+	// Map holds the scale degree of each key of the pattern, -1 for the keys
+	// which aren't mapped.
+	Map []int
+}
+
+// DefaultKeyboardMapping returns the linear mapping used by Scala when no
+// mapping is set: the tonic of the scale is on the middle C (midi note 60)
+// which is tuned at its 12-TET frequency.
+func DefaultKeyboardMapping() *KeyboardMapping {
+	return &KeyboardMapping{
+		First:     0,
+		Last:      127,
+		Middle:    60,
+		Reference: 60,
+		Freq:      NoteToFreq(60),
+	}
+}
+
+// ReadKeyboardMapping reads a Scala keyboard mapping (.kbm) file.
+func ReadKeyboardMapping(r io.Reader) (*KeyboardMapping, error) {
+	lines, err := scalaLines(r)
+	if err != nil {
+		return nil, err
+	}
+	fields := []string{}
+	for _, line := range lines {
+		if f := firstField(line); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) < 7 {
+		return nil, fmt.Errorf("keyboard mapping - %s: expected 7 header values, got %d", ErrUnexpectedData, len(fields))
+	}
+	ints := make([]int, 7)
+	for i, f := range fields[:7] {
+		if i == 5 {
+			continue
+		}
+		if ints[i], err = strconv.Atoi(f); err != nil {
+			return nil, fmt.Errorf("keyboard mapping - invalid value %q on line %d", f, i+1)
+		}
+	}
+	freq, err := strconv.ParseFloat(fields[5], 64)
+	if err != nil || freq <= 0 {
+		return nil, fmt.Errorf("keyboard mapping - invalid reference frequency %q", fields[5])
+	}
+	m := &KeyboardMapping{
+		Size:      ints[0],
+		First:     ints[1],
+		Last:      ints[2],
+		Middle:    ints[3],
+		Reference: ints[4],
+		Freq:      freq,
+		Octave:    ints[6],
+	}
+	if m.Size < 0 || m.First < 0 || m.Last > 127 || m.First > m.Last {
+		return nil, fmt.Errorf("keyboard mapping - invalid size or note range")
+	}
+	// missing entries at the end of the pattern are unmapped
+	for i := 0; i < m.Size; i++ {
+		degree := -1
+		if 7+i < len(fields) && fields[7+i] != "x" && fields[7+i] != "X" {
+			if degree, err = strconv.Atoi(fields[7+i]); err != nil || degree < 0 {
+				return nil, fmt.Errorf("keyboard mapping - invalid degree %q", fields[7+i])
+			}
+		}
+		m.Map = append(m.Map, degree)
+	}
+	return m, nil
+}
+
+// cents returns the pitch in cents of the note relative to the tonic of the
+// scale mapped on the middle note and false if the note isn't mapped.
+func (m *KeyboardMapping) cents(scale *ScalaScale, note int) (float64, bool) {
+	offset := note - m.Middle
+	if m.Size == 0 {
+		return scale.degreeCents(offset), true
+	}
+	period, key := floorDivMod(offset, m.Size)
+	degree := m.Map[key]
+	if degree < 0 {
+		return 0, false
+	}
+	octave := scale.Cents[len(scale.Cents)-1]
+	if m.Octave > 0 {
+		octave = scale.degreeCents(m.Octave)
+	}
+	return float64(period)*octave + scale.degreeCents(degree), true
+}
+
+// NewScalaTuning returns the tuning of a Scala scale mapped on the keyboard.
+// The default keyboard mapping is used if the mapping is nil.
+func NewScalaTuning(scale *ScalaScale, mapping *KeyboardMapping) (*Tuning, error) {
+	if scale == nil || len(scale.Cents) == 0 {
+		return nil, fmt.Errorf("scala tuning - empty scale")
+	}
+	if mapping == nil {
+		mapping = DefaultKeyboardMapping()
+	}
+	ref, ok := mapping.cents(scale, mapping.Reference)
+	if !ok {
+		return nil, fmt.Errorf("scala tuning - reference note %d isn't mapped", mapping.Reference)
+	}
+	t := &Tuning{Name: scale.Description}
+	for n := mapping.First; n <= mapping.Last; n++ {
+		if c, ok := mapping.cents(scale, n); ok {
+			t.Freqs[n] = mapping.Freq * math.Pow(2, (c-ref)/1200)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,135 @@
+package midi
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const justScl = `! just.scl
+!
+Ptolemy's intense diatonic
+ 7
+!
+ 9/8
+ 5/4
+ 4/3
+ 3/2
+ 5/3
+ 15/8
+ 2
+`
+
+func TestReadScala(t *testing.T) {
+	scale, err := ReadScala(strings.NewReader(justScl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scale.Description != "Ptolemy's intense diatonic" {
+		t.Errorf("unexpected description %q", scale.Description)
+	}
+	want := []float64{203.91, 386.31, 498.04, 701.96, 884.36, 1088.27, 1200}
+	if len(scale.Cents) != len(want) {
+		t.Fatalf("expected %d degrees, got %v", len(want), scale.Cents)
+	}
+	for i, c := range want {
+		if math.Abs(scale.Cents[i]-c) > 0.01 {
+			t.Errorf("degree %d: expected %.2f cents, got %.2f", i+1, c, scale.Cents[i])
+		}
+	}
+
+	errors := []string{
+		"only a description",
+		"desc\n3\n100.0\n",
+		"desc\n1\n3/0\n",
+	}
+	for _, src := range errors {
+		if _, err := ReadScala(strings.NewReader(src)); err == nil {
+			t.Errorf("expected an error reading %q", src)
+		}
+	}
+}
+
+func TestNewScalaTuning(t *testing.T) {
+	scale, err := ReadScala(strings.NewReader(justScl))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// default mapping: linear, C4 (60) is the tonic at 261.63Hz
+	tuning, err := NewScalaTuning(scale, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c4 := NoteToFreq(60)
+	tests := []struct {
+		note int
+		want float64
+	}{
+		{60, c4},
+		{61, c4 * 9 / 8},
+		{64, c4 * 3 / 2},
+		{67, c4 * 2},
+		{59, c4 * 15 / 16},
+	}
+	for _, tt := range tests {
+		if got := tuning.Freq(tt.note); math.Abs(got-tt.want) > 0.0001 {
+			t.Errorf("linear mapping, note %d: expected %f, got %f", tt.note, tt.want, got)
+		}
+	}
+
+	// white keys mapping with A4 at 440Hz and C#4 unmapped
+	kbm := `! white keys
+12
+0
+127
+60
+69
+440.0
+7
+! mapping
+0
+x
+1
+x
+2
+3
+x
+4
+x
+5
+x
+6
+`
+	mapping, err := ReadKeyboardMapping(strings.NewReader(kbm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tuning, err = NewScalaTuning(scale, mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tonic := 440 * 3 / 5.0
+	tests = []struct {
+		note int
+		want float64
+	}{
+		{69, 440},
+		{60, tonic},
+		{61, 0},
+		{64, tonic * 5 / 4},
+		{72, tonic * 2},
+		{71, tonic * 15 / 8},
+		{57, 220},
+	}
+	for _, tt := range tests {
+		if got := tuning.Freq(tt.note); math.Abs(got-tt.want) > 0.0001 {
+			t.Errorf("white keys mapping, note %d: expected %f, got %f", tt.note, tt.want, got)
+		}
+	}
+
+	mapping.Reference = 61
+	if _, err := NewScalaTuning(scale, mapping); err == nil {
+		t.Errorf("expected an error with an unmapped reference note")
+	}
+}
@@ -0,0 +1,386 @@
+package sf2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Decoder reads a SoundFont 2 file.
+type Decoder struct {
+	r         io.Reader
+	SoundFont *SoundFont
+}
+
+// NewDecoder returns a decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Open decodes the SoundFont file at the passed path.
+func Open(path string) (*SoundFont, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d := NewDecoder(f)
+	if err := d.Decode(); err != nil {
+		return nil, err
+	}
+	return d.SoundFont, nil
+}
+
+// chunk is a RIFF chunk, the id of LIST chunks is their list type.
+type chunk struct {
+	id   string
+	list bool
+	data []byte
+}
+
+// readChunks splits the content of a RIFF or LIST chunk into its sub chunks.
+func readChunks(data []byte) ([]chunk, error) {
+	chunks := []chunk{}
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("sf2: truncated chunk header")
+		}
+		id := string(data[:4])
+		size := int(binary.LittleEndian.Uint32(data[4:8]))
+		data = data[8:]
+		if size > len(data) {
+			return nil, fmt.Errorf("sf2: truncated %s chunk", id)
+		}
+		c := chunk{id: id, data: data[:size]}
+		if id == "LIST" {
+			if size < 4 {
+				return nil, fmt.Errorf("sf2: truncated LIST chunk")
+			}
+			c.id, c.list, c.data = string(c.data[:4]), true, c.data[4:]
+		}
+		chunks = append(chunks, c)
+		// chunks are padded to an even size
+		if size%2 == 1 && size < len(data) {
+			size++
+		}
+		data = data[size:]
+	}
+	return chunks, nil
+}
+
+// Decode reads the whole file and sets the SoundFont of the decoder.
+func (d *Decoder) Decode() error {
+	data, err := ioutil.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "sfbk" {
+		return fmt.Errorf("sf2: not a SoundFont file")
+	}
+	size := int(binary.LittleEndian.Uint32(data[4:8]))
+	if size < 4 || size+8 > len(data) {
+		return fmt.Errorf("sf2: truncated file")
+	}
+	lists, err := readChunks(data[12 : size+8])
+	if err != nil {
+		return err
+	}
+	sf := &SoundFont{}
+	var pdta []chunk
+	for _, list := range lists {
+		if !list.list {
+			continue
+		}
+		chunks, err := readChunks(list.data)
+		if err != nil {
+			return err
+		}
+		switch list.id {
+		case "INFO":
+			readInfo(&sf.Info, chunks)
+		case "sdta":
+			for _, c := range chunks {
+				switch c.id {
+				case "smpl":
+					sf.SampleData = make([]int16, len(c.data)/2)
+					binary.Read(bytes.NewReader(c.data), binary.LittleEndian, sf.SampleData)
+				case "sm24":
+					sf.SampleData24 = c.data
+				}
+			}
+		case "pdta":
+			pdta = chunks
+		}
+	}
+	if pdta == nil {
+		return fmt.Errorf("sf2: missing pdta chunk")
+	}
+	if err := readPresetData(sf, pdta); err != nil {
+		return err
+	}
+	d.SoundFont = sf
+	return nil
+}
+
+func readInfo(info *Info, chunks []chunk) {
+	version := func(b []byte) Version {
+		if len(b) < 4 {
+			return Version{}
+		}
+		return Version{binary.LittleEndian.Uint16(b), binary.LittleEndian.Uint16(b[2:])}
+	}
+	for _, c := range chunks {
+		s := cString(c.data)
+		switch c.id {
+		case "ifil":
+			info.Version = version(c.data)
+		case "isng":
+			info.Engine = s
+		case "INAM":
+			info.Name = s
+		case "irom":
+			info.ROM = s
+		case "iver":
+			info.ROMVersion = version(c.data)
+		case "ICRD":
+			info.CreationDate = s
+		case "IENG":
+			info.Engineers = s
+		case "IPRD":
+			info.Product = s
+		case "ICOP":
+			info.Copyright = s
+		case "ICMT":
+			info.Comments = s
+		case "ISFT":
+			info.Software = s
+		}
+	}
+}
+
+// cString returns the zero terminated string at the start of b.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// bag is the index of the first generator and modulator of a zone.
+type bag struct {
+	gen, mod int
+}
+
+// records checks the size of a pdta sub chunk and returns its number of
+// records, the terminal record included.
+func records(chunks map[string][]byte, id string, size int) (int, error) {
+	data, ok := chunks[id]
+	if !ok {
+		return 0, fmt.Errorf("sf2: missing %s chunk", id)
+	}
+	if len(data)%size != 0 || len(data) < size {
+		return 0, fmt.Errorf("sf2: invalid %s chunk size %d", id, len(data))
+	}
+	return len(data) / size, nil
+}
+
+func readBags(chunks map[string][]byte, id string, gens, mods int) ([]bag, error) {
+	n, err := records(chunks, id, 4)
+	if err != nil {
+		return nil, err
+	}
+	data := chunks[id]
+	bags := make([]bag, n)
+	for i := range bags {
+		bags[i].gen = int(binary.LittleEndian.Uint16(data[4*i:]))
+		bags[i].mod = int(binary.LittleEndian.Uint16(data[4*i+2:]))
+		if bags[i].gen > gens || bags[i].mod > mods ||
+			(i > 0 && (bags[i].gen < bags[i-1].gen || bags[i].mod < bags[i-1].mod)) {
+			return nil, fmt.Errorf("sf2: invalid %s index %d", id, i)
+		}
+	}
+	return bags, nil
+}
+
+func readModulators(chunks map[string][]byte, id string) ([]Modulator, error) {
+	n, err := records(chunks, id, 10)
+	if err != nil {
+		return nil, err
+	}
+	data := chunks[id]
+	mods := make([]Modulator, n-1)
+	for i := range mods {
+		b := data[10*i:]
+		mods[i] = Modulator{
+			Source:       ModulatorSource(binary.LittleEndian.Uint16(b)),
+			Destination:  GeneratorOperator(binary.LittleEndian.Uint16(b[2:])),
+			Amount:       int16(binary.LittleEndian.Uint16(b[4:])),
+			AmountSource: ModulatorSource(binary.LittleEndian.Uint16(b[6:])),
+			Transform:    binary.LittleEndian.Uint16(b[8:]),
+		}
+	}
+	return mods, nil
+}
+
+func readGenerators(chunks map[string][]byte, id string) ([]Generator, error) {
+	n, err := records(chunks, id, 4)
+	if err != nil {
+		return nil, err
+	}
+	data := chunks[id]
+	gens := make([]Generator, n-1)
+	for i := range gens {
+		gens[i] = Generator{
+			Operator: GeneratorOperator(binary.LittleEndian.Uint16(data[4*i:])),
+			Amount:   int16(binary.LittleEndian.Uint16(data[4*i+2:])),
+		}
+	}
+	return gens, nil
+}
+
+// zones splits the bags from..to into zones. The first zone is global when it
+// doesn't end with the link generator (InstrumentID or SampleID), the other
+// zones without it are ignored. link is called with the index of the linked
+// instrument or sample.
+func zones(bags []bag, from, to int, gens []Generator, mods []Modulator, linkOp GeneratorOperator, link func(*Zone, int) error) (global *Zone, zs []*Zone, err error) {
+	if from > to || to >= len(bags) {
+		return nil, nil, fmt.Errorf("sf2: invalid zone index %d", to)
+	}
+	for i := from; i < to; i++ {
+		z := &Zone{
+			Generators: gens[bags[i].gen:bags[i+1].gen],
+			Modulators: mods[bags[i].mod:bags[i+1].mod],
+		}
+		n := len(z.Generators)
+		if n == 0 || z.Generators[n-1].Operator != linkOp {
+			if i == from {
+				global = z
+			}
+			continue
+		}
+		if err := link(z, int(uint16(z.Generators[n-1].Amount))); err != nil {
+			return nil, nil, err
+		}
+		zs = append(zs, z)
+	}
+	return global, zs, nil
+}
+
+func readPresetData(sf *SoundFont, list []chunk) error {
+	chunks := map[string][]byte{}
+	for _, c := range list {
+		chunks[c.id] = c.data
+	}
+
+	// samples
+	n, err := records(chunks, "shdr", 46)
+	if err != nil {
+		return err
+	}
+	data := chunks["shdr"]
+	sf.Samples = make([]*Sample, n-1)
+	for i := range sf.Samples {
+		b := data[46*i:]
+		s := &Sample{
+			Name:            cString(b[:20]),
+			Start:           binary.LittleEndian.Uint32(b[20:]),
+			End:             binary.LittleEndian.Uint32(b[24:]),
+			LoopStart:       binary.LittleEndian.Uint32(b[28:]),
+			LoopEnd:         binary.LittleEndian.Uint32(b[32:]),
+			SampleRate:      binary.LittleEndian.Uint32(b[36:]),
+			OriginalPitch:   b[40],
+			PitchCorrection: int8(b[41]),
+			Link:            binary.LittleEndian.Uint16(b[42:]),
+			Type:            SampleType(binary.LittleEndian.Uint16(b[44:])),
+		}
+		if !s.Type.IsROM() && (s.Start > s.End || int(s.End) > len(sf.SampleData)) {
+			return fmt.Errorf("sf2: sample %q out of the sample data", s.Name)
+		}
+		sf.Samples[i] = s
+	}
+
+	// instruments
+	igen, err := readGenerators(chunks, "igen")
+	if err != nil {
+		return err
+	}
+	imod, err := readModulators(chunks, "imod")
+	if err != nil {
+		return err
+	}
+	ibag, err := readBags(chunks, "ibag", len(igen), len(imod))
+	if err != nil {
+		return err
+	}
+	n, err = records(chunks, "inst", 22)
+	if err != nil {
+		return err
+	}
+	data = chunks["inst"]
+	sf.Instruments = make([]*Instrument, n-1)
+	linkSample := func(z *Zone, i int) error {
+		if i >= len(sf.Samples) {
+			return fmt.Errorf("sf2: invalid sample index %d", i)
+		}
+		z.Sample = sf.Samples[i]
+		return nil
+	}
+	for i := range sf.Instruments {
+		b := data[22*i:]
+		inst := &Instrument{Name: cString(b[:20])}
+		from := int(binary.LittleEndian.Uint16(b[20:]))
+		to := int(binary.LittleEndian.Uint16(b[42:]))
+		if inst.GlobalZone, inst.Zones, err = zones(ibag, from, to, igen, imod, SampleID, linkSample); err != nil {
+			return fmt.Errorf("%v in instrument %q", err, inst.Name)
+		}
+		sf.Instruments[i] = inst
+	}
+
+	// presets
+	pgen, err := readGenerators(chunks, "pgen")
+	if err != nil {
+		return err
+	}
+	pmod, err := readModulators(chunks, "pmod")
+	if err != nil {
+		return err
+	}
+	pbag, err := readBags(chunks, "pbag", len(pgen), len(pmod))
+	if err != nil {
+		return err
+	}
+	n, err = records(chunks, "phdr", 38)
+	if err != nil {
+		return err
+	}
+	data = chunks["phdr"]
+	sf.Presets = make([]*Preset, n-1)
+	linkInstrument := func(z *Zone, i int) error {
+		if i >= len(sf.Instruments) {
+			return fmt.Errorf("sf2: invalid instrument index %d", i)
+		}
+		z.Instrument = sf.Instruments[i]
+		return nil
+	}
+	for i := range sf.Presets {
+		b := data[38*i:]
+		p := &Preset{
+			Name:       cString(b[:20]),
+			Program:    binary.LittleEndian.Uint16(b[20:]),
+			Bank:       binary.LittleEndian.Uint16(b[22:]),
+			Library:    binary.LittleEndian.Uint32(b[26:]),
+			Genre:      binary.LittleEndian.Uint32(b[30:]),
+			Morphology: binary.LittleEndian.Uint32(b[34:]),
+		}
+		from := int(binary.LittleEndian.Uint16(b[24:]))
+		to := int(binary.LittleEndian.Uint16(b[38+24:]))
+		if p.GlobalZone, p.Zones, err = zones(pbag, from, to, pgen, pmod, InstrumentID, linkInstrument); err != nil {
+			return fmt.Errorf("%v in preset %q", err, p.Name)
+		}
+		sf.Presets[i] = p
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package sf2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// The test bank has 2 samples: a looped 440Hz sine (20 frames per period at
+// 8800Hz) and a decaying square wave. Its presets are:
+//
+//	bank 0 program 0 "Split": the sine below C3, split by velocity above it
+//	(an octave higher for velocities from 64)
+//	bank 0 program 5 "Fifth Up": the sine a fifth higher, with a decay to
+//	-6dB
+//	bank 1 program 0 "Low Sine": the same an octave lower
+//	bank 128 program 0 "Kit": a kick and two hi-hats of the same exclusive
+//	class, the open one looping
+const testBank = "../fixtures/test.sf2"
+
+func TestDecoder_Decode(t *testing.T) {
+	sf, err := Open(testBank)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sf.Info.Version != (Version{2, 1}) || sf.Info.Engine != "EMU8000" || sf.Info.Name != "go-audio test bank" || sf.Info.Software != "hand made" {
+		t.Errorf("unexpected info %+v", sf.Info)
+	}
+	if len(sf.SampleData) != 1292 {
+		t.Errorf("expected 1292 samples, got %d", len(sf.SampleData))
+	}
+
+	if len(sf.Presets) != 4 {
+		t.Fatalf("expected 4 presets, got %d", len(sf.Presets))
+	}
+	for i, want := range []struct {
+		name          string
+		bank, program uint16
+		global        bool
+		zones         int
+	}{
+		{"Split", 0, 0, false, 1},
+		{"Fifth Up", 0, 5, true, 1},
+		{"Low Sine", 1, 0, false, 1},
+		{"Kit", 128, 0, false, 1},
+	} {
+		p := sf.Presets[i]
+		if p.Name != want.name || p.Bank != want.bank || p.Program != want.program ||
+			(p.GlobalZone != nil) != want.global || len(p.Zones) != want.zones {
+			t.Errorf("preset %d: unexpected %+v", i, p)
+		}
+	}
+	if p := sf.Preset(128, 0); p == nil || p.Name != "Kit" {
+		t.Errorf("expected the Kit preset, got %+v", p)
+	}
+	if p := sf.Preset(0, 1); p != nil {
+		t.Errorf("expected no preset, got %+v", p)
+	}
+	if coarse, ok := sf.Presets[1].GlobalZone.Generator(CoarseTune); !ok || coarse != 7 {
+		t.Errorf("expected a coarse tune of 7, got %d", coarse)
+	}
+	if coarse, ok := sf.Presets[2].Zones[0].Generator(CoarseTune); !ok || coarse != -12 {
+		t.Errorf("expected a coarse tune of -12, got %d", coarse)
+	}
+	if inst := sf.Presets[3].Zones[0].Instrument; inst != sf.Instruments[1] {
+		t.Errorf("expected the kit to use the second instrument, got %+v", inst)
+	}
+
+	if len(sf.Instruments) != 3 {
+		t.Fatalf("expected 3 instruments, got %d", len(sf.Instruments))
+	}
+	split := sf.Instruments[0]
+	if split.Name != "Split" || split.GlobalZone == nil || len(split.Zones) != 3 {
+		t.Fatalf("unexpected instrument %+v", split)
+	}
+	if mods := split.GlobalZone.Modulators; len(mods) != 1 {
+		t.Errorf("expected a modulator, got %+v", mods)
+	} else if m := mods[0]; m.Destination != InitialAttenuation || m.Amount != 960 ||
+		m.Source.Index() != 2 || m.Source.CC() || !m.Source.Negative() || m.Source.Bipolar() || m.Source.Curve() != 1 {
+		t.Errorf("unexpected modulator %+v", m)
+	}
+	z := split.Zones[2]
+	if lo, hi := z.KeyRange(); lo != 60 || hi != 127 {
+		t.Errorf("unexpected key range %d-%d", lo, hi)
+	}
+	if lo, hi := z.VelRange(); lo != 64 || hi != 127 {
+		t.Errorf("unexpected velocity range %d-%d", lo, hi)
+	}
+	if !z.Matches(69, 100) || z.Matches(69, 40) || z.Matches(59, 100) {
+		t.Errorf("unexpected zone matches")
+	}
+	if lo, hi := split.Zones[0].VelRange(); lo != 0 || hi != 127 {
+		t.Errorf("expected the full velocity range, got %d-%d", lo, hi)
+	}
+	if z.Sample != sf.Samples[0] {
+		t.Errorf("expected the zone to play the first sample")
+	}
+
+	if len(sf.Samples) != 2 {
+		t.Fatalf("expected 2 samples, got %d", len(sf.Samples))
+	}
+	s := sf.Samples[0]
+	if s.Name != "Sine A4" || s.Start != 0 || s.End != 400 || s.LoopStart != 200 || s.LoopEnd != 400 ||
+		s.SampleRate != 8800 || s.OriginalPitch != 69 || s.Type != MonoSample || s.Type.IsROM() {
+		t.Errorf("unexpected sample %+v", s)
+	}
+	if s := sf.Samples[1]; s.Name != "Square" || s.Start != 446 || s.End != 1246 {
+		t.Errorf("unexpected sample %+v", s)
+	}
+}
+
+func TestDecoder_Decode_errors(t *testing.T) {
+	data, err := ioutil.ReadFile(testBank)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the sample index of the last instrument zone, before the terminal
+	// generator
+	badSample := append([]byte{}, data...)
+	badSample[bytes.LastIndex(badSample, []byte("shdr"))-6] = 9
+	noPresets := append([]byte{}, data...)
+	copy(noPresets[bytes.Index(noPresets, []byte("pdta")):], "xdta")
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"wave file", []byte("RIFF\x04\x00\x00\x00WAVE"), "not a SoundFont"},
+		{"truncated file", data[:len(data)-100], "truncated"},
+		{"missing pdta", noPresets, "missing pdta"},
+		{"invalid sample", badSample, `invalid sample index 9 in instrument "Sine"`},
+	} {
+		d := NewDecoder(bytes.NewReader(tc.data))
+		if err := d.Decode(); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package sf2
+
+import (
+	"io"
+	"math"
+	"sort"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/synth"
+)
+
+// PercussionBank is the bank of the percussion presets, used by the
+// percussion channel.
+const PercussionBank = 128
+
+// Sampler plays the notes of tracks with the presets of a SoundFont. Each
+// channel plays the preset selected by its bank select (CC 0) and program
+// changes, the percussion channel plays from the PercussionBank. The preset
+// and instrument zones matching the key and velocity of a note each start a
+// voice which plays its sample with its loop, tuning and volume envelope.
+//
+// The effects of the default modulators are applied: the velocity, channel
+// volume (CC 7), pan (CC 10) and pitch wheel (with the pitch bend
+// sensitivity set by RPN 0). The other modulators as well as the filter,
+// LFOs, modulation envelope and effect sends aren't rendered.
+type Sampler struct {
+	TicksPerQuarterNote uint16
+	Tracks              []*midi.Track
+	SoundFont           *SoundFont
+	// SampleRate is the sample rate of the audio, synth.DefaultSampleRate
+	// if not set.
+	SampleRate int
+	// Gain is the master gain applied to all the voices.
+	Gain float64
+	// BendRange is the pitch bend range of the channels in semitones until
+	// it is changed, midi.DefaultPitchBendRange if not set.
+	BendRange float64
+}
+
+// NewSampler returns a sampler playing tracks with the passed resolution
+// with the presets of the SoundFont.
+func NewSampler(sf *SoundFont, ppqn uint16) *Sampler {
+	return &Sampler{
+		TicksPerQuarterNote: ppqn,
+		SoundFont:           sf,
+		SampleRate:          synth.DefaultSampleRate,
+		Gain:                synth.DefaultGain,
+	}
+}
+
+// timedEvent is a channel event and its absolute tick.
+type timedEvent struct {
+	tick uint64
+	ev   *midi.Event
+}
+
+// events returns the channel events of the tracks sorted by tick, the events
+// at the same tick are kept in the order of the tracks.
+func (s *Sampler) events() []timedEvent {
+	evs := []timedEvent{}
+	for _, t := range s.Tracks {
+		if t == nil {
+			continue
+		}
+		var tick uint64
+		for _, ev := range t.Events {
+			tick += uint64(ev.TimeDelta)
+			if ev.MsgType < midi.EventByteMap["NoteOff"] || ev.MsgType > midi.EventByteMap["PitchWheelChange"] {
+				continue
+			}
+			evs = append(evs, timedEvent{tick: tick, ev: ev})
+		}
+	}
+	sort.SliceStable(evs, func(i, j int) bool { return evs[i].tick < evs[j].tick })
+	return evs
+}
+
+// Render plays the tracks into a stereo buffer of float samples. The notes
+// still held after the last event are released at that point and the buffer
+// ends when all the voices are silent.
+func (s *Sampler) Render() *audio.FloatBuffer {
+	ppq := s.TicksPerQuarterNote
+	if ppq == 0 {
+		ppq = 96
+	}
+	sampleRate := s.SampleRate
+	if sampleRate <= 0 {
+		sampleRate = synth.DefaultSampleRate
+	}
+	p := &player{
+		s:          s,
+		sampleRate: float64(sampleRate),
+		data:       []float64{},
+		bends:      midi.NewBendTracker(s.BendRange),
+	}
+	for i := range p.channels {
+		p.channels[i] = channelState{volume: 100, pan: 64}
+	}
+	p.channels[synth.PercussionChannel].bank = PercussionBank
+	p.channels[synth.PercussionChannel].pendingBank = PercussionBank
+
+	tempo := midi.TempoMapOf(s.Tracks...)
+	for _, te := range s.events() {
+		p.advance(int(math.Round(tempo.Seconds(te.tick, ppq) * float64(sampleRate))))
+		p.handle(te.tick, te.ev)
+	}
+	for _, v := range p.voices {
+		v.noteOff(p.pos)
+	}
+	for len(p.voices) > 0 {
+		p.advance(p.pos + sampleRate/10)
+	}
+	return &audio.FloatBuffer{
+		Format: &audio.Format{NumChannels: 2, SampleRate: sampleRate},
+		Data:   p.data,
+	}
+}
+
+// WriteWAV renders the tracks and writes them as a stereo WAV file of the
+// passed bit depth (8, 16, 24 or 32).
+func (s *Sampler) WriteWAV(w io.WriteSeeker, bitDepth int) error {
+	return synth.WriteWAV(w, s.Render(), bitDepth)
+}
+
+// channelState is the state of a channel.
+type channelState struct {
+	// bank and program select the preset of the channel, the bank selected
+	// with CC 0 applies with the next program change.
+	bank, pendingBank int
+	program           int
+	volume            int
+	pan               int
+}
+
+// player holds the state of a rendering.
+type player struct {
+	s          *Sampler
+	sampleRate float64
+	data       []float64
+	bends      *midi.BendTracker
+	channels   [16]channelState
+	voices     []*voice
+	// pos is the first frame not rendered yet.
+	pos int
+}
+
+// preset returns the preset played by the channel. The missing melodic
+// presets fall back on the same program of bank 0 and the missing
+// percussion presets on the first kit.
+func (p *player) preset(ch uint8) *Preset {
+	sf := p.s.SoundFont
+	if sf == nil {
+		return nil
+	}
+	st := p.channels[ch]
+	if preset := sf.Preset(st.bank, st.program); preset != nil {
+		return preset
+	}
+	if st.bank == PercussionBank {
+		return sf.Preset(PercussionBank, 0)
+	}
+	return sf.Preset(0, st.program)
+}
+
+// handle applies a channel event.
+func (p *player) handle(tick uint64, ev *midi.Event) {
+	p.bends.Feed(tick, ev)
+	ch := ev.MsgChan & 0x0F
+	switch ev.MsgType {
+	case midi.EventByteMap["NoteOn"]:
+		p.noteOff(ch, int(ev.Note))
+		if ev.Velocity > 0 {
+			p.noteOn(ch, int(ev.Note), int(ev.Velocity))
+		}
+	case midi.EventByteMap["NoteOff"]:
+		p.noteOff(ch, int(ev.Note))
+	case midi.EventByteMap["ProgramChange"]:
+		p.channels[ch].bank = p.channels[ch].pendingBank
+		p.channels[ch].program = int(ev.NewProgram)
+	case midi.EventByteMap["ControlChange"]:
+		switch int(ev.Controller) {
+		case midi.CCVals["Bank Select"]:
+			if ch != synth.PercussionChannel {
+				p.channels[ch].pendingBank = int(ev.NewValue)
+			}
+		case midi.CCVals["Channel Volume"]:
+			p.channels[ch].volume = int(ev.NewValue)
+		case midi.CCVals["Pan"]:
+			p.channels[ch].pan = int(ev.NewValue)
+		case midi.CCVals["All Sound Off"]:
+			voices := p.voices[:0]
+			for _, v := range p.voices {
+				if v.channel != ch {
+					voices = append(voices, v)
+				}
+			}
+			p.voices = voices
+		case midi.CCVals["All Notes Off"]:
+			for _, v := range p.voices {
+				if v.channel == ch {
+					v.noteOff(p.pos)
+				}
+			}
+		}
+	}
+}
+
+// noteOn starts the voices of the zones matching the note.
+func (p *player) noteOn(ch uint8, key, vel int) {
+	preset := p.preset(ch)
+	if preset == nil {
+		return
+	}
+	started := []*voice{}
+	for _, pz := range preset.Zones {
+		if !pz.Matches(key, vel) {
+			continue
+		}
+		inst := pz.Instrument
+		for _, iz := range inst.Zones {
+			if !iz.Matches(key, vel) || iz.Sample.Type.IsROM() {
+				continue
+			}
+			gens := zoneGenerators(preset.GlobalZone, pz, inst.GlobalZone, iz)
+			if v := newVoice(p.s.SoundFont, iz.Sample, gens, ch, key, vel, p.pos, p.sampleRate); v != nil {
+				started = append(started, v)
+			}
+		}
+	}
+	for _, v := range started {
+		if v.exclusive == 0 {
+			continue
+		}
+		// the voices of the same class (like an open hi-hat closed by
+		// the pedal) are cut
+		voices := p.voices[:0]
+		for _, o := range p.voices {
+			if o.channel != ch || o.exclusive != v.exclusive {
+				voices = append(voices, o)
+			}
+		}
+		p.voices = voices
+	}
+	p.voices = append(p.voices, started...)
+}
+
+// noteOff releases the voices playing the note on the channel.
+func (p *player) noteOff(ch uint8, key int) {
+	for _, v := range p.voices {
+		if v.channel == ch && v.key == key {
+			v.noteOff(p.pos)
+		}
+	}
+}
+
+// advance renders the sounding voices until the passed frame.
+func (p *player) advance(to int) {
+	if to <= p.pos {
+		return
+	}
+	if n := 2 * to; n > len(p.data) {
+		p.data = append(p.data, make([]float64, n-len(p.data))...)
+	}
+	voices := p.voices[:0]
+	for _, v := range p.voices {
+		st := p.channels[v.channel]
+		gain := p.s.Gain * synth.Volume(st.volume)
+		left, right := panGains(v.pan + float64(st.pan-64)/63)
+		step := v.step * math.Pow(2, p.bends.Semitones(v.channel)/12)
+		if v.render(p.data, p.pos, to, step, gain*left, gain*right, p.sampleRate) {
+			voices = append(voices, v)
+		}
+	}
+	p.voices = voices
+	p.pos = to
+}
+
+// panGains returns the gains of the left and right outputs of a position
+// from -1 (hard left) to 1 (hard right) using a constant power law.
+func panGains(pos float64) (left, right float64) {
+	switch {
+	case pos <= -1:
+		return 1, 0
+	case pos >= 1:
+		return 0, 1
+	}
+	angle := (pos + 1) * math.Pi / 4
+	return math.Cos(angle), math.Sin(angle)
+}
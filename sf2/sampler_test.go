@@ -0,0 +1,223 @@
+package sf2
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/internal/miditest"
+	"github.com/go-audio/midi/synth"
+	"github.com/go-audio/wav"
+)
+
+const testRate = 8000
+
+// frequency measures the frequency of the left channel of interleaved stereo
+// samples between the passed frames by counting the rising zero crossings.
+func frequency(data []float64, from, to int) float64 {
+	crossings := 0
+	for i := from + 1; i < to; i++ {
+		if data[2*(i-1)] < 0 && data[2*i] >= 0 {
+			crossings++
+		}
+	}
+	return float64(crossings) * testRate / float64(to-from)
+}
+
+// peak returns the highest absolute sample of the left channel between the
+// passed frames.
+func peak(data []float64, from, to int) float64 {
+	max := 0.0
+	for i := from; i < to && 2*i < len(data); i++ {
+		max = math.Max(max, math.Abs(data[2*i]))
+	}
+	return max
+}
+
+func newTestSampler(t *testing.T, tracks ...*midi.Track) *Sampler {
+	sf, err := Open(testBank)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSampler(sf, 96)
+	s.SampleRate = testRate
+	s.Tracks = tracks
+	return s
+}
+
+func TestSampler_Render_presets(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		bank, program int
+		key, vel      int
+		want          float64
+	}{
+		{"low zone", 0, 0, 57, 100, 220},
+		{"soft zone", 0, 0, 69, 40, 440},
+		{"loud zone", 0, 0, 69, 100, 880},
+		{"preset zone", 0, 5, 69, 100, 659.26},
+		{"bank select", 1, 0, 69, 100, 220},
+		{"missing bank", 1, 5, 69, 100, 659.26},
+	} {
+		tr := &midi.Track{}
+		tr.AddAfterDelta(0, midi.ControlChange(0, midi.CCVals["Bank Select"], tc.bank))
+		tr.AddAfterDelta(0, midi.ProgramSelect(0, tc.program))
+		tr.AddAfterDelta(0, midi.NoteOn(0, tc.key, tc.vel))
+		// a second at 120 BPM
+		tr.AddAfterDelta(192, midi.NoteOff(0, tc.key))
+		buf := newTestSampler(t, tr).Render()
+		if buf.Format.NumChannels != 2 || buf.Format.SampleRate != testRate {
+			t.Fatalf("%s: unexpected format %+v", tc.name, buf.Format)
+		}
+		// the sample is much shorter than the note, its loop sustains it
+		if f := frequency(buf.Data, 2000, 8000); math.Abs(f-tc.want) > 2 {
+			t.Errorf("%s: expected %.1fHz, got %.1fHz", tc.name, tc.want, f)
+		}
+	}
+}
+
+func TestSampler_Render_bankAppliesOnProgramChange(t *testing.T) {
+	tr := &midi.Track{}
+	tr.AddAfterDelta(0, midi.ControlChange(0, midi.CCVals["Bank Select"], 1))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 69, 100))
+	tr.AddAfterDelta(192, midi.NoteOff(0, 69))
+	buf := newTestSampler(t, tr).Render()
+	if f := frequency(buf.Data, 2000, 8000); math.Abs(f-880) > 2 {
+		t.Errorf("expected the bank 0 preset at 880Hz, got %.1fHz", f)
+	}
+}
+
+func TestSampler_Render_envelope(t *testing.T) {
+	tr := &midi.Track{}
+	tr.AddAfterDelta(0, midi.NoteOn(0, 69, 40))
+	tr.AddAfterDelta(192, midi.NoteOff(0, 69))
+	s := newTestSampler(t, tr)
+	buf := s.Render()
+	// the release lasts 100ms, the rendering stops in the following 100ms
+	if n := buf.NumFrames(); n <= 8800 || n > 9600 {
+		t.Errorf("unexpected length %d", n)
+	}
+	if p := peak(buf.Data, 8800, buf.NumFrames()); p > 1e-9 {
+		t.Errorf("expected silence after the release, got %v", p)
+	}
+	if p := peak(buf.Data, 8000, 8400); p == 0 {
+		t.Errorf("expected the release to be heard")
+	}
+	// no decay, full level: the attenuation of the velocity only
+	want := s.Gain * (16000.0 / 32768) * 0.0992 * 0.62 * math.Sqrt2 / 2
+	if p := peak(buf.Data, 4000, 4400); math.Abs(p-want) > want/10 {
+		t.Errorf("expected a peak of %.4f, got %.4f", want, p)
+	}
+
+	// the Fifth Up preset decays to -6dB in 30ms
+	tr = &midi.Track{}
+	tr.AddAfterDelta(0, midi.ProgramSelect(0, 5))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 69, 127))
+	tr.AddAfterDelta(192, midi.NoteOff(0, 69))
+	buf = newTestSampler(t, tr).Render()
+	attack, sustain := peak(buf.Data, 0, 40), peak(buf.Data, 4000, 4400)
+	if ratio := sustain / attack; math.Abs(ratio-0.5) > 0.05 {
+		t.Errorf("expected the sustain to be half the peak level, got %.3f", ratio)
+	}
+}
+
+func TestSampler_Render_controllers(t *testing.T) {
+	tr := &midi.Track{}
+	tr.AddAfterDelta(0, midi.ControlChange(0, midi.CCVals["Pan"], 127))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 69, 40))
+	tr.AddAfterDelta(96, midi.PitchWheel(0, midi.PitchBendMax))
+	tr.AddAfterDelta(0, midi.ControlChange(0, midi.CCVals["Pan"], 64))
+	tr.AddAfterDelta(0, midi.ControlChange(0, midi.CCVals["Channel Volume"], 0))
+	tr.AddAfterDelta(0, midi.ControlChange(0, midi.CCVals["Channel Volume"], 127))
+	tr.AddAfterDelta(96, midi.NoteOff(0, 69))
+	buf := newTestSampler(t, tr).Render()
+	for i := 0; i < 4000; i++ {
+		if buf.Data[2*i] != 0 {
+			t.Fatalf("expected the first half to be hard right, frame %d is %v", i, buf.Data[2*i])
+		}
+	}
+	// the default bend range is 2 semitones
+	right := make([]float64, len(buf.Data))
+	for i := 1; i < len(buf.Data); i += 2 {
+		right[i-1] = buf.Data[i]
+	}
+	if f := frequency(right, 400, 3600); math.Abs(f-440) > 3 {
+		t.Errorf("expected 440Hz before the bend, got %.1fHz", f)
+	}
+	if f := frequency(buf.Data, 4400, 7600); math.Abs(f-493.88) > 3 {
+		t.Errorf("expected 493.9Hz after the bend, got %.1fHz", f)
+	}
+}
+
+func TestSampler_Render_percussion(t *testing.T) {
+	tr := &midi.Track{}
+	// the kick doesn't loop: it stops with its sample (100ms) although it's
+	// held
+	tr.AddAfterDelta(0, midi.NoteOn(9, 36, 127))
+	// the open hi-hat loops until the closed one cuts it
+	tr.AddAfterDelta(96, midi.NoteOn(9, 46, 127))
+	tr.AddAfterDelta(96, midi.NoteOn(9, 42, 127))
+	tr.AddAfterDelta(96, midi.NoteOff(9, 36))
+	tr.AddAfterDelta(0, midi.NoteOff(9, 42))
+	tr.AddAfterDelta(0, midi.NoteOff(9, 46))
+	buf := newTestSampler(t, tr).Render()
+	if p := peak(buf.Data, 0, 400); p == 0 {
+		t.Errorf("expected the kick to be heard")
+	}
+	if p := peak(buf.Data, 900, 4000); p != 0 {
+		t.Errorf("expected the kick to stop after its sample, got %v", p)
+	}
+	if p := peak(buf.Data, 7000, 7900); p == 0 {
+		t.Errorf("expected the open hi-hat to be held")
+	}
+	if p := peak(buf.Data, 8900, 12000); p != 0 {
+		t.Errorf("expected the closed hi-hat to cut the open one, got %v", p)
+	}
+}
+
+func TestSampler_WriteWAV(t *testing.T) {
+	tr := &midi.Track{}
+	tr.AddAfterDelta(0, midi.NoteOn(0, 69, 100))
+	tr.AddAfterDelta(96, midi.NoteOff(0, 69))
+	s := newTestSampler(t, tr)
+	f, err := ioutil.TempFile("", "sf2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := s.WriteWAV(f, 24); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	d := wav.NewDecoder(f)
+	pcm, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.BitDepth != 24 || d.NumChans != 2 || d.SampleRate != testRate {
+		t.Errorf("unexpected header %d bits, %d channels, %dHz", d.BitDepth, d.NumChans, d.SampleRate)
+	}
+	if n, want := pcm.NumFrames(), s.Render().NumFrames(); n != want {
+		t.Errorf("expected %d frames, got %d", want, n)
+	}
+}
+
+func TestSampler_Render_fixtures(t *testing.T) {
+	miditest.Fixtures(t, func(t *testing.T, d *midi.Decoder) {
+		s := newTestSampler(t, d.Tracks...)
+		s.TicksPerQuarterNote = d.TicksPerQuarterNote
+		// the programs without a preset in the test bank are silent
+		miditest.CheckRender(t, d, s.Render(), func(n miditest.Note) bool {
+			if n.Channel == synth.PercussionChannel {
+				return true
+			}
+			program := n.Track.ProgramAt(midi.GM1Bank, n.Channel, n.Start).Program
+			return s.SoundFont.Preset(0, int(program)) != nil
+		})
+	})
+}
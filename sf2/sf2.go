@@ -0,0 +1,293 @@
+// Package sf2 reads SoundFont 2 banks (presets, instruments, zones,
+// generators, modulators and samples) and renders midi tracks with them, see
+// Sampler.
+//
+// The format is described in the SoundFont 2.04 specification: a preset is
+// made of zones pointing to instruments, an instrument is made of zones
+// pointing to samples. The zones apply to ranges of keys and velocities and
+// their generators set the parameters of the voices (tuning, envelopes,
+// loops...).
+package sf2
+
+// Version is the version of the format or of a sound ROM.
+type Version struct {
+	Major, Minor uint16
+}
+
+// Info is the information chunk of a SoundFont.
+type Info struct {
+	Version Version
+	// Engine is the sound engine the bank is designed for (EMU8000 if not
+	// set).
+	Engine       string
+	Name         string
+	ROM          string
+	ROMVersion   Version
+	CreationDate string
+	Engineers    string
+	Product      string
+	Copyright    string
+	Comments     string
+	Software     string
+}
+
+// SoundFont is a decoded SoundFont 2 bank.
+type SoundFont struct {
+	Info        Info
+	Presets     []*Preset
+	Instruments []*Instrument
+	Samples     []*Sample
+	// SampleData are the 16 bit samples of the bank, indexed by the start,
+	// end and loop points of the samples.
+	SampleData []int16
+	// SampleData24 are the extra low bytes of the samples of 24 bit banks,
+	// empty for 16 bit banks.
+	SampleData24 []byte
+}
+
+// Preset returns the preset of the bank and program, nil if the SoundFont
+// doesn't have it.
+func (sf *SoundFont) Preset(bank, program int) *Preset {
+	for _, p := range sf.Presets {
+		if int(p.Bank) == bank && int(p.Program) == program {
+			return p
+		}
+	}
+	return nil
+}
+
+// Preset is a sound which can be selected with a bank and a program number.
+type Preset struct {
+	Name    string
+	Program uint16
+	// Bank is the bank of the preset, percussion presets use bank 128.
+	Bank       uint16
+	Library    uint32
+	Genre      uint32
+	Morphology uint32
+	// GlobalZone holds the generators and modulators shared by the zones,
+	// nil if the preset doesn't have one.
+	GlobalZone *Zone
+	Zones      []*Zone
+}
+
+// Instrument is a set of samples mapped to ranges of keys and velocities.
+type Instrument struct {
+	Name string
+	// GlobalZone holds the generators and modulators shared by the zones,
+	// nil if the instrument doesn't have one.
+	GlobalZone *Zone
+	Zones      []*Zone
+}
+
+// Zone is a part of a preset pointing to an instrument or a part of an
+// instrument pointing to a sample.
+type Zone struct {
+	Generators []Generator
+	Modulators []Modulator
+	// Instrument is the instrument of a preset zone.
+	Instrument *Instrument
+	// Sample is the sample of an instrument zone.
+	Sample *Sample
+}
+
+// Generator returns the amount of the last generator of the zone with the
+// passed operator and true, false if the zone doesn't have one.
+func (z *Zone) Generator(op GeneratorOperator) (int16, bool) {
+	if z == nil {
+		return 0, false
+	}
+	for i := len(z.Generators) - 1; i >= 0; i-- {
+		if z.Generators[i].Operator == op {
+			return z.Generators[i].Amount, true
+		}
+	}
+	return 0, false
+}
+
+// KeyRange returns the range of keys the zone applies to, 0 to 127 if it
+// doesn't have a key range generator.
+func (z *Zone) KeyRange() (low, high uint8) {
+	return z.rangeOf(KeyRange)
+}
+
+// VelRange returns the range of velocities the zone applies to, 0 to 127 if
+// it doesn't have a velocity range generator.
+func (z *Zone) VelRange() (low, high uint8) {
+	return z.rangeOf(VelRange)
+}
+
+func (z *Zone) rangeOf(op GeneratorOperator) (low, high uint8) {
+	amount, ok := z.Generator(op)
+	if !ok {
+		return 0, 127
+	}
+	return Generator{Amount: amount}.Range()
+}
+
+// Matches reports whether the zone applies to the key and velocity.
+func (z *Zone) Matches(key, vel int) bool {
+	kl, kh := z.KeyRange()
+	vl, vh := z.VelRange()
+	return key >= int(kl) && key <= int(kh) && vel >= int(vl) && vel <= int(vh)
+}
+
+// Sample is a recording of a sound and how to play it.
+type Sample struct {
+	Name string
+	// Start, End, LoopStart and LoopEnd are positions in the sample data of
+	// the SoundFont, End is the first position after the sample.
+	Start, End         uint32
+	LoopStart, LoopEnd uint32
+	SampleRate         uint32
+	// OriginalPitch is the key at which the sample plays at its recorded
+	// pitch, 255 for unpitched sounds.
+	OriginalPitch uint8
+	// PitchCorrection is the tuning of the sample in cents.
+	PitchCorrection int8
+	// Link is the index of the other sample of a stereo or linked pair.
+	Link uint16
+	Type SampleType
+}
+
+// SampleType tells whether a sample is mono or a channel of a stereo pair,
+// and whether it is stored in ROM.
+type SampleType uint16
+
+// Sample types, ROMSample is combined with the others.
+const (
+	MonoSample   SampleType = 1
+	RightSample  SampleType = 2
+	LeftSample   SampleType = 4
+	LinkedSample SampleType = 8
+	ROMSample    SampleType = 0x8000
+)
+
+// IsROM reports whether the sample data is stored in a sound ROM rather than
+// in the file.
+func (t SampleType) IsROM() bool {
+	return t&ROMSample != 0
+}
+
+// GeneratorOperator is the parameter set by a generator.
+type GeneratorOperator uint16
+
+// The generator operators of the SoundFont 2.04 specification.
+const (
+	StartAddrsOffset GeneratorOperator = iota
+	EndAddrsOffset
+	StartloopAddrsOffset
+	EndloopAddrsOffset
+	StartAddrsCoarseOffset
+	ModLfoToPitch
+	VibLfoToPitch
+	ModEnvToPitch
+	InitialFilterFc
+	InitialFilterQ
+	ModLfoToFilterFc
+	ModEnvToFilterFc
+	EndAddrsCoarseOffset
+	ModLfoToVolume
+	Unused1
+	ChorusEffectsSend
+	ReverbEffectsSend
+	Pan
+	Unused2
+	Unused3
+	Unused4
+	DelayModLFO
+	FreqModLFO
+	DelayVibLFO
+	FreqVibLFO
+	DelayModEnv
+	AttackModEnv
+	HoldModEnv
+	DecayModEnv
+	SustainModEnv
+	ReleaseModEnv
+	KeynumToModEnvHold
+	KeynumToModEnvDecay
+	DelayVolEnv
+	AttackVolEnv
+	HoldVolEnv
+	DecayVolEnv
+	SustainVolEnv
+	ReleaseVolEnv
+	KeynumToVolEnvHold
+	KeynumToVolEnvDecay
+	InstrumentID
+	Reserved1
+	KeyRange
+	VelRange
+	StartloopAddrsCoarseOffset
+	Keynum
+	Velocity
+	InitialAttenuation
+	Reserved2
+	EndloopAddrsCoarseOffset
+	CoarseTune
+	FineTune
+	SampleID
+	SampleModes
+	Reserved3
+	ScaleTuning
+	ExclusiveClass
+	OverridingRootKey
+	Unused5
+	EndOper
+)
+
+// Generator sets a parameter of a zone.
+type Generator struct {
+	Operator GeneratorOperator
+	// Amount is the value of the parameter, the key and velocity ranges
+	// store their low and high values in its low and high bytes, see Range.
+	Amount int16
+}
+
+// Range returns the low and high values of a range generator.
+func (g Generator) Range() (low, high uint8) {
+	return uint8(uint16(g.Amount)), uint8(uint16(g.Amount) >> 8)
+}
+
+// ModulatorSource describes the controller driving a modulator and how its
+// value is mapped.
+type ModulatorSource uint16
+
+// Index returns the general controller (when CC is false) or the midi
+// controller number of the source.
+func (s ModulatorSource) Index() uint8 {
+	return uint8(s & 0x7F)
+}
+
+// CC reports whether the source is a midi controller.
+func (s ModulatorSource) CC() bool {
+	return s&0x80 != 0
+}
+
+// Negative reports whether the source goes from its maximum to its minimum.
+func (s ModulatorSource) Negative() bool {
+	return s&0x100 != 0
+}
+
+// Bipolar reports whether the source maps to -1 to 1 instead of 0 to 1.
+func (s ModulatorSource) Bipolar() bool {
+	return s&0x200 != 0
+}
+
+// Curve returns the shape of the mapping: 0 linear, 1 concave, 2 convex and
+// 3 switch.
+func (s ModulatorSource) Curve() uint8 {
+	return uint8(s >> 10)
+}
+
+// Modulator routes a controller to a generator of a zone.
+type Modulator struct {
+	Source      ModulatorSource
+	Destination GeneratorOperator
+	Amount      int16
+	// AmountSource scales the amount.
+	AmountSource ModulatorSource
+	// Transform is applied to the output, 0 is linear and 2 absolute value.
+	Transform uint16
+}
@@ -0,0 +1,298 @@
+package sf2
+
+import (
+	"math"
+
+	"github.com/go-audio/midi/synth"
+)
+
+// generators holds the value of every generator operator of a voice.
+type generators [EndOper]int
+
+// defaultGenerators are the values of the generators not set by the zones.
+var defaultGenerators = func() generators {
+	var g generators
+	g[InitialFilterFc] = 13500
+	for _, op := range []GeneratorOperator{
+		DelayModLFO, DelayVibLFO, DelayModEnv, AttackModEnv, HoldModEnv,
+		DecayModEnv, ReleaseModEnv, DelayVolEnv, AttackVolEnv, HoldVolEnv,
+		DecayVolEnv, ReleaseVolEnv,
+	} {
+		g[op] = -12000
+	}
+	g[KeyRange] = 127 << 8
+	g[VelRange] = 127 << 8
+	g[Keynum] = -1
+	g[Velocity] = -1
+	g[ScaleTuning] = 100
+	g[OverridingRootKey] = -1
+	return g
+}()
+
+// instrumentOnly reports whether the generator operator is only valid in
+// instrument zones, the preset zones can't offset it.
+func instrumentOnly(op GeneratorOperator) bool {
+	switch op {
+	case StartAddrsOffset, EndAddrsOffset, StartloopAddrsOffset,
+		EndloopAddrsOffset, StartAddrsCoarseOffset, EndAddrsCoarseOffset,
+		StartloopAddrsCoarseOffset, EndloopAddrsCoarseOffset, Keynum,
+		Velocity, SampleModes, ExclusiveClass, OverridingRootKey,
+		InstrumentID, SampleID, KeyRange, VelRange:
+		return true
+	}
+	return false
+}
+
+// zoneGenerators returns the generators of a voice. The instrument zone
+// overrides the defaults and the global instrument zone, the preset zone
+// (overriding the global preset zone) is added to the result.
+func zoneGenerators(presetGlobal, preset, instGlobal, inst *Zone) generators {
+	g := defaultGenerators
+	for _, z := range []*Zone{instGlobal, inst} {
+		if z == nil {
+			continue
+		}
+		for _, gen := range z.Generators {
+			if gen.Operator < EndOper {
+				g[gen.Operator] = int(gen.Amount)
+			}
+		}
+	}
+	var offsets generators
+	for _, z := range []*Zone{presetGlobal, preset} {
+		if z == nil {
+			continue
+		}
+		for _, gen := range z.Generators {
+			if gen.Operator < EndOper && !instrumentOnly(gen.Operator) {
+				offsets[gen.Operator] = int(gen.Amount)
+			}
+		}
+	}
+	for op, offset := range offsets {
+		g[op] += offset
+	}
+	return g
+}
+
+// seconds converts timecents into seconds, -12000 and less are instant.
+func seconds(timecents int) float64 {
+	if timecents <= -12000 {
+		return 0
+	}
+	if timecents > 8000 {
+		timecents = 8000
+	}
+	return math.Pow(2, float64(timecents)/1200)
+}
+
+// silence is the attenuation in centibels from which a voice is silent.
+const silence = 1000
+
+// amplitude converts an attenuation in centibels into a gain.
+func amplitude(cb float64) float64 {
+	if cb >= silence {
+		return 0
+	}
+	if cb < 0 {
+		cb = 0
+	}
+	return math.Pow(10, -cb/200)
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// envelope is a volume envelope, the times are in seconds and the sustain
+// level is an attenuation in centibels. The attack is linear in amplitude,
+// the decay and release are linear in decibels and last their time for a
+// 100dB change.
+type envelope struct {
+	delay, attack, hold, decay float64
+	sustain                    float64
+	release                    float64
+}
+
+// held returns the gain t seconds after the start of a held note.
+func (e *envelope) held(t float64) float64 {
+	if t < e.delay {
+		return 0
+	}
+	t -= e.delay
+	if t < e.attack {
+		return t / e.attack
+	}
+	t -= e.attack
+	if t < e.hold {
+		return 1
+	}
+	t -= e.hold
+	cb := e.sustain
+	if e.decay > 0 && silence*t/e.decay < cb {
+		cb = silence * t / e.decay
+	}
+	return amplitude(cb)
+}
+
+// level returns the gain t seconds after the start of a note released at rel
+// seconds, rel is negative while the note is held.
+func (e *envelope) level(t, rel float64) float64 {
+	if rel < 0 || t < rel {
+		return e.held(t)
+	}
+	start := e.held(rel)
+	if start <= 0 || e.release <= 0 {
+		return 0
+	}
+	return amplitude(-200*math.Log10(start) + silence*(t-rel)/e.release)
+}
+
+// done reports whether the envelope stays silent from t seconds after the
+// start of a note released at rel seconds (negative if held).
+func (e *envelope) done(t, rel float64) bool {
+	if rel >= 0 && t >= rel {
+		return e.level(t, rel) == 0
+	}
+	return t > e.delay+e.attack && e.level(t, rel) == 0
+}
+
+// Loop modes of the SampleModes generator.
+const (
+	noLoop         = 0
+	loopContinuous = 1
+	loopRelease    = 3
+)
+
+// voice is a sample played for a note.
+type voice struct {
+	channel   uint8
+	key       int
+	exclusive int
+	data      []int16
+	// pos is the position in the sample data, end the first position after
+	// the sample.
+	pos                float64
+	end                int
+	loop               int
+	loopStart, loopEnd int
+	// step is the increment of the position per frame without pitch bend.
+	step float64
+	gain float64
+	// pan is the position of the voice from -1 (left) to 1 (right).
+	pan float64
+	env envelope
+	// start and release are frames, release is negative while the note is
+	// held.
+	start   int
+	release int
+}
+
+// newVoice returns the voice playing a sample with the passed generators, nil
+// if the sample is empty.
+func newVoice(sf *SoundFont, s *Sample, g generators, ch uint8, key, vel, frame int, sampleRate float64) *voice {
+	size := len(sf.SampleData)
+	start := clamp(int(s.Start)+g[StartAddrsOffset]+32768*g[StartAddrsCoarseOffset], 0, size)
+	end := clamp(int(s.End)+g[EndAddrsOffset]+32768*g[EndAddrsCoarseOffset], 0, size)
+	if end <= start || s.SampleRate == 0 {
+		return nil
+	}
+	v := &voice{
+		channel:   ch,
+		key:       key,
+		exclusive: g[ExclusiveClass],
+		data:      sf.SampleData,
+		pos:       float64(start),
+		end:       end,
+		loop:      g[SampleModes] & 3,
+		loopStart: clamp(int(s.LoopStart)+g[StartloopAddrsOffset]+32768*g[StartloopAddrsCoarseOffset], start, end),
+		loopEnd:   clamp(int(s.LoopEnd)+g[EndloopAddrsOffset]+32768*g[EndloopAddrsCoarseOffset], start, end),
+		pan:       float64(clamp(g[Pan], -500, 500)) / 500,
+		start:     frame,
+		release:   -1,
+	}
+	if v.loop == 2 || v.loopEnd-v.loopStart < 2 {
+		v.loop = noLoop
+	}
+
+	root := g[OverridingRootKey]
+	if root < 0 {
+		root = int(s.OriginalPitch)
+		if root > 127 {
+			root = 60
+		}
+	}
+	if g[Keynum] >= 0 {
+		key = g[Keynum]
+	}
+	if g[Velocity] >= 0 {
+		vel = g[Velocity]
+	}
+	cents := (key-root)*g[ScaleTuning] + 100*g[CoarseTune] + g[FineTune] + int(s.PitchCorrection)
+	v.step = math.Pow(2, float64(cents)/1200) * float64(s.SampleRate) / sampleRate
+	v.gain = amplitude(float64(clamp(g[InitialAttenuation], 0, 1440))) * synth.Volume(vel)
+
+	v.env = envelope{
+		delay:   seconds(g[DelayVolEnv]),
+		attack:  seconds(g[AttackVolEnv]),
+		hold:    seconds(g[HoldVolEnv] + g[KeynumToVolEnvHold]*(60-key)),
+		decay:   seconds(g[DecayVolEnv] + g[KeynumToVolEnvDecay]*(60-key)),
+		sustain: float64(clamp(g[SustainVolEnv], 0, 1440)),
+		release: seconds(g[ReleaseVolEnv]),
+	}
+	return v
+}
+
+// noteOff releases the voice at the passed frame.
+func (v *voice) noteOff(frame int) {
+	if v.release < 0 {
+		v.release = frame
+	}
+}
+
+// render adds the voice to the frames from..to of interleaved stereo data,
+// playing the sample step positions per frame. It returns false when the
+// voice is over.
+func (v *voice) render(data []float64, from, to int, step, left, right, sampleRate float64) bool {
+	rel := -1.0
+	if v.release >= 0 {
+		rel = float64(v.release-v.start) / sampleRate
+	}
+	for i := from; i < to; i++ {
+		t := float64(i-v.start) / sampleRate
+		if v.env.done(t, rel) {
+			return false
+		}
+		looping := v.loop == loopContinuous || (v.loop == loopRelease && (rel < 0 || t < rel))
+		idx := int(v.pos)
+		if idx >= v.end {
+			return false
+		}
+		next := idx + 1
+		if looping && next >= v.loopEnd {
+			next = v.loopStart
+		}
+		s0, s1 := float64(v.data[idx]), 0.0
+		if next < v.end {
+			s1 = float64(v.data[next])
+		}
+		frac := v.pos - float64(idx)
+		s := (s0 + (s1-s0)*frac) / 32768 * v.gain * v.env.level(t, rel)
+		data[2*i] += s * left
+		data[2*i+1] += s * right
+
+		v.pos += step
+		if looping {
+			for v.pos >= float64(v.loopEnd) {
+				v.pos -= float64(v.loopEnd - v.loopStart)
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,264 @@
+package synth
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/midi"
+)
+
+// Renderer plays the notes of tracks with an oscillator per note. The timing
+// follows the tempo map of the tracks, the notes are tuned with NoteToFreq
+// and bent by the pitch wheel of their channel (with the pitch bend
+// sensitivity set by RPN 0). The channel volume (CC 7) and pan (CC 10)
+// controllers apply to the following samples.
+type Renderer struct {
+	TicksPerQuarterNote uint16
+	Tracks              []*midi.Track
+	// SampleRate is the sample rate of the audio, DefaultSampleRate if not
+	// set.
+	SampleRate int
+	// Instruments are the sounds of the 16 channels.
+	Instruments [16]Instrument
+	// Gain is the master gain applied to all the notes.
+	Gain float64
+	// BendRange is the pitch bend range of the channels in semitones until
+	// it is changed, midi.DefaultPitchBendRange if not set.
+	BendRange float64
+	// Seed is the seed of the noise generator, the same seed renders the
+	// same samples.
+	Seed int64
+}
+
+// NewRenderer returns a renderer for tracks with the passed resolution. The
+// channels play sine waves with the DefaultEnvelope except the percussion
+// channel which plays noise bursts.
+func NewRenderer(ppqn uint16) *Renderer {
+	r := &Renderer{
+		TicksPerQuarterNote: ppqn,
+		SampleRate:          DefaultSampleRate,
+		Gain:                DefaultGain,
+	}
+	for i := range r.Instruments {
+		r.Instruments[i] = Instrument{Waveform: Sine, Envelope: DefaultEnvelope}
+	}
+	r.Instruments[PercussionChannel] = Instrument{Waveform: Noise, Envelope: PercussionEnvelope}
+	return r
+}
+
+// timedEvent is a channel event and its absolute tick.
+type timedEvent struct {
+	tick uint64
+	ev   *midi.Event
+}
+
+// channelState is the state of the mixing controllers of a channel.
+type channelState struct {
+	volume int
+	pan    int
+}
+
+// voice is a sounding note.
+type voice struct {
+	channel uint8
+	note    int
+	gain    float64
+	phase   float64
+	// start and release are sample positions, release is negative while the
+	// note is held.
+	start   int
+	release int
+}
+
+// player holds the state of a rendering.
+type player struct {
+	r          *Renderer
+	sampleRate int
+	data       []float64
+	bends      *midi.BendTracker
+	channels   [16]channelState
+	voices     []*voice
+	rnd        *rand.Rand
+	// pos is the first sample not rendered yet.
+	pos int
+}
+
+// events returns the channel events of the tracks sorted by tick, the events
+// at the same tick are kept in the order of the tracks.
+func (r *Renderer) events() []timedEvent {
+	evs := []timedEvent{}
+	for _, t := range r.Tracks {
+		if t == nil {
+			continue
+		}
+		var tick uint64
+		for _, ev := range t.Events {
+			tick += uint64(ev.TimeDelta)
+			if ev.MsgType < midi.EventByteMap["NoteOff"] || ev.MsgType > midi.EventByteMap["PitchWheelChange"] {
+				continue
+			}
+			evs = append(evs, timedEvent{tick: tick, ev: ev})
+		}
+	}
+	sort.SliceStable(evs, func(i, j int) bool { return evs[i].tick < evs[j].tick })
+	return evs
+}
+
+// Render plays the tracks into a stereo buffer of float samples. The buffer
+// ends when the notes released by the last event have faded out, the notes
+// still held then are released at that point.
+func (r *Renderer) Render() *audio.FloatBuffer {
+	ppq := r.TicksPerQuarterNote
+	if ppq == 0 {
+		ppq = 96
+	}
+	sampleRate := r.SampleRate
+	if sampleRate <= 0 {
+		sampleRate = DefaultSampleRate
+	}
+	buf := &audio.FloatBuffer{
+		Format: &audio.Format{NumChannels: 2, SampleRate: sampleRate},
+		Data:   []float64{},
+	}
+	evs := r.events()
+	if len(evs) == 0 {
+		return buf
+	}
+
+	tempo := midi.TempoMapOf(r.Tracks...)
+	sample := func(tick uint64) int {
+		return int(math.Round(tempo.Seconds(tick, ppq) * float64(sampleRate)))
+	}
+	var release float64
+	for _, inst := range r.Instruments {
+		if s := inst.Envelope.Release.Seconds(); s > release {
+			release = s
+		}
+	}
+	last := sample(evs[len(evs)-1].tick)
+	length := last + int(math.Ceil(release*float64(sampleRate)))
+	buf.Data = make([]float64, 2*length)
+
+	p := &player{
+		r:          r,
+		sampleRate: sampleRate,
+		data:       buf.Data,
+		bends:      midi.NewBendTracker(r.BendRange),
+		rnd:        rand.New(rand.NewSource(r.Seed)),
+	}
+	for i := range p.channels {
+		p.channels[i] = channelState{volume: 100, pan: 64}
+	}
+	for _, te := range evs {
+		p.advance(sample(te.tick))
+		p.handle(te.tick, te.ev)
+	}
+	for _, v := range p.voices {
+		if v.release < 0 {
+			v.release = last
+		}
+	}
+	p.advance(length)
+	return buf
+}
+
+// WriteWAV renders the tracks and writes them as a stereo WAV file of the
+// passed bit depth (8, 16, 24 or 32).
+func (r *Renderer) WriteWAV(w io.WriteSeeker, bitDepth int) error {
+	return WriteWAV(w, r.Render(), bitDepth)
+}
+
+// handle applies a channel event.
+func (p *player) handle(tick uint64, ev *midi.Event) {
+	p.bends.Feed(tick, ev)
+	ch := ev.MsgChan & 0x0F
+	switch ev.MsgType {
+	case midi.EventByteMap["NoteOn"]:
+		p.noteOff(ch, int(ev.Note))
+		if ev.Velocity > 0 {
+			p.voices = append(p.voices, &voice{
+				channel: ch,
+				note:    int(ev.Note),
+				gain:    Volume(int(ev.Velocity)),
+				start:   p.pos,
+				release: -1,
+			})
+		}
+	case midi.EventByteMap["NoteOff"]:
+		p.noteOff(ch, int(ev.Note))
+	case midi.EventByteMap["ControlChange"]:
+		switch int(ev.Controller) {
+		case midi.CCVals["Channel Volume"]:
+			p.channels[ch].volume = int(ev.NewValue)
+		case midi.CCVals["Pan"]:
+			p.channels[ch].pan = int(ev.NewValue)
+		case midi.CCVals["All Sound Off"]:
+			voices := p.voices[:0]
+			for _, v := range p.voices {
+				if v.channel != ch {
+					voices = append(voices, v)
+				}
+			}
+			p.voices = voices
+		case midi.CCVals["All Notes Off"]:
+			for _, v := range p.voices {
+				if v.channel == ch && v.release < 0 {
+					v.release = p.pos
+				}
+			}
+		}
+	}
+}
+
+// noteOff releases the held voices playing the note on the channel.
+func (p *player) noteOff(ch uint8, note int) {
+	for _, v := range p.voices {
+		if v.channel == ch && v.note == note && v.release < 0 {
+			v.release = p.pos
+		}
+	}
+}
+
+// advance renders the sounding voices until the passed sample position.
+func (p *player) advance(to int) {
+	if max := len(p.data) / 2; to > max {
+		to = max
+	}
+	if to <= p.pos {
+		return
+	}
+	rate := float64(p.sampleRate)
+	voices := p.voices[:0]
+	for _, v := range p.voices {
+		inst := p.r.Instruments[v.channel]
+		state := p.channels[v.channel]
+		gain := p.r.Gain * v.gain * Volume(state.volume)
+		left, right := Pan(state.pan)
+		step := p.bends.Frequency(v.channel, v.note) / rate
+		rel := -1.0
+		if v.release >= 0 {
+			rel = float64(v.release-v.start) / rate
+		}
+		done := false
+		for i := p.pos; i < to; i++ {
+			t := float64(i-v.start) / rate
+			if inst.Envelope.done(t, rel) {
+				done = true
+				break
+			}
+			s := inst.Waveform.sample(v.phase, p.rnd) * inst.Envelope.Level(t, rel) * gain
+			p.data[2*i] += s * left
+			p.data[2*i+1] += s * right
+			v.phase += step
+			v.phase -= math.Floor(v.phase)
+		}
+		if !done {
+			voices = append(voices, v)
+		}
+	}
+	p.voices = voices
+	p.pos = to
+}
@@ -0,0 +1,219 @@
+package synth
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/go-audio/midi"
+	"github.com/go-audio/midi/internal/miditest"
+	"github.com/go-audio/wav"
+)
+
+const testRate = 8000
+
+// frequency measures the frequency of a channel of interleaved stereo samples
+// between the passed frames by counting the rising zero crossings.
+func frequency(data []float64, channel, from, to int) float64 {
+	crossings := 0
+	for i := from + 1; i < to; i++ {
+		if data[2*(i-1)+channel] < 0 && data[2*i+channel] >= 0 {
+			crossings++
+		}
+	}
+	return float64(crossings) * testRate / float64(to-from)
+}
+
+// firstSound returns the first frame with a non zero sample.
+func firstSound(data []float64) int {
+	for i, v := range data {
+		if v != 0 {
+			return i / 2
+		}
+	}
+	return -1
+}
+
+func newTestRenderer(tracks ...*midi.Track) *Renderer {
+	r := NewRenderer(96)
+	r.SampleRate = testRate
+	r.Tracks = tracks
+	return r
+}
+
+func TestRenderer_Render(t *testing.T) {
+	tr := &midi.Track{}
+	// an A4 for a second at 120 BPM
+	tr.AddAfterDelta(0, midi.NoteOn(0, 69, 127))
+	tr.AddAfterDelta(192, midi.NoteOff(0, 69))
+	buf := newTestRenderer(tr).Render()
+	if buf.Format.NumChannels != 2 || buf.Format.SampleRate != testRate {
+		t.Fatalf("unexpected format %+v", buf.Format)
+	}
+	// the release of the default envelope follows the note
+	if n := buf.NumFrames(); n != testRate+testRate/10 {
+		t.Fatalf("expected %d frames, got %d", testRate+testRate/10, n)
+	}
+	if f := frequency(buf.Data, 0, 800, 7200); math.Abs(f-440) > 2 {
+		t.Errorf("expected a 440Hz tone, got %.1fHz", f)
+	}
+	// sustain level of the default envelope, centered with the default volume
+	peak := 0.0
+	for _, v := range buf.Data[2*4000 : 2*5000] {
+		peak = math.Max(peak, v)
+	}
+	want := DefaultGain * DefaultEnvelope.Sustain * Volume(100) * math.Sqrt2 / 2
+	if math.Abs(peak-want) > 1e-3 {
+		t.Errorf("expected a peak of %.4f, got %.4f", want, peak)
+	}
+	if v := buf.Data[len(buf.Data)-2]; math.Abs(v) > 1e-3 {
+		t.Errorf("expected the note to fade out, got %v", v)
+	}
+}
+
+func TestRenderer_Render_tempo(t *testing.T) {
+	conductor := &midi.Track{}
+	conductor.AddAfterDelta(0, midi.TempoEvent(60))
+	conductor.AddAfterDelta(96, midi.TempoEvent(120))
+	tr := &midi.Track{}
+	tr.AddAfterDelta(192, midi.NoteOn(0, 60, 100))
+	tr.AddAfterDelta(96, midi.NoteOff(0, 60))
+	buf := newTestRenderer(conductor, tr).Render()
+	// a second for the first quarter note then half a second for the second
+	// one, the attack starts at 0
+	if start := firstSound(buf.Data); start != 12001 {
+		t.Errorf("expected the note to start at frame 12001, got %d", start)
+	}
+}
+
+func TestRenderer_Render_controllers(t *testing.T) {
+	tr := &midi.Track{}
+	tr.AddAfterDelta(0, midi.ControlChange(0, midi.CCVals["Pan"], 0))
+	tr.AddAfterDelta(0, midi.ControlChange(1, midi.CCVals["Channel Volume"], 0))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 69, 100))
+	tr.AddAfterDelta(0, midi.NoteOn(1, 60, 100))
+	tr.AddAfterDelta(96, midi.ControlChange(0, midi.CCVals["Pan"], 127))
+	tr.AddAfterDelta(96, midi.NoteOff(0, 69))
+	tr.AddAfterDelta(0, midi.NoteOff(1, 60))
+	buf := newTestRenderer(tr).Render()
+	for i := 0; i < buf.NumFrames(); i++ {
+		left, right := buf.Data[2*i], buf.Data[2*i+1]
+		if i < 4000 && right != 0 {
+			t.Fatalf("expected the first half to be hard left, frame %d is %v, %v", i, left, right)
+		}
+		if i >= 4000 && left != 0 {
+			t.Fatalf("expected the second half to be hard right, frame %d is %v, %v", i, left, right)
+		}
+	}
+	// only the A sounds, the channel of the C is muted
+	if f := frequency(buf.Data, 0, 400, 3600); math.Abs(f-440) > 3 {
+		t.Errorf("expected a 440Hz tone, got %.1fHz", f)
+	}
+}
+
+func TestRenderer_Render_pitchBend(t *testing.T) {
+	tr := &midi.Track{}
+	// a 12 semitones bend range set with RPN 0 then a full bend up
+	for _, ev := range midi.PitchBendSensitivity(0, 12, 0) {
+		tr.AddAfterDelta(0, ev)
+	}
+	tr.AddAfterDelta(0, midi.NoteOn(0, 57, 100))
+	tr.AddAfterDelta(96, midi.PitchWheel(0, midi.PitchBendMax))
+	tr.AddAfterDelta(96, midi.NoteOff(0, 57))
+	buf := newTestRenderer(tr).Render()
+	if f := frequency(buf.Data, 0, 400, 3600); math.Abs(f-220) > 3 {
+		t.Errorf("expected a 220Hz tone before the bend, got %.1fHz", f)
+	}
+	if f := frequency(buf.Data, 0, 4400, 7600); math.Abs(f-440) > 3 {
+		t.Errorf("expected a 440Hz tone after the bend, got %.1fHz", f)
+	}
+}
+
+func TestRenderer_Render_waveforms(t *testing.T) {
+	tr := &midi.Track{}
+	tr.AddAfterDelta(0, midi.NoteOn(PercussionChannel, 38, 127))
+	tr.AddAfterDelta(0, midi.NoteOn(0, 69, 127))
+	tr.AddAfterDelta(96, midi.NoteOff(PercussionChannel, 38))
+	tr.AddAfterDelta(0, midi.NoteOff(0, 69))
+	r := newTestRenderer(tr)
+	r.Instruments[0].Waveform = Square
+	a, b := r.Render(), r.Render()
+	for i := range a.Data {
+		if a.Data[i] != b.Data[i] {
+			t.Fatalf("expected the same seed to render the same samples, frame %d differs", i/2)
+		}
+	}
+	r.Seed = 1
+	c := r.Render()
+	same := true
+	for i := range a.Data {
+		if a.Data[i] != c.Data[i] {
+			same = false
+			break
+		}
+	}
+	if same {
+		t.Errorf("expected another seed to render other samples")
+	}
+
+	// the square wave only has two levels once sustained and the noise
+	// burst is over
+	r.Instruments[PercussionChannel].Waveform = Sine
+	r.Tracks[0].Events = r.Tracks[0].Events[1:]
+	square := r.Render()
+	level := DefaultGain * DefaultEnvelope.Sustain * Volume(100) * math.Sqrt2 / 2
+	for i := 1000; i < 4000; i++ {
+		if v := square.Data[2*i]; math.Abs(math.Abs(v)-level) > 1e-9 {
+			t.Fatalf("frame %d: expected a square wave of amplitude %v, got %v", i, level, v)
+		}
+	}
+}
+
+func TestRenderer_WriteWAV(t *testing.T) {
+	tr := &midi.Track{}
+	tr.AddAfterDelta(0, midi.NoteOn(0, 69, 127))
+	tr.AddAfterDelta(96, midi.NoteOff(0, 69))
+	r := newTestRenderer(tr)
+	f, err := ioutil.TempFile("", "synth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := r.WriteWAV(f, 16); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	d := wav.NewDecoder(f)
+	pcm, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.BitDepth != 16 || d.NumChans != 2 || d.SampleRate != testRate {
+		t.Errorf("unexpected header %d bits, %d channels, %dHz", d.BitDepth, d.NumChans, d.SampleRate)
+	}
+	want := IntBuffer(r.Render(), 16)
+	if len(pcm.Data) != len(want.Data) {
+		t.Fatalf("expected %d samples, got %d", len(want.Data), len(pcm.Data))
+	}
+	for i := range want.Data {
+		if pcm.Data[i] != want.Data[i] {
+			t.Fatalf("sample %d = %d, want %d", i, pcm.Data[i], want.Data[i])
+		}
+	}
+	if err := r.WriteWAV(f, 12); err == nil {
+		t.Errorf("expected an error for an unsupported bit depth")
+	}
+}
+
+func TestRenderer_Render_fixtures(t *testing.T) {
+	miditest.Fixtures(t, func(t *testing.T, d *midi.Decoder) {
+		r := NewRenderer(d.TicksPerQuarterNote)
+		r.SampleRate = testRate
+		r.Tracks = d.Tracks
+		miditest.CheckRender(t, d, r.Render(), nil)
+	})
+}
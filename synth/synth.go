@@ -0,0 +1,209 @@
+// Package synth renders midi tracks offline into PCM audio using built-in
+// oscillators, so files can be listened to (or checked) without a sound card
+// or a sound bank. The audio is returned in the buffer types of
+// github.com/go-audio/audio and can be written as WAV.
+package synth
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/wav"
+)
+
+const (
+	// DefaultSampleRate is the sample rate used when the renderer's isn't set.
+	DefaultSampleRate = 44100
+	// DefaultGain is the master gain of a new renderer, it leaves room for a
+	// few loud notes before clipping.
+	DefaultGain = 0.5
+	// PercussionChannel is the General MIDI percussion channel (10, 0 based).
+	PercussionChannel = 9
+)
+
+// Waveform is the shape of an oscillator.
+type Waveform int
+
+const (
+	// Sine is a pure tone.
+	Sine Waveform = iota
+	// Saw is a bright tone with all the harmonics.
+	Saw
+	// Square is a hollow tone with the odd harmonics.
+	Square
+	// Noise is white noise, the pitch of the notes is ignored.
+	Noise
+)
+
+func (w Waveform) String() string {
+	switch w {
+	case Sine:
+		return "sine"
+	case Saw:
+		return "saw"
+	case Square:
+		return "square"
+	case Noise:
+		return "noise"
+	}
+	return "unknown"
+}
+
+// sample returns the value of the waveform at the passed phase (0 to 1).
+func (w Waveform) sample(phase float64, rnd *rand.Rand) float64 {
+	switch w {
+	case Saw:
+		return 2*phase - 1
+	case Square:
+		if phase < 0.5 {
+			return 1
+		}
+		return -1
+	case Noise:
+		return 2*rnd.Float64() - 1
+	}
+	return math.Sin(2 * math.Pi * phase)
+}
+
+// Envelope is an ADSR amplitude envelope. The level rises to its maximum
+// during the attack, falls to the sustain level (0 to 1) during the decay and
+// stays there until the note is released, it then fades out during the
+// release.
+type Envelope struct {
+	Attack  time.Duration
+	Decay   time.Duration
+	Sustain float64
+	Release time.Duration
+}
+
+var (
+	// DefaultEnvelope is the envelope of the melodic instruments.
+	DefaultEnvelope = Envelope{
+		Attack:  5 * time.Millisecond,
+		Decay:   100 * time.Millisecond,
+		Sustain: 0.7,
+		Release: 100 * time.Millisecond,
+	}
+	// PercussionEnvelope is a short envelope which doesn't depend on the
+	// length of the notes.
+	PercussionEnvelope = Envelope{
+		Attack: time.Millisecond,
+		Decay:  150 * time.Millisecond,
+	}
+)
+
+// held returns the level t seconds after the start of a note which is still
+// held.
+func (e Envelope) held(t float64) float64 {
+	attack, decay := e.Attack.Seconds(), e.Decay.Seconds()
+	switch {
+	case t < attack:
+		return t / attack
+	case t < attack+decay:
+		return 1 - (1-e.Sustain)*(t-attack)/decay
+	}
+	return e.Sustain
+}
+
+// Level returns the level of the envelope t seconds after the start of a note
+// released at rel seconds, a negative rel means that the note is still held.
+func (e Envelope) Level(t, rel float64) float64 {
+	if t < 0 {
+		return 0
+	}
+	if rel < 0 || t < rel {
+		return e.held(t)
+	}
+	release := e.Release.Seconds()
+	if t-rel >= release {
+		return 0
+	}
+	return e.held(rel) * (1 - (t-rel)/release)
+}
+
+// done reports whether the envelope stays silent from t seconds after the
+// start of a note released at rel seconds (negative if still held).
+func (e Envelope) done(t, rel float64) bool {
+	if rel >= 0 {
+		return t-rel >= e.Release.Seconds()
+	}
+	return e.Sustain <= 0 && t >= (e.Attack+e.Decay).Seconds()
+}
+
+// Instrument is the sound of a channel.
+type Instrument struct {
+	Waveform Waveform
+	Envelope Envelope
+}
+
+// Pan returns the gains of the left and right outputs for a pan controller
+// value (0 is hard left, 64 the center and 127 hard right) using a constant
+// power law.
+func Pan(value int) (left, right float64) {
+	switch {
+	case value <= 0:
+		return 1, 0
+	case value >= 127:
+		return 0, 1
+	}
+	angle := (float64(value-64)/63 + 1) * math.Pi / 4
+	return math.Cos(angle), math.Sin(angle)
+}
+
+// Volume returns the gain of a channel volume or velocity value (0 to 127)
+// using the General MIDI recommended curve, 40*log10(value/127) dB.
+func Volume(value int) float64 {
+	if value <= 0 {
+		return 0
+	}
+	if value > 127 {
+		value = 127
+	}
+	v := float64(value) / 127
+	return v * v
+}
+
+// IntBuffer converts float samples (-1 to 1) into integer samples of the
+// passed bit depth (8, 16, 24 or 32), as stored in WAV files. The samples out
+// of range are clipped and the 8 bit samples are unsigned.
+func IntBuffer(buf *audio.FloatBuffer, bitDepth int) *audio.IntBuffer {
+	max := float64(audio.IntMaxSignedValue(bitDepth))
+	out := &audio.IntBuffer{
+		Format: &audio.Format{
+			NumChannels: buf.Format.NumChannels,
+			SampleRate:  buf.Format.SampleRate,
+		},
+		Data:           make([]int, len(buf.Data)),
+		SourceBitDepth: bitDepth,
+	}
+	for i, v := range buf.Data {
+		if v > 1 {
+			v = 1
+		}
+		if v < -1 {
+			v = -1
+		}
+		out.Data[i] = int(math.Round(v * max))
+		if bitDepth == 8 {
+			out.Data[i] += 128
+		}
+	}
+	return out
+}
+
+// WriteWAV writes float samples (-1 to 1) as a PCM WAV file of the passed
+// bit depth, see IntBuffer.
+func WriteWAV(w io.WriteSeeker, buf *audio.FloatBuffer, bitDepth int) error {
+	if audio.IntMaxSignedValue(bitDepth) == 0 {
+		return fmt.Errorf("synth: unsupported bit depth %d", bitDepth)
+	}
+	e := wav.NewEncoder(w, buf.Format.SampleRate, bitDepth, buf.Format.NumChannels, 1)
+	if err := e.Write(IntBuffer(buf, bitDepth)); err != nil {
+		return err
+	}
+	return e.Close()
+}
@@ -0,0 +1,86 @@
+package synth
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-audio/audio"
+)
+
+func TestEnvelope_Level(t *testing.T) {
+	env := Envelope{
+		Attack:  100 * time.Millisecond,
+		Decay:   200 * time.Millisecond,
+		Sustain: 0.5,
+		Release: 400 * time.Millisecond,
+	}
+	for _, tc := range []struct {
+		name   string
+		t, rel float64
+		want   float64
+	}{
+		{"before the start", -1, -1, 0},
+		{"attack", 0.05, -1, 0.5},
+		{"peak", 0.1, -1, 1},
+		{"decay", 0.2, -1, 0.75},
+		{"sustain", 2, -1, 0.5},
+		{"release", 2.2, 2, 0.25},
+		{"released", 2.4, 2, 0},
+		{"released during the attack", 0.1, 0.05, 0.5 * 0.875},
+		{"not released yet", 0.2, 1, 0.75},
+	} {
+		if got := env.Level(tc.t, tc.rel); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s: Level(%v, %v) = %v, want %v", tc.name, tc.t, tc.rel, got, tc.want)
+		}
+	}
+	if !PercussionEnvelope.done(0.2, -1) || PercussionEnvelope.done(0.1, -1) {
+		t.Errorf("expected the percussion envelope to end after its decay")
+	}
+}
+
+func TestPan(t *testing.T) {
+	for _, tc := range []struct {
+		value       int
+		left, right float64
+	}{
+		{0, 1, 0},
+		{64, math.Sqrt2 / 2, math.Sqrt2 / 2},
+		{127, 0, 1},
+	} {
+		left, right := Pan(tc.value)
+		if math.Abs(left-tc.left) > 1e-9 || math.Abs(right-tc.right) > 1e-9 {
+			t.Errorf("Pan(%d) = %v, %v, want %v, %v", tc.value, left, right, tc.left, tc.right)
+		}
+	}
+	if v := Volume(127); v != 1 {
+		t.Errorf("Volume(127) = %v", v)
+	}
+	if v := Volume(0); v != 0 {
+		t.Errorf("Volume(0) = %v", v)
+	}
+}
+
+func TestIntBuffer(t *testing.T) {
+	buf := &audio.FloatBuffer{
+		Format: &audio.Format{NumChannels: 1, SampleRate: 8000},
+		Data:   []float64{0, 0.5, -1, 2},
+	}
+	for _, tc := range []struct {
+		bitDepth int
+		want     []int
+	}{
+		{16, []int{0, 16384, -32767, 32767}},
+		{8, []int{128, 192, 1, 255}},
+	} {
+		got := IntBuffer(buf, tc.bitDepth)
+		if got.SourceBitDepth != tc.bitDepth || got.Format.SampleRate != 8000 {
+			t.Errorf("%d bits: unexpected format %+v", tc.bitDepth, got)
+		}
+		for i, v := range got.Data {
+			if v != tc.want[i] {
+				t.Errorf("%d bits: sample %d = %d, want %d", tc.bitDepth, i, v, tc.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package midi
+
+// SysExEvent returns a system exclusive event carrying the passed message.
+// The message can start with the F0 status byte or directly with the
+// manufacturer ID, the terminating F7 is added if missing.
+func SysExEvent(msg []byte) *Event {
+	if len(msg) > 0 && msg[0] == 0xF0 {
+		msg = msg[1:]
+	}
+	data := append([]byte{}, msg...)
+	if len(data) == 0 || data[len(data)-1] != 0xF7 {
+		data = append(data, 0xF7)
+	}
+	return &Event{
+		MsgType: EventByteMap["Meta"],
+		MsgChan: 0x0,
+		SysEx:   data,
+	}
+}
+
+// IsSysEx indicates whether the event is a system exclusive event or a sysex
+// escape sequence rather than a meta event.
+func (e *Event) IsSysEx() bool {
+	return e != nil && e.MsgType == EventByteMap["Meta"] && e.MsgChan != 0xF && e.SysEx != nil
+}
+
+// SysExMessage returns the system exclusive message as sent on the wire,
+// starting with F0. Escape sequences are returned as is.
+func (e *Event) SysExMessage() []byte {
+	if !e.IsSysEx() {
+		return nil
+	}
+	if e.MsgChan == 0x7 {
+		return append([]byte{}, e.SysEx...)
+	}
+	return append([]byte{0xF0}, e.SysEx...)
+}
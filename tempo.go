@@ -0,0 +1,241 @@
+package midi
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// DefaultTempo is the tempo in microseconds per quarter note assumed until the
+// first tempo event (120 BPM).
+const DefaultTempo = 500000
+
+// BPMToMicros converts a tempo in beats (quarter notes) per minute into
+// microseconds per quarter note, rounded to the closest microsecond.
+func BPMToMicros(bpm float64) uint32 {
+	if bpm <= 0 {
+		return DefaultTempo
+	}
+	us := math.Round(60000000 / bpm)
+	// the tempo is stored on 24 bits
+	if us > 0xFFFFFF {
+		return 0xFFFFFF
+	}
+	if us < 1 {
+		return 1
+	}
+	return uint32(us)
+}
+
+// MicrosToBPM converts a tempo in microseconds per quarter note into beats
+// (quarter notes) per minute.
+func MicrosToBPM(us uint32) float64 {
+	if us == 0 {
+		return 0
+	}
+	return 60000000 / float64(us)
+}
+
+// TempoEventMicros returns a tempo event using the exact number of
+// microseconds per quarter note.
+func TempoEventMicros(us uint32) *Event {
+	return &Event{
+		MsgType:        uint8(EventByteMap["Meta"]),
+		Cmd:            uint8(MetaByteMap["Tempo"]),
+		MsPerQuartNote: us,
+		Bpm:            uint32(MicrosToBPM(us)),
+	}
+}
+
+// BPM returns the exact tempo of a tempo event in beats per minute, 0 is
+// returned for other events. Unlike the Bpm field, the value isn't truncated.
+func (e *Event) BPM() float64 {
+	if e == nil || e.MsgType != EventByteMap["Meta"] || e.Cmd != MetaByteMap["Tempo"] || e.IsSysEx() {
+		return 0
+	}
+	return MicrosToBPM(e.MsPerQuartNote)
+}
+
+// TempoBPM returns the exact tempo of the first tempo event of the track in
+// beats per minute, 0 if the track doesn't have tempo events.
+func (t *Track) TempoBPM() float64 {
+	if t == nil {
+		return 0
+	}
+	for _, ev := range t.Events {
+		if bpm := ev.BPM(); bpm > 0 {
+			return bpm
+		}
+	}
+	return 0
+}
+
+// TempoChange is a tempo starting at a given tick.
+type TempoChange struct {
+	Tick uint64
+	// MicrosPerQuarter is the tempo in microseconds per quarter note.
+	MicrosPerQuarter uint32
+}
+
+// BPM returns the tempo in beats per minute.
+func (c TempoChange) BPM() float64 {
+	return MicrosToBPM(c.MicrosPerQuarter)
+}
+
+// TempoMap is a list of tempo changes sorted by tick used to convert ticks
+// into time and back. DefaultTempo applies until the first change.
+type TempoMap []TempoChange
+
+// TempoMapOf extracts the tempo changes of the tracks. The tempo events found
+// in any of the tracks apply to all of them which matches how format 1 files
+// store their tempo map in the first track.
+func TempoMapOf(tracks ...*Track) TempoMap {
+	m := TempoMap{}
+	for _, t := range tracks {
+		if t == nil {
+			continue
+		}
+		var tick uint64
+		for _, ev := range t.Events {
+			tick += uint64(ev.TimeDelta)
+			if ev.BPM() > 0 {
+				m = append(m, TempoChange{Tick: tick, MicrosPerQuarter: ev.MsPerQuartNote})
+			}
+		}
+	}
+	sort.SliceStable(m, func(i, j int) bool { return m[i].Tick < m[j].Tick })
+	return m
+}
+
+// At returns the tempo in microseconds per quarter note at the passed tick.
+func (m TempoMap) At(tick uint64) uint32 {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Tick > tick })
+	if i == 0 {
+		return DefaultTempo
+	}
+	return m[i-1].MicrosPerQuarter
+}
+
+// Seconds returns the time in seconds elapsed from the start of the sequence
+// to the passed tick for the passed resolution (ticks per quarter note).
+func (m TempoMap) Seconds(tick uint64, ppq uint16) float64 {
+	if ppq == 0 {
+		return 0
+	}
+	var micros float64
+	var last uint64
+	tempo := uint32(DefaultTempo)
+	for _, c := range m {
+		if c.Tick >= tick {
+			break
+		}
+		micros += float64(c.Tick-last) * float64(tempo)
+		last, tempo = c.Tick, c.MicrosPerQuarter
+	}
+	micros += float64(tick-last) * float64(tempo)
+	return micros / float64(ppq) / 1e6
+}
+
+// Duration returns the time elapsed from the start of the sequence to the
+// passed tick, see Seconds.
+func (m TempoMap) Duration(tick uint64, ppq uint16) time.Duration {
+	return time.Duration(math.Round(m.Seconds(tick, ppq) * float64(time.Second)))
+}
+
+// Tick returns the tick (rounded down) reached after the passed number of
+// seconds from the start of the sequence, the reverse of Seconds.
+func (m TempoMap) Tick(seconds float64, ppq uint16) uint64 {
+	if seconds <= 0 || ppq == 0 {
+		return 0
+	}
+	micros := seconds * 1e6 * float64(ppq)
+	var last uint64
+	tempo := uint32(DefaultTempo)
+	for _, c := range m {
+		span := float64(c.Tick-last) * float64(tempo)
+		if span >= micros {
+			break
+		}
+		micros -= span
+		last, tempo = c.Tick, c.MicrosPerQuarter
+	}
+	// a small epsilon compensates the floating point errors of exact ticks
+	return last + uint64(micros/float64(tempo)+1e-9)
+}
+
+// TempoCurve is the shape of a tempo ramp.
+type TempoCurve int
+
+const (
+	// LinearTempo changes the tempo by the same number of BPM at each step.
+	LinearTempo TempoCurve = iota
+	// ExponentialTempo changes the tempo by the same ratio at each step
+	// which sounds more even for large tempo changes.
+	ExponentialTempo
+)
+
+// TempoRamp returns the tempo events of an accelerando (from < to) or a
+// ritardando (from > to) going from the start tick to the end tick. A tempo
+// event is generated every resolution ticks using the tempo of the curve at
+// that tick, the last event sets the target tempo at the end tick. The
+// AbsTicks of the returned events are set, see Track.AddTempoRamp to add them
+// to a track.
+func TempoRamp(start, end uint64, from, to float64, curve TempoCurve, resolution uint64) []*Event {
+	if resolution == 0 {
+		resolution = 1
+	}
+	events := []*Event{}
+	if end < start || from <= 0 || to <= 0 {
+		return events
+	}
+	for tick := start; tick < end; tick += resolution {
+		x := float64(tick-start) / float64(end-start)
+		bpm := from + (to-from)*x
+		if curve == ExponentialTempo {
+			bpm = from * math.Pow(to/from, x)
+		}
+		ev := TempoEventMicros(BPMToMicros(bpm))
+		ev.AbsTicks = tick
+		events = append(events, ev)
+	}
+	last := TempoEventMicros(BPMToMicros(to))
+	last.AbsTicks = end
+	return append(events, last)
+}
+
+// AddTempoRamp adds the tempo events of a ramp (see TempoRamp) to the track.
+// The tempo events of the track between the start and end ticks are replaced
+// and the ramp events are placed before the other events at the same tick.
+func (t *Track) AddTempoRamp(start, end uint64, from, to float64, curve TempoCurve, resolution uint64) {
+	if t == nil {
+		return
+	}
+	ramp := TempoRamp(start, end, from, to, curve, resolution)
+	events := make([]*Event, 0, len(t.Events)+len(ramp))
+	var tick uint64
+	var eot *Event
+	for _, ev := range t.Events {
+		tick += uint64(ev.TimeDelta)
+		ev.AbsTicks = tick
+		if ev.Cmd == MetaByteMap["End of Track"] && ev.MsgType == EventByteMap["Meta"] && !ev.IsSysEx() {
+			eot = ev
+			continue
+		}
+		if ev.BPM() > 0 && tick >= start && tick <= end {
+			continue
+		}
+		for len(ramp) > 0 && ramp[0].AbsTicks <= tick {
+			events = append(events, ramp[0])
+			ramp = ramp[1:]
+		}
+		events = append(events, ev)
+	}
+	events = append(events, ramp...)
+	if eot != nil {
+		if n := len(events); n > 0 && events[n-1].AbsTicks > eot.AbsTicks {
+			eot.AbsTicks = events[n-1].AbsTicks
+		}
+		events = append(events, eot)
+	}
+	t.setEvents(events)
+}
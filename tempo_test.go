@@ -0,0 +1,165 @@
+package midi
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mattetti/filebuffer"
+)
+
+func TestTempoEvent_precision(t *testing.T) {
+	tests := []struct {
+		bpm    float64
+		micros uint32
+	}{
+		{120, 500000},
+		{93.75, 640000},
+		{140.5, 427046},
+		{61.2345, 979840},
+	}
+	for _, tt := range tests {
+		ev := TempoEvent(tt.bpm)
+		if ev.MsPerQuartNote != tt.micros {
+			t.Errorf("TempoEvent(%g) = %d us, want %d", tt.bpm, ev.MsPerQuartNote, tt.micros)
+		}
+		if got := ev.BPM(); math.Abs(got-tt.bpm) > 0.0001 {
+			t.Errorf("BPM() = %f, want %f", got, tt.bpm)
+		}
+	}
+
+	// exact tempos survive a round trip
+	w := filebuffer.New(nil)
+	e := NewEncoder(w, SingleTrack, 96)
+	tr := e.NewTrack()
+	tr.Add(0, TempoEvent(93.75))
+	tr.Add(0, NoteOn(0, 60, 100))
+	tr.Add(1, NoteOff(0, 60))
+	if tr.Tempo() != 93 {
+		t.Errorf("expected the integer tempo to be 93, got %d", tr.Tempo())
+	}
+	if err := e.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	dec := NewDecoder(w)
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if got := dec.Tracks[0].TempoBPM(); got != 93.75 {
+		t.Errorf("TempoBPM() = %f, want 93.75", got)
+	}
+	if got := TempoEvent(93.75).String(); got != "Ch 0 @ 0 (0) \tTempo -> 93.75" {
+		t.Errorf("String() = %q", got)
+	}
+	if got := NoteOn(0, 60, 100).BPM(); got != 0 {
+		t.Errorf("expected no tempo for a note, got %f", got)
+	}
+}
+
+func TestTempoMap(t *testing.T) {
+	tr := &Track{}
+	tr.AddAfterDelta(0, TempoEvent(120))
+	tr.AddAfterDelta(960, TempoEvent(60))
+	tr.AddAfterDelta(480, TempoEvent(240))
+	m := TempoMapOf(tr)
+	want := TempoMap{{0, 500000}, {960, 1000000}, {1440, 250000}}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("TempoMapOf() = %v, want %v", m, want)
+	}
+	if m.At(1000) != 1000000 || (TempoMap{}).At(10) != DefaultTempo {
+		t.Errorf("unexpected tempo lookups")
+	}
+
+	tests := []struct {
+		tick    uint64
+		seconds float64
+	}{
+		{0, 0},
+		{480, 0.5},
+		{960, 1},
+		{1200, 1.5},
+		{1440, 2},
+		{1920, 2.25},
+	}
+	for _, tt := range tests {
+		if got := m.Seconds(tt.tick, 480); math.Abs(got-tt.seconds) > 1e-9 {
+			t.Errorf("Seconds(%d) = %f, want %f", tt.tick, got, tt.seconds)
+		}
+		if got := m.Tick(tt.seconds, 480); got != tt.tick {
+			t.Errorf("Tick(%f) = %d, want %d", tt.seconds, got, tt.tick)
+		}
+	}
+	if got := m.Duration(1920, 480); got != 2250*time.Millisecond {
+		t.Errorf("Duration() = %v", got)
+	}
+}
+
+func TestTempoRamp(t *testing.T) {
+	bpms := func(evs []*Event) []float64 {
+		out := []float64{}
+		for _, ev := range evs {
+			out = append(out, math.Round(ev.BPM()*100)/100)
+		}
+		return out
+	}
+	tests := []struct {
+		name  string
+		curve TempoCurve
+		from  float64
+		to    float64
+		want  []float64
+	}{
+		{"linear accelerando", LinearTempo, 100, 140, []float64{100, 110, 120, 130, 140}},
+		{"linear ritardando", LinearTempo, 140, 100, []float64{140, 130, 120, 110, 100}},
+		{"exponential accelerando", ExponentialTempo, 60, 240, []float64{60, 84.85, 120, 169.71, 240}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evs := TempoRamp(960, 1920, tt.from, tt.to, tt.curve, 240)
+			if got := bpms(evs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TempoRamp() = %v, want %v", got, tt.want)
+			}
+			for i, ev := range evs {
+				if ev.AbsTicks != 960+uint64(i)*240 {
+					t.Errorf("event %d at tick %d", i, ev.AbsTicks)
+				}
+			}
+		})
+	}
+}
+
+func TestTrack_AddTempoRamp(t *testing.T) {
+	tr := &Track{}
+	tr.AddAfterDelta(0, TempoEvent(100))
+	tr.AddAfterDelta(0, NoteOn(0, 60, 100))
+	tr.AddAfterDelta(480, TempoEvent(90))
+	tr.AddAfterDelta(0, NoteOff(0, 60))
+	tr.AddAfterDelta(480, NoteOn(0, 62, 100))
+	tr.AddAfterDelta(480, NoteOff(0, 62))
+	tr.AddAfterDelta(0, EndOfTrack())
+
+	tr.AddTempoRamp(480, 960, 100, 80, LinearTempo, 240)
+	want := TempoMap{{0, 600000}, {480, 600000}, {720, 666667}, {960, 750000}}
+	if got := TempoMapOf(tr); !reflect.DeepEqual(got, want) {
+		t.Errorf("tempo map = %v, want %v", got, want)
+	}
+	types := []string{}
+	deltas := []uint32{}
+	for _, ev := range tr.Events {
+		name := EventMap[ev.MsgType]
+		if ev.BPM() > 0 {
+			name = "Tempo"
+		}
+		types = append(types, name)
+		deltas = append(deltas, ev.TimeDelta)
+	}
+	wantTypes := []string{"Tempo", "NoteOn", "Tempo", "NoteOff", "Tempo", "Tempo", "NoteOn", "NoteOff", "Meta"}
+	wantDeltas := []uint32{0, 0, 480, 0, 240, 240, 0, 480, 0}
+	if !reflect.DeepEqual(types, wantTypes) || !reflect.DeepEqual(deltas, wantDeltas) {
+		t.Errorf("events = %v %v, want %v %v", types, deltas, wantTypes, wantDeltas)
+	}
+}
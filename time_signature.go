@@ -3,6 +3,7 @@ package midi
 import (
 	"fmt"
 	"math"
+	"sort"
 )
 
 // TimeSignature FF 58 04 nn dd cc bb Time Signature
@@ -31,3 +32,99 @@ func (ts *TimeSignature) Denum() int {
 func (ts *TimeSignature) String() string {
 	return fmt.Sprintf("%d/%d - %d clocks per tick - %d", ts.Numerator, ts.Denum(), ts.ClocksPerTick, ts.ThirtySecondNotesPerQuarter)
 }
+
+// TicksPerBar returns the length of a bar in ticks for the passed resolution.
+// A nil time signature is considered to be 4/4 as per the MIDI spec.
+func (ts *TimeSignature) TicksPerBar(ppq uint16) uint64 {
+	if ts == nil || ts.Numerator == 0 {
+		return 4 * uint64(ppq)
+	}
+	// the denominator is a power of 2 where 2 is a quarter note
+	return uint64(ts.Numerator) * 4 * uint64(ppq) / uint64(ts.Denum())
+}
+
+// MeterChange is a time signature starting at a given tick.
+type MeterChange struct {
+	Tick uint64
+	TimeSignature
+}
+
+// MeterMap is a list of time signature changes sorted by tick used to find
+// the bar lines. 4/4 applies until the first change.
+type MeterMap []MeterChange
+
+// MeterMapOf extracts the time signatures of the tracks. The time signatures
+// found in any of the tracks apply to all of them which matches how format 1
+// files store their meter in the first track.
+func MeterMapOf(tracks ...*Track) MeterMap {
+	m := MeterMap{}
+	tsCmd := MetaByteMap["Time Signature"]
+	for _, t := range tracks {
+		if t == nil {
+			continue
+		}
+		var tick uint64
+		for _, ev := range t.Events {
+			tick += uint64(ev.TimeDelta)
+			if ev.MsgType == EventByteMap["Meta"] && ev.Cmd == tsCmd && ev.TimeSignature != nil {
+				m = append(m, MeterChange{Tick: tick, TimeSignature: *ev.TimeSignature})
+			}
+		}
+	}
+	sort.SliceStable(m, func(i, j int) bool { return m[i].Tick < m[j].Tick })
+	return m
+}
+
+// At returns the time signature active at the passed tick, 4/4 before the
+// first change.
+func (m MeterMap) At(tick uint64) TimeSignature {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Tick > tick })
+	if i == 0 {
+		return TimeSignature{Numerator: 4, Denominator: 2, ClocksPerTick: 24, ThirtySecondNotesPerQuarter: 8}
+	}
+	return m[i-1].TimeSignature
+}
+
+// Bars returns the ticks of the bar lines starting the bars which begin
+// before the passed end tick. A time signature change which doesn't fall on a
+// bar line shortens the current bar and starts a new bar.
+func (m MeterMap) Bars(end uint64, ppq uint16) []uint64 {
+	bars := []uint64{}
+	if ppq == 0 {
+		return bars
+	}
+	for tick := uint64(0); tick < end; tick = m.nextBar(tick, ppq) {
+		bars = append(bars, tick)
+	}
+	return bars
+}
+
+// BarTick returns the tick of the bar line starting the passed bar, 0 being
+// the first bar.
+func (m MeterMap) BarTick(bar int, ppq uint16) uint64 {
+	var tick uint64
+	if ppq == 0 {
+		return tick
+	}
+	for i := 0; i < bar; i++ {
+		tick = m.nextBar(tick, ppq)
+	}
+	return tick
+}
+
+// nextBar returns the tick of the bar line following the one at the passed
+// tick.
+func (m MeterMap) nextBar(tick uint64, ppq uint16) uint64 {
+	ts := m.At(tick)
+	next := tick + ts.TicksPerBar(ppq)
+	if next == tick {
+		// invalid time signatures are treated as 4/4
+		next = tick + 4*uint64(ppq)
+	}
+	// the first change after the bar line starts a new bar
+	i := sort.Search(len(m), func(i int) bool { return m[i].Tick > tick })
+	if i < len(m) && m[i].Tick < next {
+		next = m[i].Tick
+	}
+	return next
+}
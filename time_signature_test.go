@@ -0,0 +1,56 @@
+package midi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTimeSignature_TicksPerBar(t *testing.T) {
+	tests := []struct {
+		name string
+		ts   *TimeSignature
+		ppq  uint16
+		want uint64
+	}{
+		{name: "nil", ts: nil, ppq: 96, want: 384},
+		{name: "4/4", ts: &TimeSignature{Numerator: 4, Denominator: 2}, ppq: 96, want: 384},
+		{name: "3/4", ts: &TimeSignature{Numerator: 3, Denominator: 2}, ppq: 480, want: 1440},
+		{name: "6/8", ts: &TimeSignature{Numerator: 6, Denominator: 3}, ppq: 96, want: 288},
+		{name: "2/2", ts: &TimeSignature{Numerator: 2, Denominator: 1}, ppq: 96, want: 384},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ts.TicksPerBar(tt.ppq); got != tt.want {
+				t.Errorf("TicksPerBar() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeterMap_Bars(t *testing.T) {
+	tr := &Track{}
+	tr.AddAfterDelta(0, &Event{MsgType: 0xF, Cmd: 0x58, TimeSignature: &TimeSignature{Numerator: 3, Denominator: 2}})
+	// a 6/8 bar starting in the middle of the second 3/4 bar
+	tr.AddAfterDelta(96*4, &Event{MsgType: 0xF, Cmd: 0x58, TimeSignature: &TimeSignature{Numerator: 6, Denominator: 3}})
+	m := MeterMapOf(tr)
+
+	if ts := m.At(96 * 4); ts.Numerator != 6 || ts.Denum() != 8 {
+		t.Errorf("expected 6/8 at tick 384, got %s", &ts)
+	}
+	if ts := MeterMapOf().At(0); ts.Numerator != 4 || ts.Denum() != 4 {
+		t.Errorf("expected 4/4 by default, got %s", &ts)
+	}
+	got := m.Bars(96*10, 96)
+	want := []uint64{0, 288, 384, 672}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected bars %v, got %v", want, got)
+	}
+	if bars := m.Bars(0, 96); len(bars) != 0 {
+		t.Errorf("expected no bars, got %v", bars)
+	}
+	for i, tick := range want {
+		if got := m.BarTick(i, 96); got != tick {
+			t.Errorf("BarTick(%d) = %d, want %d", i, got, tick)
+		}
+	}
+}
@@ -16,6 +16,9 @@ type Track struct {
 	_name        string
 	ticksPerBeat uint16
 	currentTicks uint64
+	// decoded tracks are encoded as they are, without a default time
+	// signature
+	decoded bool
 }
 
 // Add schedules the passed event after x beats (relative to the previous event)
@@ -86,16 +89,60 @@ func (t *Track) Name() string {
 	return ""
 }
 
+// Copy returns a deep copy of the track and its events.
+func (t *Track) Copy() *Track {
+	if t == nil {
+		return nil
+	}
+	cc := &Track{
+		Size:         t.Size,
+		Events:       make([]*Event, len(t.Events)),
+		_name:        t._name,
+		ticksPerBeat: t.ticksPerBeat,
+		currentTicks: t.currentTicks,
+		decoded:      t.decoded,
+	}
+	for i, ev := range t.Events {
+		cc.Events[i] = ev.Copy()
+	}
+	return cc
+}
+
+// setEvents replaces the events of the track using their AbsTicks to compute
+// their delta times.
+func (t *Track) setEvents(events []*Event) {
+	t.Events = events
+	var last uint64
+	for _, ev := range events {
+		ev.TimeDelta = uint32(ev.AbsTicks - last)
+		last = ev.AbsTicks
+	}
+	t.currentTicks = last
+}
+
 // ChunkData converts the track and its events into a binary byte slice (chunk
 // header included). If endTrack is set to true, the end track metadata will be
-// added if not already present.
+// added if not already present. A 4/4 time signature is added to the tracks
+// which weren't decoded and don't have a time signature, the name set with
+// SetName is added if the track doesn't have a name event. Channel events
+// flagged with RunningStatus are encoded without their status byte when it
+// repeats the status of the previous event.
 func (t *Track) ChunkData(endTrack bool) ([]byte, error) {
 	buff := bytes.NewBuffer(nil)
+	var hasTimeSig, hasName bool
+	for _, e := range t.Events {
+		if e.MsgType == EventByteMap["Meta"] && !e.IsSysEx() {
+			hasTimeSig = hasTimeSig || e.Cmd == MetaByteMap["Time Signature"]
+			hasName = hasName || e.Cmd == MetaByteMap["Sequence/Track name"]
+		}
+	}
 	// time signature
 	// TODO: don't have 4/4 36, 8 hardcoded
-	buff.Write([]byte{0x00, 0xFF, 0x58, 0x04, 0x04, 0x02, 0x24, 0x08})
+	if !t.decoded && !hasTimeSig {
+		buff.Write([]byte{0x00, 0xFF, 0x58, 0x04, 0x04, 0x02, 0x24, 0x08})
+	}
 	// name event if name set
-	if name := t.Name(); len(name) > 0 {
+	if name := t.Name(); len(name) > 0 && !hasName {
 		t.Events = append([]*Event{TrackName(name)}, t.Events...)
 	}
 
@@ -106,11 +153,23 @@ func (t *Track) ChunkData(endTrack bool) ([]byte, error) {
 			}
 		}
 	}
+	var status byte
 	for _, e := range t.Events {
 		data, err := e.Encode()
 		if err != nil {
 			return nil, err
 		}
+		// running status only applies to consecutive channel events
+		if isVoiceMsgType(e.MsgType) {
+			s := e.MsgType<<4 | e.MsgChan
+			if e.RunningStatus && s == status {
+				n := len(EncodeVarint(e.TimeDelta))
+				data = append(data[:n], data[n+1:]...)
+			}
+			status = s
+		} else {
+			status = 0
+		}
 		if _, err := buff.Write(data); err != nil {
 			return nil, err
 		}
@@ -301,3 +301,22 @@ func TestTrack_AbsoluteEvents_MultiTrack(t *testing.T) {
 		})
 	}
 }
+
+func TestTrack_Copy(t *testing.T) {
+	var nilTrack *Track
+	if nilTrack.Copy() != nil {
+		t.Fatal("expected the copy of a nil track to be nil")
+	}
+	tr := &Track{}
+	tr.SetName("copy")
+	tr.Add(0, NoteOn(0, 60, 90))
+	tr.Add(1, NoteOff(0, 60))
+	cc := tr.Copy()
+	if !reflect.DeepEqual(tr, cc) {
+		t.Fatalf("expected %#v to equal %#v", cc, tr)
+	}
+	cc.Events[0].Note = 62
+	if tr.Events[0].Note != 60 {
+		t.Fatal("modifying the copy should not modify the original track")
+	}
+}
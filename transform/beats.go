@@ -0,0 +1,521 @@
+package transform
+
+import (
+	"math"
+	"sort"
+
+	"github.com/go-audio/midi"
+)
+
+// beatFrame is the resolution in seconds of the onset envelope used to track
+// beats.
+const beatFrame = 0.005
+
+// BeatTracker estimates the beats and downbeats of a performance recorded
+// without a click so it can be aligned to bars, see BeatGrid.Align. The zero
+// value uses the default settings.
+type BeatTracker struct {
+	// MinBPM and MaxBPM limit the tempo of the detected beats, 60 and 180
+	// BPM by default.
+	MinBPM float64
+	MaxBPM float64
+	// BeatsPerBar is the number of beats of a bar used to find the downbeats,
+	// 4 by default.
+	BeatsPerBar int
+	// Tightness sets how much the tempo is allowed to drift from one beat to
+	// the next, higher values follow the estimated tempo more strictly. 100
+	// by default.
+	Tightness float64
+}
+
+// Beat is a beat detected in a performance.
+type Beat struct {
+	// Seconds is the time of the beat from the start of the sequence.
+	Seconds float64
+	// Downbeat indicates the first beat of a bar.
+	Downbeat bool
+}
+
+// BeatGrid is the list of beats of a performance.
+type BeatGrid struct {
+	Beats       []Beat
+	BeatsPerBar int
+}
+
+// onset is a note start used to track beats.
+type onset struct {
+	seconds float64
+	weight  float64
+	accent  float64
+}
+
+// Track estimates the beats of the notes of the passed tracks. The tempo map
+// of the tracks is used to convert their ticks into time so tracks with tempo
+// changes are analyzed as they are heard. An empty grid is returned if the
+// tracks don't have enough notes to find a tempo.
+func (b BeatTracker) Track(tracks []*midi.Track, ppq uint16) BeatGrid {
+	b = b.withDefaults()
+	grid := BeatGrid{BeatsPerBar: b.BeatsPerBar}
+	onsets := trackOnsets(tracks, ppq)
+	if len(onsets) < 2 || ppq == 0 {
+		return grid
+	}
+
+	envelope := onsetEnvelope(onsets)
+	period := b.period(envelope)
+	if period == 0 {
+		return grid
+	}
+	frames := b.trackBeats(envelope, period)
+	if len(frames) < 2 {
+		return grid
+	}
+
+	// snap the beats to the strongest onset played close to them so the notes
+	// played on the beat land exactly on the grid
+	window := float64(period) * beatFrame / 8
+	for _, f := range frames {
+		t := float64(f) * beatFrame
+		best := -1
+		for i := sort.Search(len(onsets), func(i int) bool { return onsets[i].seconds >= t-window }); i < len(onsets) && onsets[i].seconds <= t+window; i++ {
+			if best < 0 || onsets[i].weight > onsets[best].weight {
+				best = i
+			}
+		}
+		if best >= 0 {
+			t = onsets[best].seconds
+		}
+		grid.Beats = append(grid.Beats, Beat{Seconds: t})
+	}
+	grid.findDownbeats(onsets)
+	return grid
+}
+
+func (b BeatTracker) withDefaults() BeatTracker {
+	if b.MinBPM <= 0 {
+		b.MinBPM = 60
+	}
+	if b.MaxBPM <= b.MinBPM {
+		b.MaxBPM = math.Max(180, b.MinBPM*2)
+	}
+	if b.BeatsPerBar <= 0 {
+		b.BeatsPerBar = 4
+	}
+	if b.Tightness <= 0 {
+		b.Tightness = 100
+	}
+	return b
+}
+
+// trackOnsets returns the note starts of the tracks sorted by time. Notes
+// played together (chords, flams) are merged into a single onset.
+func trackOnsets(tracks []*midi.Track, ppq uint16) []onset {
+	tempos := midi.TempoMapOf(tracks...)
+	notes := []*trackNote{}
+	for _, t := range tracks {
+		if t != nil {
+			notes = append(notes, pairNotes(t.Events)...)
+		}
+	}
+	if len(notes) == 0 {
+		return nil
+	}
+	// the lowest notes of the performance (bass, kick drum) are considered
+	// low notes
+	pitches := make([]int, len(notes))
+	for i, n := range notes {
+		pitches[i] = int(n.on.Note)
+	}
+	sort.Ints(pitches)
+	low := pitches[len(pitches)/10]
+
+	all := []onset{}
+	for _, n := range notes {
+		start := tempos.Seconds(n.startTick, ppq)
+		length := tempos.Seconds(n.endTick, ppq) - start
+		weight := float64(n.on.Velocity) / 127
+		// long and low notes tend to start bars
+		accent := weight * (1 + math.Min(length, 2))
+		if int(n.on.Note) <= low {
+			accent *= 2
+		}
+		all = append(all, onset{seconds: start, weight: weight, accent: accent})
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].seconds < all[j].seconds })
+
+	onsets := []onset{}
+	for _, o := range all {
+		if n := len(onsets); n > 0 && o.seconds-onsets[n-1].seconds < 0.03 {
+			onsets[n-1].weight += o.weight
+			onsets[n-1].accent += o.accent
+			continue
+		}
+		onsets = append(onsets, o)
+	}
+	return onsets
+}
+
+// onsetEnvelope returns the strength of the onsets for each frame, each onset
+// is spread over a few frames to tolerate small timing variations.
+func onsetEnvelope(onsets []onset) []float64 {
+	const spread = 2
+	last := onsets[len(onsets)-1].seconds
+	envelope := make([]float64, int(last/beatFrame)+3*spread+2)
+	for _, o := range onsets {
+		center := int(math.Round(o.seconds / beatFrame))
+		for i := center - 3*spread; i <= center+3*spread; i++ {
+			if i < 0 {
+				continue
+			}
+			d := float64(i-center) / spread
+			envelope[i] += o.weight * math.Exp(-d*d/2)
+		}
+	}
+	// normalize the envelope so the tightness doesn't depend on the density
+	// of the notes
+	var sum, sq float64
+	for _, v := range envelope {
+		sum += v
+		sq += v * v
+	}
+	mean := sum / float64(len(envelope))
+	if std := math.Sqrt(sq/float64(len(envelope)) - mean*mean); std > 0 {
+		for i := range envelope {
+			envelope[i] /= std
+		}
+	}
+	return envelope
+}
+
+// period returns the most likely beat period in frames using the
+// autocorrelation of the onset envelope. Periods close to 120 BPM are
+// favored to choose between the multiples of the beat.
+func (b BeatTracker) period(envelope []float64) int {
+	autocorr := func(lag int) float64 {
+		var sum float64
+		for i := 0; i+lag < len(envelope); i++ {
+			sum += envelope[i] * envelope[i+lag]
+		}
+		return sum
+	}
+	minLag := int(math.Round(60 / b.MaxBPM / beatFrame))
+	maxLag := int(math.Round(60 / b.MinBPM / beatFrame))
+	var best int
+	var bestScore float64
+	for lag := minLag; lag <= maxLag; lag++ {
+		if lag >= len(envelope) {
+			break
+		}
+		octaves := math.Log2(float64(lag) * beatFrame / 0.5)
+		score := (autocorr(lag) + autocorr(2*lag)/2) * math.Exp(-octaves*octaves/2)
+		if score > bestScore {
+			best, bestScore = lag, score
+		}
+	}
+	return best
+}
+
+// trackBeats finds the sequence of frames best matching the onsets while
+// keeping close to the passed period using dynamic programming (see Ellis,
+// Beat Tracking by Dynamic Programming, 2007).
+func (b BeatTracker) trackBeats(envelope []float64, period int) []int {
+	n := len(envelope)
+	score := make([]float64, n)
+	prev := make([]int, n)
+	for t := 0; t < n; t++ {
+		prev[t] = -1
+		best := 0.0
+		for tau := t - 2*period; tau <= t-period/2; tau++ {
+			if tau < 0 {
+				continue
+			}
+			drift := math.Log(float64(t-tau) / float64(period))
+			if s := score[tau] - b.Tightness*drift*drift; s > best {
+				best, prev[t] = s, tau
+			}
+		}
+		score[t] = envelope[t] + best
+	}
+
+	// the sequence ends on the best score of the last beat period
+	end := n - 1
+	for t := n - 1; t >= 0 && t >= n-1-period; t-- {
+		if score[t] > score[end] {
+			end = t
+		}
+	}
+	frames := []int{}
+	for t := end; t >= 0; t = prev[t] {
+		frames = append([]int{t}, frames...)
+	}
+	return frames
+}
+
+// findDownbeats marks the downbeats using the position in the bar where the
+// onsets played on the beat are the most accented.
+func (g *BeatGrid) findDownbeats(onsets []onset) {
+	accents := make([]float64, len(g.Beats))
+	for i, beat := range g.Beats {
+		window := g.period(i) / 8
+		for _, o := range onsets {
+			if math.Abs(o.seconds-beat.Seconds) <= window && o.accent > accents[i] {
+				accents[i] = o.accent
+			}
+		}
+	}
+	var phase int
+	bestScore := -1.0
+	for p := 0; p < g.BeatsPerBar; p++ {
+		var sum float64
+		var count int
+		for i := p; i < len(accents); i += g.BeatsPerBar {
+			sum += accents[i]
+			count++
+		}
+		if count > 0 && sum/float64(count) > bestScore {
+			phase, bestScore = p, sum/float64(count)
+		}
+	}
+	for i := phase; i < len(g.Beats); i += g.BeatsPerBar {
+		g.Beats[i].Downbeat = true
+	}
+}
+
+// period returns the length in seconds of the beat starting at the passed
+// index, the last beat has the length of the previous one.
+func (g BeatGrid) period(i int) float64 {
+	if len(g.Beats) < 2 {
+		return 0
+	}
+	if i >= len(g.Beats)-1 {
+		i = len(g.Beats) - 2
+	}
+	return g.Beats[i+1].Seconds - g.Beats[i].Seconds
+}
+
+// BPM returns the tempo of the beat starting at the passed index.
+func (g BeatGrid) BPM(i int) float64 {
+	if p := g.period(i); p > 0 {
+		return 60 / p
+	}
+	return 0
+}
+
+// TempoMap returns the tempo map placing each beat on a quarter note and the
+// downbeats on bar lines for the passed resolution, see Align.
+func (g BeatGrid) TempoMap(ppq uint16) midi.TempoMap {
+	a := g.align(0, ppq)
+	return a.tempoMap()
+}
+
+// alignment maps the time of a performance to the ticks of the aligned
+// sequence, the ticks are placed linearly between the anchors.
+type alignment struct {
+	ppq     uint64
+	ticks   []uint64
+	seconds []float64
+	// pickup is the length in ticks of the first bar when it's incomplete,
+	// 0 otherwise.
+	pickup uint64
+	// unit and denominator are the note value measuring the first bar.
+	unit        uint64
+	denominator uint8
+}
+
+// align anchors the beats on quarter notes starting from the downbeats, the
+// beats are extended to cover the sequence until the passed time. The time
+// before the first bar line is a partial first bar: the beats of the pickup,
+// preceded by a fraction of a beat (rounded to a sixteenth note) played at
+// the tempo needed to reach the first beat.
+func (g BeatGrid) align(end float64, ppq uint16) alignment {
+	a := alignment{ppq: uint64(ppq), unit: uint64(ppq), denominator: 2}
+	if ppq%4 == 0 {
+		a.unit, a.denominator = uint64(ppq)/4, 4
+	}
+	g = g.increasing()
+	if len(g.Beats) < 2 || ppq == 0 {
+		return a
+	}
+	bpb := g.BeatsPerBar
+	if bpb <= 0 {
+		bpb = 4
+	}
+	downbeat := 0
+	for i, beat := range g.Beats {
+		if beat.Downbeat {
+			downbeat = i
+			break
+		}
+	}
+	times := make([]float64, len(g.Beats))
+	for i, beat := range g.Beats {
+		times[i] = beat.Seconds
+	}
+
+	// fill the time before the first beat with beats at its tempo
+	first := g.period(0)
+	for times[0] >= first {
+		times = append([]float64{times[0] - first}, times...)
+		downbeat++
+	}
+	var lead uint64
+	if times[0] > 0 {
+		lead = uint64(math.Round(times[0]/first*float64(uint64(ppq)/a.unit))) * a.unit
+		if lead == 0 {
+			// too short to be notated, the first beat starts a bit earlier
+			times[0] = 0
+		}
+	}
+	if lead > 0 {
+		a.ticks = append(a.ticks, 0)
+		a.seconds = append(a.seconds, 0)
+	}
+	last := g.period(len(g.Beats) - 1)
+	for times[len(times)-1] < end {
+		times = append(times, times[len(times)-1]+last)
+	}
+	for i, t := range times {
+		a.ticks = append(a.ticks, lead+uint64(i)*uint64(ppq))
+		a.seconds = append(a.seconds, t)
+	}
+	a.pickup = (lead + uint64(downbeat)*uint64(ppq)) % (uint64(bpb) * uint64(ppq))
+	return a
+}
+
+// increasing returns a copy of the grid without the beats which don't come
+// after the previous beat, the period of a beat must be positive.
+func (g BeatGrid) increasing() BeatGrid {
+	beats := make([]Beat, 0, len(g.Beats))
+	for _, beat := range g.Beats {
+		if n := len(beats); n > 0 && !(beat.Seconds > beats[n-1].Seconds) {
+			continue
+		}
+		beats = append(beats, beat)
+	}
+	g.Beats = beats
+	return g
+}
+
+// tempoMap returns the tempo changes matching the anchors.
+func (a alignment) tempoMap() midi.TempoMap {
+	m := midi.TempoMap{}
+	for i := 0; i+1 < len(a.ticks); i++ {
+		quarters := float64(a.ticks[i+1]-a.ticks[i]) / float64(a.ppq)
+		us := uint32(math.Round((a.seconds[i+1] - a.seconds[i]) / quarters * 1e6))
+		if us == 0 {
+			us = 1
+		}
+		if n := len(m); n > 0 && m[n-1].MicrosPerQuarter == us {
+			continue
+		}
+		m = append(m, midi.TempoChange{Tick: a.ticks[i], MicrosPerQuarter: us})
+	}
+	return m
+}
+
+// tick returns the tick of the passed time.
+func (a alignment) tick(s float64) uint64 {
+	i := sort.Search(len(a.seconds), func(i int) bool { return a.seconds[i] > s }) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i > len(a.seconds)-2 {
+		i = len(a.seconds) - 2
+	}
+	pos := float64(a.ticks[i]) + (s-a.seconds[i])/(a.seconds[i+1]-a.seconds[i])*float64(a.ticks[i+1]-a.ticks[i])
+	return uint64(math.Round(pos))
+}
+
+// timeSignatures returns the time signature events of the aligned sequence
+// and their ticks: the partial first bar if any, then the bars of the grid.
+func (a alignment) timeSignatures(beatsPerBar int) ([]*midi.Event, []uint64) {
+	if beatsPerBar <= 0 {
+		beatsPerBar = 4
+	}
+	ts := func(num int, denom uint8) *midi.Event {
+		return &midi.Event{
+			MsgType: midi.EventByteMap["Meta"],
+			Cmd:     midi.MetaByteMap["Time Signature"],
+			TimeSignature: &midi.TimeSignature{
+				Numerator:                   uint8(num),
+				Denominator:                 denom,
+				ClocksPerTick:               24,
+				ThirtySecondNotesPerQuarter: 8,
+			},
+		}
+	}
+	if a.pickup == 0 {
+		return []*midi.Event{ts(beatsPerBar, 2)}, []uint64{0}
+	}
+	return []*midi.Event{ts(int(a.pickup/a.unit), a.denominator), ts(beatsPerBar, 2)}, []uint64{0, a.pickup}
+}
+
+// Align creates a copy of the tracks where each beat of the grid is a quarter
+// note and the downbeats are on bar lines, the notes keep playing at the same
+// time. The tempo and time signature events of the tracks are replaced by a
+// tempo change on each beat and by time signatures of BeatsPerBar quarter
+// notes, added to the first track which is created if missing. When the
+// performance starts with a pickup, the first bar is a shorter bar ending on
+// the first downbeat. The beats which don't come after the previous beat are
+// ignored. ppq is the resolution of the passed tracks and newPPQ the
+// resolution of the returned tracks, use a high resolution to limit the
+// rounding of the notes played between beats.
+func (g BeatGrid) Align(tracks []*midi.Track, ppq, newPPQ uint16) []*midi.Track {
+	out := make([]*midi.Track, len(tracks))
+	for i, t := range tracks {
+		out[i] = t.Copy()
+	}
+	tempos := midi.TempoMapOf(tracks...)
+	var end float64
+	for _, t := range out {
+		if t == nil || len(t.Events) == 0 {
+			continue
+		}
+		ticks := eventTicks(t)
+		if s := tempos.Seconds(ticks[len(ticks)-1], ppq); s > end {
+			end = s
+		}
+	}
+	a := g.align(end, newPPQ)
+	if len(a.ticks) < 2 || ppq == 0 {
+		return out
+	}
+	if len(out) == 0 {
+		out = append(out, nil)
+	}
+	if out[0] == nil {
+		out[0] = &midi.Track{}
+	}
+
+	for ti, t := range out {
+		if t == nil {
+			continue
+		}
+		ticks := eventTicks(t)
+		events := []*midi.Event{}
+		newTicks := []uint64{}
+		if ti == 0 {
+			events, newTicks = a.timeSignatures(g.BeatsPerBar)
+			for _, c := range a.tempoMap() {
+				events = append(events, midi.TempoEventMicros(c.MicrosPerQuarter))
+				newTicks = append(newTicks, c.Tick)
+			}
+		}
+		for i, ev := range t.Events {
+			if ev.BPM() > 0 || ev.MsgType == midi.EventByteMap["Meta"] && ev.Cmd == midi.MetaByteMap["Time Signature"] {
+				continue
+			}
+			tick := a.tick(tempos.Seconds(ticks[i], ppq))
+			// events at the start of the sequence (track name, program
+			// changes...) stay there
+			if ticks[i] == 0 && !isNote(ev) {
+				tick = 0
+			}
+			events = append(events, ev)
+			newTicks = append(newTicks, tick)
+		}
+		t.Events = events
+		setEventTicks(t, newTicks)
+	}
+	return out
+}
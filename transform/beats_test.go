@@ -0,0 +1,214 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/midi"
+)
+
+// performance returns a track played without a click: a pickup beat followed
+// by bars accelerating from 100 to 130 BPM with some timing jitter.
+func performance(beats, beatsPerBar int) (*midi.Track, []float64) {
+	times := []float64{0.1}
+	for i := 1; i < beats; i++ {
+		bpm := 100 + 30*float64(i)/float64(beats)
+		times = append(times, times[i-1]+60/bpm)
+	}
+	jitter := []float64{0.004, -0.006, 0.008, -0.003, 0}
+	type note struct {
+		seconds, length float64
+		key, vel        int
+	}
+	notes := []note{}
+	for i, t := range times {
+		t += jitter[i%len(jitter)]
+		notes = append(notes, note{t, 0.1, 60, 70}, note{t + 0.3, 0.1, 67, 45})
+		if i%beatsPerBar == 1 {
+			notes = append(notes, note{t, 1, 36, 100})
+		}
+	}
+	// 120 BPM at 480 ticks per quarter note
+	tick := func(s float64) uint64 { return uint64(math.Round(s * 960)) }
+	evTicks := []uint64{}
+	tr := &midi.Track{}
+	for _, n := range notes {
+		tr.Events = append(tr.Events, midi.NoteOn(0, n.key, n.vel), midi.NoteOff(0, n.key))
+		evTicks = append(evTicks, tick(n.seconds), tick(n.seconds+n.length))
+	}
+	tr.Events = append(tr.Events, midi.EndOfTrack())
+	evTicks = append(evTicks, evTicks[len(evTicks)-1])
+	setEventTicks(tr, evTicks)
+	return tr, times
+}
+
+func TestBeatTracker_Track(t *testing.T) {
+	tr, times := performance(25, 4)
+	grid := BeatTracker{}.Track([]*midi.Track{tr}, 480)
+	if len(grid.Beats) != len(times) {
+		t.Fatalf("expected %d beats, got %d", len(times), len(grid.Beats))
+	}
+	for i, beat := range grid.Beats {
+		if math.Abs(beat.Seconds-times[i]) > 0.01 {
+			t.Errorf("beat %d at %.3fs, want %.3fs", i, beat.Seconds, times[i])
+		}
+		if beat.Downbeat != (i%4 == 1) {
+			t.Errorf("beat %d: expected downbeat to be %t", i, i%4 == 1)
+		}
+	}
+	// the timing jitter changes the tempo of single beats by a few BPM
+	if bpm := grid.BPM(2); math.Abs(bpm-103.6) > 4 {
+		t.Errorf("expected the tempo to start around 103.6 BPM, got %.1f", bpm)
+	}
+	if bpm := grid.BPM(22); math.Abs(bpm-127.6) > 4 {
+		t.Errorf("expected the tempo to end around 127.6 BPM, got %.1f", bpm)
+	}
+	if got := (BeatTracker{}).Track([]*midi.Track{{}}, 480); len(got.Beats) != 0 {
+		t.Errorf("expected no beats without notes, got %d", len(got.Beats))
+	}
+}
+
+func TestBeatGrid_Align(t *testing.T) {
+	tests := []struct {
+		name        string
+		beatsPerBar int
+		bars        int
+		// the pickup beat and a sixteenth note for the silence before it
+		wantMeters []string
+	}{
+		{name: "4/4", beatsPerBar: 4, bars: 6, wantMeters: []string{"5/16", "4/4"}},
+		{name: "3/4", beatsPerBar: 3, bars: 8, wantMeters: []string{"5/16", "3/4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, _ := performance(25, tt.beatsPerBar)
+			tracks := []*midi.Track{tr}
+			grid := BeatTracker{BeatsPerBar: tt.beatsPerBar}.Track(tracks, 480)
+			aligned := grid.Align(tracks, 480, 960)
+
+			// the performance keeps its timing
+			before := noteSeconds(tracks, 480)
+			after := noteSeconds(aligned, 960)
+			if len(after) != len(before) {
+				t.Fatalf("expected %d notes, got %d", len(before), len(after))
+			}
+			for i := range after {
+				if math.Abs(after[i]-before[i]) > 0.001 {
+					t.Errorf("note %d moved from %.4fs to %.4fs", i, before[i], after[i])
+				}
+			}
+
+			meter := midi.MeterMapOf(aligned...)
+			meters := []string{}
+			for _, c := range meter {
+				meters = append(meters, fmt.Sprintf("%d/%d", c.Numerator, c.Denum()))
+			}
+			if !reflect.DeepEqual(meters, tt.wantMeters) {
+				t.Errorf("expected the time signatures %v, got %v", tt.wantMeters, meters)
+			}
+			barLines := map[uint64]bool{}
+			for _, tick := range meter.Bars(eventTicks(aligned[0])[len(aligned[0].Events)-1], 960) {
+				barLines[tick] = true
+			}
+			var bars int
+			for _, n := range pairNotes(aligned[0].Events) {
+				if n.on.Note == 36 {
+					bars++
+					if !barLines[n.startTick] {
+						t.Errorf("expected the downbeat at tick %d to start a bar", n.startTick)
+					}
+				}
+			}
+			if bars != tt.bars {
+				t.Errorf("expected %d bars, got %d", tt.bars, bars)
+			}
+			if tr.Events[0].TimeDelta != 100 {
+				t.Error("the original track should not be modified")
+			}
+		})
+	}
+}
+
+func TestBeatGrid_Align_invalidBeats(t *testing.T) {
+	// the notes go on after the last beat
+	tr := &midi.Track{}
+	for i := 0; i < 6; i++ {
+		tr.AddAfterDelta(0, midi.NoteOn(0, 60, 90))
+		tr.AddAfterDelta(240, midi.NoteOff(0, 60))
+		tr.AddAfterDelta(240, midi.NoteOn(0, 64, 90))
+		tr.AddAfterDelta(0, midi.NoteOff(0, 64))
+	}
+	tracks := []*midi.Track{nil, tr}
+	// a repeated beat and a beat going back in time are ignored
+	grid := BeatGrid{BeatsPerBar: 4, Beats: []Beat{
+		{Seconds: 0, Downbeat: true}, {Seconds: 0.5}, {Seconds: 0.5}, {Seconds: 1},
+		{Seconds: 0.9}, {Seconds: 1.5}, {Seconds: 2, Downbeat: true}, {Seconds: 2},
+	}}
+	aligned := grid.Align(tracks, 480, 960)
+	if aligned[0] == nil {
+		t.Fatal("expected a conductor track to be created")
+	}
+	if tm := midi.TempoMapOf(aligned[0]); len(tm) != 1 || tm[0].BPM() != 120 {
+		t.Errorf("expected a single 120 BPM tempo, got %v", tm)
+	}
+	if m := midi.MeterMapOf(aligned[0]); len(m) != 1 || m[0].Numerator != 4 || m[0].Denum() != 4 {
+		t.Errorf("expected a 4/4 time signature, got %v", m)
+	}
+	before := noteSeconds(tracks[1:], 480)
+	after := noteSeconds(aligned, 960)
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("expected the notes at %v, got %v", before, after)
+	}
+}
+
+func TestBeatGrid_Align_fixture(t *testing.T) {
+	f, err := os.Open("../fixtures/unquantized.mid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dec := midi.NewDecoder(f)
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	ppq := dec.TicksPerQuarterNote
+	grid := BeatTracker{}.Track(dec.Tracks, ppq)
+	if len(grid.Beats) != 16 {
+		t.Fatalf("expected 16 beats, got %d", len(grid.Beats))
+	}
+	for i := 1; i < len(grid.Beats)-1; i++ {
+		if bpm := grid.BPM(i); math.Abs(bpm-120) > 1 {
+			t.Errorf("beat %d at %.1f BPM", i, bpm)
+		}
+	}
+
+	aligned := grid.Align(dec.Tracks, ppq, 960)
+	before := noteSeconds(dec.Tracks, ppq)
+	after := noteSeconds(aligned, 960)
+	for i := range after {
+		if math.Abs(after[i]-before[i]) > 0.001 {
+			t.Errorf("note %d moved from %.4fs to %.4fs", i, before[i], after[i])
+		}
+	}
+	for _, n := range pairNotes(aligned[0].Events) {
+		// the kick drum is played on the first and third beats
+		if n.on.Note == 36 && n.startTick%(2*960) != 0 {
+			t.Errorf("expected the kick drum at tick %d to be on a half note", n.startTick)
+		}
+	}
+}
+
+// noteSeconds returns the start time of the notes of the tracks.
+func noteSeconds(tracks []*midi.Track, ppq uint16) []float64 {
+	tempos := midi.TempoMapOf(tracks...)
+	out := []float64{}
+	for _, t := range tracks {
+		for _, n := range pairNotes(t.Events) {
+			out = append(out, tempos.Seconds(n.startTick, ppq))
+		}
+	}
+	return out
+}
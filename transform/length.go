@@ -0,0 +1,97 @@
+package transform
+
+import (
+	"math"
+
+	"github.com/go-audio/midi"
+)
+
+// FixedLength creates a copy of the passed events and sets the duration of
+// every event to the passed number of ticks.
+func FixedLength(events midi.AbsEvents, ticks int) midi.AbsEvents {
+	cc := events.Copy()
+	for _, ev := range cc {
+		ev.Duration = ticks
+	}
+	sortAbsEvents(cc)
+	return cc
+}
+
+// ScaleLength creates a copy of the passed events and scales their durations
+// by the passed percentage (50 halves the durations, 200 doubles them).
+// Durations are kept at a minimum of 1 tick.
+func ScaleLength(events midi.AbsEvents, percent float64) midi.AbsEvents {
+	cc := events.Copy()
+	for _, ev := range cc {
+		ev.Duration = int(math.Round(float64(ev.Duration) * percent / 100))
+		if ev.Duration < 1 {
+			ev.Duration = 1
+		}
+	}
+	sortAbsEvents(cc)
+	return cc
+}
+
+// Legato creates a copy of the passed events and changes the duration of each
+// event so it ends when the next event starts. Events starting at the same
+// time (chords) all end at the start of the following event. The events
+// starting last keep their duration.
+func Legato(events midi.AbsEvents) midi.AbsEvents {
+	cc := events.Copy()
+	sortAbsEvents(cc)
+	for i, ev := range cc {
+		for _, next := range cc[i+1:] {
+			if next.Start > ev.Start {
+				ev.Duration = next.Start - ev.Start
+				break
+			}
+		}
+	}
+	sortAbsEvents(cc)
+	return cc
+}
+
+// RemoveOverlaps creates a copy of the passed events and shortens the events
+// overlapping with a following event of the same pitch so they end when the
+// next one starts. Duplicate events (same pitch, same start) are merged
+// into the longest one.
+func RemoveOverlaps(events midi.AbsEvents) midi.AbsEvents {
+	cc := events.Copy()
+	sortAbsEvents(cc)
+	out := make(midi.AbsEvents, 0, len(cc))
+	// last kept event per pitch
+	last := map[int]*midi.AbsEv{}
+	for _, ev := range cc {
+		prev, ok := last[ev.MIDINote]
+		if ok && prev.Start == ev.Start {
+			// events are sorted by duration so the current one is longer
+			prev.Duration = ev.Duration
+			prev.Vel = ev.Vel
+			continue
+		}
+		if ok && prev.End() > ev.Start {
+			prev.Duration = ev.Start - prev.Start
+		}
+		last[ev.MIDINote] = ev
+		out = append(out, ev)
+	}
+	sortAbsEvents(out)
+	return out
+}
+
+// LimitLength creates a copy of the passed events and makes sure their
+// durations are within the passed range (in ticks). A max value of 0 means
+// that there is no maximum.
+func LimitLength(events midi.AbsEvents, min, max int) midi.AbsEvents {
+	cc := events.Copy()
+	for _, ev := range cc {
+		if ev.Duration < min {
+			ev.Duration = min
+		}
+		if max > 0 && ev.Duration > max {
+			ev.Duration = max
+		}
+	}
+	sortAbsEvents(cc)
+	return cc
+}
@@ -0,0 +1,90 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/midi"
+)
+
+func TestLengthTransforms(t *testing.T) {
+	events := midi.AbsEvents{
+		{Start: 0, Duration: 40, Vel: 80, MIDINote: 60},
+		{Start: 0, Duration: 60, Vel: 80, MIDINote: 64},
+		{Start: 96, Duration: 200, Vel: 80, MIDINote: 60},
+		{Start: 192, Duration: 10, Vel: 80, MIDINote: 60},
+	}
+	tests := []struct {
+		name string
+		fn   func(midi.AbsEvents) midi.AbsEvents
+		want midi.AbsEvents
+	}{
+		{name: "fixed length",
+			fn: func(evs midi.AbsEvents) midi.AbsEvents { return FixedLength(evs, 48) },
+			want: midi.AbsEvents{
+				{Start: 0, Duration: 48, Vel: 80, MIDINote: 60},
+				{Start: 0, Duration: 48, Vel: 80, MIDINote: 64},
+				{Start: 96, Duration: 48, Vel: 80, MIDINote: 60},
+				{Start: 192, Duration: 48, Vel: 80, MIDINote: 60},
+			},
+		},
+		{name: "scale length",
+			fn: func(evs midi.AbsEvents) midi.AbsEvents { return ScaleLength(evs, 50) },
+			want: midi.AbsEvents{
+				{Start: 0, Duration: 20, Vel: 80, MIDINote: 60},
+				{Start: 0, Duration: 30, Vel: 80, MIDINote: 64},
+				{Start: 96, Duration: 100, Vel: 80, MIDINote: 60},
+				{Start: 192, Duration: 5, Vel: 80, MIDINote: 60},
+			},
+		},
+		{name: "legato",
+			fn: Legato,
+			want: midi.AbsEvents{
+				{Start: 0, Duration: 96, Vel: 80, MIDINote: 60},
+				{Start: 0, Duration: 96, Vel: 80, MIDINote: 64},
+				{Start: 96, Duration: 96, Vel: 80, MIDINote: 60},
+				{Start: 192, Duration: 10, Vel: 80, MIDINote: 60},
+			},
+		},
+		{name: "remove overlaps",
+			fn: RemoveOverlaps,
+			want: midi.AbsEvents{
+				{Start: 0, Duration: 40, Vel: 80, MIDINote: 60},
+				{Start: 0, Duration: 60, Vel: 80, MIDINote: 64},
+				{Start: 96, Duration: 96, Vel: 80, MIDINote: 60},
+				{Start: 192, Duration: 10, Vel: 80, MIDINote: 60},
+			},
+		},
+		{name: "limit length",
+			fn: func(evs midi.AbsEvents) midi.AbsEvents { return LimitLength(evs, 24, 96) },
+			want: midi.AbsEvents{
+				{Start: 0, Duration: 40, Vel: 80, MIDINote: 60},
+				{Start: 0, Duration: 60, Vel: 80, MIDINote: 64},
+				{Start: 96, Duration: 96, Vel: 80, MIDINote: 60},
+				{Start: 192, Duration: 24, Vel: 80, MIDINote: 60},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.fn(events)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+	if events[2].Duration != 200 {
+		t.Fatal("the original events should not be modified")
+	}
+}
+
+func TestRemoveOverlaps_duplicates(t *testing.T) {
+	events := midi.AbsEvents{
+		{Start: 0, Duration: 40, Vel: 60, MIDINote: 60},
+		{Start: 0, Duration: 80, Vel: 90, MIDINote: 60},
+	}
+	want := midi.AbsEvents{{Start: 0, Duration: 80, Vel: 90, MIDINote: 60}}
+	if got := RemoveOverlaps(events); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,139 @@
+package transform
+
+import (
+	"sort"
+
+	"github.com/go-audio/midi"
+)
+
+// PedalRegion is a section of a track during which a pedal is held down.
+type PedalRegion struct {
+	Channel uint8
+	// Controller is the controller number of the pedal (64 for sustain, 66
+	// for sostenuto).
+	Controller uint8
+	// Start is the tick at which the pedal was pressed.
+	Start uint64
+	// End is the tick at which the pedal was released or the last tick of
+	// the track if it was never released.
+	End uint64
+}
+
+// PedalRegions reports the regions of the track during which the pedal using
+// the passed controller number is down (value of 64 or more). The regions are
+// sorted by start tick.
+func PedalRegions(track *midi.Track, controller int) []PedalRegion {
+	regions := []PedalRegion{}
+	if track == nil {
+		return regions
+	}
+	cc := midi.EventByteMap["ControlChange"]
+	down := map[uint8]uint64{}
+	var tick uint64
+	for _, ev := range track.Events {
+		tick += uint64(ev.TimeDelta)
+		if ev.MsgType != cc || int(ev.Controller) != controller {
+			continue
+		}
+		start, isDown := down[ev.MsgChan]
+		switch {
+		case ev.NewValue >= 64 && !isDown:
+			down[ev.MsgChan] = tick
+		case ev.NewValue < 64 && isDown:
+			regions = append(regions, PedalRegion{Channel: ev.MsgChan, Controller: uint8(controller), Start: start, End: tick})
+			delete(down, ev.MsgChan)
+		}
+	}
+	for ch, start := range down {
+		regions = append(regions, PedalRegion{Channel: ch, Controller: uint8(controller), Start: start, End: tick})
+	}
+	sort.SliceStable(regions, func(i, j int) bool {
+		if regions[i].Start != regions[j].Start {
+			return regions[i].Start < regions[j].Start
+		}
+		return regions[i].Channel < regions[j].Channel
+	})
+	return regions
+}
+
+// ApplySustain creates a copy of the passed track where the notes released
+// while the sustain pedal (CC64) is down are extended until the pedal is
+// released and the sustain pedal events are removed. If sostenuto is set, the
+// notes held when the sostenuto pedal (CC66) is pressed are also extended
+// until it's released and the sostenuto events are removed. A sustained note
+// is ended early if the same key is played again on the same channel.
+// Use Track.AbsoluteEvents on the returned track to get the notes as heard.
+func ApplySustain(track *midi.Track, sostenuto bool) *midi.Track {
+	cc := track.Copy()
+	if cc == nil {
+		return nil
+	}
+	sustainCC := midi.CCVals["Sustain"]
+	sostenutoCC := midi.CCVals["Sostenuto"]
+	sustains := PedalRegions(cc, sustainCC)
+	var sostenutos []PedalRegion
+	if sostenuto {
+		sostenutos = PedalRegions(cc, sostenutoCC)
+	}
+
+	notes := pairNotes(cc.Events)
+	// notes grouped by channel and key, sorted by start
+	byKey := map[[2]uint8][]*trackNote{}
+	for _, n := range notes {
+		id := [2]uint8{n.on.MsgChan, n.on.Note}
+		byKey[id] = append(byKey[id], n)
+	}
+	ends := map[*midi.Event]uint64{}
+	for _, n := range notes {
+		if n.off == nil {
+			continue
+		}
+		end := n.endTick
+		ch := n.on.MsgChan
+		// a note released at the very tick the pedal goes down isn't sustained
+		for _, r := range sustains {
+			if r.Channel == ch && r.Start < n.endTick && n.endTick < r.End && r.End > end {
+				end = r.End
+			}
+		}
+		// sostenuto only holds the notes which were down when it was pressed
+		for _, r := range sostenutos {
+			if r.Channel == ch && n.startTick <= r.Start && r.Start < n.endTick && n.endTick < r.End && r.End > end {
+				end = r.End
+			}
+		}
+		// re-striking the same key ends the sustained note
+		for _, next := range byKey[[2]uint8{ch, n.on.Note}] {
+			if next.startTick > n.startTick {
+				if next.startTick < end {
+					end = next.startTick
+				}
+				break
+			}
+		}
+		if end < n.endTick {
+			end = n.endTick
+		}
+		ends[n.off] = end
+	}
+
+	ticks := eventTicks(cc)
+	events := make([]*midi.Event, 0, len(cc.Events))
+	newTicks := make([]uint64, 0, len(cc.Events))
+	ccType := midi.EventByteMap["ControlChange"]
+	for i, ev := range cc.Events {
+		if ev.MsgType == ccType &&
+			(int(ev.Controller) == sustainCC || (sostenuto && int(ev.Controller) == sostenutoCC)) {
+			continue
+		}
+		tick := ticks[i]
+		if end, ok := ends[ev]; ok {
+			tick = end
+		}
+		events = append(events, ev)
+		newTicks = append(newTicks, tick)
+	}
+	cc.Events = events
+	setEventTicks(cc, newTicks)
+	return cc
+}
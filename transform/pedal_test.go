@@ -0,0 +1,84 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/midi"
+)
+
+func pedalTrack() *midi.Track {
+	track := &midi.Track{}
+	// C held with sostenuto, E with sustain, E struck again while sustained
+	track.AddAfterDelta(0, midi.NoteOn(0, 60, 80))
+	track.AddAfterDelta(10, midi.ControlChange(0, 66, 127))
+	track.AddAfterDelta(40, midi.NoteOff(0, 60))
+	track.AddAfterDelta(0, midi.ControlChange(0, 64, 127))
+	track.AddAfterDelta(0, midi.NoteOn(0, 64, 70))
+	track.AddAfterDelta(50, midi.NoteOff(0, 64))
+	track.AddAfterDelta(50, midi.NoteOn(0, 64, 60))
+	track.AddAfterDelta(20, midi.NoteOff(0, 64))
+	track.AddAfterDelta(30, midi.ControlChange(0, 64, 0))
+	track.AddAfterDelta(0, midi.NoteOn(0, 67, 50))
+	track.AddAfterDelta(50, midi.NoteOff(0, 67))
+	track.AddAfterDelta(50, midi.ControlChange(0, 66, 0))
+	return track
+}
+
+func TestPedalRegions(t *testing.T) {
+	track := pedalTrack()
+	want := []PedalRegion{{Channel: 0, Controller: 64, Start: 50, End: 200}}
+	if got := PedalRegions(track, 64); !reflect.DeepEqual(got, want) {
+		t.Errorf("PedalRegions(64) = %v, want %v", got, want)
+	}
+	want = []PedalRegion{{Channel: 0, Controller: 66, Start: 10, End: 300}}
+	if got := PedalRegions(track, 66); !reflect.DeepEqual(got, want) {
+		t.Errorf("PedalRegions(66) = %v, want %v", got, want)
+	}
+
+	// pedal never released
+	track = &midi.Track{}
+	track.AddAfterDelta(0, midi.ControlChange(1, 64, 100))
+	track.AddAfterDelta(96, midi.NoteOn(1, 60, 80))
+	want = []PedalRegion{{Channel: 1, Controller: 64, Start: 0, End: 96}}
+	if got := PedalRegions(track, 64); !reflect.DeepEqual(got, want) {
+		t.Errorf("PedalRegions() = %v, want %v", got, want)
+	}
+}
+
+func TestApplySustain(t *testing.T) {
+	tests := []struct {
+		name      string
+		sostenuto bool
+		want      midi.AbsEvents
+	}{
+		{name: "sustain only", want: midi.AbsEvents{
+			{Start: 0, Duration: 50, Vel: 80, MIDINote: 60},
+			{Start: 50, Duration: 100, Vel: 70, MIDINote: 64},
+			{Start: 150, Duration: 50, Vel: 60, MIDINote: 64},
+			{Start: 200, Duration: 50, Vel: 50, MIDINote: 67},
+		}},
+		{name: "sustain and sostenuto", sostenuto: true, want: midi.AbsEvents{
+			{Start: 0, Duration: 300, Vel: 80, MIDINote: 60},
+			{Start: 50, Duration: 100, Vel: 70, MIDINote: 64},
+			{Start: 150, Duration: 50, Vel: 60, MIDINote: 64},
+			{Start: 200, Duration: 50, Vel: 50, MIDINote: 67},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ApplySustain(pedalTrack(), tt.sostenuto)
+			if evs := got.AbsoluteEvents(); !reflect.DeepEqual(evs, tt.want) {
+				t.Errorf("ApplySustain() notes = %v, want %v", evs, tt.want)
+			}
+			for _, ev := range got.Events {
+				if ev.MsgType != midi.EventByteMap["ControlChange"] {
+					continue
+				}
+				if ev.Controller == 64 || (tt.sostenuto && ev.Controller == 66) {
+					t.Errorf("expected the pedal event %v to be removed", ev)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package transform
+
+import (
+	"sort"
+
+	"github.com/go-audio/midi"
+)
+
+// Stretch creates a copy of the passed events and multiplies their start and
+// duration by num/den. A ratio of 1/2 gives double-time, 2/1 half-time and 3/2
+// turns quarter notes into dotted quarter notes. Durations are kept at a
+// minimum of 1 tick.
+func Stretch(events midi.AbsEvents, num, den int) midi.AbsEvents {
+	cc := events.Copy()
+	if num <= 0 || den <= 0 {
+		return cc
+	}
+	for _, ev := range cc {
+		end := scaleTick(uint64(ev.End()), num, den)
+		ev.Start = int(scaleTick(uint64(ev.Start), num, den))
+		ev.Duration = int(end) - ev.Start
+		if ev.Duration < 1 {
+			ev.Duration = 1
+		}
+	}
+	sortAbsEvents(cc)
+	return cc
+}
+
+// StretchTrack creates a copy of the passed track and multiplies the position
+// of all its events (notes, controllers, meta events...) by num/den. Tempo
+// events are moved with the rest of the events, their values aren't changed
+// so the stretched track plays faster or slower. The notes keep lasting at
+// least 1 tick.
+func StretchTrack(track *midi.Track, num, den int) *midi.Track {
+	cc := track.Copy()
+	if cc == nil || num <= 0 || den <= 0 {
+		return cc
+	}
+	ticks := eventTicks(cc)
+	index := map[*midi.Event]int{}
+	for i, ev := range cc.Events {
+		index[ev] = i
+		ticks[i] = scaleTick(ticks[i], num, den)
+	}
+	for _, n := range pairNotes(cc.Events) {
+		if n.off == nil {
+			continue
+		}
+		on, off := index[n.on], index[n.off]
+		if ticks[off] <= ticks[on] {
+			ticks[off] = ticks[on] + 1
+		}
+	}
+	setEventTicks(cc, ticks)
+	return cc
+}
+
+// Shift creates a copy of the passed events and moves them by the passed
+// number of ticks. When moving events earlier, the events ending before the
+// start of the sequence are removed and the ones overlapping the start are
+// shortened.
+func Shift(events midi.AbsEvents, ticks int) midi.AbsEvents {
+	cc := events.Copy()
+	out := make(midi.AbsEvents, 0, len(cc))
+	for _, ev := range cc {
+		start := ev.Start + ticks
+		end := ev.End() + ticks
+		if end <= 0 {
+			continue
+		}
+		if start < 0 {
+			start = 0
+		}
+		ev.Start = start
+		ev.Duration = end - start
+		out = append(out, ev)
+	}
+	sortAbsEvents(out)
+	return out
+}
+
+// ShiftTrack creates a copy of the passed track and moves its events by the
+// passed number of ticks. Use ShiftTrackBars to shift by bars.
+// Non note events found at the very start of the track (track name, tempo,
+// program changes...) stay at the start. When moving events earlier, notes
+// ending before the start of the track are removed, notes overlapping the
+// start are shortened and other events are moved to the start.
+func ShiftTrack(track *midi.Track, ticks int) *midi.Track {
+	cc := track.Copy()
+	if cc == nil {
+		return nil
+	}
+	evTicks := eventTicks(cc)
+	notes := pairNotes(cc.Events)
+	drop := map[*midi.Event]bool{}
+	for _, n := range notes {
+		if int(n.endTick)+ticks <= 0 && n.off != nil {
+			drop[n.on] = true
+			drop[n.off] = true
+		}
+	}
+	events := make([]*midi.Event, 0, len(cc.Events))
+	newTicks := make([]uint64, 0, len(cc.Events))
+	for i, ev := range cc.Events {
+		if drop[ev] {
+			continue
+		}
+		tick := int(evTicks[i])
+		if tick != 0 || isNote(ev) {
+			tick += ticks
+		}
+		if tick < 0 {
+			tick = 0
+		}
+		events = append(events, ev)
+		newTicks = append(newTicks, uint64(tick))
+	}
+	cc.Events = events
+	setEventTicks(cc, newTicks)
+	return cc
+}
+
+// ShiftTrackBars creates a copy of the passed track and moves its events by
+// the passed number of bars, see ShiftTrack. The bars are measured with the
+// meter of the sequence (usually midi.MeterMapOf all its tracks): moving
+// events later inserts bars in the meter of the first bar, moving them
+// earlier removes the first bars whatever their meter.
+func ShiftTrackBars(track *midi.Track, bars int, meter midi.MeterMap, ppq uint16) *midi.Track {
+	if bars < 0 {
+		return ShiftTrack(track, -int(meter.BarTick(-bars, ppq)))
+	}
+	return ShiftTrack(track, int(meter.BarTick(1, ppq))*bars)
+}
+
+// Reverse creates a copy of the passed events and reverses the region going
+// from the start tick (included) to the end tick (excluded). Only the events
+// starting within the region are reversed, their end is limited to the end
+// of the region.
+func Reverse(events midi.AbsEvents, start, end int) midi.AbsEvents {
+	cc := events.Copy()
+	for _, ev := range cc {
+		if ev.Start < start || ev.Start >= end {
+			continue
+		}
+		evEnd := ev.End()
+		if evEnd > end {
+			evEnd = end
+		}
+		ev.Start, ev.Duration = start+end-evEnd, evEnd-ev.Start
+	}
+	sortAbsEvents(cc)
+	return cc
+}
+
+// ReverseTrack creates a copy of the passed track and reverses the region
+// going from the start tick (included) to the end tick (excluded). Notes
+// starting within the region are mirrored (their end is limited to the end of
+// the region), other channel events are mirrored around the center of the
+// region and tempo changes are rewritten so each tempo section keeps its
+// tempo once reversed. Other meta events aren't moved.
+func ReverseTrack(track *midi.Track, start, end uint64) *midi.Track {
+	cc := track.Copy()
+	if cc == nil || end <= start {
+		return cc
+	}
+	ticks := eventTicks(cc)
+	tickOf := map[*midi.Event]uint64{}
+	for i, ev := range cc.Events {
+		tickOf[ev] = ticks[i]
+	}
+
+	// notes
+	for _, n := range pairNotes(cc.Events) {
+		if n.startTick < start || n.startTick >= end || n.off == nil {
+			continue
+		}
+		noteEnd := n.endTick
+		if noteEnd > end {
+			noteEnd = end
+		}
+		tickOf[n.on] = start + end - noteEnd
+		tickOf[n.off] = start + end - n.startTick
+	}
+
+	// tempo sections
+	tempoCmd := midi.MetaByteMap["Tempo"]
+	var tempos []*midi.Event
+	var before *midi.Event
+	events := make([]*midi.Event, 0, len(cc.Events))
+	for i, ev := range cc.Events {
+		tick := ticks[i]
+		if ev.MsgType == midi.EventByteMap["Meta"] && ev.Cmd == tempoCmd {
+			if tick < start {
+				before = ev
+			} else if tick < end {
+				tempos = append(tempos, ev)
+				continue
+			}
+			events = append(events, ev)
+			continue
+		}
+		if !isNote(ev) && ev.MsgType != midi.EventByteMap["Meta"] && tick > start && tick < end {
+			tickOf[ev] = start + end - tick
+		}
+		events = append(events, ev)
+	}
+	if len(tempos) > 0 {
+		first := midi.TempoEventMicros(midi.DefaultTempo)
+		if before != nil {
+			first = before.Copy()
+		}
+		// the section before the first tempo change of the region ends the
+		// reversed region
+		sections := append([]*midi.Event{first}, tempos...)
+		bounds := []uint64{start}
+		for _, ev := range tempos {
+			bounds = append(bounds, tickOf[ev])
+		}
+		bounds = append(bounds, end)
+		for i, ev := range sections {
+			if bounds[i] == bounds[i+1] {
+				continue
+			}
+			newEv := ev.Copy()
+			tickOf[newEv] = start + end - bounds[i+1]
+			events = append(events, newEv)
+		}
+		// restore the tempo used after the region unless it's set there
+		if !hasTempoAt(cc.Events, tickOf, end) {
+			last := tempos[len(tempos)-1].Copy()
+			tickOf[last] = end
+			events = append(events, last)
+		}
+	}
+
+	cc.Events = events
+	newTicks := make([]uint64, len(events))
+	for i, ev := range events {
+		newTicks[i] = tickOf[ev]
+	}
+	setEventTicks(cc, newTicks)
+	return cc
+}
+
+// hasTempoAt reports if one of the events is a tempo event at the passed tick.
+func hasTempoAt(events []*midi.Event, tickOf map[*midi.Event]uint64, tick uint64) bool {
+	for _, ev := range events {
+		if ev.Cmd == midi.MetaByteMap["Tempo"] && ev.MsgType == midi.EventByteMap["Meta"] && tickOf[ev] == tick {
+			return true
+		}
+	}
+	return false
+}
+
+// scaleTick multiplies the tick by num/den rounding to the closest tick.
+func scaleTick(tick uint64, num, den int) uint64 {
+	return (tick*uint64(num)*2 + uint64(den)) / (uint64(den) * 2)
+}
+
+// isNote reports if the event is a note on or note off event.
+func isNote(ev *midi.Event) bool {
+	return ev.MsgType == midi.EventByteMap["NoteOn"] || ev.MsgType == midi.EventByteMap["NoteOff"]
+}
+
+// eventTicks returns the absolute position of each event of the track
+// computed from their time deltas.
+func eventTicks(track *midi.Track) []uint64 {
+	ticks := make([]uint64, len(track.Events))
+	var tick uint64
+	for i, ev := range track.Events {
+		tick += uint64(ev.TimeDelta)
+		ticks[i] = tick
+	}
+	return ticks
+}
+
+// setEventTicks moves the track events to the passed absolute positions,
+// sorts them and updates their time deltas. The end of track event is kept
+// last.
+func setEventTicks(track *midi.Track, ticks []uint64) {
+	eot := midi.MetaByteMap["End of Track"]
+	isEOT := func(ev *midi.Event) bool {
+		return ev.MsgType == midi.EventByteMap["Meta"] && ev.Cmd == eot
+	}
+	for i, ev := range track.Events {
+		ev.AbsTicks = ticks[i]
+	}
+	var last uint64
+	for _, ev := range track.Events {
+		if !isEOT(ev) && ev.AbsTicks > last {
+			last = ev.AbsTicks
+		}
+	}
+	for _, ev := range track.Events {
+		if isEOT(ev) && ev.AbsTicks < last {
+			ev.AbsTicks = last
+		}
+	}
+	sort.SliceStable(track.Events, func(i, j int) bool {
+		a, b := track.Events[i], track.Events[j]
+		if a.AbsTicks != b.AbsTicks {
+			return a.AbsTicks < b.AbsTicks
+		}
+		if isEOT(a) != isEOT(b) {
+			return isEOT(b)
+		}
+		// note offs before note ons so notes on the same key don't overlap
+		return noteOffFirst(a) && !noteOffFirst(b)
+	})
+	var prev uint64
+	for _, ev := range track.Events {
+		ev.TimeDelta = uint32(ev.AbsTicks - prev)
+		prev = ev.AbsTicks
+	}
+}
+
+// noteOffFirst reports if the event is a note off (or a note on without
+// velocity).
+func noteOffFirst(ev *midi.Event) bool {
+	return ev.MsgType == midi.EventByteMap["NoteOff"] ||
+		(ev.MsgType == midi.EventByteMap["NoteOn"] && ev.Velocity == 0)
+}
+
+// trackNote is a note on event paired with its note off.
+type trackNote struct {
+	on        *midi.Event
+	off       *midi.Event
+	startTick uint64
+	endTick   uint64
+}
+
+// pairNotes matches the note on events with their note off events. Notes
+// which never end have a nil off event and end at the last tick of the track.
+func pairNotes(events []*midi.Event) []*trackNote {
+	notes := []*trackNote{}
+	active := map[[2]uint8][]*trackNote{}
+	var tick uint64
+	for _, ev := range events {
+		tick += uint64(ev.TimeDelta)
+		if !isNote(ev) {
+			continue
+		}
+		id := [2]uint8{ev.MsgChan, ev.Note}
+		if !noteOffFirst(ev) {
+			n := &trackNote{on: ev, startTick: tick}
+			notes = append(notes, n)
+			active[id] = append(active[id], n)
+			continue
+		}
+		if held := active[id]; len(held) > 0 {
+			held[0].off = ev
+			held[0].endTick = tick
+			active[id] = held[1:]
+		}
+	}
+	for _, n := range notes {
+		if n.off == nil {
+			n.endTick = tick
+		}
+	}
+	return notes
+}
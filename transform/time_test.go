@@ -0,0 +1,238 @@
+package transform
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/midi"
+)
+
+func TestStretch(t *testing.T) {
+	events := midi.AbsEvents{
+		{Start: 0, Duration: 96, Vel: 80, MIDINote: 60},
+		{Start: 96, Duration: 48, Vel: 80, MIDINote: 62},
+		{Start: 145, Duration: 47, Vel: 80, MIDINote: 64},
+	}
+	tests := []struct {
+		name     string
+		num, den int
+		want     midi.AbsEvents
+	}{
+		{name: "double time", num: 1, den: 2, want: midi.AbsEvents{
+			{Start: 0, Duration: 48, Vel: 80, MIDINote: 60},
+			{Start: 48, Duration: 24, Vel: 80, MIDINote: 62},
+			{Start: 73, Duration: 23, Vel: 80, MIDINote: 64},
+		}},
+		{name: "half time", num: 2, den: 1, want: midi.AbsEvents{
+			{Start: 0, Duration: 192, Vel: 80, MIDINote: 60},
+			{Start: 192, Duration: 96, Vel: 80, MIDINote: 62},
+			{Start: 290, Duration: 94, Vel: 80, MIDINote: 64},
+		}},
+		{name: "3:2", num: 3, den: 2, want: midi.AbsEvents{
+			{Start: 0, Duration: 144, Vel: 80, MIDINote: 60},
+			{Start: 144, Duration: 72, Vel: 80, MIDINote: 62},
+			{Start: 218, Duration: 70, Vel: 80, MIDINote: 64},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Stretch(events, tt.num, tt.den); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Stretch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// the start and end of short notes are rounded to the same tick
+	short := midi.AbsEvents{{Start: 1, Duration: 1, Vel: 80, MIDINote: 60}}
+	want := midi.AbsEvents{{Start: 1, Duration: 1, Vel: 80, MIDINote: 60}}
+	if got := Stretch(short, 1, 2); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stretch() = %v, want %v", got, want)
+	}
+}
+
+func TestStretchTrack(t *testing.T) {
+	track := &midi.Track{}
+	track.AddAfterDelta(0, midi.TempoEvent(120))
+	track.AddAfterDelta(0, midi.NoteOn(0, 60, 90))
+	track.AddAfterDelta(96, midi.NoteOff(0, 60))
+	track.AddAfterDelta(0, midi.TempoEvent(90))
+	track.AddAfterDelta(0, midi.ControlChange(0, 64, 127))
+	track.AddAfterDelta(96, midi.EndOfTrack())
+
+	got := StretchTrack(track, 1, 2)
+	wantDeltas := []uint32{0, 0, 48, 0, 0, 48}
+	for i, ev := range got.Events {
+		if ev.TimeDelta != wantDeltas[i] {
+			t.Errorf("[%d] expected delta %d, got %d", i, wantDeltas[i], ev.TimeDelta)
+		}
+	}
+	if got.Events[3].MsPerQuartNote != track.Events[3].MsPerQuartNote {
+		t.Error("expected the tempo value not to be changed")
+	}
+	if track.Events[2].TimeDelta != 96 {
+		t.Fatal("the original track should not be modified")
+	}
+}
+
+func TestStretchTrack_shortNotes(t *testing.T) {
+	track := &midi.Track{}
+	track.AddAfterDelta(1, midi.NoteOn(0, 60, 90))
+	track.AddAfterDelta(1, midi.NoteOff(0, 60))
+	track.AddAfterDelta(0, midi.NoteOn(0, 62, 90))
+	track.AddAfterDelta(0, midi.NoteOff(0, 62))
+
+	// the notes last at least a tick so their note off doesn't come before
+	// their note on
+	got := StretchTrack(track, 1, 2)
+	want := []string{"60 1-2", "62 1-2"}
+	notes := []string{}
+	for _, n := range pairNotes(got.Events) {
+		notes = append(notes, fmt.Sprintf("%d %d-%d", n.on.Note, n.startTick, n.endTick))
+	}
+	if !reflect.DeepEqual(notes, want) {
+		t.Errorf("expected the notes %v, got %v", want, notes)
+	}
+}
+
+func TestShift(t *testing.T) {
+	events := midi.AbsEvents{
+		{Start: 0, Duration: 96, Vel: 80, MIDINote: 60},
+		{Start: 96, Duration: 96, Vel: 80, MIDINote: 62},
+	}
+	want := midi.AbsEvents{
+		{Start: 384, Duration: 96, Vel: 80, MIDINote: 60},
+		{Start: 480, Duration: 96, Vel: 80, MIDINote: 62},
+	}
+	if got := Shift(events, 384); !reflect.DeepEqual(got, want) {
+		t.Errorf("Shift() = %v, want %v", got, want)
+	}
+	want = midi.AbsEvents{
+		{Start: 0, Duration: 72, Vel: 80, MIDINote: 62},
+	}
+	if got := Shift(events, -120); !reflect.DeepEqual(got, want) {
+		t.Errorf("Shift() = %v, want %v", got, want)
+	}
+}
+
+func TestShiftTrack(t *testing.T) {
+	track := &midi.Track{}
+	track.AddAfterDelta(0, midi.TempoEvent(120))
+	track.AddAfterDelta(0, midi.NoteOn(0, 60, 90))
+	track.AddAfterDelta(96, midi.NoteOff(0, 60))
+	track.AddAfterDelta(0, midi.NoteOn(0, 62, 90))
+	track.AddAfterDelta(96, midi.NoteOff(0, 62))
+
+	bar := int((*midi.TimeSignature)(nil).TicksPerBar(96))
+	got := ShiftTrack(track, bar)
+	wantDeltas := []uint32{0, 384, 96, 0, 96}
+	for i, ev := range got.Events {
+		if ev.TimeDelta != wantDeltas[i] {
+			t.Errorf("[%d] expected delta %d, got %d", i, wantDeltas[i], ev.TimeDelta)
+		}
+	}
+
+	got = ShiftTrack(track, -96)
+	if len(got.Events) != 3 {
+		t.Fatalf("expected the first note to be dropped, got %d events", len(got.Events))
+	}
+	wantDeltas = []uint32{0, 0, 96}
+	for i, ev := range got.Events {
+		if ev.TimeDelta != wantDeltas[i] {
+			t.Errorf("[%d] expected delta %d, got %d", i, wantDeltas[i], ev.TimeDelta)
+		}
+	}
+}
+
+func TestShiftTrackBars(t *testing.T) {
+	// a 3/4 bar followed by 4/4 bars
+	track := &midi.Track{}
+	track.AddAfterDelta(0, &midi.Event{MsgType: 0xF, Cmd: 0x58, TimeSignature: &midi.TimeSignature{Numerator: 3, Denominator: 2}})
+	track.AddAfterDelta(288, &midi.Event{MsgType: 0xF, Cmd: 0x58, TimeSignature: &midi.TimeSignature{Numerator: 4, Denominator: 2}})
+	track.AddAfterDelta(0, midi.NoteOn(0, 60, 90))
+	track.AddAfterDelta(96, midi.NoteOff(0, 60))
+	track.AddAfterDelta(288, midi.NoteOn(0, 62, 90))
+	track.AddAfterDelta(96, midi.NoteOff(0, 62))
+	meter := midi.MeterMapOf(track)
+
+	tests := []struct {
+		name       string
+		bars       int
+		wantDeltas []uint32
+	}{
+		// the inserted bar is a 3/4 bar like the first one
+		{name: "later", bars: 1, wantDeltas: []uint32{0, 576, 0, 96, 288, 96}},
+		// removing the 3/4 bar moves the first note to the start
+		{name: "earlier", bars: -1, wantDeltas: []uint32{0, 0, 0, 96, 288, 96}},
+		{name: "earlier across meters", bars: -2, wantDeltas: []uint32{0, 0, 0, 96}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ShiftTrackBars(track, tt.bars, meter, 96)
+			deltas := []uint32{}
+			for _, ev := range got.Events {
+				deltas = append(deltas, ev.TimeDelta)
+			}
+			if !reflect.DeepEqual(deltas, tt.wantDeltas) {
+				t.Errorf("expected deltas %v, got %v", tt.wantDeltas, deltas)
+			}
+		})
+	}
+}
+
+func TestReverse(t *testing.T) {
+	events := midi.AbsEvents{
+		{Start: 0, Duration: 96, Vel: 80, MIDINote: 60},
+		{Start: 96, Duration: 48, Vel: 80, MIDINote: 62},
+		{Start: 144, Duration: 96, Vel: 80, MIDINote: 64},
+		{Start: 384, Duration: 96, Vel: 80, MIDINote: 65},
+	}
+	want := midi.AbsEvents{
+		{Start: 0, Duration: 48, Vel: 80, MIDINote: 64},
+		{Start: 48, Duration: 48, Vel: 80, MIDINote: 62},
+		{Start: 96, Duration: 96, Vel: 80, MIDINote: 60},
+		{Start: 384, Duration: 96, Vel: 80, MIDINote: 65},
+	}
+	if got := Reverse(events, 0, 192); !reflect.DeepEqual(got, want) {
+		t.Errorf("Reverse() = %v, want %v", got, want)
+	}
+}
+
+func TestReverseTrack(t *testing.T) {
+	track := &midi.Track{}
+	track.AddAfterDelta(0, midi.TempoEvent(120))
+	track.AddAfterDelta(0, midi.NoteOn(0, 60, 90))
+	track.AddAfterDelta(96, midi.NoteOff(0, 60))
+	track.AddAfterDelta(0, midi.TempoEvent(60))
+	track.AddAfterDelta(0, midi.NoteOn(0, 62, 70))
+	track.AddAfterDelta(48, midi.NoteOff(0, 62))
+	track.AddAfterDelta(48, midi.NoteOn(0, 64, 50))
+	track.AddAfterDelta(96, midi.NoteOff(0, 64))
+
+	got := ReverseTrack(track, 0, 192)
+	gotEvs := got.AbsoluteEvents()
+	want := midi.AbsEvents{
+		{Start: 48, Duration: 48, Vel: 70, MIDINote: 62},
+		{Start: 96, Duration: 96, Vel: 90, MIDINote: 60},
+		{Start: 192, Duration: 96, Vel: 50, MIDINote: 64},
+	}
+	if !reflect.DeepEqual(gotEvs, want) {
+		t.Errorf("ReverseTrack() notes = %v, want %v", gotEvs, want)
+	}
+
+	// tempo sections: 60 BPM from 0 to 96, 120 BPM from 96 to 192 and
+	// back to 60 BPM after the region.
+	type tempo struct {
+		tick uint64
+		ms   uint32
+	}
+	tempos := []tempo{}
+	for _, ev := range got.Events {
+		if ev.Cmd == midi.MetaByteMap["Tempo"] {
+			tempos = append(tempos, tempo{ev.AbsTicks, ev.MsPerQuartNote})
+		}
+	}
+	wantTempos := []tempo{{0, 1000000}, {96, 500000}, {192, 1000000}}
+	if !reflect.DeepEqual(tempos, wantTempos) {
+		t.Errorf("ReverseTrack() tempos = %v, want %v", tempos, wantTempos)
+	}
+}
@@ -0,0 +1,257 @@
+package transform
+
+import (
+	"sort"
+
+	"github.com/go-audio/midi"
+)
+
+// drumChannel is the zero indexed General MIDI percussion channel (channel 10).
+const drumChannel = 9
+
+var (
+	majorScale = []int{0, 2, 4, 5, 7, 9, 11}
+	minorScale = []int{0, 2, 3, 5, 7, 8, 10}
+)
+
+// Transposer moves notes by a fixed number of semitones.
+type Transposer struct {
+	// Semitones is the chromatic interval to move the notes by, negative
+	// values transpose down.
+	Semitones int
+	// Drop indicates that notes ending up outside of the 0-127 MIDI range
+	// should be removed instead of being clamped to the closest valid note.
+	Drop bool
+	// Drums indicates that the percussion channel (channel 10) should also be
+	// transposed. It is skipped by default since drum notes map to instruments
+	// and not to pitches.
+	Drums bool
+}
+
+// Transpose creates a copy of the passed events and transposes the copy as
+// per the transposer settings.
+func (t Transposer) Transpose(events midi.AbsEvents) midi.AbsEvents {
+	return mapAbsEvents(events, t.mapper(), t.Drop)
+}
+
+// TransposeTrack creates a copy of the passed track and transposes its notes.
+func (t Transposer) TransposeTrack(track *midi.Track) *midi.Track {
+	return t.TransposeTracks([]*midi.Track{track})[0]
+}
+
+// TransposeTracks creates a copy of the passed tracks (usually all the tracks
+// of a file) and transposes their notes.
+func (t Transposer) TransposeTracks(tracks []*midi.Track) []*midi.Track {
+	return mapTracks(tracks, t.mapper(), t.Drop, t.Drums)
+}
+
+func (t Transposer) mapper() noteMapper {
+	return func(note int, tick uint64) int {
+		return note + t.Semitones
+	}
+}
+
+// DiatonicTransposer moves notes by scale degrees within a key. Notes which
+// aren't part of the scale keep their chromatic distance to the scale degree
+// right below them.
+type DiatonicTransposer struct {
+	// Steps is the number of scale degrees to move the notes by, 2 moves a C
+	// to an E in C major, -1 moves it to a B.
+	Steps int
+	// Key is the number of sharps (positive value) or flats (negative value)
+	// of the key to use when no key signature is found in the tracks.
+	Key int
+	// Minor indicates that Key refers to a minor key.
+	Minor bool
+	// ForceKey indicates that Key and Minor should be used even if the tracks
+	// contain key signature events.
+	ForceKey bool
+	// Drop indicates that notes ending up outside of the 0-127 MIDI range
+	// should be removed instead of being clamped to the closest valid note.
+	Drop bool
+	// Drums indicates that the percussion channel (channel 10) should also be
+	// transposed.
+	Drums bool
+}
+
+// Transpose creates a copy of the passed events and transposes the copy in
+// the key set on the transposer.
+func (t DiatonicTransposer) Transpose(events midi.AbsEvents) midi.AbsEvents {
+	keys := midi.KeyTimeline{{KeySignature: t.keySignature()}}
+	return mapAbsEvents(events, t.mapper(keys), t.Drop)
+}
+
+// TransposeTrack creates a copy of the passed track and transposes its notes
+// using the track's key signatures.
+func (t DiatonicTransposer) TransposeTrack(track *midi.Track) *midi.Track {
+	return t.TransposeTracks([]*midi.Track{track})[0]
+}
+
+// TransposeTracks creates a copy of the passed tracks and transposes their
+// notes. The key signatures found in any of the tracks apply to all of them
+// which matches how format 1 files store their key signatures in the first
+// track.
+func (t DiatonicTransposer) TransposeTracks(tracks []*midi.Track) []*midi.Track {
+	// the passed key applies until the first key signature of the tracks
+	keys := midi.KeyTimeline{{KeySignature: t.keySignature()}}
+	if !t.ForceKey {
+		keys = append(keys, midi.KeyTimelineOf(tracks...)...)
+	}
+	return mapTracks(tracks, t.mapper(keys), t.Drop, t.Drums)
+}
+
+func (t DiatonicTransposer) keySignature() midi.KeySignature {
+	return midi.KeySignature{Key: int8(t.Key), Minor: t.Minor}
+}
+
+func (t DiatonicTransposer) mapper(keys midi.KeyTimeline) noteMapper {
+	return func(note int, tick uint64) int {
+		k := keys.At(tick)
+		scale := majorScale
+		if k.Minor {
+			scale = minorScale
+		}
+		tonic := k.Tonic()
+		// position of the note relative to the tonic of the key
+		rel := note - tonic
+		octave := floorDiv(rel, 12)
+		pc := rel - octave*12
+		// find the scale degree at or below the note
+		degree := len(scale) - 1
+		for i, step := range scale {
+			if step > pc {
+				degree = i - 1
+				break
+			}
+		}
+		offset := pc - scale[degree]
+
+		degree += t.Steps
+		octave += floorDiv(degree, len(scale))
+		degree -= floorDiv(degree, len(scale)) * len(scale)
+		return tonic + octave*12 + scale[degree] + offset
+	}
+}
+
+// noteMapper returns the new value for a note found at the passed tick.
+type noteMapper func(note int, tick uint64) int
+
+// mapAbsEvents returns a copy of the events with the notes replaced as per
+// the mapper.
+func mapAbsEvents(events midi.AbsEvents, fn noteMapper, drop bool) midi.AbsEvents {
+	cc := events.Copy()
+	out := make(midi.AbsEvents, 0, len(cc))
+	for _, ev := range cc {
+		note, ok := fitRange(fn(ev.MIDINote, uint64(ev.Start)), drop)
+		if !ok {
+			continue
+		}
+		ev.MIDINote = note
+		out = append(out, ev)
+	}
+	sortAbsEvents(out)
+	return out
+}
+
+// mapTracks returns copies of the tracks with the notes replaced as per the
+// mapper. Note off and aftertouch events follow the note on they belong to so
+// a note can't get stuck when the mapping changes while it's held.
+func mapTracks(tracks []*midi.Track, fn noteMapper, drop, drums bool) []*midi.Track {
+	noteOn := midi.EventByteMap["NoteOn"]
+	noteOff := midi.EventByteMap["NoteOff"]
+	afterTouch := midi.EventByteMap["AfterTouch"]
+
+	out := make([]*midi.Track, len(tracks))
+	for i, track := range tracks {
+		cc := track.Copy()
+		if cc == nil {
+			continue
+		}
+		// active notes per channel and original note, FIFO ordered
+		active := map[[2]uint8][]int{}
+		events := make([]*midi.Event, 0, len(cc.Events))
+		var tick uint64
+		var carry uint32
+		for _, ev := range cc.Events {
+			tick += uint64(ev.TimeDelta)
+			isNote := ev.MsgType == noteOn || ev.MsgType == noteOff || ev.MsgType == afterTouch
+			if !isNote || (ev.MsgChan == drumChannel && !drums) {
+				ev.TimeDelta += carry
+				carry = 0
+				events = append(events, ev)
+				continue
+			}
+			id := [2]uint8{ev.MsgChan, ev.Note}
+			var note int
+			switch {
+			case ev.MsgType == noteOn && ev.Velocity > 0:
+				note = fn(int(ev.Note), tick)
+				active[id] = append(active[id], note)
+			case ev.MsgType == afterTouch:
+				if held := active[id]; len(held) > 0 {
+					note = held[0]
+				} else {
+					note = fn(int(ev.Note), tick)
+				}
+			default:
+				if held := active[id]; len(held) > 0 {
+					note = held[0]
+					active[id] = held[1:]
+				} else {
+					note = fn(int(ev.Note), tick)
+				}
+			}
+			n, ok := fitRange(note, drop)
+			if !ok {
+				// the dropped event's delta is carried over to the next event
+				carry += ev.TimeDelta
+				continue
+			}
+			ev.Note = uint8(n)
+			ev.TimeDelta += carry
+			carry = 0
+			events = append(events, ev)
+		}
+		cc.Events = events
+		out[i] = cc
+	}
+	return out
+}
+
+// fitRange returns the note within the valid MIDI note range. If drop is set
+// and the note isn't within the range, false is returned.
+func fitRange(note int, drop bool) (int, bool) {
+	if note >= 0 && note <= 127 {
+		return note, true
+	}
+	if drop {
+		return 0, false
+	}
+	if note < 0 {
+		return 0, true
+	}
+	return 127, true
+}
+
+// sortAbsEvents sorts the events by start time, duration and finally note.
+func sortAbsEvents(evs midi.AbsEvents) {
+	sort.Slice(evs, func(i, j int) bool {
+		if evs[i].Start != evs[j].Start {
+			return evs[i].Start < evs[j].Start
+		}
+		if evs[i].Duration != evs[j].Duration {
+			return evs[i].Duration < evs[j].Duration
+		}
+		return evs[i].MIDINote < evs[j].MIDINote
+	})
+}
+
+// floorDiv returns the integer division of a by b rounded towards negative
+// infinity.
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
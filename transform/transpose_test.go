@@ -0,0 +1,145 @@
+package transform
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/midi"
+)
+
+func TestTransposer_Transpose(t *testing.T) {
+	events := midi.AbsEvents{
+		{Start: 0, Duration: 96, Vel: 90, MIDINote: 0},
+		{Start: 0, Duration: 96, Vel: 90, MIDINote: 60},
+		{Start: 96, Duration: 96, Vel: 90, MIDINote: 125},
+	}
+	tests := []struct {
+		name       string
+		transposer Transposer
+		want       []int
+	}{
+		{name: "up a fifth, clamped", transposer: Transposer{Semitones: 7}, want: []int{7, 67, 127}},
+		{name: "up a fifth, dropped", transposer: Transposer{Semitones: 7, Drop: true}, want: []int{7, 67}},
+		{name: "down an octave, clamped", transposer: Transposer{Semitones: -12}, want: []int{0, 48, 113}},
+		{name: "down an octave, dropped", transposer: Transposer{Semitones: -12, Drop: true}, want: []int{48, 113}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.transposer.Transpose(events)
+			if notes := absNotes(got); !reflect.DeepEqual(notes, tt.want) {
+				t.Errorf("Transpose() notes = %v, want %v", notes, tt.want)
+			}
+		})
+	}
+	if events[1].MIDINote != 60 {
+		t.Fatal("the original events should not be modified")
+	}
+}
+
+func TestTransposer_TransposeTrack(t *testing.T) {
+	track := &midi.Track{}
+	track.AddAfterDelta(0, midi.NoteOn(0, 60, 90))
+	track.AddAfterDelta(0, midi.NoteOn(9, 36, 90))
+	track.AddAfterDelta(96, midi.NoteOff(0, 60))
+	track.AddAfterDelta(0, midi.NoteOff(9, 36))
+	track.AddAfterDelta(0, midi.NoteOn(0, 122, 90))
+	track.AddAfterDelta(48, midi.NoteOff(0, 122))
+	track.AddAfterDelta(48, midi.NoteOn(0, 64, 90))
+	track.AddAfterDelta(96, midi.NoteOff(0, 64))
+
+	got := Transposer{Semitones: 7, Drop: true}.TransposeTrack(track)
+	want := []struct {
+		ch, note uint8
+		delta    uint32
+	}{
+		{0, 67, 0},
+		{9, 36, 0},
+		{0, 67, 96},
+		{9, 36, 0},
+		{0, 71, 96},
+		{0, 71, 96},
+	}
+	if len(got.Events) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(got.Events))
+	}
+	for i, ev := range got.Events {
+		if ev.MsgChan != want[i].ch || ev.Note != want[i].note || ev.TimeDelta != want[i].delta {
+			t.Errorf("[%d] expected ch %d note %d delta %d, got ch %d note %d delta %d",
+				i, want[i].ch, want[i].note, want[i].delta, ev.MsgChan, ev.Note, ev.TimeDelta)
+		}
+	}
+	if track.Events[0].Note != 60 {
+		t.Fatal("the original track should not be modified")
+	}
+}
+
+func TestDiatonicTransposer_Transpose(t *testing.T) {
+	// C major scale from C3 to C4
+	cMajor := []int{60, 62, 64, 65, 67, 69, 71, 72}
+	events := midi.AbsEvents{}
+	for i, n := range cMajor {
+		events = append(events, &midi.AbsEv{Start: i * 96, Duration: 96, Vel: 80, MIDINote: n})
+	}
+	tests := []struct {
+		name       string
+		transposer DiatonicTransposer
+		want       []int
+	}{
+		{name: "third up in C", transposer: DiatonicTransposer{Steps: 2}, want: []int{64, 65, 67, 69, 71, 72, 74, 76}},
+		{name: "second down in C", transposer: DiatonicTransposer{Steps: -1}, want: []int{59, 60, 62, 64, 65, 67, 69, 71}},
+		{name: "octave up in C", transposer: DiatonicTransposer{Steps: 7}, want: []int{72, 74, 76, 77, 79, 81, 83, 84}},
+		// Eb major: Eb F G Ab Bb C D, E and B are chromatic notes
+		{name: "second up in Eb", transposer: DiatonicTransposer{Steps: 1, Key: -3}, want: []int{62, 63, 66, 67, 68, 71, 73, 74}},
+		// A minor shares the C major scale
+		{name: "third up in A minor", transposer: DiatonicTransposer{Steps: 2, Minor: true}, want: []int{64, 65, 67, 69, 71, 72, 74, 76}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.transposer.Transpose(events)
+			if notes := absNotes(got); !reflect.DeepEqual(notes, tt.want) {
+				t.Errorf("Transpose() notes = %v, want %v", notes, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiatonicTransposer_TransposeTracks(t *testing.T) {
+	r, err := os.Open("../fixtures/c-maj-scale.mid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	dec := midi.NewDecoder(r)
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the fixture is in C major, switch its key signature to G major
+	track := dec.Tracks[0].Copy()
+	for _, ev := range track.Events {
+		if ev.Cmd == midi.MetaByteMap["Key Signature"] {
+			ev.Key = 1
+		}
+	}
+	tracks := DiatonicTransposer{Steps: 2}.TransposeTracks([]*midi.Track{track})
+	// in G major, F is a chromatic note a half step above E
+	want := []int{52, 54, 55, 56, 59, 60, 62, 64}
+	if notes := absNotes(tracks[0].AbsoluteEvents()); !reflect.DeepEqual(notes, want) {
+		t.Errorf("TransposeTracks() notes = %v, want %v", notes, want)
+	}
+
+	tracks = DiatonicTransposer{Steps: 2, ForceKey: true}.TransposeTracks([]*midi.Track{track})
+	want = []int{52, 53, 55, 57, 59, 60, 62, 64}
+	if notes := absNotes(tracks[0].AbsoluteEvents()); !reflect.DeepEqual(notes, want) {
+		t.Errorf("TransposeTracks() with forced key notes = %v, want %v", notes, want)
+	}
+}
+
+func absNotes(evs midi.AbsEvents) []int {
+	notes := []int{}
+	for _, ev := range evs {
+		notes = append(notes, ev.MIDINote)
+	}
+	return notes
+}
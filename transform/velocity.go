@@ -0,0 +1,165 @@
+package transform
+
+import (
+	"math"
+
+	"github.com/go-audio/midi"
+)
+
+// VelocityMapper converts the velocity of a note starting at the passed tick.
+type VelocityMapper interface {
+	MapVelocity(vel int, tick uint64) int
+}
+
+// Velocity creates a copy of the passed events and applies the velocity
+// mappers to the copy in order. The resulting velocities are kept within the
+// 1-127 range so notes can't be turned into note offs.
+func Velocity(events midi.AbsEvents, mappers ...VelocityMapper) midi.AbsEvents {
+	cc := events.Copy()
+	for _, ev := range cc {
+		ev.Vel = mapVelocity(ev.Vel, uint64(ev.Start), mappers)
+	}
+	return cc
+}
+
+// VelocityTrack creates a copy of the passed track and applies the velocity
+// mappers to all its note on events.
+func VelocityTrack(track *midi.Track, mappers ...VelocityMapper) *midi.Track {
+	cc := track.Copy()
+	if cc == nil {
+		return nil
+	}
+	noteOn := midi.EventByteMap["NoteOn"]
+	var tick uint64
+	for _, ev := range cc.Events {
+		tick += uint64(ev.TimeDelta)
+		if ev.MsgType != noteOn || ev.Velocity == 0 {
+			continue
+		}
+		ev.Velocity = uint8(mapVelocity(int(ev.Velocity), tick, mappers))
+	}
+	return cc
+}
+
+func mapVelocity(vel int, tick uint64, mappers []VelocityMapper) int {
+	for _, m := range mappers {
+		vel = m.MapVelocity(vel, tick)
+	}
+	if vel < 1 {
+		return 1
+	}
+	if vel > 127 {
+		return 127
+	}
+	return vel
+}
+
+// VelocityScale multiplies velocities by a factor, 1.0 leaves them unchanged.
+type VelocityScale struct {
+	Factor float64
+}
+
+// MapVelocity implements the VelocityMapper interface.
+func (s VelocityScale) MapVelocity(vel int, tick uint64) int {
+	return int(math.Round(float64(vel) * s.Factor))
+}
+
+// VelocityOffset adds a fixed value (positive or negative) to velocities.
+type VelocityOffset struct {
+	Offset int
+}
+
+// MapVelocity implements the VelocityMapper interface.
+func (o VelocityOffset) MapVelocity(vel int, tick uint64) int {
+	return vel + o.Offset
+}
+
+// VelocityCompressor reduces or increases the distance between velocities and
+// a threshold. A ratio of 2.0 halves the distance to the threshold
+// (compression) while a ratio of 0.5 doubles it (expansion).
+type VelocityCompressor struct {
+	// Threshold is the velocity the other velocities are moved towards or
+	// away from.
+	Threshold int
+	// Ratio is the compression ratio, values under 1.0 expand the dynamic.
+	Ratio float64
+	// AboveOnly indicates that only the velocities above the threshold
+	// should be modified, like an audio compressor would do.
+	AboveOnly bool
+}
+
+// MapVelocity implements the VelocityMapper interface.
+func (c VelocityCompressor) MapVelocity(vel int, tick uint64) int {
+	if c.Ratio <= 0 || (c.AboveOnly && vel <= c.Threshold) {
+		return vel
+	}
+	dist := float64(vel-c.Threshold) / c.Ratio
+	return c.Threshold + int(math.Round(dist))
+}
+
+// VelocityCurve maps velocities through a lookup table or, if the table isn't
+// set, through an exponential curve.
+type VelocityCurve struct {
+	// Table is a 128 entry lookup table indexed by the incoming velocity.
+	Table []int
+	// Exponent is the exponent of the curve used when the table isn't set.
+	// Values above 1.0 soften the response, values under 1.0 harden it.
+	Exponent float64
+}
+
+// MapVelocity implements the VelocityMapper interface.
+func (c VelocityCurve) MapVelocity(vel int, tick uint64) int {
+	if len(c.Table) == 128 && vel >= 0 && vel <= 127 {
+		return c.Table[vel]
+	}
+	if c.Exponent <= 0 {
+		return vel
+	}
+	return int(math.Round(127 * math.Pow(float64(vel)/127, c.Exponent)))
+}
+
+// VelocityLimit keeps velocities within a range.
+type VelocityLimit struct {
+	Min int
+	Max int
+}
+
+// MapVelocity implements the VelocityMapper interface.
+func (l VelocityLimit) MapVelocity(vel int, tick uint64) int {
+	if vel < l.Min {
+		return l.Min
+	}
+	if l.Max > 0 && vel > l.Max {
+		return l.Max
+	}
+	return vel
+}
+
+// VelocityFade linearly scales velocities between the start and end ticks
+// going from the From factor to the To factor. A fade in would use 0.0 to 1.0
+// and a fade out 1.0 to 0.0. Notes before the start are left untouched while
+// the notes after the end keep the To factor.
+type VelocityFade struct {
+	Start uint64
+	End   uint64
+	From  float64
+	To    float64
+}
+
+// MapVelocity implements the VelocityMapper interface.
+func (f VelocityFade) MapVelocity(vel int, tick uint64) int {
+	if tick < f.Start {
+		return vel
+	}
+	var factor float64
+	switch {
+	case tick > f.End:
+		factor = f.To
+	case f.End > f.Start:
+		pos := float64(tick-f.Start) / float64(f.End-f.Start)
+		factor = f.From + (f.To-f.From)*pos
+	default:
+		factor = f.From
+	}
+	return int(math.Round(float64(vel) * factor))
+}
@@ -0,0 +1,74 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/midi"
+)
+
+func TestVelocity(t *testing.T) {
+	events := midi.AbsEvents{
+		{Start: 0, Duration: 96, Vel: 20, MIDINote: 60},
+		{Start: 96, Duration: 96, Vel: 64, MIDINote: 62},
+		{Start: 192, Duration: 96, Vel: 100, MIDINote: 64},
+		{Start: 288, Duration: 96, Vel: 127, MIDINote: 65},
+	}
+	linear := make([]int, 128)
+	for i := range linear {
+		linear[i] = 127 - i
+	}
+	tests := []struct {
+		name    string
+		mappers []VelocityMapper
+		want    []int
+	}{
+		{name: "no mappers", want: []int{20, 64, 100, 127}},
+		{name: "scale", mappers: []VelocityMapper{VelocityScale{Factor: 0.5}}, want: []int{10, 32, 50, 64}},
+		{name: "scale clamped", mappers: []VelocityMapper{VelocityScale{Factor: 2}}, want: []int{40, 127, 127, 127}},
+		{name: "offset", mappers: []VelocityMapper{VelocityOffset{Offset: -30}}, want: []int{1, 34, 70, 97}},
+		{name: "compress", mappers: []VelocityMapper{VelocityCompressor{Threshold: 64, Ratio: 2}}, want: []int{42, 64, 82, 96}},
+		{name: "compress above", mappers: []VelocityMapper{VelocityCompressor{Threshold: 64, Ratio: 2, AboveOnly: true}}, want: []int{20, 64, 82, 96}},
+		{name: "expand", mappers: []VelocityMapper{VelocityCompressor{Threshold: 64, Ratio: 0.5}}, want: []int{1, 64, 127, 127}},
+		{name: "table", mappers: []VelocityMapper{VelocityCurve{Table: linear}}, want: []int{107, 63, 27, 1}},
+		{name: "exponent", mappers: []VelocityMapper{VelocityCurve{Exponent: 2}}, want: []int{3, 32, 79, 127}},
+		{name: "limit", mappers: []VelocityMapper{VelocityLimit{Min: 40, Max: 110}}, want: []int{40, 64, 100, 110}},
+		{name: "fade in", mappers: []VelocityMapper{VelocityFade{Start: 0, End: 192, From: 0, To: 1}}, want: []int{1, 32, 100, 127}},
+		{name: "fade out", mappers: []VelocityMapper{VelocityFade{Start: 0, End: 192, From: 1, To: 0.5}}, want: []int{20, 48, 50, 64}},
+		{name: "chained", mappers: []VelocityMapper{VelocityOffset{Offset: 10}, VelocityLimit{Max: 100}}, want: []int{30, 74, 100, 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Velocity(events, tt.mappers...)
+			vels := []int{}
+			for _, ev := range got {
+				vels = append(vels, ev.Vel)
+			}
+			if !reflect.DeepEqual(vels, tt.want) {
+				t.Errorf("Velocity() = %v, want %v", vels, tt.want)
+			}
+		})
+	}
+	if events[0].Vel != 20 {
+		t.Fatal("the original events should not be modified")
+	}
+}
+
+func TestVelocityTrack(t *testing.T) {
+	track := &midi.Track{}
+	track.AddAfterDelta(0, midi.NoteOn(0, 60, 100))
+	track.AddAfterDelta(96, midi.NoteOn(0, 60, 0))
+	track.AddAfterDelta(0, midi.NoteOn(0, 62, 80))
+	track.AddAfterDelta(96, midi.NoteOff(0, 62))
+
+	got := VelocityTrack(track, VelocityFade{Start: 0, End: 96, From: 1, To: 0.5})
+	want := []uint8{100, 0, 40, 64}
+	for i, ev := range got.Events {
+		if ev.Velocity != want[i] {
+			t.Errorf("[%d] expected velocity %d, got %d", i, want[i], ev.Velocity)
+		}
+	}
+	if track.Events[2].Velocity != 80 {
+		t.Fatal("the original track should not be modified")
+	}
+}
@@ -0,0 +1,257 @@
+package midi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ErrNotMTS is returned when a sysex message isn't a supported MIDI Tuning
+// Standard message.
+var ErrNotMTS = errors.New("not a MIDI Tuning Standard message")
+
+// Tuning maps the 128 midi notes to frequencies. The zero value has no mapped
+// note, use EqualTemperament or DefaultTuning to start from the standard
+// tuning.
+type Tuning struct {
+	// Name is the name of the tuning, it's limited to 16 ASCII characters
+	// in MIDI Tuning Standard bulk dumps.
+	Name string
+	// Freqs holds the frequency in Hz of each midi note, 0 for the notes
+	// which aren't mapped.
+	Freqs [128]float64
+}
+
+// EqualTemperament returns the 12 tone equal temperament tuning where the A4
+// (midi note 69) has the passed frequency (440Hz, 435Hz, 415Hz...).
+func EqualTemperament(refA float64) *Tuning {
+	t := &Tuning{Name: fmt.Sprintf("12-TET A=%gHz", refA)}
+	for i := range t.Freqs {
+		t.Freqs[i] = refA * math.Pow(2, (float64(i)-69)/12)
+	}
+	return t
+}
+
+// DefaultTuning returns the 12 tone equal temperament tuning used by
+// NoteToFreq.
+func DefaultTuning() *Tuning {
+	return EqualTemperament(rootA)
+}
+
+// Freq returns the frequency of the midi note or 0 if the note isn't mapped.
+func (t *Tuning) Freq(note int) float64 {
+	if t == nil || note < 0 || note > 127 {
+		return 0
+	}
+	return t.Freqs[note]
+}
+
+// BentFreq returns the frequency of the midi note bent by the passed number
+// of semitones. Bends are applied in 12-TET semitones, as synths do, and
+// don't follow the tuning.
+func (t *Tuning) BentFreq(note int, semitones float64) float64 {
+	return t.Freq(note) * math.Pow(2, semitones/12)
+}
+
+// Note returns the mapped midi note with the closest frequency to the passed
+// frequency and the distance in cents from that note to the frequency. -1 is
+// returned if no note is mapped.
+func (t *Tuning) Note(freq float64) (int, float64) {
+	note, cents := -1, 0.0
+	if t == nil || freq <= 0 {
+		return note, cents
+	}
+	for i, f := range t.Freqs {
+		if f <= 0 {
+			continue
+		}
+		c := 1200 * math.Log2(freq/f)
+		if note == -1 || math.Abs(c) < math.Abs(cents) {
+			note, cents = i, c
+		}
+	}
+	return note, cents
+}
+
+// mtsNoChange is the MTS frequency data marking a note which shouldn't be
+// retuned.
+var mtsNoChange = [3]byte{0x7F, 0x7F, 0x7F}
+
+// mtsFreq encodes a frequency in the MTS format: a semitone (the 12-TET midi
+// note at or below the frequency using A4 = 440Hz) and a 14 bit fraction of
+// a semitone (units of 100/16384 cents).
+func mtsFreq(freq float64) [3]byte {
+	if freq <= 0 {
+		return mtsNoChange
+	}
+	semis := 69 + 12*math.Log2(freq/440)
+	if semis <= 0 {
+		return [3]byte{}
+	}
+	note := math.Floor(semis)
+	frac := int(math.Round((semis - note) * 16384))
+	if frac == 16384 {
+		note, frac = note+1, 0
+	}
+	if note > 127 {
+		note, frac = 127, 0x3FFE
+	}
+	// 7F 7F 7F is reserved
+	if note == 127 && frac == 0x3FFF {
+		frac = 0x3FFE
+	}
+	return [3]byte{byte(note), byte(frac >> 7), byte(frac & 0x7F)}
+}
+
+// mtsDecodeFreq decodes a MTS frequency, false is returned for the no
+// change value.
+func mtsDecodeFreq(data []byte) (float64, bool) {
+	if data[0] == 0x7F && data[1] == 0x7F && data[2] == 0x7F {
+		return 0, false
+	}
+	semis := float64(data[0]&0x7F) + float64(uint16(data[1]&0x7F)<<7|uint16(data[2]&0x7F))/16384
+	return 440 * math.Pow(2, (semis-69)/12), true
+}
+
+// BulkDump returns the MIDI Tuning Standard bulk tuning dump (non real time,
+// sub ID 08 01) of the tuning for the passed tuning program. Use 0x7F as
+// device ID to address all devices. Notes which aren't mapped are sent with
+// the "no change" value.
+func (t *Tuning) BulkDump(device, program uint8) []byte {
+	msg := []byte{0xF0, 0x7E, device & 0x7F, 0x08, 0x01, program & 0x7F}
+	name := make([]byte, 16)
+	for i := range name {
+		name[i] = ' '
+	}
+	for i, c := range []byte(t.Name) {
+		if i >= len(name) {
+			break
+		}
+		if c < 0x20 || c > 0x7E {
+			c = '?'
+		}
+		name[i] = c
+	}
+	msg = append(msg, name...)
+	for _, f := range t.Freqs {
+		data := mtsFreq(f)
+		msg = append(msg, data[:]...)
+	}
+	// the checksum is the XOR of the bytes following F0
+	var sum byte
+	for _, b := range msg[1:] {
+		sum ^= b
+	}
+	return append(msg, sum&0x7F, 0xF7)
+}
+
+// NoteChange returns the MIDI Tuning Standard real time single note tuning
+// change (sub ID 08 02) retuning the passed notes, or all the mapped notes if
+// none is passed, of the tuning program. Use 0x7F as device ID to address all
+// devices.
+func (t *Tuning) NoteChange(device, program uint8, notes ...int) []byte {
+	if len(notes) == 0 {
+		for i, f := range t.Freqs {
+			if f > 0 {
+				notes = append(notes, i)
+			}
+		}
+	}
+	if len(notes) > 127 {
+		notes = notes[:127]
+	}
+	msg := []byte{0xF0, 0x7F, device & 0x7F, 0x08, 0x02, program & 0x7F, byte(len(notes))}
+	for _, n := range notes {
+		data := mtsFreq(t.Freq(n))
+		msg = append(msg, byte(n&0x7F), data[0], data[1], data[2])
+	}
+	return append(msg, 0xF7)
+}
+
+// ApplySysEx updates the tuning with a MIDI Tuning Standard message: a bulk
+// tuning dump (08 01), a real time single note tuning change (08 02) or a non
+// real time single note tuning change with bank (08 07). The tuning program
+// and bank of the message are ignored. The message can start with F0 or
+// directly with the universal sysex ID, ErrNotMTS is returned for other
+// messages.
+func (t *Tuning) ApplySysEx(msg []byte) error {
+	if len(msg) > 0 && msg[0] == 0xF0 {
+		msg = msg[1:]
+	}
+	if len(msg) > 0 && msg[len(msg)-1] == 0xF7 {
+		msg = msg[:len(msg)-1]
+	}
+	if len(msg) < 5 || (msg[0] != 0x7E && msg[0] != 0x7F) || msg[2] != 0x08 {
+		return ErrNotMTS
+	}
+	var changes []byte
+	switch {
+	case msg[0] == 0x7E && msg[3] == 0x01:
+		// 7E dev 08 01 prog name[16] 128*(xx yy zz) checksum
+		if len(msg) != 5+16+128*3+1 {
+			return fmt.Errorf("MTS bulk dump - %s (%d bytes)", ErrUnexpectedData, len(msg))
+		}
+		var sum byte
+		for _, b := range msg[:len(msg)-1] {
+			sum ^= b
+		}
+		if sum&0x7F != msg[len(msg)-1] {
+			return fmt.Errorf("MTS bulk dump - invalid checksum %#X, expected %#X", msg[len(msg)-1], sum&0x7F)
+		}
+		t.Name = strings.TrimRight(string(msg[5:21]), " \x00")
+		data := msg[21 : len(msg)-1]
+		for i := range t.Freqs {
+			if f, ok := mtsDecodeFreq(data[i*3 : i*3+3]); ok {
+				t.Freqs[i] = f
+			}
+		}
+		return nil
+	case msg[0] == 0x7F && msg[3] == 0x02:
+		// 7F dev 08 02 prog count [key xx yy zz]...
+		changes = msg[5:]
+	case msg[0] == 0x7E && msg[3] == 0x07 && len(msg) >= 6:
+		// 7E dev 08 07 bank prog count [key xx yy zz]...
+		changes = msg[6:]
+	default:
+		return ErrNotMTS
+	}
+	if len(changes) < 1 || len(changes[1:]) != int(changes[0])*4 {
+		return fmt.Errorf("MTS single note tuning change - %s", ErrUnexpectedData)
+	}
+	for data := changes[1:]; len(data) >= 4; data = data[4:] {
+		if f, ok := mtsDecodeFreq(data[1:4]); ok {
+			t.Freqs[data[0]&0x7F] = f
+		}
+	}
+	return nil
+}
+
+// BulkDumpEvent returns a sysex event with the bulk tuning dump of the tuning
+// so it can be added to a track.
+func (t *Tuning) BulkDumpEvent(device, program uint8) *Event {
+	return SysExEvent(t.BulkDump(device, program))
+}
+
+// NoteChangeEvent returns a sysex event with the single note tuning change of
+// the passed notes (all mapped notes if none) so it can be added to a track.
+func (t *Tuning) NoteChangeEvent(device, program uint8, notes ...int) *Event {
+	return SysExEvent(t.NoteChange(device, program, notes...))
+}
+
+// ApplyTrack updates the tuning with the MIDI Tuning Standard messages found
+// in the sysex events of the track, in order. Other sysex events are ignored.
+func (t *Tuning) ApplyTrack(track *Track) error {
+	if track == nil {
+		return nil
+	}
+	for _, ev := range track.Events {
+		if !ev.IsSysEx() || ev.MsgChan != 0x0 {
+			continue
+		}
+		if err := t.ApplySysEx(ev.SysEx); err != nil && err != ErrNotMTS {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package midi
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/mattetti/filebuffer"
+)
+
+func TestEqualTemperament(t *testing.T) {
+	tests := []struct {
+		refA float64
+		note int
+		want float64
+	}{
+		{440, 69, 440},
+		{440, 81, 880},
+		{440, 60, 261.6256},
+		{415, 69, 415},
+		{415, 57, 207.5},
+	}
+	for _, tt := range tests {
+		got := EqualTemperament(tt.refA).Freq(tt.note)
+		if math.Abs(got-tt.want) > 0.0001 {
+			t.Errorf("A=%g, note %d: expected %f, got %f", tt.refA, tt.note, tt.want, got)
+		}
+	}
+	tuning := DefaultTuning()
+	if note, cents := tuning.Note(445); note != 69 || math.Abs(cents-19.56) > 0.01 {
+		t.Errorf("Note(445) = %d, %f", note, cents)
+	}
+	if got := tuning.BentFreq(69, 12); math.Abs(got-880) > 0.0001 {
+		t.Errorf("BentFreq(69, 12) = %f", got)
+	}
+	if got := tuning.Freq(128); got != 0 {
+		t.Errorf("expected out of range notes to be unmapped, got %f", got)
+	}
+}
+
+func TestTuning_BulkDump(t *testing.T) {
+	tuning := EqualTemperament(432)
+	tuning.Name = "Verdi tuning"
+	tuning.Freqs[0] = 0
+	msg := tuning.BulkDump(0x7F, 3)
+	if len(msg) != 408 {
+		t.Fatalf("expected a 408 byte message, got %d", len(msg))
+	}
+	if want := []byte{0xF0, 0x7E, 0x7F, 0x08, 0x01, 0x03, 'V'}; !reflect.DeepEqual(msg[:7], want) {
+		t.Errorf("unexpected header % X", msg[:7])
+	}
+	if !reflect.DeepEqual(msg[22:25], []byte{0x7F, 0x7F, 0x7F}) {
+		t.Errorf("expected the unmapped note to be sent as no change, got % X", msg[22:25])
+	}
+
+	got := DefaultTuning()
+	if err := got.ApplySysEx(msg); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Verdi tuning" {
+		t.Errorf("unexpected name %q", got.Name)
+	}
+	if got.Freqs[0] != DefaultTuning().Freqs[0] {
+		t.Errorf("expected the unmapped note to keep its frequency, got %f", got.Freqs[0])
+	}
+	for n := 1; n < 128; n++ {
+		// MTS has a resolution of 0.0061 cents
+		if cents := 1200 * math.Log2(got.Freqs[n]/tuning.Freqs[n]); math.Abs(cents) > 0.01 {
+			t.Fatalf("note %d off by %f cents", n, cents)
+		}
+	}
+
+	msg[len(msg)-2] ^= 0x01
+	if err := got.ApplySysEx(msg); err == nil {
+		t.Errorf("expected a checksum error")
+	}
+}
+
+func TestTuning_NoteChange(t *testing.T) {
+	tuning := DefaultTuning()
+	// quarter tone up
+	tuning.Freqs[60] = NoteToFreq(60) * math.Pow(2, 0.5/12)
+	msg := tuning.NoteChange(0, 1, 60)
+	want := []byte{0xF0, 0x7F, 0x00, 0x08, 0x02, 0x01, 0x01, 60, 60, 0x40, 0x00, 0xF7}
+	if !reflect.DeepEqual(msg, want) {
+		t.Fatalf("NoteChange() = % X, want % X", msg, want)
+	}
+
+	got := DefaultTuning()
+	if err := got.ApplySysEx(msg); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(got.Freqs[60]-tuning.Freqs[60]) > 0.0001 || got.Freqs[61] != tuning.Freqs[61] {
+		t.Errorf("unexpected frequencies %f and %f", got.Freqs[60], got.Freqs[61])
+	}
+
+	// non real time version with a bank
+	msg = []byte{0xF0, 0x7E, 0x00, 0x08, 0x07, 0x00, 0x01, 0x01, 69, 69, 0x00, 0x00, 0xF7}
+	got.Freqs[69] = 0
+	if err := got.ApplySysEx(msg); err != nil || math.Abs(got.Freqs[69]-440) > 0.0001 {
+		t.Errorf("ApplySysEx() = %v, frequency %f", err, got.Freqs[69])
+	}
+	if err := got.ApplySysEx([]byte{0xF0, 0x43, 0x10, 0x4C, 0xF7}); err != ErrNotMTS {
+		t.Errorf("expected ErrNotMTS for a Yamaha message, got %v", err)
+	}
+}
+
+func TestTuning_SysExRoundTrip(t *testing.T) {
+	tuning := DefaultTuning()
+	tuning.Freqs[64] = NoteToFreq(64) * math.Pow(2, -0.14/12)
+
+	w := filebuffer.New(nil)
+	e := NewEncoder(w, SingleTrack, 96)
+	tr := e.NewTrack()
+	tr.Add(0, SysExEvent([]byte{0x43, 0x10, 0x4C, 0x00, 0x00, 0x7E, 0x00}))
+	tr.Add(0, tuning.NoteChangeEvent(0x7F, 0, 64))
+	tr.Add(0, NoteOn(0, 64, 100))
+	tr.Add(1, NoteOff(0, 64))
+	if err := e.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	dec := NewDecoder(w)
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	sysex := []*Event{}
+	for _, ev := range dec.Tracks[0].Events {
+		if ev.IsSysEx() {
+			sysex = append(sysex, ev)
+		}
+	}
+	if len(sysex) != 2 {
+		t.Fatalf("expected 2 sysex events, got %d", len(sysex))
+	}
+	if want := []byte{0xF0, 0x43, 0x10, 0x4C, 0x00, 0x00, 0x7E, 0x00, 0xF7}; !reflect.DeepEqual(sysex[0].SysExMessage(), want) {
+		t.Errorf("SysExMessage() = % X, want % X", sysex[0].SysExMessage(), want)
+	}
+	if notes := dec.Tracks[0].AbsoluteEvents(); len(notes) != 1 || notes[0].MIDINote != 64 {
+		t.Errorf("expected the note following the sysex events to be decoded, got %v", notes)
+	}
+
+	got := DefaultTuning()
+	if err := got.ApplyTrack(dec.Tracks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(got.Freqs[64]-tuning.Freqs[64]) > 0.001 {
+		t.Errorf("expected E4 at %f, got %f", tuning.Freqs[64], got.Freqs[64])
+	}
+}